@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/artwork"
+	"opentify/internal/library"
+)
+
+const (
+	albumThumbSize = 160
+	// Concurrent thumbnail decodes; keeps scrolling smooth on large libraries.
+	albumThumbWorkers = 4
+)
+
+// newAlbumGrid builds the "Albümler" page: a virtualised grid of album
+// covers that opens a detail view with the tracklist. Only cells that are
+// on screen request their thumbnail. The returned func reloads the albums.
+func newAlbumGrid(lib *library.Index, art *artwork.Cache, play func(paths []string, start int, shuffle bool)) (fyne.CanvasObject, func()) {
+	var albums []library.Album
+
+	// bound tracks which album each grid cell currently shows, so a slow
+	// thumbnail load does not land on a recycled cell.
+	var boundMu sync.Mutex
+	bound := map[*canvas.Image]string{}
+	sem := make(chan struct{}, albumThumbWorkers)
+
+	setCover := func(img *canvas.Image, key string, paths []string) {
+		boundMu.Lock()
+		bound[img] = key
+		boundMu.Unlock()
+		if th, ok := art.Cached(key); ok {
+			img.Resource = nil
+			img.Image = th
+			img.Refresh()
+			return
+		}
+		img.Image = nil
+		img.Resource = theme.MediaMusicIcon()
+		img.Refresh()
+		if len(paths) > 3 {
+			paths = paths[:3]
+		}
+		go func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			boundMu.Lock()
+			stale := bound[img] != key
+			boundMu.Unlock()
+			if stale {
+				return // scrolled away before we got a worker
+			}
+			th, err := art.Thumbnail(key, paths)
+			if err != nil {
+				return
+			}
+			fyne.Do(func() {
+				boundMu.Lock()
+				stale := bound[img] != key
+				boundMu.Unlock()
+				if stale {
+					return
+				}
+				img.Resource = nil
+				img.Image = th
+				img.Refresh()
+			})
+		}()
+	}
+
+	var showDetail func(a library.Album)
+	grid := widget.NewGridWrap(
+		func() int { return len(albums) },
+		func() fyne.CanvasObject {
+			img := canvas.NewImageFromResource(theme.MediaMusicIcon())
+			img.FillMode = canvas.ImageFillContain
+			img.SetMinSize(fyne.NewSize(albumThumbSize, albumThumbSize))
+			title := widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+			title.Wrapping = fyne.TextTruncate
+			artist := widget.NewLabelWithStyle("", fyne.TextAlignCenter, fyne.TextStyle{})
+			artist.Wrapping = fyne.TextTruncate
+			return container.NewBorder(nil, container.NewVBox(title, artist), nil, nil, img)
+		},
+		func(i widget.GridWrapItemID, o fyne.CanvasObject) {
+			if i < 0 || i >= len(albums) {
+				return
+			}
+			a := albums[i]
+			cell := o.(*fyne.Container)
+			// Border layout keeps the centre object first, then the bottom one.
+			img := cell.Objects[0].(*canvas.Image)
+			labels := cell.Objects[1].(*fyne.Container)
+			labels.Objects[0].(*widget.Label).SetText(a.Title)
+			labels.Objects[1].(*widget.Label).SetText(a.Artist)
+			setCover(img, a.Key(), audioFiles(a.Tracks))
+		},
+	)
+	grid.OnSelected = func(id widget.GridWrapItemID) {
+		grid.Unselect(id)
+		if id >= 0 && id < len(albums) {
+			showDetail(albums[id])
+		}
+	}
+
+	// Detail view
+	var current library.Album
+	detailCover := canvas.NewImageFromResource(theme.MediaMusicIcon())
+	detailCover.FillMode = canvas.ImageFillContain
+	detailCover.SetMinSize(fyne.NewSize(200, 200))
+	titleLbl := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	titleLbl.Wrapping = fyne.TextTruncate
+	artistLbl := widget.NewLabel("")
+	artistLbl.Wrapping = fyne.TextTruncate
+	infoLbl := widget.NewLabel("")
+	tracks := widget.NewList(
+		func() int { return len(current.Tracks) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			if i >= 0 && i < len(current.Tracks) {
+				o.(*widget.Label).SetText(trackRowText(current.Tracks[i]))
+			}
+		},
+	)
+	tracks.OnSelected = func(id widget.ListItemID) {
+		tracks.Unselect(id)
+		play(trackPaths(current.Tracks), id, false)
+	}
+	var detail *fyne.Container
+	backBtn := widget.NewButtonWithIcon("Albümler", theme.NavigateBackIcon(), func() {
+		detail.Hide()
+		grid.Show()
+	})
+	playBtn := widget.NewButtonWithIcon("Tümünü Çal", theme.MediaPlayIcon(), func() { play(trackPaths(current.Tracks), 0, false) })
+	shuffleBtn := widget.NewButtonWithIcon("Karıştır", theme.MediaReplayIcon(), func() { play(trackPaths(current.Tracks), 0, true) })
+	header := container.NewBorder(
+		container.NewHBox(backBtn),
+		widget.NewSeparator(),
+		detailCover, nil,
+		container.NewVBox(titleLbl, artistLbl, infoLbl, container.NewHBox(playBtn, shuffleBtn)),
+	)
+	detail = container.NewBorder(header, nil, nil, nil, tracks)
+	detail.Hide()
+
+	showDetail = func(a library.Album) {
+		current = a
+		titleLbl.SetText(a.Title)
+		artistLbl.SetText(a.Artist)
+		info := fmt.Sprintf("%d parça · %s", len(a.Tracks), formatDur(a.Duration()))
+		if a.Year > 0 {
+			info = fmt.Sprintf("%d · %s", a.Year, info)
+		}
+		infoLbl.SetText(info)
+		setCover(detailCover, a.Key(), audioFiles(a.Tracks))
+		tracks.ScrollToTop()
+		tracks.Refresh()
+		grid.Hide()
+		detail.Show()
+	}
+
+	refresh := func() {
+		albums = lib.Albums()
+		grid.Refresh()
+		if detail.Visible() {
+			for _, a := range albums {
+				if a.Key() == current.Key() {
+					current = a
+					tracks.Refresh()
+					return
+				}
+			}
+			detail.Hide()
+			grid.Show()
+		}
+	}
+	return container.NewStack(grid, detail), refresh
+}
+
+func trackPaths(ts []library.Track) []string {
+	out := make([]string, len(ts))
+	for i, t := range ts {
+		out[i] = t.Path
+	}
+	return out
+}
+
+// audioFiles lists the files holding the tracks' audio, once each; CUE
+// sheet tracks share their album image.
+func audioFiles(ts []library.Track) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, t := range ts {
+		if f := t.AudioFile(); !seen[f] {
+			seen[f] = true
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/backup"
+	"opentify/internal/history"
+	"opentify/internal/library"
+	"opentify/internal/paths"
+	"opentify/internal/state"
+)
+
+// exportFlag returns the file of "--export FILE" or "--export=FILE" in
+// args, the command line without the program name.
+func exportFlag(args []string) (string, bool) {
+	for i, a := range args {
+		name, val, hasVal := strings.Cut(strings.TrimLeft(a, "-"), "=")
+		switch {
+		case !strings.HasPrefix(a, "-") || name != "export":
+		case hasVal:
+			return val, val != ""
+		case i+1 < len(args):
+			return args[i+1], true
+		}
+	}
+	return "", false
+}
+
+// exportBackup writes a backup of the current profile to file without
+// opening a window.
+func exportBackup(dirs paths.Dirs, file string) error {
+	profiles, err := state.OpenProfiles(dirs.Config, dirs.Data)
+	if err != nil {
+		return err
+	}
+	name := profiles.Current()
+	s, err := state.Load(profiles.StateFile(name))
+	if err != nil {
+		return err
+	}
+	lib, err := library.Open(dirs.Library())
+	if err != nil {
+		return err
+	}
+	hist, err := history.Open(historyFile(profiles, name))
+	if err != nil {
+		return err
+	}
+	return backup.Export(file, backup.Data{
+		Profile:  name,
+		State:    s,
+		History:  hist.Entries(),
+		Library:  lib,
+		MusicDir: musicDir(dirs, profiles),
+	})
+}
+
+// showBackupExport asks where to save a backup of the data from data.
+func showBackupExport(w fyne.Window, data func() backup.Data) {
+	save := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+		if err != nil || wc == nil {
+			return
+		}
+		_ = wc.Close()
+		if err := backup.Export(wc.URI().Path(), data()); err != nil {
+			dialog.ShowError(fmt.Errorf("yedek yazılamadı: %w", err), w)
+			return
+		}
+		dialog.ShowInformation("Yedekle", "Yedek kaydedildi: "+wc.URI().Path(), w)
+	}, w)
+	name := "opentify-" + data().Profile + "-" + time.Now().Format("2006-01-02")
+	save.SetFileName(name + backup.Ext)
+	save.Show()
+}
+
+// showBackupImport asks for a backup and whether to merge it into the
+// current profile or replace its data, imports it into st and hist, and
+// reports what happened. Covers of the backup's playlists are saved in
+// coverDir; done is called after the import.
+func showBackupImport(w fyne.Window, lib *library.Index, st *state.Store, hist *history.Log, musicDir, coverDir string, done func(backup.Mode)) {
+	d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+		if err != nil || r == nil {
+			return
+		}
+		_ = r.Close()
+		a, err := backup.Read(r.URI().Path())
+		if errors.Is(err, backup.ErrFormat) {
+			dialog.ShowError(errors.New("bu dosya bir Opentify yedeği değil ya da daha yeni bir sürümle alınmış"), w)
+			return
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("yedek okunamadı: %w", err), w)
+			return
+		}
+		modes := []string{"Birleştir", "Değiştir"}
+		modeSel := widget.NewSelect(modes, nil)
+		modeSel.SetSelectedIndex(0)
+		about := fmt.Sprintf("%q profili, %s\n%d playlist, %d beğeni, %d dinleme kaydı",
+			a.Manifest.Profile, a.Manifest.Created.Local().Format("02.01.2006 15:04"),
+			len(a.State.Playlists)+len(a.State.SmartPlaylists), len(a.State.Liked), len(a.History))
+		help := widget.NewLabel("Birleştir: mevcut veriler korunur, yedektekiler eklenir; çakışmalarda yerel kayıt tutulur.\n" +
+			"Değiştir: bu profilin playlistleri, beğenileri, puanları, geçmişi ve ayarları yedektekilerle değiştirilir.")
+		help.Wrapping = fyne.TextWrapWord
+		dialog.ShowForm("Yedekten Geri Yükle", "Geri Yükle", "İptal", []*widget.FormItem{
+			widget.NewFormItem("Yedek", widget.NewLabel(about)),
+			widget.NewFormItem("Kip", modeSel),
+			widget.NewFormItem("", help),
+		}, func(ok bool) {
+			if !ok {
+				return
+			}
+			mode := backup.Merge
+			if modeSel.SelectedIndex() == 1 {
+				mode = backup.Replace
+			}
+			ids, missing := a.Resolve(lib, musicDir)
+			if err := lib.Save(); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			var rep backup.Report
+			_ = st.Update(state.ChangeAll, func(s *state.State) error {
+				rep = a.Apply(s, ids, mode, coverDir)
+				return nil
+			})
+			rep.Missing = missing
+			n, err := hist.Import(a.HistoryIn(lib, ids), mode == backup.Replace)
+			if err != nil {
+				dialog.ShowError(fmt.Errorf("dinleme geçmişi yazılamadı: %w", err), w)
+			}
+			rep.History = n
+			done(mode)
+			showBackupReport(w, rep)
+		}, w)
+	}, w)
+	d.SetFilter(storage.NewExtensionFileFilter([]string{backup.Ext}))
+	d.Show()
+}
+
+// showBackupReport lists what an import added and how its conflicts were
+// settled.
+func showBackupReport(w fyne.Window, rep backup.Report) {
+	lines := []string{fmt.Sprintf("Eklenen: %d playlist, %d beğeni, %d puan, %d dinleme kaydı.", rep.Playlists, rep.Liked, rep.Ratings, rep.History)}
+	if rep.SettingsLoaded {
+		lines = append(lines, "Ayarlar yedektekilerle değiştirildi.")
+	}
+	var renamed []string
+	for from, to := range rep.Renamed {
+		renamed = append(renamed, fmt.Sprintf("  %q, aynı adlı farklı bir liste olduğu için %q olarak eklendi", from, to))
+	}
+	sort.Strings(renamed)
+	if len(renamed) > 0 || rep.KeptRatings > 0 || rep.KeptOffsets > 0 {
+		lines = append(lines, "", "Çakışmalar:")
+		lines = append(lines, renamed...)
+		if rep.KeptRatings > 0 {
+			lines = append(lines, fmt.Sprintf("  %d parçanın puanı yedektekinden farklı; yerel puan tutuldu", rep.KeptRatings))
+		}
+		if rep.KeptOffsets > 0 {
+			lines = append(lines, fmt.Sprintf("  %d parçanın söz kayması yedektekinden farklı; yerel değer tutuldu", rep.KeptOffsets))
+		}
+	}
+	if rep.CoversDropped > 0 {
+		lines = append(lines, "", fmt.Sprintf("%d playlist kapağı geri yüklenemedi.", rep.CoversDropped))
+	}
+	if len(rep.Missing) > 0 {
+		lines = append(lines, "", fmt.Sprintf("Kütüphanede bulunamayan %d parça (dosyaları müzik klasörüne eklendiğinde kendiliğinden bağlanır):", len(rep.Missing)))
+		for _, t := range rep.Missing {
+			lines = append(lines, "  "+t.Label())
+		}
+	}
+	text := widget.NewLabel(strings.Join(lines, "\n"))
+	scroll := container.NewVScroll(text)
+	scroll.SetMinSize(fyne.NewSize(480, 260))
+	dialog.ShowCustom("Yedekten Geri Yükle", "Tamam", scroll, w)
+}
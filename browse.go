@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/library"
+)
+
+// browseEntry is one row of a browse tab (an artist, album, genre, ...).
+type browseEntry struct {
+	name   string
+	sub    string
+	tracks []library.Track
+}
+
+// newBrowsePage builds the "Göz At" page with artist, album artist, album,
+// genre and decade tabs. play receives the chosen tracks in order and the
+// index to start from; shuffle asks the caller to randomise them. The returned func reloads the tabs
+// from the index.
+func newBrowsePage(lib *library.Index, play func(paths []string, start int, shuffle bool)) (fyne.CanvasObject, func()) {
+	groups := func(gs []library.Group) []browseEntry {
+		out := make([]browseEntry, 0, len(gs))
+		for _, g := range gs {
+			out = append(out, browseEntry{name: g.Name, sub: fmt.Sprintf("%d parça", len(g.Tracks)), tracks: g.Tracks})
+		}
+		return out
+	}
+	artists, r1 := newBrowseTab(func() []browseEntry { return groups(lib.Artists()) }, play)
+	albumArtists, r2 := newBrowseTab(func() []browseEntry { return groups(lib.AlbumArtists()) }, play)
+	albums, r3 := newBrowseTab(func() []browseEntry {
+		as := lib.Albums()
+		out := make([]browseEntry, 0, len(as))
+		for _, a := range as {
+			sub := a.Artist
+			if a.Year > 0 {
+				sub = fmt.Sprintf("%s · %d", a.Artist, a.Year)
+			}
+			out = append(out, browseEntry{name: a.Title, sub: sub, tracks: a.Tracks})
+		}
+		return out
+	}, play)
+	genres, r4 := newBrowseTab(func() []browseEntry { return groups(lib.Genres()) }, play)
+	decades, r5 := newBrowseTab(func() []browseEntry {
+		out := groups(lib.Decades())
+		for i := range out {
+			out[i].name = decadeLabel(out[i].name)
+		}
+		return out
+	}, play)
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Sanatçılar", artists),
+		container.NewTabItem("Albüm Sanatçıları", albumArtists),
+		container.NewTabItem("Albümler", albums),
+		container.NewTabItem("Türler", genres),
+		container.NewTabItem("Yıllar", decades),
+	)
+	refresh := func() {
+		for _, r := range []func(){r1, r2, r3, r4, r5} {
+			r()
+		}
+	}
+	return tabs, refresh
+}
+
+// newBrowseTab shows a list of entries; selecting one drills down into its
+// tracks with "play all" and "shuffle all" actions.
+func newBrowseTab(load func() []browseEntry, play func(paths []string, start int, shuffle bool)) (fyne.CanvasObject, func()) {
+	var entries []browseEntry
+	var current browseEntry
+
+	groupList := widget.NewList(
+		func() int { return len(entries) },
+		func() fyne.CanvasObject {
+			return container.NewVBox(
+				widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
+				widget.NewLabel(""),
+			)
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			if i < 0 || i >= len(entries) {
+				return
+			}
+			box := o.(*fyne.Container)
+			box.Objects[0].(*widget.Label).SetText(entries[i].name)
+			box.Objects[1].(*widget.Label).SetText(entries[i].sub)
+		},
+	)
+
+	trackList := widget.NewList(
+		func() int { return len(current.tracks) },
+		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			if i < 0 || i >= len(current.tracks) {
+				return
+			}
+			o.(*widget.Label).SetText(trackRowText(current.tracks[i]))
+		},
+	)
+	paths := func() []string { return trackPaths(current.tracks) }
+	trackList.OnSelected = func(id widget.ListItemID) {
+		trackList.Unselect(id)
+		ps := paths()
+		if id < 0 || id >= len(ps) {
+			return
+		}
+		// Queue the whole group but start from the clicked track.
+		play(ps, id, false)
+	}
+
+	titleLbl := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	titleLbl.Wrapping = fyne.TextTruncate
+	subLbl := widget.NewLabel("")
+	var detail *fyne.Container
+	backBtn := widget.NewButtonWithIcon("", theme.NavigateBackIcon(), func() {
+		detail.Hide()
+		groupList.Show()
+		groupList.UnselectAll()
+	})
+	playBtn := widget.NewButtonWithIcon("Tümünü Çal", theme.MediaPlayIcon(), func() { play(paths(), 0, false) })
+	shuffleBtn := widget.NewButtonWithIcon("Karıştır", theme.MediaReplayIcon(), func() { play(paths(), 0, true) })
+	header := container.NewVBox(
+		container.NewBorder(nil, nil, backBtn, nil, titleLbl),
+		container.NewHBox(subLbl, playBtn, shuffleBtn),
+		widget.NewSeparator(),
+	)
+	detail = container.NewBorder(header, nil, nil, nil, trackList)
+	detail.Hide()
+
+	groupList.OnSelected = func(id widget.ListItemID) {
+		if id < 0 || id >= len(entries) {
+			return
+		}
+		current = entries[id]
+		titleLbl.SetText(current.name)
+		subLbl.SetText(fmt.Sprintf("%s · %s", current.sub, formatDur(tracksDuration(current.tracks))))
+		trackList.ScrollToTop()
+		trackList.Refresh()
+		groupList.Hide()
+		detail.Show()
+	}
+
+	refresh := func() {
+		entries = load()
+		groupList.Refresh()
+		if detail.Visible() {
+			// Keep the open group in sync with the index.
+			for _, e := range entries {
+				if e.name == current.name {
+					current = e
+					trackList.Refresh()
+					return
+				}
+			}
+			detail.Hide()
+			groupList.Show()
+		}
+	}
+	return container.NewStack(groupList, detail), refresh
+}
+
+func trackRowText(t library.Track) string {
+	prefix := ""
+	switch {
+	case t.Disc > 1 && t.TrackNo > 0:
+		prefix = fmt.Sprintf("%d-%02d. ", t.Disc, t.TrackNo)
+	case t.TrackNo > 0:
+		prefix = fmt.Sprintf("%02d. ", t.TrackNo)
+	}
+	text := prefix + t.DisplayTitle()
+	if t.Artist != "" {
+		text += " — " + t.Artist
+	}
+	if t.Duration > 0 {
+		text += " (" + formatDur(t.Duration) + ")"
+	}
+	return text
+}
+
+func tracksDuration(ts []library.Track) time.Duration {
+	var d time.Duration
+	for _, t := range ts {
+		d += t.Duration
+	}
+	return d
+}
+
+// decadeLabel turns "1990" into "1990'lar" with the right vowel harmony.
+func decadeLabel(year string) string {
+	n, err := strconv.Atoi(year)
+	if err != nil {
+		return year
+	}
+	switch (n / 10) % 10 {
+	case 1, 3, 4, 6, 9:
+		return year + "'lar"
+	}
+	return year + "'ler"
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/dupes"
+	"opentify/internal/library"
+	"opentify/internal/state"
+)
+
+// copyDetails describes one copy of a duplicate group for the side-by-side
+// comparison.
+func copyDetails(root string, t library.Track) string {
+	format := strings.ToUpper(t.Ext())
+	if t.Bitrate > 0 {
+		format += fmt.Sprintf(" · %d kbps", t.Bitrate)
+	}
+	if t.SampleRate > 0 {
+		format += fmt.Sprintf(" · %.1f kHz", float64(t.SampleRate)/1000)
+	}
+	path := t.Path
+	if r, err := filepath.Rel(root, t.Path); err == nil {
+		path = r
+	}
+	return strings.Join([]string{
+		t.DisplayTitle(),
+		t.Artist,
+		format,
+		formatDur(t.Duration),
+		fmt.Sprintf("%.1f MB", float64(t.Size)/(1<<20)),
+		path,
+	}, "\n")
+}
+
+// showDuplicates opens the duplicate finder. Each group lists its copies
+// side by side with the best one preselected; merging moves likes and
+// playlist entries onto the kept copy and optionally deletes the others.
+// merged is called after st has been saved with the survivor and the paths
+// that no longer exist.
+func showDuplicates(w fyne.Window, root string, lib *library.Index, st *state.Store, fps *dupes.FingerprintCache, merged func(survivor string, removed []string)) {
+	acousticCheck := widget.NewCheck("Ses parmak izi ile doğrula (yavaş, ilk taramada dosyalar çözülür)", nil)
+	acousticCheck.SetChecked(true)
+	deleteCheck := widget.NewCheck("Birleştirirken diğer kopyaları diskten sil", nil)
+	summary := widget.NewLabel("Taramak için \"Tara\"ya basın.")
+	groupsBox := container.NewVBox()
+
+	var render func(groups []dupes.Group)
+	mergeGroup := func(g dupes.Group, keep int, done func()) {
+		survivor := g.Tracks[keep].Path
+		var others, otherIDs []string
+		for i, t := range g.Tracks {
+			if i != keep {
+				others = append(others, t.Path)
+				otherIDs = append(otherIDs, t.ID)
+			}
+		}
+		apply := func(remove bool) {
+			st.MergeInto(g.Tracks[keep].ID, otherIDs)
+			var removed []string
+			var failed []string
+			if remove {
+				for _, p := range others {
+					// CUE sheet tracks share their image with the rest of
+					// the album; they are only merged.
+					if library.IsCue(p) {
+						continue
+					}
+					if err := os.Remove(p); err != nil {
+						failed = append(failed, filepath.Base(p))
+						continue
+					}
+					removed = append(removed, p)
+				}
+			}
+			merged(survivor, removed)
+			done()
+			if len(failed) > 0 {
+				dialog.ShowError(fmt.Errorf("silinemeyen dosyalar: %s", strings.Join(failed, ", ")), w)
+			}
+		}
+		if !deleteCheck.Checked {
+			apply(false)
+			return
+		}
+		dialog.ShowConfirm("Kopyaları sil", fmt.Sprintf("%d dosya kalıcı olarak silinecek. Devam edilsin mi?", len(others)), func(ok bool) {
+			if ok {
+				apply(true)
+			}
+		}, w)
+	}
+
+	render = func(groups []dupes.Group) {
+		groupsBox.RemoveAll()
+		for gi := range groups {
+			g := groups[gi]
+			keep := 0
+			var checks []*widget.Check
+			cols := make([]fyne.CanvasObject, len(g.Tracks))
+			for i, t := range g.Tracks {
+				info := widget.NewLabel(copyDetails(root, t))
+				info.Wrapping = fyne.TextWrapBreak
+				c := widget.NewCheck("Bunu sakla", nil)
+				c.SetChecked(i == 0)
+				c.OnChanged = func(on bool) {
+					if !on {
+						// One copy must always stay selected.
+						if keep == i {
+							c.SetChecked(true)
+						}
+						return
+					}
+					keep = i
+					for j, o := range checks {
+						if j != i {
+							o.SetChecked(false)
+						}
+					}
+				}
+				checks = append(checks, c)
+				cols[i] = container.NewVBox(c, info)
+			}
+			title := fmt.Sprintf("%s — %d kopya", g.Tracks[0].DisplayTitle(), len(g.Tracks))
+			if g.Acoustic {
+				title += " (ses ile doğrulandı)"
+			}
+			mergeBtn := widget.NewButton("Birleştir", func() {
+				mergeGroup(g, keep, func() {
+					rest := append(groups[:gi:gi], groups[gi+1:]...)
+					summary.SetText(fmt.Sprintf("%d kopya grubu kaldı.", len(rest)))
+					render(rest)
+				})
+			})
+			groupsBox.Add(widget.NewCard(title, "", container.NewBorder(nil, container.NewHBox(mergeBtn), nil, nil,
+				container.NewGridWithColumns(len(cols), cols...))))
+		}
+		groupsBox.Refresh()
+	}
+
+	var scanBtn *widget.Button
+	scanBtn = widget.NewButton("Tara", func() {
+		scanBtn.Disable()
+		bar := widget.NewProgressBar()
+		prog := dialog.NewCustomWithoutButtons("Kopyalar aranıyor", bar, w)
+		prog.Show()
+		opt := dupes.Options{
+			Acoustic: acousticCheck.Checked,
+			Progress: func(n, total int) {
+				fyne.Do(func() { bar.SetValue(float64(n) / float64(total)) })
+			},
+		}
+		tracks := lib.Tracks()
+		go func() {
+			groups := dupes.Find(tracks, fps, opt)
+			fyne.Do(func() {
+				prog.Hide()
+				scanBtn.Enable()
+				extra := 0
+				for _, g := range groups {
+					extra += len(g.Tracks) - 1
+				}
+				if len(groups) == 0 {
+					summary.SetText("Kopya bulunamadı.")
+				} else {
+					summary.SetText(fmt.Sprintf("%d grupta %d fazla kopya bulundu. En iyi kopya önceden seçildi.", len(groups), extra))
+				}
+				render(groups)
+			})
+		}()
+	})
+
+	top := container.NewVBox(acousticCheck, deleteCheck, scanBtn, summary)
+	d := dialog.NewCustom("Kopya Bulucu", "Kapat", container.NewBorder(top, nil, nil, nil, container.NewVScroll(groupsBox)), w)
+	d.Resize(fyne.NewSize(900, 650))
+	d.Show()
+}
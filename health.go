@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/health"
+	"opentify/internal/library"
+	"opentify/internal/state"
+)
+
+var healthKindLabels = map[health.Kind]string{
+	health.Unreadable: "Açılamıyor",
+	health.Corrupt:    "Bozuk",
+	health.Truncated:  "Kesik",
+	health.Empty:      "Boş",
+	health.BadTags:    "Etiket okunamıyor",
+}
+
+// issueText is the second line of a broken file row.
+func issueText(is health.Issue) string {
+	parts := []string{healthKindLabels[is.Kind]}
+	if is.Expected > 0 {
+		parts = append(parts, fmt.Sprintf("%s / %s çözüldü", formatDur(is.Decoded), formatDur(is.Expected)))
+	}
+	if is.Detail != "" {
+		parts = append(parts, is.Detail)
+	}
+	return strings.Join(parts, " · ")
+}
+
+// showHealthCheck opens the library health report. The "Bozuk dosyalar" tab
+// decodes every file in the background; "Eksik dosyalar" lists playlist
+// entries and likes whose files are gone and relinks or removes them in
+// bulk. changed is called after st has been modified and saved.
+func showHealthCheck(w fyne.Window, root string, lib *library.Index, st *state.Store, changed func()) {
+	rel := func(p string) string {
+		if r, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(r, "..") {
+			return r
+		}
+		return p
+	}
+	twoLines := func() fyne.CanvasObject {
+		top := widget.NewLabel("")
+		top.Truncation = fyne.TextTruncateEllipsis
+		bottom := widget.NewLabel("")
+		bottom.Truncation = fyne.TextTruncateEllipsis
+		return container.NewVBox(top, bottom)
+	}
+
+	// Broken files.
+	var issues []health.Issue
+	issueList := widget.NewList(
+		func() int { return len(issues) },
+		twoLines,
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			c := o.(*fyne.Container)
+			c.Objects[0].(*widget.Label).SetText(rel(issues[id].Path))
+			c.Objects[1].(*widget.Label).SetText(issueText(issues[id]))
+		},
+	)
+	scanStatus := widget.NewLabel("Tüm dosyalar baştan sona çözülerek denetlenir; büyük kütüphanelerde birkaç dakika sürebilir.")
+	scanStatus.Wrapping = fyne.TextWrapWord
+	bar := widget.NewProgressBar()
+	bar.Hide()
+	var stop chan struct{}
+	var scanBtn, stopBtn *widget.Button
+	scanBtn = widget.NewButton("Denetle", func() {
+		scanBtn.Disable()
+		stopBtn.Enable()
+		bar.SetValue(0)
+		bar.Show()
+		scanStatus.SetText("Denetleniyor...")
+		stop = make(chan struct{})
+		quit := stop
+		tracks := lib.Tracks()
+		go func() {
+			found := health.Scan(tracks, quit, func(n, total int) {
+				fyne.Do(func() { bar.SetValue(float64(n) / float64(total)) })
+			})
+			fyne.Do(func() {
+				if stop == quit {
+					stop = nil
+				}
+				issues = found
+				issueList.Refresh()
+				bar.Hide()
+				scanBtn.Enable()
+				stopBtn.Disable()
+				files := map[string]bool{}
+				for _, is := range found {
+					files[is.Path] = true
+				}
+				msg := fmt.Sprintf("%d dosya denetlendi, %d dosyada sorun bulundu.", len(tracks), len(files))
+				select {
+				case <-quit:
+					msg = "Denetim durduruldu. " + fmt.Sprintf("%d dosyada sorun bulundu.", len(files))
+				default:
+				}
+				scanStatus.SetText(msg)
+			})
+		}()
+	})
+	stopBtn = widget.NewButton("Durdur", func() {
+		if stop != nil {
+			close(stop)
+			stop = nil
+		}
+		stopBtn.Disable()
+	})
+	stopBtn.Disable()
+	brokenTab := container.NewBorder(
+		container.NewVBox(container.NewHBox(scanBtn, stopBtn), bar, scanStatus), nil, nil, nil, issueList)
+
+	// Missing files.
+	var refs []health.Ref
+	var suggest []string // relink target per ref, "" when unknown
+	picked := map[int]bool{}
+	missingStatus := widget.NewLabel("")
+	var missingList *widget.List
+	missingList = widget.NewList(
+		func() int { return len(refs) },
+		func() fyne.CanvasObject {
+			return container.NewBorder(nil, nil, widget.NewCheck("", nil), widget.NewButton("Bul...", nil), twoLines())
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			c := o.(*fyne.Container)
+			lines := c.Objects[0].(*fyne.Container)
+			check := c.Objects[1].(*widget.Check)
+			find := c.Objects[2].(*widget.Button)
+			r := refs[id]
+			name := rel(r.Path)
+			if r.Path == "" {
+				name = "(bilinmeyen dosya)"
+			}
+			lines.Objects[0].(*widget.Label).SetText(name)
+			var where []string
+			if r.Liked {
+				where = append(where, "Beğendiklerim")
+			}
+			where = append(where, r.Playlists...)
+			info := "Kullanıldığı yer: " + strings.Join(where, ", ")
+			if suggest[id] != "" {
+				info += "  →  " + rel(suggest[id])
+			}
+			lines.Objects[1].(*widget.Label).SetText(info)
+			check.OnChanged = nil
+			check.SetChecked(picked[id])
+			check.OnChanged = func(on bool) { picked[id] = on }
+			find.OnTapped = func() {
+				fd := dialog.NewFileOpen(func(rc fyne.URIReadCloser, err error) {
+					if err != nil || rc == nil {
+						return
+					}
+					_ = rc.Close()
+					suggest[id] = rc.URI().Path()
+					missingList.RefreshItem(id)
+				}, w)
+				if u, err := storage.ListerForURI(storage.NewFileURI(root)); err == nil {
+					fd.SetLocation(u)
+				}
+				fd.Show()
+			}
+		},
+	)
+	reloadMissing := func() {
+		st.View(func(s *state.State) { refs = health.Missing(s, lib) })
+		tracks := lib.Tracks()
+		suggest = make([]string, len(refs))
+		for i, r := range refs {
+			suggest[i], _ = health.Suggest(r.Path, tracks)
+		}
+		picked = map[int]bool{}
+		for i := range refs {
+			picked[i] = true
+		}
+		if len(refs) == 0 {
+			missingStatus.SetText("Playlist ve beğenilerde eksik dosya yok.")
+		} else {
+			missingStatus.SetText(fmt.Sprintf("%d kayıt artık var olmayan dosyalara işaret ediyor.", len(refs)))
+		}
+		missingList.Refresh()
+	}
+	selectedRefs := func() []int {
+		var out []int
+		for i := range refs {
+			if picked[i] {
+				out = append(out, i)
+			}
+		}
+		return out
+	}
+	relinkBtn := widget.NewButton("Seçilenleri yeniden bağla", func() {
+		var relinked []string
+		for _, i := range selectedRefs() {
+			p := suggest[i]
+			if p == "" {
+				continue
+			}
+			// Files picked outside the library are indexed first
+			id := lib.ID(p)
+			if id == "" {
+				if err := lib.Refresh(p); err != nil {
+					dialog.ShowError(err, w)
+					continue
+				}
+				id = lib.ID(p)
+			}
+			st.MergeInto(id, []string{refs[i].ID})
+			relinked = append(relinked, refs[i].ID)
+		}
+		if len(relinked) == 0 {
+			dialog.ShowInformation("Yeniden bağla", "Seçilen kayıtlar için bulunmuş bir dosya yok; \"Bul...\" ile seçebilirsiniz.", w)
+			return
+		}
+		if err := lib.Forget(relinked...); err != nil {
+			fmt.Fprintln(os.Stderr, "library:", err)
+		}
+		changed()
+		reloadMissing()
+	})
+	removeBtn := widget.NewButton("Seçilenleri kaldır", func() {
+		var ids []string
+		for _, i := range selectedRefs() {
+			ids = append(ids, refs[i].ID)
+		}
+		if len(ids) == 0 {
+			return
+		}
+		dialog.ShowConfirm("Kayıtları kaldır", fmt.Sprintf("%d dosya playlistlerden ve beğenilerden kaldırılacak. Devam edilsin mi?", len(ids)), func(ok bool) {
+			if !ok {
+				return
+			}
+			if st.RemoveTracks(ids) {
+				changed()
+			}
+			if err := lib.Forget(ids...); err != nil {
+				fmt.Fprintln(os.Stderr, "library:", err)
+			}
+			reloadMissing()
+		}, w)
+	})
+	allBtn := widget.NewButton("Tümünü seç", func() {
+		all := len(selectedRefs()) < len(refs)
+		for i := range refs {
+			picked[i] = all
+		}
+		missingList.Refresh()
+	})
+	missingTab := container.NewBorder(
+		container.NewVBox(missingStatus, container.NewHBox(allBtn, relinkBtn, removeBtn)), nil, nil, nil, missingList)
+	reloadMissing()
+
+	tabs := container.NewAppTabs(
+		container.NewTabItem("Bozuk dosyalar", brokenTab),
+		container.NewTabItem("Eksik dosyalar", missingTab),
+	)
+	if len(refs) > 0 {
+		tabs.SelectIndex(1)
+	}
+	d := dialog.NewCustom("Kütüphane Denetimi", "Kapat", tabs, w)
+	d.SetOnClosed(func() {
+		if stop != nil {
+			close(stop)
+			stop = nil
+		}
+	})
+	d.Resize(fyne.NewSize(900, 600))
+	d.Show()
+}
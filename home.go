@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sort"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/artwork"
+	"opentify/internal/history"
+	"opentify/internal/library"
+	"opentify/internal/state"
+)
+
+const (
+	homeShelfLen  = 12
+	homeThumbSize = 120
+)
+
+// newHomePage builds the "Anasayfa" page with the "Son çalınanlar", "En çok
+// çalınanlar" and "Son eklenenler" shelves. Tapping a card plays its shelf
+// from there. musicDir is named when the library is empty. The returned
+// func rebuilds the shelves.
+func newHomePage(lib *library.Index, st *state.Store, hist *history.Log, musicDir string, art *artwork.Cache, play func(paths []string, start int, shuffle bool)) (fyne.CanvasObject, func()) {
+	sem := make(chan struct{}, albumThumbWorkers)
+	card := func(t library.Track, onTap func()) fyne.CanvasObject {
+		img := canvas.NewImageFromResource(theme.MediaMusicIcon())
+		img.FillMode = canvas.ImageFillContain
+		img.SetMinSize(fyne.NewSize(homeThumbSize, homeThumbSize))
+		key := "file:" + t.AudioFile()
+		if th, ok := art.Cached(key); ok {
+			img.Resource, img.Image = nil, th
+		} else {
+			go func() {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+				th, err := art.Thumbnail(key, []string{t.AudioFile()})
+				if err != nil {
+					return
+				}
+				fyne.Do(func() {
+					img.Resource, img.Image = nil, th
+					img.Refresh()
+				})
+			}()
+		}
+		title := widget.NewLabelWithStyle(t.DisplayTitle(), fyne.TextAlignCenter, fyne.TextStyle{Bold: true})
+		title.Wrapping = fyne.TextTruncate
+		artist := widget.NewLabelWithStyle(t.Artist, fyne.TextAlignCenter, fyne.TextStyle{})
+		artist.Wrapping = fyne.TextTruncate
+		// The flat button behind the card makes all of it tappable.
+		btn := widget.NewButton("", onTap)
+		btn.Importance = widget.LowImportance
+		body := container.NewBorder(nil, container.NewVBox(title, artist), nil, nil, img)
+		return container.NewGridWrap(fyne.NewSize(homeThumbSize+16, homeThumbSize+80), container.NewStack(btn, body))
+	}
+	shelf := func(title, empty string, paths []string) fyne.CanvasObject {
+		header := widget.NewLabelWithStyle(title, fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+		if len(paths) == 0 {
+			return container.NewVBox(header, widget.NewLabel(empty))
+		}
+		row := container.NewHBox()
+		for i, p := range paths {
+			t, _ := lib.Get(p)
+			row.Add(card(t, func() { play(paths, i, false) }))
+		}
+		return container.NewVBox(header, container.NewHScroll(row))
+	}
+	// known keeps the paths that are still in the library, up to a shelf.
+	known := func(paths []string) []string {
+		var out []string
+		for _, p := range paths {
+			if _, ok := lib.Get(p); ok {
+				out = append(out, p)
+				if len(out) == homeShelfLen {
+					break
+				}
+			}
+		}
+		return out
+	}
+
+	box := container.NewVBox()
+	refresh := func() {
+		// By ID, so plays follow files that were moved since
+		recent := known(lib.Paths(hist.Recent(4 * homeShelfLen)))
+
+		var most []string
+		stats := map[string]state.PlayStats{}
+		st.View(func(s *state.State) {
+			for id, ps := range s.Stats {
+				if ps.Plays > 0 {
+					most = append(most, id)
+					stats[id] = ps
+				}
+			}
+		})
+		sort.Slice(most, func(i, j int) bool {
+			a, b := stats[most[i]], stats[most[j]]
+			if a.Plays != b.Plays {
+				return a.Plays > b.Plays
+			}
+			return a.LastPlayed.After(b.LastPlayed)
+		})
+		most = known(lib.Paths(most))
+
+		tracks := lib.Tracks()
+		sort.SliceStable(tracks, func(i, j int) bool { return tracks[i].Added.After(tracks[j].Added) })
+		added := make([]string, 0, homeShelfLen)
+		for _, t := range tracks {
+			if len(added) == homeShelfLen {
+				break
+			}
+			added = append(added, t.Path)
+		}
+
+		box.Objects = []fyne.CanvasObject{
+			widget.NewLabelWithStyle("Opentify'a hoş geldiniz", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
+			shelf("Son çalınanlar", "Henüz bir şey dinlemediniz.", recent),
+			shelf("En çok çalınanlar", "Bir parçayı yarısına (en fazla 4 dakika) kadar dinlediğinizde burada sayılır.", most),
+			shelf("Son eklenenler", "Kütüphaneniz boş. Müziklerinizi "+musicDir+" klasörüne ekleyin.", added),
+		}
+		box.Refresh()
+	}
+	return container.NewVScroll(box), refresh
+}
@@ -0,0 +1,190 @@
+// Package artwork extracts album covers (embedded pictures or folder images),
+// stores scaled thumbnails on disk and keeps recently used ones in memory.
+package artwork
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	_ "image/png" // folder.png and embedded PNG covers
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/image/draw"
+
+	"opentify/internal/tags"
+)
+
+// ErrNoArtwork is returned when neither the files nor their folder carry a cover.
+var ErrNoArtwork = errors.New("artwork: no cover found")
+
+// Folder images looked up next to the tracks, in order of preference.
+var folderNames = []string{"cover.jpg", "cover.png", "folder.jpg", "folder.png", "front.jpg", "front.png", "album.jpg"}
+
+// Cache serves square thumbnails of a fixed size.
+type Cache struct {
+	dir  string
+	size int
+
+	mu    sync.Mutex
+	mem   map[string]*list.Element
+	order *list.List // most recently used at the front
+	limit int
+}
+
+type memEntry struct {
+	key string
+	img image.Image
+}
+
+// New returns a cache storing size x size thumbnails under dir and keeping up
+// to memLimit decoded images in memory.
+func New(dir string, size, memLimit int) *Cache {
+	return &Cache{dir: dir, size: size, mem: map[string]*list.Element{}, order: list.New(), limit: memLimit}
+}
+
+// Thumbnail returns the cached thumbnail for key, creating it from the first
+// of paths that has artwork. It performs disk I/O and decoding, so callers
+// should run it off the UI goroutine.
+func (c *Cache) Thumbnail(key string, paths []string) (image.Image, error) {
+	if img, ok := c.Cached(key); ok {
+		return img, nil
+	}
+	file := filepath.Join(c.dir, hash(key)+".jpg")
+	none := filepath.Join(c.dir, hash(key)+".none")
+	if b, err := os.ReadFile(file); err == nil {
+		if img, err := jpeg.Decode(bytes.NewReader(b)); err == nil {
+			c.remember(key, img)
+			return img, nil
+		}
+	}
+	if _, err := os.Stat(none); err == nil {
+		return nil, ErrNoArtwork
+	}
+
+	src, err := Find(paths)
+	if err != nil {
+		if errors.Is(err, ErrNoArtwork) {
+			// Remember the miss so we do not rescan the files on every scroll.
+			_ = os.MkdirAll(c.dir, 0o755)
+			_ = os.WriteFile(none, nil, 0o644)
+		}
+		return nil, err
+	}
+	thumb := Scale(src, c.size)
+	if err := os.MkdirAll(c.dir, 0o755); err == nil {
+		var buf bytes.Buffer
+		if jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}) == nil {
+			_ = os.WriteFile(file, buf.Bytes(), 0o644)
+		}
+	}
+	c.remember(key, thumb)
+	return thumb, nil
+}
+
+// Forget drops key from memory and disk so it is rebuilt on next use.
+func (c *Cache) Forget(key string) {
+	c.mu.Lock()
+	if el, ok := c.mem[key]; ok {
+		c.order.Remove(el)
+		delete(c.mem, key)
+	}
+	c.mu.Unlock()
+	_ = os.Remove(filepath.Join(c.dir, hash(key)+".jpg"))
+	_ = os.Remove(filepath.Join(c.dir, hash(key)+".none"))
+}
+
+// ClearMisses forgets every "no artwork" result so covers added since the
+// last lookup are picked up.
+func (c *Cache) ClearMisses() {
+	matches, _ := filepath.Glob(filepath.Join(c.dir, "*.none"))
+	for _, m := range matches {
+		_ = os.Remove(m)
+	}
+}
+
+// Cached returns the thumbnail for key if it is already decoded in memory.
+// It never touches the disk and is cheap enough for the UI goroutine.
+func (c *Cache) Cached(key string) (image.Image, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.mem[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*memEntry).img, true
+}
+
+func (c *Cache) remember(key string, img image.Image) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.mem[key]; ok {
+		el.Value.(*memEntry).img = img
+		c.order.MoveToFront(el)
+		return
+	}
+	c.mem[key] = c.order.PushFront(&memEntry{key: key, img: img})
+	for c.limit > 0 && c.order.Len() > c.limit {
+		last := c.order.Back()
+		c.order.Remove(last)
+		delete(c.mem, last.Value.(*memEntry).key)
+	}
+}
+
+// Find returns the full-size cover for a set of tracks: the first embedded
+// picture, otherwise a conventional image file in one of their folders.
+func Find(paths []string) (image.Image, error) {
+	for _, p := range paths {
+		pic, err := tags.ReadPicture(p)
+		if err != nil {
+			continue
+		}
+		if img, _, err := image.Decode(bytes.NewReader(pic.Data)); err == nil {
+			return img, nil
+		}
+	}
+	seen := map[string]bool{}
+	for _, p := range paths {
+		dir := filepath.Dir(p)
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		for _, name := range folderNames {
+			f, err := os.Open(filepath.Join(dir, name))
+			if err != nil {
+				continue
+			}
+			img, _, err := image.Decode(f)
+			_ = f.Close()
+			if err == nil {
+				return img, nil
+			}
+		}
+	}
+	return nil, ErrNoArtwork
+}
+
+// Scale fits src into a size x size square, cropping the longer side.
+func Scale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2))
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, crop, draw.Src, nil)
+	return dst
+}
+
+func hash(key string) string {
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
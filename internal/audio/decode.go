@@ -0,0 +1,45 @@
+// Package audio decodes local media files with the beep decoders and
+// derives compact acoustic fingerprints from them.
+package audio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+// Decode opens path with the decoder matching its extension. Closing the
+// returned stream closes the file.
+func Decode(path string) (beep.StreamSeekCloser, beep.Format, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	var decode func(*os.File) (beep.StreamSeekCloser, beep.Format, error)
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".mp3":
+		decode = func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) { return mp3.Decode(f) }
+	case ".wav":
+		decode = func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) { return wav.Decode(f) }
+	case ".flac":
+		decode = func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) { return flac.Decode(f) }
+	case ".ogg":
+		decode = func(f *os.File) (beep.StreamSeekCloser, beep.Format, error) { return vorbis.Decode(f) }
+	default:
+		_ = f.Close()
+		return nil, beep.Format{}, fmt.Errorf("desteklenmeyen format: %s", ext)
+	}
+	st, format, err := decode(f)
+	if err != nil {
+		_ = f.Close()
+	}
+	return st, format, err
+}
@@ -0,0 +1,195 @@
+package audio
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"time"
+
+	"github.com/faiface/beep"
+)
+
+// Fingerprint parameters. Audio is analysed as mono at fpRate; every hop
+// yields one 16 bit sub-fingerprint describing how the energy of 17
+// log-spaced bands between fpLow and fpHigh changes (Haitsma & Kalker).
+const (
+	fpRate    = 5512
+	fpFrame   = 2048
+	fpHop     = 256 // ~46 ms
+	fpBands   = 17
+	fpLow     = 300.0
+	fpHigh    = 2000.0
+	fpSeconds = 120 // analyse at most the first two minutes
+)
+
+// FrameDuration is the time covered by one sub-fingerprint step.
+const FrameDuration = float64(fpHop) / fpRate
+
+// Fingerprint is a sequence of 16 bit sub-fingerprints.
+type Fingerprint []uint16
+
+// ErrTooShort is returned for files with less audio than one frame.
+var ErrTooShort = errors.New("audio: too short to fingerprint")
+
+// FingerprintFile decodes path and computes its fingerprint.
+func FingerprintFile(path string) (Fingerprint, error) {
+	return FingerprintSegment(path, 0, 0)
+}
+
+// FingerprintSegment fingerprints the part of path that starts at start
+// and lasts length (zero: to the end), such as a CUE sheet track.
+func FingerprintSegment(path string, start, length time.Duration) (Fingerprint, error) {
+	st, format, err := Decode(path)
+	if err != nil {
+		return nil, err
+	}
+	defer st.Close()
+	var s beep.Streamer = st
+	if start > 0 {
+		if err := st.Seek(format.SampleRate.N(start)); err != nil {
+			return nil, err
+		}
+	}
+	if length > 0 {
+		s = beep.Take(format.SampleRate.N(length), st)
+	}
+	return FingerprintStream(s, format.SampleRate)
+}
+
+// FingerprintStream computes the fingerprint of the first fpSeconds of s.
+func FingerprintStream(s beep.Streamer, sr beep.SampleRate) (Fingerprint, error) {
+	var src beep.Streamer = s
+	if sr != fpRate {
+		src = beep.Resample(1, sr, fpRate, s)
+	}
+	mono := make([]float64, 0, fpRate*fpSeconds)
+	buf := make([][2]float64, 4096)
+	for len(mono) < cap(mono) {
+		n, ok := src.Stream(buf)
+		for _, x := range buf[:n] {
+			mono = append(mono, (x[0]+x[1])/2)
+		}
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil && len(mono) == 0 {
+		return nil, err
+	}
+	if len(mono) < fpFrame+fpHop {
+		return nil, ErrTooShort
+	}
+
+	// Band edges as FFT bin indices.
+	var edges [fpBands + 1]int
+	for i := range edges {
+		f := fpLow * math.Pow(fpHigh/fpLow, float64(i)/fpBands)
+		edges[i] = int(f * fpFrame / fpRate)
+	}
+	window := make([]float64, fpFrame)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(fpFrame-1))
+	}
+	spec := make([]complex128, fpFrame)
+	var prev, cur [fpBands]float64
+	var fp Fingerprint
+	for off := 0; off+fpFrame <= len(mono); off += fpHop {
+		for i := range spec {
+			spec[i] = complex(mono[off+i]*window[i], 0)
+		}
+		fft(spec)
+		for b := 0; b < fpBands; b++ {
+			e := 0.0
+			for k := edges[b]; k < edges[b+1]; k++ {
+				re, im := real(spec[k]), imag(spec[k])
+				e += re*re + im*im
+			}
+			cur[b] = e
+		}
+		if off > 0 {
+			var v uint16
+			for b := 0; b < fpBands-1; b++ {
+				if (cur[b]-cur[b+1])-(prev[b]-prev[b+1]) > 0 {
+					v |= 1 << b
+				}
+			}
+			fp = append(fp, v)
+		}
+		prev = cur
+	}
+	return fp, nil
+}
+
+// fft is an in-place iterative radix-2 transform; len(a) must be a power
+// of two.
+func fft(a []complex128) {
+	n := len(a)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			a[i], a[j] = a[j], a[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				u := a[start+k]
+				v := a[start+k+size/2] * wk
+				a[start+k] = u + v
+				a[start+k+size/2] = u - v
+				wk *= w
+			}
+		}
+	}
+}
+
+// maxShift is how far (in frames) two fingerprints may be misaligned, to
+// allow for different leading silence (~5 s).
+const maxShift = 108
+
+// Similarity compares two fingerprints and returns 1 minus the lowest bit
+// error rate over all alignments within maxShift. Identical recordings
+// score above 0.8, unrelated ones around 0.5.
+func Similarity(a, b Fingerprint) float64 {
+	minOverlap := min(len(a), len(b)) / 2
+	if minOverlap < 16 {
+		return 0
+	}
+	// A coarse pass on every 8th frame finds the alignment, the exact bit
+	// error rate is then computed around it only.
+	coarse, at := 1.0, 0
+	for shift := -maxShift; shift <= maxShift; shift++ {
+		if ber, ok := bitErrors(a, b, shift, 8, minOverlap); ok && ber < coarse {
+			coarse, at = ber, shift
+		}
+	}
+	best := 1.0
+	for shift := at - 2; shift <= at+2; shift++ {
+		if ber, ok := bitErrors(a, b, shift, 1, minOverlap); ok && ber < best {
+			best = ber
+		}
+	}
+	return 1 - best
+}
+
+// bitErrors is the bit error rate of a against b shifted by shift frames,
+// sampling every step-th frame. ok is false when the overlap is too small.
+func bitErrors(a, b Fingerprint, shift, step, minOverlap int) (float64, bool) {
+	lo, hi := max(0, -shift), min(len(a), len(b)-shift)
+	if hi-lo < minOverlap {
+		return 0, false
+	}
+	errs, n := 0, 0
+	for i := lo; i < hi; i += step {
+		errs += bits.OnesCount16(a[i] ^ b[i+shift])
+		n++
+	}
+	return float64(errs) / float64(16*n), true
+}
@@ -0,0 +1,329 @@
+// Package backup writes the user data of a profile into a single archive
+// and reads it back, on the same machine or another one. Tracks are
+// described by their path relative to the music folder, their audio hash
+// and their tags, so the data finds them again in a library kept
+// elsewhere.
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"opentify/internal/history"
+	"opentify/internal/library"
+	"opentify/internal/state"
+)
+
+// Version is the format of the archives written by this build.
+const Version = 1
+
+// Ext is the extension of backup archives.
+const Ext = ".opentify-backup"
+
+// ErrFormat is returned for files that are not a backup this build reads.
+var ErrFormat = errors.New("backup: not an Opentify backup")
+
+// Files of an archive, a zip file.
+const (
+	manifestFile = "manifest.json"
+	stateFile    = "state.json" // the state; tracks by their key in Manifest.Tracks
+	historyFile  = "history.jsonl"
+	artworkFile  = "artwork.json"
+	coverDir     = "covers/"
+)
+
+// Manifest describes an archive.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Profile string    `json:"profile,omitempty"`
+
+	// Tracks are the tracks the state and the history refer to, by the
+	// key they use for them: the track ID, or an arbitrary key for played
+	// files that were not in the library.
+	Tracks map[string]Track `json:"tracks"`
+}
+
+// Track is a track as stored in an archive.
+type Track struct {
+	// Path is slash-separated and relative to the music folder, or
+	// absolute for files outside it (Outside).
+	Path    string `json:"path"`
+	Outside bool   `json:"outside,omitempty"`
+
+	Hash     string        `json:"hash,omitempty"`
+	Title    string        `json:"title,omitempty"`
+	Artist   string        `json:"artist,omitempty"`
+	Album    string        `json:"album,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+}
+
+// Label describes t for reports: "Artist - Title" when known, otherwise
+// its path.
+func (t Track) Label() string {
+	if t.Title != "" && t.Artist != "" {
+		return t.Artist + " - " + t.Title
+	}
+	return t.Path
+}
+
+// Artwork is the artwork manifest of an archive. Album thumbnails are not
+// archived, as they are rebuilt from the music files; playlist covers the
+// user picked are, under covers/.
+type Artwork struct {
+	Covers map[string]string `json:"covers,omitempty"` // playlist -> file in the archive
+}
+
+// Data is what Export saves.
+type Data struct {
+	Profile  string
+	State    *state.State
+	History  []history.Entry
+	Library  *library.Index
+	MusicDir string // the folder track paths are stored relative to
+}
+
+// Export writes d into a new archive at file, replacing it atomically.
+func Export(file string, d Data) error {
+	m := Manifest{Version: Version, Created: time.Now(), Profile: d.Profile, Tracks: map[string]Track{}}
+	describe := func(t library.Track) Track {
+		out := Track{Path: t.Path, Hash: t.Hash, Title: t.Title, Artist: t.Artist, Album: t.Album, Duration: t.Duration}
+		if rel, err := filepath.Rel(d.MusicDir, t.Path); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			out.Path = filepath.ToSlash(rel)
+		} else {
+			out.Outside = true
+		}
+		return out
+	}
+	refer := func(id string) {
+		if _, ok := m.Tracks[id]; ok {
+			return
+		}
+		if t, _ := d.Library.ByID(id); t.Path != "" {
+			m.Tracks[id] = describe(t)
+		}
+	}
+	s := d.State
+	for _, ids := range s.Playlists {
+		for _, id := range ids {
+			refer(id)
+		}
+	}
+	for id := range s.Liked {
+		refer(id)
+	}
+	for id := range s.Ratings {
+		refer(id)
+	}
+	for id := range s.LyricsOffsets {
+		refer(id)
+	}
+	for id := range s.Stats {
+		refer(id)
+	}
+	for id := range s.Matches {
+		refer(id)
+	}
+	// Plays refer to tracks by ID; those without one, by path
+	keys := map[string]string{}
+	hist := make([]history.Entry, 0, len(d.History))
+	for _, e := range d.History {
+		if e.ID != "" {
+			refer(e.ID)
+		}
+		if _, ok := m.Tracks[e.ID]; ok && e.ID != "" {
+			e.Path, e.ID = e.ID, ""
+			hist = append(hist, e)
+			continue
+		}
+		key, ok := keys[e.Path]
+		if !ok {
+			t, indexed := d.Library.Get(e.Path)
+			if key = t.ID; !indexed || key == "" {
+				key = "file:" + strconv.Itoa(len(keys))
+			}
+			keys[e.Path] = key
+			if _, ok := m.Tracks[key]; !ok {
+				m.Tracks[key] = describe(t)
+			}
+		}
+		e.Path, e.ID = key, ""
+		hist = append(hist, e)
+	}
+
+	dir := filepath.Dir(file)
+	f, err := os.CreateTemp(dir, filepath.Base(file)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	zw := zip.NewWriter(f)
+	err = write(zw, m, s, hist)
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, file)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+func write(zw *zip.Writer, m Manifest, s *state.State, hist []history.Entry) error {
+	put := func(name string, v any) error {
+		w, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+	if err := put(manifestFile, m); err != nil {
+		return err
+	}
+	// Covers are files of this machine; they travel inside the archive
+	art := Artwork{Covers: map[string]string{}}
+	for _, name := range s.PlaylistNames() {
+		cover := s.PlaylistInfo[name].Cover
+		if cover == "" {
+			continue
+		}
+		b, err := os.ReadFile(cover)
+		if err != nil {
+			continue // gone already; the playlist falls back to its tracks' art
+		}
+		file := coverDir + strconv.Itoa(len(art.Covers)) + strings.ToLower(filepath.Ext(cover))
+		w, err := zw.Create(file)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+		art.Covers[name] = file
+	}
+	if err := put(artworkFile, art); err != nil {
+		return err
+	}
+	if err := put(stateFile, s); err != nil {
+		return err
+	}
+	w, err := zw.Create(historyFile)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, e := range hist {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Archive is a backup read back.
+type Archive struct {
+	Manifest Manifest
+	Artwork  Artwork
+	State    *state.State
+	// History refers to tracks by their key in Manifest.Tracks.
+	History []history.Entry
+
+	covers map[string][]byte // by file in the archive
+}
+
+// Read reads the archive at file.
+func Read(file string) (*Archive, error) {
+	zr, err := zip.OpenReader(file)
+	if err != nil {
+		if errors.Is(err, zip.ErrFormat) {
+			return nil, ErrFormat
+		}
+		return nil, err
+	}
+	defer zr.Close()
+	a := &Archive{covers: map[string][]byte{}}
+	var haveManifest bool
+	for _, f := range zr.File {
+		var err error
+		switch name := f.Name; {
+		case name == manifestFile:
+			haveManifest = true
+			err = readJSON(f, &a.Manifest)
+		case name == artworkFile:
+			err = readJSON(f, &a.Artwork)
+		case name == stateFile:
+			var b []byte
+			if b, err = readAll(f); err == nil {
+				a.State, err = state.Parse(b)
+			}
+		case name == historyFile:
+			a.History, err = readHistory(f)
+		case strings.HasPrefix(name, coverDir) && !f.FileInfo().IsDir():
+			a.covers[name], err = readAll(f)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	switch {
+	case !haveManifest || a.State == nil:
+		return nil, ErrFormat
+	case a.Manifest.Version > Version:
+		return nil, fmt.Errorf("%w: version %d is newer than this build", ErrFormat, a.Manifest.Version)
+	case a.State.Version < 1:
+		// Tracks by path, which the manifest does not describe
+		return nil, ErrFormat
+	}
+	return a, nil
+}
+
+func readAll(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func readJSON(f *zip.File, v any) error {
+	b, err := readAll(f)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+func readHistory(f *zip.File) ([]history.Entry, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var out []history.Entry
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e history.Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.Path != "" {
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
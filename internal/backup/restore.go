@@ -0,0 +1,270 @@
+package backup
+
+import (
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"opentify/internal/dupes"
+	"opentify/internal/history"
+	"opentify/internal/library"
+	"opentify/internal/state"
+)
+
+// Mode says what an import does with the data already there.
+type Mode int
+
+const (
+	// Merge adds the archive to the data. Local settings are kept, and so
+	// are local ratings, lyrics offsets and metadata matches that differ;
+	// playlists of the same name but other tracks are imported under a new
+	// name.
+	Merge Mode = iota
+	// Replace swaps the data for the archive.
+	Replace
+)
+
+// Report sums up an import.
+type Report struct {
+	Playlists      int // playlists and smart playlists added
+	Liked          int // likes added
+	Ratings        int // ratings added
+	History        int // plays added
+	Renamed        map[string]string
+	KeptRatings    int // local ratings that differ from the archive's
+	KeptOffsets    int // local lyrics offsets that differ from the archive's
+	Missing        []Track
+	CoversDropped  int // covers that could not be restored
+	SettingsLoaded bool
+}
+
+// Resolve finds the tracks of the archive in lib, whose music folder is
+// musicDir: by their path, then by their audio hash, then by artist and
+// title, preferring the closest duration. Tracks that are not found are
+// added to lib as lost tracks at the path they would have here, so they
+// are relinked once their files show up; they are returned as missing.
+// The result maps the keys of the archive to track IDs of lib.
+func (a *Archive) Resolve(lib *library.Index, musicDir string) (ids map[string]string, missing []Track) {
+	tracks := lib.Tracks()
+	byHash := map[string]string{}
+	byKey := map[string][]library.Track{}
+	for _, t := range tracks {
+		if t.Hash != "" {
+			byHash[t.Hash] = t.ID
+		}
+		k := dupes.Key(t)
+		byKey[k] = append(byKey[k], t)
+	}
+	ids = map[string]string{}
+	for _, key := range slices.Sorted(maps.Keys(a.Manifest.Tracks)) {
+		t := a.Manifest.Tracks[key]
+		p := t.Path
+		if !t.Outside {
+			p = filepath.Join(musicDir, filepath.FromSlash(path.Clean("/"+t.Path)))
+		}
+		if id := lib.ID(p); id != "" {
+			ids[key] = id
+			continue
+		}
+		if id, ok := byHash[t.Hash]; ok && t.Hash != "" {
+			ids[key] = id
+			continue
+		}
+		if t.Title != "" {
+			if id, ok := closest(byKey[dupes.Key(library.Track{Artist: t.Artist, Title: t.Title})], t.Duration); ok {
+				ids[key] = id
+				continue
+			}
+		}
+		ids[key] = lib.AddLost(library.Track{
+			Path: p, Hash: t.Hash, Title: t.Title, Artist: t.Artist, Album: t.Album, Duration: t.Duration,
+			Added: time.Now(),
+		})
+		missing = append(missing, t)
+	}
+	return ids, missing
+}
+
+// closest returns the ID of the candidate whose duration is nearest to d,
+// or of the only candidate when d is unknown.
+func closest(cands []library.Track, d time.Duration) (string, bool) {
+	switch {
+	case len(cands) == 0:
+		return "", false
+	case len(cands) == 1:
+		return cands[0].ID, true
+	case d <= 0:
+		return "", false
+	}
+	best, bestDiff := 0, time.Duration(-1)
+	for i, t := range cands {
+		diff := max(t.Duration-d, d-t.Duration)
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = i, diff
+		}
+	}
+	return cands[best].ID, true
+}
+
+// Apply brings the state of the archive into s, with the track IDs from
+// Resolve. Playlist covers are written into coverDir. It uses up the
+// archive's state, so it is called once.
+func (a *Archive) Apply(s *state.State, ids map[string]string, mode Mode, coverDir string) Report {
+	in := a.State
+	in.RemapIDs(func(key string) string {
+		if id, ok := ids[key]; ok {
+			return id
+		}
+		return key
+	})
+	r := Report{Renamed: map[string]string{}}
+	for name, info := range in.PlaylistInfo {
+		// A cover path from the archive's machine means nothing here
+		info.Cover = ""
+		if file, ok := a.Artwork.Covers[name]; ok {
+			if p, err := a.writeCover(file, coverDir); err == nil {
+				info.Cover = p
+			} else {
+				r.CoversDropped++
+			}
+		}
+		in.PlaylistInfo[name] = info
+	}
+
+	if mode == Replace {
+		r.Playlists = len(in.Playlists) + len(in.SmartPlaylists)
+		r.Liked, r.Ratings = len(in.Liked), len(in.Ratings)
+		r.SettingsLoaded = true
+		*s = *in
+		return r
+	}
+
+	for _, name := range in.PlaylistNames() {
+		refs := in.Playlists[name]
+		local, ok := s.Playlists[name]
+		if ok && slices.Equal(local, refs) {
+			continue
+		}
+		to := name
+		if ok {
+			to = freeName(name, func(n string) bool { _, taken := s.Playlists[n]; return taken })
+			r.Renamed[name] = to
+		}
+		s.Playlists[to] = refs
+		s.PlaylistInfo[to] = in.PlaylistInfo[name]
+		r.Playlists++
+	}
+	for name, pl := range in.SmartPlaylists {
+		local, ok := s.SmartPlaylists[name]
+		if ok && sameSmart(local, pl) {
+			continue
+		}
+		to := name
+		if ok {
+			to = freeName(name, func(n string) bool { _, taken := s.SmartPlaylists[n]; return taken })
+			r.Renamed[name] = to
+		}
+		s.SmartPlaylists[to] = pl
+		r.Playlists++
+	}
+	for id := range in.Liked {
+		if !s.Liked[id] {
+			s.Liked[id] = true
+			r.Liked++
+		}
+	}
+	for id, stars := range in.Ratings {
+		if local, ok := s.Ratings[id]; ok {
+			if local != stars {
+				r.KeptRatings++
+			}
+			continue
+		}
+		s.Ratings[id] = stars
+		r.Ratings++
+	}
+	for id, ms := range in.LyricsOffsets {
+		if local, ok := s.LyricsOffsets[id]; ok {
+			if local != ms {
+				r.KeptOffsets++
+			}
+			continue
+		}
+		s.LyricsOffsets[id] = ms
+	}
+	// Both sides may count the same plays, as with a backup of this very
+	// profile, so counts are not added up
+	for id, ps := range in.Stats {
+		local := s.Stats[id]
+		local.Plays = max(local.Plays, ps.Plays)
+		local.Skips = max(local.Skips, ps.Skips)
+		if ps.LastPlayed.After(local.LastPlayed) {
+			local.LastPlayed = ps.LastPlayed
+		}
+		s.Stats[id] = local
+	}
+	for id, m := range in.Matches {
+		if _, ok := s.Matches[id]; !ok {
+			s.Matches[id] = m
+		}
+	}
+	return r
+}
+
+// HistoryIn returns the plays of the archive with the paths of the tracks in
+// lib, for history.Log.Import; ids is the result of Resolve.
+func (a *Archive) HistoryIn(lib *library.Index, ids map[string]string) []history.Entry {
+	out := make([]history.Entry, 0, len(a.History))
+	for _, e := range a.History {
+		t, _ := lib.ByID(ids[e.Path])
+		if t.Path == "" {
+			continue
+		}
+		e.Path, e.ID = t.Path, t.ID
+		out = append(out, e)
+	}
+	return out
+}
+
+// writeCover saves the archived cover file into dir under a name of its
+// own and returns its path.
+func (a *Archive) writeCover(file, dir string) (string, error) {
+	b, ok := a.covers[file]
+	if !ok {
+		return "", os.ErrNotExist
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, "cover-*"+path.Ext(file))
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// freeName returns "name (yedek)", "name (yedek 2)", ... whichever is not
+// taken.
+func freeName(name string, taken func(string) bool) string {
+	n := name + " (yedek)"
+	for i := 2; taken(n); i++ {
+		n = name + " (yedek " + strconv.Itoa(i) + ")"
+	}
+	return n
+}
+
+func sameSmart(a, b state.SmartPlaylist) bool {
+	return a.Match == b.Match && a.Limit == b.Limit && a.Sort == b.Sort && a.Desc == b.Desc && slices.Equal(a.Rules, b.Rules)
+}
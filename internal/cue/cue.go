@@ -0,0 +1,206 @@
+// Package cue parses CUE sheets that split a single-file album image into
+// tracks.
+package cue
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"opentify/internal/textenc"
+)
+
+// Sheet is a parsed CUE sheet.
+type Sheet struct {
+	Performer string
+	Title     string
+	Genre     string // REM GENRE
+	Year      int    // REM DATE
+	Disc      int    // REM DISCNUMBER
+	Files     []File
+}
+
+// File is a FILE entry with the tracks stored in it.
+type File struct {
+	Name   string // as written in the sheet, relative to it
+	Type   string // WAVE, MP3, ...
+	Tracks []Track
+}
+
+// Track is a TRACK entry.
+type Track struct {
+	Number    int
+	Title     string
+	Performer string
+	// Start is INDEX 01, the offset of the track in its file.
+	Start time.Duration
+}
+
+// ErrNoTracks is returned for sheets without any playable track.
+var ErrNoTracks = errors.New("cue: no tracks")
+
+// ParseFile reads and parses the sheet at path.
+func ParseFile(path string) (*Sheet, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(b)
+}
+
+// Parse parses a sheet. The encoding is detected (UTF-8, UTF-16 with BOM,
+// otherwise Windows-1254). Tracks without INDEX 01 are dropped. A track
+// belongs to the FILE its INDEX 01 is in: with gaps appended, rippers put
+// the pregap (INDEX 00) at the end of the previous file.
+func Parse(b []byte) (*Sheet, error) {
+	s := &Sheet{}
+	var track *Track
+	// Indexes into s.Files, which grows: the current FILE and the one of
+	// the open track's INDEX 01
+	file, trackFile := -1, -1
+	flush := func() {
+		if track != nil && trackFile >= 0 {
+			s.Files[trackFile].Tracks = append(s.Files[trackFile].Tracks, *track)
+		}
+		track, trackFile = nil, -1
+	}
+	for _, raw := range strings.Split(textenc.Decode(b), "\n") {
+		fields := splitFields(strings.TrimSpace(raw))
+		if len(fields) == 0 {
+			continue
+		}
+		arg := func(i int) string {
+			if i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+		switch strings.ToUpper(fields[0]) {
+		case "FILE":
+			s.Files = append(s.Files, File{Name: arg(1), Type: strings.ToUpper(arg(2))})
+			file = len(s.Files) - 1
+		case "TRACK":
+			flush()
+			n, _ := strconv.Atoi(arg(1))
+			if strings.EqualFold(arg(2), "AUDIO") || arg(2) == "" {
+				track = &Track{Number: n}
+			}
+		case "INDEX":
+			if track != nil && arg(1) == "01" && file >= 0 {
+				if d, ok := parseTime(arg(2)); ok {
+					track.Start, trackFile = d, file
+				}
+			}
+		case "TITLE":
+			if track != nil {
+				track.Title = arg(1)
+			} else {
+				s.Title = arg(1)
+			}
+		case "PERFORMER":
+			if track != nil {
+				track.Performer = arg(1)
+			} else {
+				s.Performer = arg(1)
+			}
+		case "REM":
+			switch strings.ToUpper(arg(1)) {
+			case "GENRE":
+				s.Genre = arg(2)
+			case "DATE":
+				if len(arg(2)) >= 4 {
+					s.Year, _ = strconv.Atoi(arg(2)[:4])
+				}
+			case "DISCNUMBER":
+				s.Disc, _ = strconv.Atoi(arg(2))
+			}
+		}
+	}
+	flush()
+	files := s.Files[:0]
+	for _, f := range s.Files {
+		if len(f.Tracks) > 0 {
+			files = append(files, f)
+		}
+	}
+	s.Files = files
+	if len(files) == 0 {
+		return nil, ErrNoTracks
+	}
+	return s, nil
+}
+
+// splitFields splits a line on spaces, keeping "quoted values" together.
+func splitFields(line string) []string {
+	var out []string
+	for line != "" {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			break
+		}
+		if line[0] == '"' {
+			end := strings.IndexByte(line[1:], '"')
+			if end < 0 {
+				out = append(out, line[1:])
+				break
+			}
+			out = append(out, line[1:end+1])
+			line = line[end+2:]
+			continue
+		}
+		end := strings.IndexFunc(line, unicode.IsSpace)
+		if end < 0 {
+			out = append(out, line)
+			break
+		}
+		out = append(out, line[:end])
+		line = line[end:]
+	}
+	return out
+}
+
+// parseTime parses "mm:ss:ff" with 75 frames per second.
+func parseTime(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return 0, false
+		}
+		n[i] = v
+	}
+	frames := (n[0]*60+n[1])*75 + n[2]
+	return time.Duration(frames) * time.Second / 75, true
+}
+
+// Resolve returns the audio file a FILE entry of the sheet at sheetPath
+// refers to. Rippers often write the name of the original WAV although
+// the image was later compressed, so a file with the same base name and
+// another audio extension is accepted too. ok is false when neither exists.
+func Resolve(sheetPath, name string, isMedia func(string) bool) (string, bool) {
+	dir := filepath.Dir(sheetPath)
+	p := filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(name, `\`, "/")))
+	if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+		return p, true
+	}
+	base := strings.TrimSuffix(filepath.Base(p), filepath.Ext(p))
+	entries, err := os.ReadDir(filepath.Dir(p))
+	if err != nil {
+		return "", false
+	}
+	for _, e := range entries {
+		n := e.Name()
+		if e.Type().IsRegular() && strings.EqualFold(strings.TrimSuffix(n, filepath.Ext(n)), base) && isMedia(n) {
+			return filepath.Join(filepath.Dir(p), n), true
+		}
+	}
+	return "", false
+}
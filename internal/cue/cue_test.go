@@ -0,0 +1,103 @@
+package cue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSingleFile(t *testing.T) {
+	s, err := Parse([]byte(`REM GENRE Rock
+REM DATE 1994
+PERFORMER "Band"
+TITLE "Album"
+FILE "album.flac" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    PERFORMER "Guest"
+    INDEX 00 03:59:00
+    INDEX 01 04:00:37
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Performer != "Band" || s.Title != "Album" || s.Genre != "Rock" || s.Year != 1994 {
+		t.Errorf("sheet = %+v", s)
+	}
+	if len(s.Files) != 1 || len(s.Files[0].Tracks) != 2 {
+		t.Fatalf("files = %+v", s.Files)
+	}
+	two := s.Files[0].Tracks[1]
+	if two.Title != "Two" || two.Performer != "Guest" || two.Start != 4*time.Minute+37*time.Second/75 {
+		t.Errorf("track 2 = %+v", two)
+	}
+}
+
+// EAC's "gaps appended" layout: the pregap of a track ends the previous
+// file, its INDEX 01 starts the next one.
+func TestParseMultiFilePregap(t *testing.T) {
+	s, err := Parse([]byte(`PERFORMER "Band"
+FILE "01 One.wav" WAVE
+  TRACK 01 AUDIO
+    TITLE "One"
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    TITLE "Two"
+    INDEX 00 03:58:20
+FILE "02 Two.wav" WAVE
+    INDEX 01 00:00:00
+  TRACK 03 AUDIO
+    TITLE "Three"
+    INDEX 00 04:10:00
+FILE "03 Three.wav" WAVE
+    INDEX 01 00:00:00
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		file  string
+		title string
+	}{{"01 One.wav", "One"}, {"02 Two.wav", "Two"}, {"03 Three.wav", "Three"}}
+	if len(s.Files) != len(want) {
+		t.Fatalf("files = %+v", s.Files)
+	}
+	for i, w := range want {
+		f := s.Files[i]
+		if f.Name != w.file || len(f.Tracks) != 1 || f.Tracks[0].Title != w.title || f.Tracks[0].Start != 0 {
+			t.Errorf("file %d = %+v, want %s with %q at 0", i, f, w.file, w.title)
+		}
+	}
+}
+
+func TestParseDropsTracksWithoutStart(t *testing.T) {
+	s, err := Parse([]byte(`FILE "a.wav" WAVE
+  TRACK 01 AUDIO
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 01:00:00
+FILE "b.wav" WAVE
+  TRACK 03 AUDIO
+    INDEX 01 00:00:00
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, f := range s.Files {
+		for _, tr := range f.Tracks {
+			got = append(got, tr.Number)
+		}
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 3 {
+		t.Errorf("tracks = %v, want [1 3]", got)
+	}
+}
+
+func TestParseNoTracks(t *testing.T) {
+	if _, err := Parse([]byte("TITLE \"Nothing\"\n")); err != ErrNoTracks {
+		t.Errorf("err = %v, want ErrNoTracks", err)
+	}
+}
@@ -23,6 +23,7 @@ type Client struct {
 	lastTrack          string
 	startTime          time.Time
 	lastConnectAttempt time.Time
+	disabled           bool
 }
 
 var (
@@ -43,7 +44,7 @@ func (c *Client) Connect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if c.connected {
+	if c.connected || c.disabled {
 		return nil
 	}
 
@@ -62,6 +63,10 @@ func (c *Client) UpdatePresence(trackPath string, artist string, title string, i
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.disabled {
+		return nil
+	}
+
 	if !c.connected {
 		// Opportunistic reconnect with a small cooldown to avoid spamming
 		if time.Since(c.lastConnectAttempt) > 2*time.Second && ipcAvailable() {
@@ -171,6 +176,20 @@ func (c *Client) Disconnect() {
 	}
 }
 
+// SetEnabled turns Rich Presence on or off. While it is off, presence
+// updates are dropped and no connection is attempted.
+func (c *Client) SetEnabled(on bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.disabled = !on
+	if !on && c.connected {
+		client.Logout()
+		c.connected = false
+		c.lastTrack = ""
+	}
+}
+
 // ipcAvailable checks for the presence of a Discord IPC socket on this OS.
 func ipcAvailable() bool {
 	switch runtime.GOOS {
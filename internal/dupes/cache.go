@@ -0,0 +1,113 @@
+package dupes
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"opentify/internal/audio"
+	"opentify/internal/library"
+)
+
+// FingerprintCache stores fingerprints on disk, one file per track named
+// after the SHA-1 of its path, so only new or modified files are decoded.
+type FingerprintCache struct {
+	dir string
+	mu  sync.Mutex
+	mem map[memKey]audio.Fingerprint
+}
+
+// memKey identifies a version of a file, so an edited file is decoded
+// again within a session too.
+type memKey struct {
+	path string
+	size int64
+	mod  int64
+}
+
+func keyOf(t library.Track) memKey {
+	return memKey{t.Path, t.Size, t.ModTime.UnixNano()}
+}
+
+// NewFingerprintCache returns a cache rooted at dir.
+func NewFingerprintCache(dir string) *FingerprintCache {
+	return &FingerprintCache{dir: dir, mem: map[memKey]audio.Fingerprint{}}
+}
+
+func (c *FingerprintCache) file(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+".fp")
+}
+
+// Get returns the fingerprint of t, computing it when the cached one is
+// missing or was made from a different size or modification time.
+func (c *FingerprintCache) Get(t library.Track) (audio.Fingerprint, error) {
+	c.mu.Lock()
+	fp, ok := c.mem[keyOf(t)]
+	c.mu.Unlock()
+	if ok {
+		return fp, nil
+	}
+	if fp, ok := c.load(t); ok {
+		c.remember(t, fp)
+		return fp, nil
+	}
+	var err error
+	if t.File != "" {
+		fp, err = audio.FingerprintSegment(t.File, t.Start, t.End-t.Start)
+	} else {
+		fp, err = audio.FingerprintFile(t.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.remember(t, fp)
+	if err := c.store(t, fp); err != nil {
+		return fp, err
+	}
+	return fp, nil
+}
+
+func (c *FingerprintCache) remember(t library.Track, fp audio.Fingerprint) {
+	c.mu.Lock()
+	c.mem[keyOf(t)] = fp
+	c.mu.Unlock()
+}
+
+// File layout: size (8 bytes), mtime in unix nanoseconds (8 bytes), then
+// the sub-fingerprints, all little-endian.
+func (c *FingerprintCache) load(t library.Track) (audio.Fingerprint, bool) {
+	b, err := os.ReadFile(c.file(t.Path))
+	if err != nil || len(b) < 16 || len(b)%2 != 0 {
+		return nil, false
+	}
+	if int64(binary.LittleEndian.Uint64(b)) != t.Size || int64(binary.LittleEndian.Uint64(b[8:])) != t.ModTime.UnixNano() {
+		return nil, false
+	}
+	b = b[16:]
+	fp := make(audio.Fingerprint, len(b)/2)
+	for i := range fp {
+		fp[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return fp, true
+}
+
+func (c *FingerprintCache) store(t library.Track, fp audio.Fingerprint) error {
+	if t.Size == 0 || t.ModTime.IsZero() {
+		return errors.New("dupes: track without size or mtime")
+	}
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+	b := make([]byte, 16+2*len(fp))
+	binary.LittleEndian.PutUint64(b, uint64(t.Size))
+	binary.LittleEndian.PutUint64(b[8:], uint64(t.ModTime.UnixNano()))
+	for i, v := range fp {
+		binary.LittleEndian.PutUint16(b[16+2*i:], v)
+	}
+	return os.WriteFile(c.file(t.Path), b, 0o644)
+}
@@ -0,0 +1,233 @@
+// Package dupes finds copies of the same song in the library (for example a
+// YouTube mp3 and a CD flac) using normalised tags, durations and acoustic
+// fingerprints.
+package dupes
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"opentify/internal/audio"
+	"opentify/internal/library"
+	"opentify/internal/search"
+)
+
+// Options tune Find. Zero values select the defaults.
+type Options struct {
+	// DurationTolerance is the largest length difference between copies
+	// (default 3s; YouTube uploads often carry a short intro or outro).
+	DurationTolerance time.Duration
+	// Acoustic enables fingerprints: tag matches are confirmed with them
+	// and differently tagged copies are found by sound alone.
+	Acoustic bool
+	// Threshold is the fingerprint similarity regarded as the same
+	// recording (default 0.75).
+	Threshold float64
+	// Progress is called while fingerprints are computed.
+	Progress func(done, total int)
+}
+
+// Group is a set of tracks believed to be the same song, best copy first.
+type Group struct {
+	Tracks []library.Track
+	// Acoustic is set when at least one pair was confirmed by sound.
+	Acoustic bool
+}
+
+// Bracketed title suffixes that do not make a different recording.
+var noiseRe = regexp.MustCompile(`(?i)[\(\[][^\)\]]*\b(official|video|audio|lyrics?|hd|hq|4k|klip|clip|visuali[sz]er|resmi|remaster(ed)?|explicit)\b[^\)\]]*[\)\]]`)
+
+// Key returns the normalised artist/title key of t. Untagged files fall
+// back to "Artist - Title" file names.
+func Key(t library.Track) string {
+	artist, title := t.PrimaryArtist(), t.Title
+	if title == "" {
+		base := strings.TrimSuffix(filepath.Base(t.Path), filepath.Ext(t.Path))
+		title = base
+		if a, ti, ok := strings.Cut(base, " - "); ok {
+			artist, title = a, ti
+		}
+	}
+	title = titleFeatRe.ReplaceAllString(noiseRe.ReplaceAllString(title, ""), "")
+	return normalize(artist) + "\x00" + normalize(title)
+}
+
+var titleFeatRe = regexp.MustCompile(`(?i)[\(\[]?\s*\b(feat\.?|ft\.?|featuring)\s.*$`)
+
+// normalize folds case and diacritics and keeps letters and digits only.
+func normalize(s string) string {
+	var b strings.Builder
+	for _, r := range search.Fold(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Find groups duplicate tracks. fps may be nil when opt.Acoustic is off.
+func Find(tracks []library.Track, fps *FingerprintCache, opt Options) []Group {
+	if opt.DurationTolerance == 0 {
+		opt.DurationTolerance = 3 * time.Second
+	}
+	if opt.Threshold == 0 {
+		opt.Threshold = 0.75
+	}
+	acoustic := opt.Acoustic && fps != nil
+
+	parent := make([]int, len(tracks))
+	for i := range parent {
+		parent[i] = i
+	}
+	var root func(int) int
+	root = func(i int) int {
+		if parent[i] != i {
+			parent[i] = root(parent[i])
+		}
+		return parent[i]
+	}
+	// confirmed is kept on roots; a merged root hands its flag on.
+	confirmed := map[int]bool{}
+	union := func(i, j int, byFP bool) {
+		ri, rj := root(i), root(j)
+		if ri != rj {
+			parent[ri] = rj
+			confirmed[rj] = confirmed[rj] || confirmed[ri]
+		}
+		if byFP {
+			confirmed[rj] = true
+		}
+	}
+	closeEnough := func(a, b library.Track) bool {
+		if a.Duration == 0 || b.Duration == 0 {
+			return true
+		}
+		d := a.Duration - b.Duration
+		return d <= opt.DurationTolerance && d >= -opt.DurationTolerance
+	}
+
+	// Fingerprints, computed up front so progress can be reported.
+	prints := make([]audio.Fingerprint, len(tracks))
+	if acoustic {
+		for i, t := range tracks {
+			prints[i], _ = fps.Get(t) // undecodable files just lack one
+			if opt.Progress != nil {
+				opt.Progress(i+1, len(tracks))
+			}
+		}
+	}
+	// similar is -1 when either fingerprint is missing.
+	similar := func(i, j int) float64 {
+		if prints[i] == nil || prints[j] == nil {
+			return -1
+		}
+		return audio.Similarity(prints[i], prints[j])
+	}
+
+	// Same normalised tags and a similar length.
+	byKey := map[string][]int{}
+	for i, t := range tracks {
+		k := Key(t)
+		if strings.HasSuffix(k, "\x00") {
+			continue // no usable title
+		}
+		byKey[k] = append(byKey[k], i)
+	}
+	for _, idx := range byKey {
+		for a := 0; a < len(idx); a++ {
+			for b := a + 1; b < len(idx); b++ {
+				i, j := idx[a], idx[b]
+				if !closeEnough(tracks[i], tracks[j]) {
+					continue
+				}
+				s := -1.0
+				if acoustic {
+					s = similar(i, j)
+					if s >= 0 && s < opt.Threshold {
+						continue // e.g. a live version under the same name
+					}
+				}
+				union(i, j, s >= opt.Threshold)
+			}
+		}
+	}
+
+	// Same sound under different tags: compare neighbours by length.
+	if acoustic {
+		order := make([]int, 0, len(tracks))
+		for i := range tracks {
+			if prints[i] != nil && tracks[i].Duration > 0 {
+				order = append(order, i)
+			}
+		}
+		sort.Slice(order, func(a, b int) bool { return tracks[order[a]].Duration < tracks[order[b]].Duration })
+		for a := range order {
+			for b := a + 1; b < len(order); b++ {
+				i, j := order[a], order[b]
+				if tracks[j].Duration-tracks[i].Duration > opt.DurationTolerance {
+					break
+				}
+				if root(i) != root(j) && similar(i, j) >= opt.Threshold {
+					union(i, j, true)
+				}
+			}
+		}
+	}
+
+	members := map[int][]library.Track{}
+	var roots []int
+	for i, t := range tracks {
+		r := root(i)
+		if members[r] == nil {
+			roots = append(roots, r)
+		}
+		members[r] = append(members[r], t)
+	}
+	var out []Group
+	for _, r := range roots {
+		if len(members[r]) < 2 {
+			continue
+		}
+		g := Group{Tracks: members[r], Acoustic: confirmed[r]}
+		SortBest(g.Tracks)
+		out = append(out, g)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return search.Fold(out[i].Tracks[0].DisplayTitle()) < search.Fold(out[j].Tracks[0].DisplayTitle())
+	})
+	return out
+}
+
+// lossless formats always win over lossy ones.
+var lossless = map[string]bool{"flac": true, "wav": true}
+
+// quality ranks a copy: lossless first, then bitrate, sample rate and how
+// completely it is tagged.
+func quality(t library.Track) int {
+	q := t.Bitrate
+	if lossless[t.Ext()] {
+		q += 100000
+	}
+	if t.Ext() == "mp4" {
+		q -= 1000 // video download; the audio-only copy is preferred
+	}
+	q += t.SampleRate / 1000
+	for _, s := range []string{t.Title, t.Artist, t.Album} {
+		if s != "" {
+			q += 5
+		}
+	}
+	if t.Year > 0 {
+		q += 5
+	}
+	return q
+}
+
+// SortBest orders copies best first.
+func SortBest(ts []library.Track) {
+	sort.SliceStable(ts, func(i, j int) bool { return quality(ts[i]) > quality(ts[j]) })
+}
@@ -0,0 +1,112 @@
+package dupes
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"opentify/internal/audio"
+	"opentify/internal/library"
+)
+
+func testPrint(seed uint16) audio.Fingerprint {
+	fp := make(audio.Fingerprint, 64)
+	for i := range fp {
+		fp[i] = uint16(i)*7919 ^ seed
+	}
+	return fp
+}
+
+// cached returns a track whose fingerprint is already on disk, so Find
+// does not decode anything.
+func cached(t *testing.T, c *FingerprintCache, path, title string, fp audio.Fingerprint) library.Track {
+	t.Helper()
+	tr := library.Track{Path: path, Artist: "Barış Manço", Title: title, Size: 100, ModTime: time.Unix(1700000000, 0)}
+	if fp != nil {
+		if err := c.store(tr, fp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tr
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		tr   library.Track
+		want string
+	}{
+		{library.Track{Artist: "Barış Manço", Title: "Gülpembe"}, "barismanco\x00gulpembe"},
+		{library.Track{Artist: "Barış Manço", Title: "Gülpembe (Official Video)"}, "barismanco\x00gulpembe"},
+		{library.Track{Artist: "Barış Manço", Title: "Gülpembe [Remastered 2019]"}, "barismanco\x00gulpembe"},
+		{library.Track{Artist: "Barış Manço", Title: "Gülpembe (Live)"}, "barismanco\x00gulpembelive"},
+		{library.Track{Artist: "Tarkan", Title: "Yolla feat. Someone"}, "tarkan\x00yolla"},
+		{library.Track{Path: "/m/Barış Manço - Gülpembe.mp3"}, "barismanco\x00gulpembe"},
+		{library.Track{Path: "/m/Gülpembe.mp3"}, "\x00gulpembe"},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.tr); got != tt.want {
+			t.Errorf("Key(%+v) = %q, want %q", tt.tr, got, tt.want)
+		}
+	}
+}
+
+func TestFindKeepsAcousticFlagAcrossUnions(t *testing.T) {
+	c := NewFingerprintCache(t.TempDir())
+	fp := testPrint(1)
+	tracks := []library.Track{
+		cached(t, c, "/m/a.mp3", "Gülpembe", fp),
+		cached(t, c, "/m/b.flac", "Gülpembe", fp),
+		cached(t, c, "/m/c.ogg", "Gülpembe", nil), // no fingerprint: a tag match only
+		cached(t, c, "/m/d.mp3", "Dönence", nil),
+		cached(t, c, "/m/e.mp3", "Dönence", nil),
+	}
+	groups := Find(tracks, c, Options{Acoustic: true})
+	if len(groups) != 2 {
+		t.Fatalf("%d groups, want 2", len(groups))
+	}
+	for _, g := range groups {
+		want := g.Tracks[0].Title == "Gülpembe"
+		if g.Acoustic != want || len(g.Tracks) != map[bool]int{true: 3, false: 2}[want] {
+			t.Errorf("%s: %d tracks, acoustic %v", g.Tracks[0].Title, len(g.Tracks), g.Acoustic)
+		}
+	}
+}
+
+func TestFindByTagsAndDuration(t *testing.T) {
+	tr := func(path, title string, d time.Duration) library.Track {
+		return library.Track{Path: path, Artist: "Cem Karaca", Title: title, Duration: d}
+	}
+	tracks := []library.Track{
+		tr("/m/a.mp3", "Tamirci Çırağı", 200*time.Second),
+		tr("/m/b.flac", "Tamirci Cirağı (Official Audio)", 202*time.Second),
+		tr("/m/c.mp3", "Tamirci Çırağı", 260*time.Second), // another recording
+		tr("/m/d.mp3", "Islak Islak", 0),
+	}
+	groups := Find(tracks, nil, Options{})
+	if len(groups) != 1 || len(groups[0].Tracks) != 2 || groups[0].Acoustic {
+		t.Fatalf("groups = %+v", groups)
+	}
+	if groups[0].Tracks[0].Path != "/m/b.flac" {
+		t.Errorf("best copy %s, want the flac", groups[0].Tracks[0].Path)
+	}
+}
+
+func TestFingerprintCacheChecksFileVersion(t *testing.T) {
+	c := NewFingerprintCache(t.TempDir())
+	path := filepath.Join(t.TempDir(), "missing.mp3")
+	tr := cached(t, c, path, "x", testPrint(2))
+	if fp, err := c.Get(tr); err != nil || len(fp) != 64 {
+		t.Fatalf("Get = %d, %v", len(fp), err)
+	}
+	// Once the file changes the remembered fingerprint is stale; the
+	// file is gone, so decoding fails.
+	tr.Size++
+	if fp, err := c.Get(tr); err == nil {
+		t.Errorf("changed file: got a %d long fingerprint", len(fp))
+	}
+	tr.Size--
+	tr.ModTime = tr.ModTime.Add(time.Second)
+	if _, err := c.Get(tr); err == nil {
+		t.Error("touched file: got the old fingerprint")
+	}
+}
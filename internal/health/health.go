@@ -0,0 +1,253 @@
+// Package health checks library files by decoding them completely and finds
+// playlist entries and likes that point to files which no longer exist.
+package health
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+
+	"opentify/internal/audio"
+	"opentify/internal/dupes"
+	"opentify/internal/library"
+	"opentify/internal/state"
+	"opentify/internal/tags"
+)
+
+// Kind classifies a problem with a file.
+type Kind int
+
+const (
+	Unreadable Kind = iota // cannot be opened or no decoder accepts it
+	Corrupt                // decoding failed part-way through
+	Truncated              // decodes to less audio than its header declares
+	Empty                  // zero bytes or no audio at all
+	BadTags                // the tag block cannot be parsed
+)
+
+// Issue is a problem found in one file.
+type Issue struct {
+	Path   string
+	Kind   Kind
+	Detail string
+	// Decoded and Expected are the decoded length and the length declared
+	// by the file; zero when unknown.
+	Decoded, Expected time.Duration
+}
+
+// Check decodes t completely and returns its problems, if any. Formats the
+// beep decoders do not handle (mp4) are only checked for being empty. CUE
+// sheet tracks are checked through their album image, see Scan.
+func Check(t library.Track) []Issue {
+	info, err := os.Stat(t.Path)
+	if err != nil {
+		return []Issue{{Path: t.Path, Kind: Unreadable, Detail: err.Error()}}
+	}
+	if info.Size() == 0 {
+		return []Issue{{Path: t.Path, Kind: Empty, Detail: "0 bytes"}}
+	}
+	if t.Ext() == "mp4" {
+		return nil
+	}
+
+	var out []Issue
+	expected := t.Duration
+	tg, err := tags.Read(t.Path)
+	switch {
+	case err != nil && !errors.Is(err, tags.ErrUnsupported):
+		out = append(out, Issue{Path: t.Path, Kind: BadTags, Detail: err.Error()})
+	case err == nil && tg.Duration > 0:
+		expected = tg.Duration
+	}
+
+	st, format, err := audio.Decode(t.Path)
+	if err != nil {
+		return append(out, Issue{Path: t.Path, Kind: Unreadable, Detail: err.Error(), Expected: expected})
+	}
+	defer st.Close()
+	n, derr := drain(st)
+	decoded := format.SampleRate.D(n)
+	switch {
+	case derr != nil:
+		out = append(out, Issue{Path: t.Path, Kind: Corrupt, Detail: derr.Error(), Decoded: decoded, Expected: expected})
+	case n == 0:
+		out = append(out, Issue{Path: t.Path, Kind: Empty, Detail: "no audio", Expected: expected})
+	case expected > 0 && decoded < expected-truncTolerance(expected):
+		out = append(out, Issue{Path: t.Path, Kind: Truncated, Decoded: decoded, Expected: expected})
+	}
+	return out
+}
+
+// truncTolerance allows for the inexact durations estimated from MP3
+// headers: 2s or 2%, whichever is larger.
+func truncTolerance(d time.Duration) time.Duration {
+	return max(2*time.Second, d/50)
+}
+
+// drain streams s to the end and returns the number of samples. io.EOF
+// reported by some decoders at the end is not an error.
+func drain(s beep.Streamer) (int, error) {
+	buf := make([][2]float64, 8192)
+	total := 0
+	for {
+		n, ok := s.Stream(buf)
+		total += n
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return total, err
+	}
+	return total, nil
+}
+
+// Scan checks tracks on several goroutines and returns the issues sorted by
+// path. Closing stop ends the scan early; progress may be nil.
+func Scan(tracks []library.Track, stop <-chan struct{}, progress func(done, total int)) []Issue {
+	// The tracks of a CUE sheet share one image, which is decoded once.
+	images := map[string]bool{}
+	files := tracks[:0:0]
+	for _, t := range tracks {
+		if t.File == "" {
+			files = append(files, t)
+		} else if !images[t.File] {
+			images[t.File] = true
+			files = append(files, library.Track{Path: t.File})
+		}
+	}
+	tracks = files
+	jobs := make(chan library.Track)
+	var (
+		mu   sync.Mutex
+		out  []Issue
+		done int
+		wg   sync.WaitGroup
+	)
+	for range max(1, runtime.NumCPU()/2) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range jobs {
+				found := Check(t)
+				mu.Lock()
+				out = append(out, found...)
+				done++
+				d := done
+				mu.Unlock()
+				if progress != nil {
+					progress(d, len(tracks))
+				}
+			}
+		}()
+	}
+feed:
+	for _, t := range tracks {
+		select {
+		case jobs <- t:
+		case <-stop:
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Ref is a track referenced by the user's data whose file no longer exists.
+type Ref struct {
+	ID        string
+	Path      string   // last known location, "" if never seen
+	Playlists []string // playlists containing it, sorted
+	Liked     bool
+}
+
+// Missing lists the tracks in playlists and likes of st whose files are
+// gone from lib or from the disk.
+func Missing(st *state.State, lib *library.Index) []Ref {
+	refs := map[string]*Ref{}
+	exists := map[string]bool{}
+	gone := func(id string) bool {
+		ok, seen := exists[id]
+		if !seen {
+			t, present := lib.ByID(id)
+			if present {
+				_, err := os.Stat(library.DiskPath(t.Path))
+				present = err == nil
+			}
+			ok = present
+			exists[id] = ok
+		}
+		return !ok
+	}
+	ref := func(id string) *Ref {
+		if refs[id] == nil {
+			t, _ := lib.ByID(id)
+			refs[id] = &Ref{ID: id, Path: t.Path}
+		}
+		return refs[id]
+	}
+	for name, ids := range st.Playlists {
+		for _, id := range ids {
+			if gone(id) {
+				r := ref(id)
+				if len(r.Playlists) == 0 || r.Playlists[len(r.Playlists)-1] != name {
+					r.Playlists = append(r.Playlists, name)
+				}
+			}
+		}
+	}
+	for id, liked := range st.Liked {
+		if liked && gone(id) {
+			ref(id).Liked = true
+		}
+	}
+	out := make([]Ref, 0, len(refs))
+	for _, r := range refs {
+		sort.Strings(r.Playlists)
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
+
+// Suggest returns the library file a missing path most likely moved to: the
+// only track with the same file name, or else the only one with the same
+// artist/title key. ok is false when there is no unambiguous candidate.
+func Suggest(missing string, tracks []library.Track) (string, bool) {
+	if missing == "" {
+		return "", false
+	}
+	base := strings.ToLower(filepath.Base(missing))
+	var match []string
+	for _, t := range tracks {
+		if strings.ToLower(filepath.Base(t.Path)) == base {
+			match = append(match, t.Path)
+		}
+	}
+	if len(match) == 1 {
+		return match[0], true
+	}
+	if len(match) > 1 {
+		return "", false
+	}
+	key := dupes.Key(library.Track{Path: missing})
+	for _, t := range tracks {
+		if dupes.Key(t) == key {
+			match = append(match, t.Path)
+		}
+	}
+	if len(match) == 1 {
+		return match[0], true
+	}
+	return "", false
+}
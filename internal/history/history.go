@@ -0,0 +1,332 @@
+// Package history records what was played, for how long and whether the
+// play counts towards the statistics.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Entry is one play of a track.
+type Entry struct {
+	Path string `json:"path"` // the file as it was played
+	// ID is the library ID of the track (library.Track.ID), which follows
+	// the file when it is moved. Entries of older logs lack it until
+	// AssignIDs.
+	ID       string        `json:"id,omitempty"`
+	Start    time.Time     `json:"start"`
+	Listened time.Duration `json:"listened"` // audio actually heard; seeks are not included
+	Duration time.Duration `json:"duration,omitempty"`
+
+	Completed bool `json:"completed,omitempty"` // played to the end
+	Skipped   bool `json:"skipped,omitempty"`   // left for another track before it counted
+	Counted   bool `json:"counted,omitempty"`   // passed the play threshold
+}
+
+// Threshold returns how long a track of length d has to be listened to for
+// the play to count: half of it, at most four minutes. Tracks of unknown
+// length need 30 seconds.
+func Threshold(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 30 * time.Second
+	}
+	return min(d/2, 4*time.Minute)
+}
+
+// Outcome says how a play ended.
+type Outcome int
+
+const (
+	Interrupted Outcome = iota // stopped or the app was closed
+	Completed                  // the track played to its end
+	Skipped                    // another track was started
+)
+
+// maxStep is the largest position change that still counts as listening;
+// bigger jumps are seeks.
+const maxStep = 2 * time.Second
+
+// Session follows the track that is playing now. The zero value is idle.
+type Session struct {
+	cur     *Entry
+	last    time.Duration
+	havePos bool
+}
+
+// Begin starts following path. A play that is still open is ended as
+// skipped and returned with ok set.
+func (s *Session) Begin(path string, dur time.Duration, now time.Time) (prev Entry, ok bool) {
+	prev, ok = s.End(Skipped)
+	s.cur = &Entry{Path: path, Start: now, Duration: dur}
+	return prev, ok
+}
+
+// Observe records the playback position of path. Positions of other files
+// are ignored, as are jumps caused by seeking.
+func (s *Session) Observe(path string, pos time.Duration) {
+	if s.cur == nil || s.cur.Path != path {
+		return
+	}
+	if s.havePos && pos > s.last && pos-s.last <= maxStep {
+		s.cur.Listened += pos - s.last
+	}
+	s.last, s.havePos = pos, true
+}
+
+// Path returns the track of the open play, "" when there is none.
+func (s *Session) Path() string {
+	if s.cur == nil {
+		return ""
+	}
+	return s.cur.Path
+}
+
+// End closes the open play, if any, and classifies it.
+func (s *Session) End(how Outcome) (Entry, bool) {
+	if s.cur == nil {
+		return Entry{}, false
+	}
+	e := *s.cur
+	s.cur, s.last, s.havePos = nil, 0, false
+	e.Counted = e.Listened >= Threshold(e.Duration)
+	e.Completed = how == Completed
+	e.Skipped = how == Skipped && !e.Counted
+	return e, true
+}
+
+// Log is the append-only play log, one JSON entry per line.
+type Log struct {
+	path string
+
+	mu      sync.Mutex
+	entries []Entry // oldest first
+	partial bool    // the file does not end in a newline
+}
+
+// Open reads the log at path. A missing file is an empty log; lines that
+// do not parse (e.g. cut off by a crash) are skipped, and the next entry
+// starts on a line of its own.
+func Open(path string) (*Log, error) {
+	entries, partial, err := read(path)
+	return &Log{path: path, entries: entries, partial: partial}, err
+}
+
+// Switch makes l the log at path, for example another user's.
+func (l *Log) Switch(path string) error {
+	entries, partial, err := read(path)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.path, l.entries, l.partial = path, entries, partial
+	return err
+}
+
+// read returns the entries of the log at path and whether its last line
+// lacks a newline.
+func read(path string) ([]Entry, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	defer f.Close()
+	var entries []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) == nil && e.Path != "" {
+			entries = append(entries, e)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return entries, false, err
+	}
+	return entries, !endsInNewline(f), nil
+}
+
+// endsInNewline reports whether f is empty or its last byte is '\n'.
+func endsInNewline(f *os.File) bool {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() == 0 {
+		return true
+	}
+	var last [1]byte
+	_, err = f.ReadAt(last[:], fi.Size()-1)
+	return err != nil || last[0] == '\n'
+}
+
+// Append adds e to the log and the file.
+func (l *Log) Append(e Entry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	line := append(b, '\n')
+	if l.partial {
+		line = append([]byte{'\n'}, line...)
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	l.partial = false
+	return f.Close()
+}
+
+// Recent returns the IDs of up to n distinct tracks, most recently played
+// first. Skipped plays and plays without an ID are left out.
+func (l *Log) Recent(n int) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []string
+	seen := map[string]bool{}
+	for i := len(l.entries) - 1; i >= 0 && len(out) < n; i-- {
+		e := l.entries[i]
+		if e.Skipped || e.ID == "" || seen[e.ID] {
+			continue
+		}
+		seen[e.ID] = true
+		out = append(out, e.ID)
+	}
+	return out
+}
+
+// AssignIDs gives the entries of logs from before track IDs the ID of
+// their file, id(path), and rewrites the file. It reports whether any
+// entry changed.
+func (l *Log) AssignIDs(id func(path string) string) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed := false
+	for i, e := range l.entries {
+		if e.ID == "" {
+			if l.entries[i].ID = id(e.Path); l.entries[i].ID != "" {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+	return true, l.rewrite()
+}
+
+// Entries returns a copy of the log, oldest first.
+func (l *Log) Entries() []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Entry(nil), l.entries...)
+}
+
+// Import adds entries to the log, or replaces the log with them when
+// replace is set, and returns how many were added. Entries already in the
+// log (same track, by ID or else by path, and start) are skipped; the log
+// is kept in order of start.
+func (l *Log) Import(entries []Entry, replace bool) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if replace {
+		l.entries = nil
+	}
+	type key struct {
+		track string
+		start time.Time
+	}
+	keyOf := func(e Entry) key {
+		if e.ID != "" {
+			return key{e.ID, e.Start.UTC()}
+		}
+		return key{"path:" + e.Path, e.Start.UTC()}
+	}
+	seen := map[key]bool{}
+	for _, e := range l.entries {
+		seen[keyOf(e)] = true
+	}
+	added := 0
+	for _, e := range entries {
+		k := keyOf(e)
+		if seen[k] || e.Path == "" {
+			continue
+		}
+		seen[k] = true
+		l.entries = append(l.entries, e)
+		added++
+	}
+	sort.SliceStable(l.entries, func(i, j int) bool { return l.entries[i].Start.Before(l.entries[j].Start) })
+	if added == 0 && !replace {
+		return 0, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o755); err != nil {
+		return added, err
+	}
+	return added, l.rewrite()
+}
+
+// Rename rewrites the entries of moved files (old path -> new path) and
+// the file behind the log.
+func (l *Log) Rename(m map[string]string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	changed := false
+	for i, e := range l.entries {
+		if np, ok := m[e.Path]; ok {
+			l.entries[i].Path = np
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return l.rewrite()
+}
+
+// rewrite replaces the file with the in-memory entries. Callers hold l.mu.
+func (l *Log) rewrite() error {
+	tmp := l.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range l.entries {
+		if err := enc.Encode(e); err != nil {
+			f.Close()
+			os.Remove(tmp)
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, l.path); err != nil {
+		return err
+	}
+	l.partial = false
+	return nil
+}
@@ -0,0 +1,192 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendAfterPartialLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	// The last write was cut off by a crash
+	data := `{"path":"a.mp3","start":"2024-06-15T12:00:00Z","listened":1000000000}` + "\n" + `{"path":"b.mp3","sta`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(l.Entries()); n != 1 {
+		t.Fatalf("%d entries, want 1", n)
+	}
+	for _, p := range []string{"c.mp3", "d.mp3"} {
+		if err := l.Append(Entry{Path: p, Start: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range l.Entries() {
+		got = append(got, e.Path)
+	}
+	if strings.Join(got, " ") != "a.mp3 c.mp3 d.mp3" {
+		t.Errorf("entries %v after reopening", got)
+	}
+	b, _ := os.ReadFile(path)
+	if lines := strings.Split(string(b), "\n"); len(lines) != 5 || lines[1] != `{"path":"b.mp3","sta` {
+		t.Errorf("file:\n%s", b)
+	}
+}
+
+func TestSession(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		dur       time.Duration
+		positions []time.Duration
+		how       Outcome
+		want      Entry
+	}{
+		{"played through", 60 * time.Second, steps(0, 60*time.Second), Completed,
+			Entry{Listened: 60 * time.Second, Completed: true, Counted: true}},
+		{"skipped early", 60 * time.Second, steps(0, 10*time.Second), Skipped,
+			Entry{Listened: 10 * time.Second, Skipped: true}},
+		{"skipped after the threshold", 60 * time.Second, steps(0, 40*time.Second), Skipped,
+			Entry{Listened: 40 * time.Second, Counted: true}},
+		{"seeks are not listening", 600 * time.Second, append(steps(0, 5*time.Second), steps(500*time.Second, 510*time.Second)...), Interrupted,
+			Entry{Listened: 15 * time.Second}},
+		{"unknown length", 0, steps(0, 30*time.Second), Interrupted,
+			Entry{Listened: 30 * time.Second, Counted: true}},
+	}
+	for _, tt := range tests {
+		var s Session
+		s.Begin("a.mp3", tt.dur, now)
+		s.Observe("other.mp3", time.Second) // ignored
+		for _, p := range tt.positions {
+			s.Observe("a.mp3", p)
+		}
+		got, ok := s.End(tt.how)
+		tt.want.Path, tt.want.Start, tt.want.Duration = "a.mp3", now, tt.dur
+		if !ok || got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+		if _, ok := s.End(Interrupted); ok {
+			t.Errorf("%s: ended twice", tt.name)
+		}
+	}
+}
+
+// steps returns the positions from a to b one second apart.
+func steps(a, b time.Duration) []time.Duration {
+	var out []time.Duration
+	for p := a; p <= b; p += time.Second {
+		out = append(out, p)
+	}
+	return out
+}
+
+func TestThreshold(t *testing.T) {
+	tests := []struct{ d, want time.Duration }{
+		{0, 30 * time.Second},
+		{3 * time.Minute, 90 * time.Second},
+		{20 * time.Minute, 4 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := Threshold(tt.d); got != tt.want {
+			t.Errorf("Threshold(%v) = %v, want %v", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestAssignIDsAndRecent(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	// A log from before track IDs
+	old := `{"path":"/m/a.mp3","start":"2024-01-01T10:00:00Z","listened":60000000000,"counted":true}
+{"path":"/m/b.mp3","start":"2024-01-01T10:05:00Z","listened":60000000000,"counted":true}
+{"path":"/m/a.mp3","start":"2024-01-01T10:10:00Z","listened":1000000000,"skipped":true}
+`
+	if err := os.WriteFile(path, []byte(old), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := l.Recent(10); len(got) != 0 {
+		t.Errorf("Recent before IDs = %v, want none", got)
+	}
+	ids := map[string]string{"/m/a.mp3": "id-a", "/m/b.mp3": "id-b"}
+	changed, err := l.AssignIDs(func(p string) string { return ids[p] })
+	if err != nil || !changed {
+		t.Fatalf("AssignIDs = %v, %v", changed, err)
+	}
+	if changed, _ := l.AssignIDs(func(p string) string { return ids[p] }); changed {
+		t.Error("second AssignIDs changed entries")
+	}
+
+	// The file was moved; new plays come from its new path
+	if err := l.Append(Entry{Path: "/m/moved/a.mp3", ID: "id-a", Start: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), Counted: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := l.Recent(10), []string{"id-a", "id-b"}; !slices.Equal(got, want) {
+		t.Errorf("Recent = %v, want %v", got, want)
+	}
+
+	// The IDs are in the file
+	again, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range again.Entries() {
+		if e.ID == "" {
+			t.Errorf("entry %+v without ID after reopening", e)
+		}
+	}
+}
+
+func TestSwitchAfterPartialLine(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(filepath.Join(dir, "a.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(dir, "b.jsonl")
+	if err := os.WriteFile(other, []byte(`{"path":"x.mp3","sta`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Switch(other); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(Entry{Path: "y.mp3", Start: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if l, err = Open(other); err != nil || len(l.Entries()) != 1 || l.Entries()[0].Path != "y.mp3" {
+		t.Errorf("after Switch: %+v, %v", l.Entries(), err)
+	}
+}
+
+func TestImportMatchesByID(t *testing.T) {
+	l, err := Open(filepath.Join(t.TempDir(), "history.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	if err := l.Append(Entry{Path: "/old/a.mp3", ID: "id-a", Start: start}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := l.Import([]Entry{
+		{Path: "/new/a.mp3", ID: "id-a", Start: start},                // the same play, from another path
+		{Path: "/new/a.mp3", ID: "id-a", Start: start.Add(time.Hour)}, // another play
+	}, false)
+	if err != nil || n != 1 {
+		t.Errorf("Import = %d, %v, want 1 added", n, err)
+	}
+}
@@ -0,0 +1,285 @@
+package library
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// VariousArtists is the album artist used for compilations.
+const VariousArtists = "Various Artists"
+
+// Group is a named set of tracks shown by the browse views.
+type Group struct {
+	Name   string
+	Tracks []Track
+}
+
+// Album is a set of tracks sharing album title and album artist, ordered by
+// disc and track number.
+type Album struct {
+	Title       string
+	Artist      string
+	Year        int
+	Compilation bool
+	Tracks      []Track
+}
+
+// Duration is the summed length of the album's tracks.
+func (a Album) Duration() time.Duration {
+	var d time.Duration
+	for _, t := range a.Tracks {
+		d += t.Duration
+	}
+	return d
+}
+
+// Key identifies the album independently of letter case.
+func (a Album) Key() string {
+	return fold(a.Artist) + "\x00" + fold(a.Title)
+}
+
+var (
+	// "A feat. B", "A ft B", "A featuring B"
+	featRe = regexp.MustCompile(`(?i)\s+(?:feat\.?|ft\.?|featuring)\s+`)
+	// "(feat. B)" or "[ft. B]" inside a title
+	titleFeatRe = regexp.MustCompile(`(?i)[\(\[]\s*(?:feat\.?|ft\.?|featuring)\s+([^\)\]]+)[\)\]]`)
+)
+
+// SplitArtists splits an artist credit into individual names. Multi-value
+// tags (joined with ";") and "feat." credits are split; "&", "," and "/" are
+// kept because they are commonly part of a band name.
+func SplitArtists(s string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(name string) {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[fold(name)] {
+			return
+		}
+		seen[fold(name)] = true
+		out = append(out, name)
+	}
+	for _, part := range strings.Split(s, ";") {
+		for _, name := range featRe.Split(part, -1) {
+			add(name)
+		}
+	}
+	return out
+}
+
+// Artists returns every credited artist of t, including "feat." guests named
+// in the title.
+func (t Track) Artists() []string {
+	names := SplitArtists(t.Artist)
+	for _, m := range titleFeatRe.FindAllStringSubmatch(t.Title, -1) {
+		for _, n := range strings.Split(m[1], ",") {
+			for _, a := range SplitArtists(strings.ReplaceAll(n, " & ", ";")) {
+				if !containsFold(names, a) {
+					names = append(names, a)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// PrimaryArtist is the first credited artist, or "" when untagged.
+func (t Track) PrimaryArtist() string {
+	if a := SplitArtists(t.Artist); len(a) > 0 {
+		return a[0]
+	}
+	return ""
+}
+
+// ResolvedAlbumArtist returns the album artist tag, VariousArtists for
+// flagged compilations, or the primary artist.
+func (t Track) ResolvedAlbumArtist() string {
+	switch {
+	case t.AlbumArtist != "":
+		return t.AlbumArtist
+	case t.Compilation:
+		return VariousArtists
+	}
+	return t.PrimaryArtist()
+}
+
+// Artists groups tracks by every credited artist.
+func (ix *Index) Artists() []Group {
+	return groupBy(ix.Tracks(), Track.Artists)
+}
+
+// AlbumArtists groups tracks by their resolved album artist, so guest
+// appearances do not create separate entries.
+func (ix *Index) AlbumArtists() []Group {
+	albums := ix.Albums()
+	byArtist := map[string]*Group{}
+	var order []string
+	for _, a := range albums {
+		k := fold(a.Artist)
+		g, ok := byArtist[k]
+		if !ok {
+			g = &Group{Name: a.Artist}
+			byArtist[k] = g
+			order = append(order, k)
+		}
+		g.Tracks = append(g.Tracks, a.Tracks...)
+	}
+	out := make([]Group, 0, len(order))
+	for _, k := range order {
+		out = append(out, *byArtist[k])
+	}
+	sortGroups(out)
+	return out
+}
+
+// Genres groups tracks by genre; multi-valued genres appear in each group.
+func (ix *Index) Genres() []Group {
+	return groupBy(ix.Tracks(), func(t Track) []string {
+		var out []string
+		for _, g := range strings.Split(t.Genre, ";") {
+			if g = strings.TrimSpace(g); g != "" {
+				out = append(out, g)
+			}
+		}
+		return out
+	})
+}
+
+// Decades groups tracks by decade; Name is the first year ("1990").
+func (ix *Index) Decades() []Group {
+	out := groupBy(ix.Tracks(), func(t Track) []string {
+		if t.Year <= 0 {
+			return nil
+		}
+		d := t.Year / 10 * 10
+		return []string{strconv.Itoa(d)}
+	})
+	sort.Slice(out, func(i, j int) bool { return out[i].Name > out[j].Name })
+	return out
+}
+
+// Albums groups tagged tracks into albums. Tracks without an album artist
+// that share an album title and folder but not an artist are treated as a
+// compilation credited to VariousArtists.
+func (ix *Index) Albums() []Album {
+	tracks := ix.Tracks()
+
+	// Decide the album artist of untagged compilations per folder first.
+	type folderKey struct{ album, dir string }
+	folderArtists := map[folderKey]map[string]bool{}
+	for _, t := range tracks {
+		if t.Album == "" || t.AlbumArtist != "" || t.Compilation {
+			continue
+		}
+		k := folderKey{fold(t.Album), filepath.Dir(t.Path)}
+		if folderArtists[k] == nil {
+			folderArtists[k] = map[string]bool{}
+		}
+		folderArtists[k][fold(t.PrimaryArtist())] = true
+	}
+
+	byKey := map[string]*Album{}
+	var order []string
+	for _, t := range tracks {
+		if t.Album == "" {
+			continue
+		}
+		artist := t.ResolvedAlbumArtist()
+		comp := t.Compilation || artist == VariousArtists
+		if t.AlbumArtist == "" && !t.Compilation {
+			if len(folderArtists[folderKey{fold(t.Album), filepath.Dir(t.Path)}]) > 1 {
+				artist, comp = VariousArtists, true
+			}
+		}
+		k := fold(artist) + "\x00" + fold(t.Album)
+		a, ok := byKey[k]
+		if !ok {
+			a = &Album{Title: t.Album, Artist: artist}
+			byKey[k] = a
+			order = append(order, k)
+		}
+		a.Compilation = a.Compilation || comp
+		if t.Year > a.Year {
+			a.Year = t.Year
+		}
+		a.Tracks = append(a.Tracks, t)
+	}
+
+	out := make([]Album, 0, len(order))
+	for _, k := range order {
+		a := byKey[k]
+		SortAlbumOrder(a.Tracks)
+		out = append(out, *a)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if ai, aj := fold(out[i].Artist), fold(out[j].Artist); ai != aj {
+			return ai < aj
+		}
+		if out[i].Year != out[j].Year {
+			return out[i].Year < out[j].Year
+		}
+		return fold(out[i].Title) < fold(out[j].Title)
+	})
+	return out
+}
+
+// SortAlbumOrder orders tracks by album, disc, track number and path.
+func SortAlbumOrder(ts []Track) {
+	sort.SliceStable(ts, func(i, j int) bool {
+		a, b := ts[i], ts[j]
+		if fa, fb := fold(a.Album), fold(b.Album); fa != fb {
+			return fa < fb
+		}
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		if a.TrackNo != b.TrackNo {
+			return a.TrackNo < b.TrackNo
+		}
+		return a.Path < b.Path
+	})
+}
+
+func groupBy(tracks []Track, keys func(Track) []string) []Group {
+	byKey := map[string]*Group{}
+	var order []string
+	for _, t := range tracks {
+		for _, name := range keys(t) {
+			k := fold(name)
+			g, ok := byKey[k]
+			if !ok {
+				g = &Group{Name: name}
+				byKey[k] = g
+				order = append(order, k)
+			}
+			g.Tracks = append(g.Tracks, t)
+		}
+	}
+	out := make([]Group, 0, len(order))
+	for _, k := range order {
+		g := byKey[k]
+		SortAlbumOrder(g.Tracks)
+		out = append(out, *g)
+	}
+	sortGroups(out)
+	return out
+}
+
+func sortGroups(gs []Group) {
+	sort.SliceStable(gs, func(i, j int) bool { return fold(gs[i].Name) < fold(gs[j].Name) })
+}
+
+func fold(s string) string { return strings.ToLower(strings.TrimSpace(s)) }
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if fold(v) == fold(s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package library
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"opentify/internal/cue"
+	"opentify/internal/tags"
+)
+
+// CuePath returns the path of track n of the CUE sheet at sheet.
+func CuePath(sheet string, n int) string {
+	return sheet + "#" + strconv.Itoa(n)
+}
+
+// SplitCue splits a CUE track path into its sheet and track number.
+func SplitCue(path string) (sheet string, n int, ok bool) {
+	i := strings.LastIndexByte(path, '#')
+	if i < 0 || !strings.EqualFold(filepath.Ext(path[:i]), ".cue") {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(path[i+1:])
+	if err != nil {
+		return "", 0, false
+	}
+	return path[:i], n, true
+}
+
+// IsCue reports whether path names a CUE sheet track.
+func IsCue(path string) bool {
+	_, _, ok := SplitCue(path)
+	return ok
+}
+
+// DiskPath returns the file whose existence decides whether path is still
+// valid: the sheet for CUE tracks, path itself otherwise.
+func DiskPath(path string) string {
+	if sheet, _, ok := SplitCue(path); ok {
+		return sheet
+	}
+	return path
+}
+
+// cueTracks builds the virtual tracks of a CUE sheet. Sheet-level
+// PERFORMER/TITLE become album artist and album, falling back to the tags
+// of the image. Size and ModTime combine the sheet and its audio files so
+// editing either is noticed by Scan.
+func cueTracks(sheet string, info os.FileInfo) []*Track {
+	s, err := cue.ParseFile(sheet)
+	if err != nil {
+		return nil
+	}
+	playable := func(name string) bool {
+		return IsMedia(name) && !strings.EqualFold(filepath.Ext(name), ".mp4")
+	}
+	first := func(vals ...string) string {
+		for _, v := range vals {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	var out []*Track
+	seen := map[int]bool{}
+	for _, f := range s.Files {
+		audio, ok := cue.Resolve(sheet, f.Name, playable)
+		if !ok {
+			continue
+		}
+		ainfo, err := os.Stat(audio)
+		if err != nil {
+			continue
+		}
+		tg, _ := tags.Read(audio)
+		mod := info.ModTime()
+		if ainfo.ModTime().After(mod) {
+			mod = ainfo.ModTime()
+		}
+		for i, ct := range f.Tracks {
+			if seen[ct.Number] {
+				continue
+			}
+			seen[ct.Number] = true
+			t := &Track{
+				Path:        CuePath(sheet, ct.Number),
+				File:        audio,
+				Start:       ct.Start,
+				Title:       ct.Title,
+				Artist:      first(ct.Performer, s.Performer, tg.Artist),
+				AlbumArtist: first(s.Performer, tg.AlbumArtist),
+				Album:       first(s.Title, tg.Album),
+				Genre:       first(s.Genre, tg.Genre),
+				Year:        s.Year,
+				TrackNo:     ct.Number,
+				Disc:        s.Disc,
+				Bitrate:     tg.Bitrate,
+				SampleRate:  tg.SampleRate,
+				Size:        info.Size() + ainfo.Size(),
+				ModTime:     mod,
+			}
+			if t.Year == 0 {
+				t.Year = tg.Year
+			}
+			if i+1 < len(f.Tracks) {
+				t.End = f.Tracks[i+1].Start
+				t.Duration = t.End - t.Start
+			} else if tg.Duration > t.Start {
+				t.Duration = tg.Duration - t.Start
+			}
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,195 @@
+package library
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"opentify/internal/tags"
+)
+
+// hashSample is the number of bytes hashed at the start, middle and end of
+// the audio data.
+const hashSample = 64 << 10
+
+// newID returns a random UUID (version 4) for a track seen for the first
+// time.
+func newID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// audioHash fingerprints the audio data of the file at path from its length
+// and samples of its start, middle and end. Tags are left out where the
+// format allows (see tags.AudioRange), so the hash survives tag edits as
+// well as moves.
+func audioHash(path string) (string, error) {
+	start, end, err := tags.AudioRange(path)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n := end - start
+	_ = binary.Write(h, binary.LittleEndian, n)
+	// Small files are hashed whole
+	offsets, size := []int64{start}, n
+	if n > 3*hashSample {
+		offsets, size = []int64{start, start + n/2 - hashSample/2, end - hashSample}, hashSample
+	}
+	for _, off := range offsets {
+		if _, err := io.Copy(h, io.NewSectionReader(f, off, size)); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// hashTrack sets t.Hash. hashes caches the hashes of album images shared
+// by CUE tracks.
+func hashTrack(t *Track, hashes map[string]string) {
+	audio := t.AudioFile()
+	h, ok := hashes[audio]
+	if !ok {
+		h, _ = audioHash(audio)
+		hashes[audio] = h
+	}
+	if h != "" && t.File != "" {
+		h += "#" + strconv.Itoa(t.TrackNo)
+	}
+	t.Hash = h
+}
+
+// identify gives t an ID: old's when t replaces the entry of the same
+// path, the ID of a lost track with the same hash when the file was moved
+// here, a new one otherwise. The caller holds ix.mu.
+func (ix *Index) identify(t, old *Track) {
+	switch {
+	case old != nil && old.ID != "":
+		t.ID = old.ID
+	case t.Hash != "" && ix.relink(t):
+	default:
+		t.ID = newID()
+	}
+	ix.ids[t.ID] = t.Path
+}
+
+// relink takes over the ID and added date of a lost track with t's hash.
+// The caller holds ix.mu.
+func (ix *Index) relink(t *Track) bool {
+	for id, l := range ix.lost {
+		if l.Hash != t.Hash {
+			continue
+		}
+		t.ID = id
+		if !l.Added.IsZero() {
+			t.Added = l.Added
+		}
+		delete(ix.lost, id)
+		return true
+	}
+	return false
+}
+
+// ID returns the ID of the indexed track at path, "" if there is none.
+func (ix *Index) ID(path string) string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if t := ix.tracks[path]; t != nil {
+		return t.ID
+	}
+	return ""
+}
+
+// ByID returns the track with the given ID. present is false for tracks
+// whose file is gone; their last known entry is returned then, or a zero
+// Track for unknown IDs.
+func (ix *Index) ByID(id string) (t Track, present bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	if p, ok := ix.ids[id]; ok {
+		if t := ix.tracks[p]; t != nil {
+			return *t, true
+		}
+	}
+	if l := ix.lost[id]; l != nil {
+		return *l, false
+	}
+	return Track{}, false
+}
+
+// Paths returns the paths of the tracks with the given IDs, in order,
+// leaving out tracks that are gone.
+func (ix *Index) Paths(ids []string) []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if p, ok := ix.ids[id]; ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// IDFor returns the ID of the track at path. A path that is not in the
+// library becomes a lost track, so references to files that were already
+// missing keep a stable ID as well.
+func (ix *Index) IDFor(path string) string {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if t := ix.tracks[path]; t != nil {
+		return t.ID
+	}
+	for id, l := range ix.lost {
+		if l.Path == path {
+			return id
+		}
+	}
+	id := newID()
+	ix.lost[id] = &Track{Path: path, ID: id, Lost: true}
+	return id
+}
+
+// AddLost records t as a lost track, for references to a file that is not
+// here, such as those of a backup from another machine, and returns its
+// ID. A lost track with the same hash is reused; the file takes the ID
+// over when a scan finds it.
+func (ix *Index) AddLost(t Track) string {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if t.Hash != "" {
+		for id, l := range ix.lost {
+			if l.Hash == t.Hash {
+				return id
+			}
+		}
+	}
+	t.ID, t.Lost = newID(), true
+	t.File, t.Start, t.End = "", 0, 0
+	ix.lost[t.ID] = &t
+	return t.ID
+}
+
+// Forget drops lost tracks for good, for example after the references to
+// them were removed.
+func (ix *Index) Forget(ids ...string) error {
+	ix.mu.Lock()
+	for _, id := range ids {
+		delete(ix.lost, id)
+	}
+	ix.mu.Unlock()
+	return ix.Save()
+}
@@ -0,0 +1,411 @@
+// Package library keeps a persistent, tag-aware index of the local music
+// directory so views can group and search tracks without re-reading files.
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"opentify/internal/tags"
+)
+
+// Track is a single indexed media file.
+type Track struct {
+	// ID stays with the track when its file is moved or retagged; user
+	// data refers to tracks by it. Hash identifies the audio to recognise
+	// moved files.
+	ID   string `json:"id,omitempty"`
+	Hash string `json:"hash,omitempty"`
+	// Lost marks a track whose file is gone; it is kept so the file can
+	// be relinked when it shows up elsewhere.
+	Lost bool `json:"lost,omitempty"`
+
+	Path        string        `json:"path"`
+	Title       string        `json:"title,omitempty"`
+	Artist      string        `json:"artist,omitempty"`
+	AlbumArtist string        `json:"album_artist,omitempty"`
+	Album       string        `json:"album,omitempty"`
+	Genre       string        `json:"genre,omitempty"`
+	Year        int           `json:"year,omitempty"`
+	TrackNo     int           `json:"track,omitempty"`
+	Disc        int           `json:"disc,omitempty"`
+	Compilation bool          `json:"compilation,omitempty"`
+	Rating      int           `json:"rating,omitempty"` // stars from the file's tags
+	Duration    time.Duration `json:"duration,omitempty"`
+	Bitrate     int           `json:"bitrate,omitempty"`
+	SampleRate  int           `json:"sample_rate,omitempty"`
+	Size        int64         `json:"size"`
+	ModTime     time.Time     `json:"mtime"`
+	Added       time.Time     `json:"added"`
+
+	// CUE sheet tracks are virtual: Path is "<sheet>.cue#<n>" and the
+	// audio is Start..End of File (End zero means to the end of File).
+	File  string        `json:"file,omitempty"`
+	Start time.Duration `json:"start,omitempty"`
+	End   time.Duration `json:"end,omitempty"`
+}
+
+// DisplayTitle returns the tag title or the file name without extension.
+func (t Track) DisplayTitle() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	if t.File != "" {
+		base := filepath.Base(t.File)
+		return fmt.Sprintf("%s %02d", strings.TrimSuffix(base, filepath.Ext(base)), t.TrackNo)
+	}
+	base := filepath.Base(t.Path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// Ext returns the lower-case extension of the audio file without the dot
+// ("mp3").
+func (t Track) Ext() string {
+	return strings.TrimPrefix(strings.ToLower(filepath.Ext(t.AudioFile())), ".")
+}
+
+// AudioFile returns the file holding the track's audio: File for CUE
+// tracks, Path otherwise.
+func (t Track) AudioFile() string {
+	if t.File != "" {
+		return t.File
+	}
+	return t.Path
+}
+
+// IsMedia reports whether path has a playable extension.
+func IsMedia(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3", ".wav", ".flac", ".ogg", ".mp4":
+		return true
+	}
+	return false
+}
+
+// Index maps file paths to their tracks. It is safe for concurrent use.
+type Index struct {
+	mu     sync.RWMutex
+	path   string
+	tracks map[string]*Track
+	ids    map[string]string // ID -> path of present tracks
+	lost   map[string]*Track // by ID
+}
+
+// Open loads the index stored at path. A missing file yields an empty index.
+func Open(path string) (*Index, error) {
+	ix := &Index{path: path, tracks: map[string]*Track{}, ids: map[string]string{}, lost: map[string]*Track{}}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ix, nil
+		}
+		return ix, err
+	}
+	var list []*Track
+	if err := json.Unmarshal(b, &list); err != nil {
+		return ix, err
+	}
+	for _, t := range list {
+		switch {
+		case t == nil || t.Path == "":
+		case t.Lost:
+			if t.ID != "" {
+				ix.lost[t.ID] = t
+			}
+		default:
+			ix.tracks[t.Path] = t
+			if t.ID != "" {
+				ix.ids[t.ID] = t.Path
+			}
+		}
+	}
+	return ix, nil
+}
+
+// Save writes the index back to the file it was opened from.
+func (ix *Index) Save() error {
+	ix.mu.RLock()
+	list := make([]*Track, 0, len(ix.tracks)+len(ix.lost))
+	for _, t := range ix.tracks {
+		list = append(list, t)
+	}
+	for _, t := range ix.lost {
+		list = append(list, t)
+	}
+	ix.mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+	if d := filepath.Dir(ix.path); d != "." && d != "" {
+		if err := os.MkdirAll(d, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(ix.path, b, 0o644)
+}
+
+// Scan walks dir, re-reads tags of new or modified files and returns the
+// sorted list of media paths. Entries of files that disappeared become
+// lost tracks; a new file with the audio of a lost track takes over its ID.
+func (ix *Index) Scan(dir string) ([]string, error) {
+	type seen struct {
+		path string
+		info os.FileInfo
+	}
+	var found, sheets []seen
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		if IsMedia(p) {
+			found = append(found, seen{p, info})
+		} else if strings.EqualFold(filepath.Ext(p), ".cue") {
+			sheets = append(sheets, seen{p, info})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]string, 0, len(found))
+	present := make(map[string]bool, len(found))
+	changed := false
+	now := time.Now()
+
+	// Album images with a CUE sheet are replaced by their tracks.
+	covered := map[string]bool{}
+	var cueList []*Track
+	for _, sh := range sheets {
+		for _, t := range cueTracks(sh.path, sh.info) {
+			covered[t.File] = true
+			files = append(files, t.Path)
+			present[t.Path] = true
+			cueList = append(cueList, t)
+		}
+	}
+	for _, s := range found {
+		if !covered[s.path] {
+			files = append(files, s.path)
+			present[s.path] = true
+		}
+	}
+
+	// Vanished files are marked lost first so that files moved within dir
+	// are relinked below.
+	prefix := filepath.Clean(dir) + string(filepath.Separator)
+	ix.mu.Lock()
+	for p, t := range ix.tracks {
+		if !present[p] && strings.HasPrefix(filepath.Clean(p), prefix) {
+			delete(ix.tracks, p)
+			delete(ix.ids, t.ID)
+			if t.ID != "" {
+				t.Lost = true
+				ix.lost[t.ID] = t
+			}
+			changed = true
+		}
+	}
+	ix.mu.Unlock()
+
+	hashes := map[string]string{}
+	for _, t := range cueList {
+		ix.mu.RLock()
+		old := ix.tracks[t.Path]
+		ix.mu.RUnlock()
+		if old != nil && old.ID != "" && old.File == t.File && old.Size == t.Size && old.ModTime.Equal(t.ModTime) {
+			continue
+		}
+		hashTrack(t, hashes)
+		t.Added = now
+		if old != nil && !old.Added.IsZero() {
+			t.Added = old.Added
+		}
+		ix.mu.Lock()
+		ix.identify(t, old)
+		ix.tracks[t.Path] = t
+		ix.mu.Unlock()
+		changed = true
+	}
+
+	for _, s := range found {
+		if covered[s.path] {
+			continue
+		}
+		ix.mu.RLock()
+		old := ix.tracks[s.path]
+		ix.mu.RUnlock()
+		var t *Track
+		if old != nil && old.Size == s.info.Size() && old.ModTime.Equal(s.info.ModTime()) {
+			if old.ID != "" {
+				continue
+			}
+			// Indexed before tracks had IDs; the tags are still good
+			c := *old
+			t = &c
+		} else {
+			t = readTrack(s.path, s.info)
+			t.Added = now
+			if old != nil && !old.Added.IsZero() {
+				t.Added = old.Added
+			}
+		}
+		hashTrack(t, hashes)
+		ix.mu.Lock()
+		ix.identify(t, old)
+		ix.tracks[s.path] = t
+		ix.mu.Unlock()
+		changed = true
+	}
+
+	if changed {
+		if err := ix.Save(); err != nil {
+			return files, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Refresh re-reads the tags of the given files, for example after they
+// were edited, and saves the index.
+func (ix *Index) Refresh(paths ...string) error {
+	for _, p := range paths {
+		if IsCue(p) {
+			continue // rebuilt from the sheet by Scan
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return err
+		}
+		t := readTrack(p, info)
+		hashTrack(t, map[string]string{})
+		ix.mu.Lock()
+		old := ix.tracks[p]
+		t.Added = time.Now()
+		if old != nil && !old.Added.IsZero() {
+			t.Added = old.Added
+		}
+		ix.identify(t, old)
+		ix.tracks[p] = t
+		ix.mu.Unlock()
+	}
+	return ix.Save()
+}
+
+// Move re-keys tracks of files that were moved (old path -> new path),
+// keeping their ID, tags and added date, and saves the index.
+func (ix *Index) Move(m map[string]string) error {
+	ix.mu.Lock()
+	moved := make([]*Track, 0, len(m))
+	for old := range m {
+		if t := ix.tracks[old]; t != nil {
+			delete(ix.tracks, old)
+			moved = append(moved, t)
+		}
+	}
+	for _, t := range moved {
+		t.Path = m[t.Path]
+		if info, err := os.Stat(t.Path); err == nil {
+			t.Size, t.ModTime = info.Size(), info.ModTime()
+		}
+		ix.tracks[t.Path] = t
+		if t.ID != "" {
+			ix.ids[t.ID] = t.Path
+		}
+	}
+	ix.mu.Unlock()
+	return ix.Save()
+}
+
+// Rebase makes the relative paths of the index, which older versions
+// resolved against the working directory, absolute under root, keeping
+// IDs and tags. It saves the index and returns the renames (old -> new).
+func (ix *Index) Rebase(root string) (map[string]string, error) {
+	abs := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(root, p)
+	}
+	m := map[string]string{}
+	ix.mu.Lock()
+	tracks := make(map[string]*Track, len(ix.tracks))
+	for p, t := range ix.tracks {
+		t.Path, t.File = abs(t.Path), abs(t.File)
+		if t.Path != p {
+			m[p] = t.Path
+		}
+		tracks[t.Path] = t
+		if t.ID != "" {
+			ix.ids[t.ID] = t.Path
+		}
+	}
+	ix.tracks = tracks
+	for _, t := range ix.lost {
+		t.Path, t.File = abs(t.Path), abs(t.File)
+	}
+	ix.mu.Unlock()
+	if len(m) == 0 {
+		return m, nil
+	}
+	return m, ix.Save()
+}
+
+func readTrack(path string, info os.FileInfo) *Track {
+	t := &Track{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	tg, err := tags.Read(path)
+	if err != nil {
+		return t
+	}
+	t.Title = tg.Title
+	t.Artist = tg.Artist
+	t.AlbumArtist = tg.AlbumArtist
+	t.Album = tg.Album
+	t.Genre = tg.Genre
+	t.Year = tg.Year
+	t.TrackNo = tg.Track
+	t.Disc = tg.Disc
+	t.Compilation = tg.Compilation
+	t.Rating = tg.Rating
+	t.Duration = tg.Duration
+	t.Bitrate = tg.Bitrate
+	t.SampleRate = tg.SampleRate
+	return t
+}
+
+// Get returns the track for path.
+func (ix *Index) Get(path string) (Track, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	t, ok := ix.tracks[path]
+	if !ok {
+		return Track{Path: path}, false
+	}
+	return *t, true
+}
+
+// Tracks returns a copy of every indexed track sorted by path.
+func (ix *Index) Tracks() []Track {
+	ix.mu.RLock()
+	out := make([]Track, 0, len(ix.tracks))
+	for _, t := range ix.tracks {
+		out = append(out, *t)
+	}
+	ix.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out
+}
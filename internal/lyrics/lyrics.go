@@ -0,0 +1,192 @@
+// Package lyrics loads song lyrics from .lrc sidecar files or embedded tags
+// and maps a playback position to the current line.
+package lyrics
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"opentify/internal/tags"
+	"opentify/internal/textenc"
+)
+
+// Line is one line of lyrics. Time is zero for unsynced lyrics.
+type Line struct {
+	Time time.Duration
+	Text string
+}
+
+// Lyrics are the lyrics of a track.
+type Lyrics struct {
+	Lines []Line
+	// Synced reports whether Lines carry timestamps, sorted by time.
+	Synced bool
+	// Source describes where the lyrics came from: "lrc", "sylt" or "tag".
+	Source string
+}
+
+// Empty reports whether there is nothing to show.
+func (l Lyrics) Empty() bool { return len(l.Lines) == 0 }
+
+// Load returns the lyrics of the file at path, preferring a sidecar .lrc
+// file next to it, then synced and finally unsynced embedded lyrics. A
+// track without lyrics yields empty Lyrics and no error.
+func Load(path string) (Lyrics, error) {
+	if b, err := readSidecar(path); err == nil {
+		if l := Parse(textenc.Decode(b)); !l.Empty() {
+			l.Source = "lrc"
+			return l, nil
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return Lyrics{}, err
+	}
+	emb, err := tags.ReadLyrics(path)
+	if err != nil && !errors.Is(err, tags.ErrUnsupported) {
+		return Lyrics{}, err
+	}
+	if len(emb.Synced) > 0 {
+		l := Lyrics{Synced: true, Source: "sylt"}
+		for _, s := range emb.Synced {
+			l.Lines = append(l.Lines, Line{Time: s.Time, Text: s.Text})
+		}
+		sort.SliceStable(l.Lines, func(i, j int) bool { return l.Lines[i].Time < l.Lines[j].Time })
+		return l, nil
+	}
+	l := Parse(emb.Text)
+	l.Source = "tag"
+	return l, nil
+}
+
+// LoadSegment returns the lyrics of the range start..end of file, a CUE
+// sheet track of an album image; end 0 is the end of file. Only synced
+// lyrics of the image can be cut to the track, with times made relative
+// to its start; unsynced ones cover the whole album and are left out.
+func LoadSegment(file string, start, end time.Duration) (Lyrics, error) {
+	whole, err := Load(file)
+	if err != nil || !whole.Synced {
+		return Lyrics{}, err
+	}
+	l := Lyrics{Synced: true, Source: whole.Source}
+	for _, ln := range whole.Lines {
+		if ln.Time >= start && (end <= 0 || ln.Time < end) {
+			ln.Time -= start
+			l.Lines = append(l.Lines, ln)
+		}
+	}
+	return l, nil
+}
+
+// readSidecar reads "<name>.lrc" next to path, matching the extension
+// case-insensitively.
+func readSidecar(path string) ([]byte, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	for _, ext := range []string{".lrc", ".LRC", ".Lrc"} {
+		b, err := os.ReadFile(base + ext)
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return b, err
+		}
+	}
+	return nil, fs.ErrNotExist
+}
+
+var (
+	// "[mm:ss]", "[mm:ss.xx]", "[mm:ss:xx]" and "[hh:mm:ss.xx]" time tags.
+	timeTagRe = regexp.MustCompile(`^\[(\d+):(\d{1,2})(?::(\d{1,2}))?(?:[.:](\d{1,3}))?\]`)
+	// Enhanced LRC word timings "<mm:ss.xx>".
+	wordTagRe = regexp.MustCompile(`<\d+:\d{1,2}(?:[.:]\d{1,3})?>`)
+	// ID tags such as "[ar:Artist]" and "[offset:+250]".
+	idTagRe = regexp.MustCompile(`^\[([a-zA-Z#]+):(.*)\]$`)
+)
+
+// Parse reads LRC text. Text without any time tag is returned unsynced,
+// one Line per line, with blank lines kept as paragraph breaks.
+func Parse(s string) Lyrics {
+	s = strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+	var synced []Line
+	var offset time.Duration
+	for _, raw := range strings.Split(s, "\n") {
+		line := strings.TrimSpace(raw)
+		var times []time.Duration
+		for {
+			m := timeTagRe.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			times = append(times, tagTime(m))
+			line = strings.TrimSpace(line[len(m[0]):])
+		}
+		if len(times) == 0 {
+			if m := idTagRe.FindStringSubmatch(line); m != nil && strings.EqualFold(m[1], "offset") {
+				if ms, err := strconv.Atoi(strings.TrimSpace(m[2])); err == nil {
+					offset = time.Duration(ms) * time.Millisecond
+				}
+			}
+			continue
+		}
+		text := strings.TrimSpace(wordTagRe.ReplaceAllString(line, ""))
+		for _, t := range times {
+			synced = append(synced, Line{Time: t, Text: text})
+		}
+	}
+	if len(synced) > 0 {
+		// A positive offset shows lyrics earlier.
+		for i := range synced {
+			synced[i].Time = max(0, synced[i].Time-offset)
+		}
+		sort.SliceStable(synced, func(i, j int) bool { return synced[i].Time < synced[j].Time })
+		return Lyrics{Lines: synced, Synced: true}
+	}
+
+	var lines []Line
+	for _, raw := range strings.Split(strings.TrimSpace(s), "\n") {
+		if idTagRe.MatchString(strings.TrimSpace(raw)) {
+			continue
+		}
+		lines = append(lines, Line{Text: strings.TrimRightFunc(raw, func(r rune) bool { return r == ' ' || r == '\t' })})
+	}
+	if len(lines) == 1 && lines[0].Text == "" {
+		lines = nil
+	}
+	return Lyrics{Lines: lines}
+}
+
+// tagTime converts a timeTagRe match. Three numeric fields are
+// "[hh:mm:ss.xx]" when a fraction follows and "[mm:ss:xx]" otherwise.
+func tagTime(m []string) time.Duration {
+	a, _ := strconv.Atoi(m[1])
+	b, _ := strconv.Atoi(m[2])
+	d := time.Duration(a)*time.Minute + time.Duration(b)*time.Second
+	frac := m[4]
+	if m[3] != "" {
+		if frac == "" {
+			frac = m[3]
+		} else {
+			c, _ := strconv.Atoi(m[3])
+			d = time.Duration(a)*time.Hour + time.Duration(b)*time.Minute + time.Duration(c)*time.Second
+		}
+	}
+	if frac != "" {
+		n, _ := strconv.Atoi(frac)
+		for i := len(frac); i < 3; i++ {
+			n *= 10
+		}
+		d += time.Duration(n) * time.Millisecond
+	}
+	return d
+}
+
+// At returns the index of the line sung at pos, or -1 before the first
+// line and for unsynced lyrics.
+func (l Lyrics) At(pos time.Duration) int {
+	if !l.Synced {
+		return -1
+	}
+	return sort.Search(len(l.Lines), func(i int) bool { return l.Lines[i].Time > pos }) - 1
+}
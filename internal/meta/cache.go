@@ -0,0 +1,300 @@
+package meta
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache keeps lookup results and artwork on disk, under lookups/ and
+// images/ of its folder, one file per entry named after the SHA-1 of its
+// key. It is offline-first: whatever is cached is served at once, and
+// entries older than their TTL are refreshed in the background for the
+// next time. Least recently used files go once the cache outgrows
+// MaxBytes.
+type Cache struct {
+	LookupTTL time.Duration // for lookups with results
+	MissTTL   time.Duration // for lookups without results
+	ImageTTL  time.Duration
+	MaxBytes  int64
+	Client    *http.Client // for artwork; nil for a client with a timeout
+
+	dir string
+
+	mu         sync.Mutex
+	size       int64 // bytes on disk, -1 until counted
+	refreshing map[string]bool
+}
+
+// NewCache returns a cache rooted at dir holding up to maxBytes.
+func NewCache(dir string, maxBytes int64) *Cache {
+	return &Cache{
+		LookupTTL:  30 * 24 * time.Hour,
+		MissTTL:    24 * time.Hour,
+		ImageTTL:   90 * 24 * time.Hour,
+		MaxBytes:   maxBytes,
+		dir:        dir,
+		size:       -1,
+		refreshing: map[string]bool{},
+	}
+}
+
+// CacheKey is the key of the lookup of q with providers for the track
+// known as id, its library ID or its path. Changes to the tags or to the
+// providers make for a new key.
+func CacheKey(id string, q Query, providers []Provider) string {
+	parts := []string{id, q.Term, q.Artist, q.Title, q.Album, strconv.Itoa(q.limit())}
+	for _, p := range providers {
+		parts = append(parts, p.Name())
+	}
+	return strings.Join(parts, "\x00")
+}
+
+func (c *Cache) file(kind, key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(c.dir, kind, hex.EncodeToString(sum[:]))
+}
+
+type lookupEntry struct {
+	Fetched time.Time `json:"fetched"`
+	Results []Info    `json:"results"`
+}
+
+// Search is the package's Search with the results kept under key, see
+// CacheKey. A lookup that finds nothing is cached too, for MissTTL.
+func (c *Cache) Search(ctx context.Context, providers []Provider, key string, q Query) ([]Info, error) {
+	file := c.file("lookups", key)
+	var e lookupEntry
+	if b, err := c.read(file); err == nil && json.Unmarshal(b, &e) == nil {
+		ttl := c.LookupTTL
+		if len(e.Results) == 0 {
+			ttl = c.MissTTL
+		}
+		if time.Since(e.Fetched) > ttl {
+			c.refresh(file, func(ctx context.Context) error {
+				_, err := c.search(ctx, providers, file, q)
+				return err
+			})
+		}
+		if len(e.Results) == 0 {
+			return nil, ErrNotFound
+		}
+		return e.Results, nil
+	}
+	return c.search(ctx, providers, file, q)
+}
+
+func (c *Cache) search(ctx context.Context, providers []Provider, file string, q Query) ([]Info, error) {
+	infos, err := Search(ctx, providers, q)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		// Nothing learned; the next lookup tries again
+		return nil, err
+	}
+	b, merr := json.Marshal(lookupEntry{Fetched: time.Now(), Results: infos})
+	if merr == nil {
+		_ = c.write(file, b)
+	}
+	return infos, err
+}
+
+// Image returns the file at url, an artwork URL of Info, from the cache or
+// else downloaded.
+func (c *Cache) Image(ctx context.Context, url string) ([]byte, error) {
+	file := c.file("images", url)
+	if b, err := c.read(file); err == nil {
+		if fi, err := os.Stat(file + ".fetched"); err != nil || time.Since(fi.ModTime()) > c.ImageTTL {
+			c.refresh(file, func(ctx context.Context) error {
+				_, err := c.download(ctx, file, url)
+				return err
+			})
+		}
+		return b, nil
+	}
+	return c.download(ctx, file, url)
+}
+
+// The largest artwork file accepted.
+const maxImage = 16 << 20
+
+func (c *Cache) download(ctx context.Context, file, url string) ([]byte, error) {
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxImage+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxImage {
+		return nil, errors.New("meta: artwork too large")
+	}
+	if err := c.write(file, b); err == nil {
+		// The image keeps its access time as modification time, for
+		// eviction; when it was fetched is kept aside
+		_ = os.WriteFile(file+".fetched", nil, 0o644)
+	}
+	return b, nil
+}
+
+// refresh runs fn in the background unless it already runs for file.
+func (c *Cache) refresh(file string, fn func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.refreshing[file] {
+		return
+	}
+	c.refreshing[file] = true
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		_ = fn(ctx)
+		c.mu.Lock()
+		delete(c.refreshing, file)
+		c.mu.Unlock()
+	}()
+}
+
+// read returns the contents of file, marking it as used.
+func (c *Cache) read(file string) ([]byte, error) {
+	b, err := os.ReadFile(file)
+	if err == nil {
+		now := time.Now()
+		_ = os.Chtimes(file, now, now)
+	}
+	return b, err
+}
+
+// write replaces file atomically and evicts old entries when the cache
+// has grown too large.
+func (c *Cache) write(file string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(file), ".tmp*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	var old int64
+	if fi, serr := os.Stat(file); serr == nil {
+		old = fi.Size()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), file)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.size < 0 {
+		c.size = c.count()
+	} else {
+		c.size += int64(len(b)) - old
+	}
+	if c.MaxBytes > 0 && c.size > c.MaxBytes {
+		c.trim()
+	}
+	return nil
+}
+
+type cacheFile struct {
+	path string
+	size int64
+	used time.Time
+}
+
+func (c *Cache) files() []cacheFile {
+	var out []cacheFile
+	for _, kind := range []string{"lookups", "images"} {
+		entries, _ := os.ReadDir(filepath.Join(c.dir, kind))
+		for _, e := range entries {
+			fi, err := e.Info()
+			// Files being written (.tmp*) are not entries yet
+			if err != nil || !fi.Mode().IsRegular() || strings.HasSuffix(e.Name(), ".fetched") || strings.HasPrefix(e.Name(), ".tmp") {
+				continue
+			}
+			out = append(out, cacheFile{filepath.Join(c.dir, kind, e.Name()), fi.Size(), fi.ModTime()})
+		}
+	}
+	return out
+}
+
+func (c *Cache) count() int64 {
+	var n int64
+	for _, f := range c.files() {
+		n += f.size
+	}
+	return n
+}
+
+// trim removes the least recently used files until the cache is back to
+// nine tenths of MaxBytes. c.mu is held.
+func (c *Cache) trim() {
+	files := c.files()
+	slices.SortFunc(files, func(a, b cacheFile) int { return a.used.Compare(b.used) })
+	c.size = 0
+	for _, f := range files {
+		c.size += f.size
+	}
+	for _, f := range files {
+		if c.size <= c.MaxBytes/10*9 {
+			break
+		}
+		if err := os.Remove(f.path); err == nil || errors.Is(err, fs.ErrNotExist) {
+			os.Remove(f.path + ".fetched")
+			c.size -= f.size
+		}
+	}
+}
+
+// Size returns the bytes the cache takes on disk.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.size = c.count()
+	return c.size
+}
+
+// Clear removes every entry.
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, kind := range []string{"lookups", "images"} {
+		if err := os.RemoveAll(filepath.Join(c.dir, kind)); err != nil {
+			return err
+		}
+	}
+	c.size = 0
+	return nil
+}
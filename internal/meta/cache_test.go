@@ -0,0 +1,196 @@
+package meta
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// counting is a provider with fixed answers that counts its searches.
+type counting struct {
+	infos []Info
+	calls atomic.Int32
+}
+
+func (p *counting) Name() string { return "counting" }
+
+func (p *counting) Search(context.Context, Query) ([]Info, error) {
+	p.calls.Add(1)
+	return p.infos, nil
+}
+
+// idle waits for the background refreshes of c to finish.
+func idle(t *testing.T, c *Cache) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		c.mu.Lock()
+		n := len(c.refreshing)
+		c.mu.Unlock()
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("refresh did not finish")
+}
+
+func TestCacheSearchTTL(t *testing.T) {
+	old := []Info{{Title: "Old", Source: "counting"}}
+	tests := []struct {
+		name    string
+		cached  []Info
+		age     time.Duration
+		refresh bool
+	}{
+		{"fresh", old, time.Hour, false},
+		{"stale", old, 31 * 24 * time.Hour, true},
+		{"fresh miss", nil, time.Hour, false},
+		{"stale miss", nil, 25 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		c := NewCache(t.TempDir(), 0)
+		p := &counting{infos: []Info{{Title: "New", Source: "counting"}}}
+		b, _ := json.Marshal(lookupEntry{Fetched: time.Now().Add(-tt.age), Results: tt.cached})
+		if err := c.write(c.file("lookups", "k"), b); err != nil {
+			t.Fatal(err)
+		}
+
+		// The cached answer comes at once, stale or not
+		got, err := c.Search(context.Background(), []Provider{p}, "k", Query{})
+		if tt.cached == nil {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s: err = %v, want ErrNotFound", tt.name, err)
+			}
+		} else if len(got) != 1 || got[0].Title != "Old" {
+			t.Errorf("%s: got %+v, want the cached entry", tt.name, got)
+		}
+		idle(t, c)
+		if n := p.calls.Load(); (n == 1) != tt.refresh {
+			t.Errorf("%s: %d searches, refresh %v", tt.name, n, tt.refresh)
+		}
+
+		// A refresh is what the next lookup sees
+		want := "Old"
+		if tt.refresh {
+			want = "New"
+		}
+		got, _ = c.Search(context.Background(), []Provider{p}, "k", Query{})
+		if tt.cached == nil && !tt.refresh {
+			if len(got) != 0 {
+				t.Errorf("%s: then %+v, want no results", tt.name, got)
+			}
+		} else if len(got) != 1 || got[0].Title != want {
+			t.Errorf("%s: then %+v, want %s", tt.name, got, want)
+		}
+	}
+}
+
+func TestCacheTrim(t *testing.T) {
+	entry := bytes.Repeat([]byte{'x'}, 300)
+	tests := []struct {
+		used string // entry read before the cache overflows
+		gone string
+	}{
+		{"", "a"},
+		{"a", "b"},
+		{"b", "a"},
+		{"c", "a"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		c := NewCache(dir, 1000)
+		// A file still being written is not part of the cache
+		if err := os.MkdirAll(filepath.Join(dir, "lookups"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		tmp := filepath.Join(dir, "lookups", ".tmp123")
+		if err := os.WriteFile(tmp, make([]byte, 5000), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		for i, key := range []string{"a", "b", "c"} {
+			file := c.file("lookups", key)
+			if err := c.write(file, entry); err != nil {
+				t.Fatal(err)
+			}
+			at := time.Now().Add(time.Duration(i-3) * time.Hour)
+			if err := os.Chtimes(file, at, at); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if tt.used != "" {
+			if _, err := c.read(c.file("lookups", tt.used)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := c.write(c.file("lookups", "d"), entry); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, key := range []string{"a", "b", "c", "d"} {
+			_, err := os.Stat(c.file("lookups", key))
+			if exists := err == nil; exists == (key == tt.gone) {
+				t.Errorf("used %q: %s exists %v, want %q evicted", tt.used, key, exists, tt.gone)
+			}
+		}
+		if _, err := os.Stat(tmp); err != nil {
+			t.Errorf("used %q: file being written removed", tt.used)
+		}
+		if n := c.Size(); n != 900 {
+			t.Errorf("used %q: Size = %d, want 900", tt.used, n)
+		}
+	}
+}
+
+func TestCacheClear(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Write([]byte("image"))
+	}))
+	t.Cleanup(srv.Close)
+	c := NewCache(t.TempDir(), 0)
+	p := &counting{infos: []Info{{Title: "Song", Source: "counting"}}}
+	ctx := context.Background()
+
+	steps := []struct {
+		clear    bool
+		searches int32
+		requests int32
+		size     int64
+	}{
+		{false, 1, 1, -1},
+		{false, 1, 1, -1}, // served from the cache
+		{true, 1, 1, 0},
+		{false, 2, 2, -1}, // fetched again
+	}
+	for i, st := range steps {
+		if st.clear {
+			if err := c.Clear(); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			if _, err := c.Search(ctx, []Provider{p}, "k", Query{}); err != nil {
+				t.Fatal(err)
+			}
+			if b, err := c.Image(ctx, srv.URL+"/cover.jpg"); err != nil || string(b) != "image" {
+				t.Fatalf("Image = %q, %v", b, err)
+			}
+		}
+		if n := p.calls.Load(); n != st.searches {
+			t.Errorf("step %d: %d searches, want %d", i, n, st.searches)
+		}
+		if n := requests.Load(); n != st.requests {
+			t.Errorf("step %d: %d downloads, want %d", i, n, st.requests)
+		}
+		if n := c.Size(); (st.size < 0 && n == 0) || (st.size >= 0 && n != st.size) {
+			t.Errorf("step %d: Size = %d", i, n)
+		}
+	}
+}
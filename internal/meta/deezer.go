@@ -0,0 +1,69 @@
+package meta
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Deezer is the public search of the Deezer API. No API key required.
+type Deezer struct {
+	BaseURL string       // "" for https://api.deezer.com
+	Client  *http.Client // nil for a client with a timeout
+}
+
+func (*Deezer) Name() string { return "Deezer" }
+
+func (p *Deezer) Search(ctx context.Context, q Query) ([]Info, error) {
+	query := q.Term
+	if q.Title != "" {
+		// Deezer's advanced search syntax
+		query = "track:" + strconv.Quote(q.Title)
+		if q.Artist != "" {
+			query = "artist:" + strconv.Quote(q.Artist) + " " + query
+		}
+	}
+	v := url.Values{}
+	v.Set("q", query)
+	v.Set("limit", strconv.Itoa(q.limit()))
+	endpoint := baseURL(p.BaseURL, "https://api.deezer.com") + "/search?" + v.Encode()
+
+	var out struct {
+		Data []struct {
+			Title    string `json:"title"`
+			Duration int64  `json:"duration"` // seconds
+			Artist   struct {
+				Name string `json:"name"`
+			} `json:"artist"`
+			Album struct {
+				Title    string `json:"title"`
+				CoverBig string `json:"cover_big"`
+			} `json:"album"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := getJSON(ctx, p.Client, endpoint, nil, &out); err != nil {
+		return nil, err
+	}
+	// Deezer reports errors, such as quota limits, with status 200
+	if out.Error != nil {
+		return nil, errors.New("API error: " + out.Error.Message)
+	}
+	infos := make([]Info, 0, len(out.Data))
+	for _, r := range out.Data {
+		infos = append(infos, Info{
+			Title:    r.Title,
+			Artist:   r.Artist.Name,
+			Album:    r.Album.Title,
+			Artwork:  r.Album.CoverBig,
+			Duration: time.Duration(r.Duration) * time.Second,
+			Source:   p.Name(),
+		})
+	}
+	return infos, nil
+}
@@ -0,0 +1,52 @@
+package meta
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ITunes is the iTunes Search API. No API key required.
+type ITunes struct {
+	BaseURL string       // "" for https://itunes.apple.com
+	Client  *http.Client // nil for a client with a timeout
+}
+
+func (*ITunes) Name() string { return "iTunes" }
+
+func (p *ITunes) Search(ctx context.Context, q Query) ([]Info, error) {
+	v := url.Values{}
+	v.Set("term", q.text())
+	v.Set("entity", "song")
+	v.Set("limit", strconv.Itoa(q.limit()))
+	endpoint := baseURL(p.BaseURL, "https://itunes.apple.com") + "/search?" + v.Encode()
+
+	var out struct {
+		Results []struct {
+			TrackName       string `json:"trackName"`
+			ArtistName      string `json:"artistName"`
+			CollectionName  string `json:"collectionName"`
+			ArtworkURL100   string `json:"artworkUrl100"`
+			TrackTimeMillis int64  `json:"trackTimeMillis"`
+		} `json:"results"`
+	}
+	if err := getJSON(ctx, p.Client, endpoint, nil, &out); err != nil {
+		return nil, err
+	}
+	infos := make([]Info, 0, len(out.Results))
+	for _, r := range out.Results {
+		infos = append(infos, Info{
+			Title:  r.TrackName,
+			Artist: r.ArtistName,
+			Album:  r.CollectionName,
+			// Request higher-res artwork if available
+			Artwork:  strings.Replace(r.ArtworkURL100, "100x100bb.jpg", "600x600bb.jpg", 1),
+			Duration: time.Duration(r.TrackTimeMillis) * time.Millisecond,
+			Source:   p.Name(),
+		})
+	}
+	return infos, nil
+}
@@ -1,62 +1,181 @@
+// Package meta looks up track metadata and artwork in online catalogues.
+// Each catalogue is a Provider; Search asks several of them at once and
+// merges their answers in the order of preference.
 package meta
 
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
 	"strings"
+	"sync"
 	"time"
 )
 
+// ErrNotFound is returned when no provider knows the track.
+var ErrNotFound = errors.New("meta: no results")
+
 // Info holds minimal track metadata and artwork URL.
 type Info struct {
-	Title   string
-	Artist  string
-	Album   string
-	Artwork string // URL
-}
-
-// Lookup queries iTunes Search API for a given freeform term and returns the best match.
-// No API key required.
-func Lookup(ctx context.Context, term string) (Info, error) {
-	q := url.Values{}
-	q.Set("term", term)
-	q.Set("entity", "song")
-	q.Set("limit", "1")
-	endpoint := "https://itunes.apple.com/search?" + q.Encode()
-
-	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	client := &http.Client{Timeout: 8 * time.Second}
-	resp, err := client.Do(req)
+	Title    string
+	Artist   string
+	Album    string
+	Artwork  string        // URL
+	Duration time.Duration // 0 when unknown
+	Source   string        // name of the provider
+}
+
+// Query describes the track looked for. Artist and Title are used when
+// known; Term is the free-form fallback, such as a file name.
+type Query struct {
+	Term   string
+	Artist string
+	Title  string
+	Album  string
+	Limit  int // results per provider, 1 when 0
+}
+
+func (q Query) limit() int {
+	return max(q.Limit, 1)
+}
+
+// text is the query as free-form search text.
+func (q Query) text() string {
+	if q.Title != "" {
+		return strings.TrimSpace(q.Artist + " " + q.Title)
+	}
+	return q.Term
+}
+
+// Provider is an online catalogue of tracks.
+type Provider interface {
+	// Name identifies the provider in settings and in Info.Source.
+	Name() string
+	// Search returns up to q.Limit matches, best first.
+	Search(ctx context.Context, q Query) ([]Info, error)
+}
+
+// Names are the built-in providers, in their default order.
+var Names = []string{"iTunes", "MusicBrainz", "Deezer"}
+
+// ByName returns the built-in provider called name, using its public
+// endpoint, or nil.
+func ByName(name string) Provider {
+	switch name {
+	case "iTunes":
+		return &ITunes{}
+	case "MusicBrainz":
+		return &MusicBrainz{}
+	case "Deezer":
+		return &Deezer{}
+	}
+	return nil
+}
+
+// Search asks all providers at once and merges their results: those of
+// earlier providers come first, and a track found by several of them is
+// listed once, completed with what the later ones know. It fails only
+// when every provider does.
+func Search(ctx context.Context, providers []Provider, q Query) ([]Info, error) {
+	results := make([][]Info, len(providers))
+	errs := make([]error, len(providers))
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = p.Search(ctx, q)
+			if errs[i] != nil {
+				errs[i] = fmt.Errorf("%s: %w", p.Name(), errs[i])
+			}
+		}()
+	}
+	wg.Wait()
+
+	var out []Info
+	seen := map[string]int{}
+	failed := 0
+	for i, infos := range results {
+		if errs[i] != nil {
+			failed++
+			continue
+		}
+		for _, in := range infos {
+			k := key(in)
+			j, ok := seen[k]
+			if !ok {
+				seen[k] = len(out)
+				out = append(out, in)
+				continue
+			}
+			have := &out[j]
+			if have.Album == "" {
+				have.Album = in.Album
+			}
+			if have.Artwork == "" {
+				have.Artwork = in.Artwork
+			}
+			if have.Duration == 0 {
+				have.Duration = in.Duration
+			}
+		}
+	}
+	if len(out) == 0 {
+		if failed > 0 && failed == len(providers) {
+			return nil, errors.Join(errs...)
+		}
+		return nil, ErrNotFound
+	}
+	return out, nil
+}
+
+// Lookup returns the best match of providers for q.
+func Lookup(ctx context.Context, providers []Provider, q Query) (Info, error) {
+	q.Limit = 1
+	out, err := Search(ctx, providers, q)
 	if err != nil {
 		return Info{}, err
 	}
+	return out[0], nil
+}
+
+// key is what makes results of different providers the same track.
+func key(in Info) string {
+	norm := func(s string) string { return strings.Join(strings.Fields(strings.ToLower(s)), " ") }
+	return norm(in.Artist) + "\x00" + norm(in.Title)
+}
+
+var defaultClient = &http.Client{Timeout: 8 * time.Second}
+
+// getJSON decodes the JSON answer to a GET of endpoint into v.
+func getJSON(ctx context.Context, client *http.Client, endpoint string, header http.Header, v any) error {
+	if client == nil {
+		client = defaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
 	defer resp.Body.Close()
-	var out struct {
-		ResultCount int `json:"resultCount"`
-		Results     []struct {
-			TrackName      string `json:"trackName"`
-			ArtistName     string `json:"artistName"`
-			CollectionName string `json:"collectionName"`
-			ArtworkURL100  string `json:"artworkUrl100"`
-		} `json:"results"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
-		return Info{}, err
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// baseURL returns base without a trailing slash, or def when it is empty.
+func baseURL(base, def string) string {
+	if base == "" {
+		return def
 	}
-	if out.ResultCount == 0 || len(out.Results) == 0 {
-		return Info{}, fmt.Errorf("no results")
-	}
-	r := out.Results[0]
-	art := r.ArtworkURL100
-	// Request higher-res artwork if available
-	art = strings.Replace(art, "100x100bb.jpg", "600x600bb.jpg", 1)
-	return Info{
-		Title:   r.TrackName,
-		Artist:  r.ArtistName,
-		Album:   r.CollectionName,
-		Artwork: art,
-	}, nil
+	return strings.TrimSuffix(base, "/")
 }
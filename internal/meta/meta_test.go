@@ -0,0 +1,183 @@
+package meta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve answers every request with status and body, recording the last
+// request in *got.
+func serve(t *testing.T, status int, body string, got **http.Request) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got != nil {
+			*got = r
+		}
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestITunes(t *testing.T) {
+	var req *http.Request
+	srv := serve(t, http.StatusOK, `{"resultCount":1,"results":[{"trackName":"Song","artistName":"Band","collectionName":"LP",
+		"artworkUrl100":"http://img/100x100bb.jpg","trackTimeMillis":201500}]}`, &req)
+	out, err := (&ITunes{BaseURL: srv.URL}).Search(context.Background(), Query{Artist: "Band", Title: "Song", Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Info{Title: "Song", Artist: "Band", Album: "LP", Artwork: "http://img/600x600bb.jpg", Duration: 201500 * time.Millisecond, Source: "iTunes"}
+	if len(out) != 1 || out[0] != want {
+		t.Errorf("got %+v, want %+v", out, want)
+	}
+	if q := req.URL.Query(); req.URL.Path != "/search" || q.Get("term") != "Band Song" || q.Get("limit") != "3" || q.Get("entity") != "song" {
+		t.Errorf("request %s", req.URL)
+	}
+}
+
+func TestMusicBrainz(t *testing.T) {
+	var req *http.Request
+	srv := serve(t, http.StatusOK, `{"recordings":[{"title":"Song","length":200000,
+		"artist-credit":[{"name":"A","joinphrase":" & "},{"name":"B"}],
+		"releases":[{"id":"r-1","title":"LP"}]},
+		{"title":"Bare","artist-credit":[{"name":"C"}]}]}`, &req)
+	p := &MusicBrainz{BaseURL: srv.URL, CoverBaseURL: "http://covers"}
+	out, err := p.Search(context.Background(), Query{Artist: "A", Title: `Say "Hi"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Info{
+		{Title: "Song", Artist: "A & B", Album: "LP", Artwork: "http://covers/release/r-1/front-500", Duration: 200 * time.Second, Source: "MusicBrainz"},
+		{Title: "Bare", Artist: "C", Source: "MusicBrainz"},
+	}
+	if len(out) != len(want) || out[0] != want[0] || out[1] != want[1] {
+		t.Errorf("got %+v, want %+v", out, want)
+	}
+	if got := req.URL.Query().Get("query"); got != `recording:"Say \"Hi\"" AND artist:"A"` {
+		t.Errorf("query %q", got)
+	}
+	if req.Header.Get("User-Agent") == "" || strings.HasPrefix(req.Header.Get("User-Agent"), "Go-http-client") {
+		t.Errorf("User-Agent %q", req.Header.Get("User-Agent"))
+	}
+}
+
+func TestDeezer(t *testing.T) {
+	var req *http.Request
+	srv := serve(t, http.StatusOK, `{"data":[{"title":"Song","duration":199,"artist":{"name":"Band"},
+		"album":{"title":"LP","cover_big":"http://img/big.jpg"}}]}`, &req)
+	out, err := (&Deezer{BaseURL: srv.URL}).Search(context.Background(), Query{Term: "band song"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Info{Title: "Song", Artist: "Band", Album: "LP", Artwork: "http://img/big.jpg", Duration: 199 * time.Second, Source: "Deezer"}
+	if len(out) != 1 || out[0] != want {
+		t.Errorf("got %+v, want %+v", out, want)
+	}
+	if got := req.URL.Query().Get("q"); got != "band song" {
+		t.Errorf("q %q", got)
+	}
+}
+
+func TestProvidersEmptyAndErrors(t *testing.T) {
+	providers := map[string]func(base string) Provider{
+		"iTunes":      func(base string) Provider { return &ITunes{BaseURL: base} },
+		"MusicBrainz": func(base string) Provider { return &MusicBrainz{BaseURL: base} },
+		"Deezer":      func(base string) Provider { return &Deezer{BaseURL: base} },
+	}
+	empty := map[string]string{
+		"iTunes":      `{"resultCount":0,"results":[]}`,
+		"MusicBrainz": `{"recordings":[]}`,
+		"Deezer":      `{"data":[],"total":0}`,
+	}
+	for name, newP := range providers {
+		t.Run(name, func(t *testing.T) {
+			out, err := newP(serve(t, http.StatusOK, empty[name], nil).URL).Search(context.Background(), Query{Term: "x"})
+			if err != nil || len(out) != 0 {
+				t.Errorf("empty: %+v, %v", out, err)
+			}
+			if _, err := newP(serve(t, http.StatusServiceUnavailable, "busy", nil).URL).Search(context.Background(), Query{Term: "x"}); err == nil {
+				t.Error("no error for status 503")
+			}
+			if _, err := newP(serve(t, http.StatusOK, "<html>", nil).URL).Search(context.Background(), Query{Term: "x"}); err == nil {
+				t.Error("no error for a body that is not JSON")
+			}
+		})
+	}
+	// Deezer reports its errors with status 200
+	_, err := (&Deezer{BaseURL: serve(t, http.StatusOK, `{"error":{"type":"Exception","message":"Quota limit exceeded","code":4}}`, nil).URL}).
+		Search(context.Background(), Query{Term: "x"})
+	if err == nil || !strings.Contains(err.Error(), "Quota") {
+		t.Errorf("Deezer error = %v", err)
+	}
+}
+
+// fake is a provider with fixed answers.
+type fake struct {
+	name  string
+	infos []Info
+	err   error
+}
+
+func (f fake) Name() string { return f.name }
+
+func (f fake) Search(context.Context, Query) ([]Info, error) { return f.infos, f.err }
+
+func TestSearchMerge(t *testing.T) {
+	first := fake{name: "first", infos: []Info{
+		{Title: "Song", Artist: "Band", Source: "first"},
+		{Title: "Other", Artist: "X", Source: "first"},
+	}}
+	second := fake{name: "second", infos: []Info{
+		{Title: "Live", Artist: "Band", Source: "second"},
+		{Title: "song", Artist: " band ", Album: "LP", Artwork: "http://a", Duration: time.Minute, Source: "second"},
+	}}
+	failing := fake{name: "failing", err: errors.New("down")}
+
+	out, err := Search(context.Background(), []Provider{first, failing, second}, Query{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Info{
+		// The first provider's result, completed by the second one's
+		{Title: "Song", Artist: "Band", Album: "LP", Artwork: "http://a", Duration: time.Minute, Source: "first"},
+		{Title: "Other", Artist: "X", Source: "first"},
+		{Title: "Live", Artist: "Band", Source: "second"},
+	}
+	if len(out) != len(want) {
+		t.Fatalf("got %+v, want %+v", out, want)
+	}
+	for i := range want {
+		if out[i] != want[i] {
+			t.Errorf("result %d = %+v, want %+v", i, out[i], want[i])
+		}
+	}
+
+	// Priority follows the order of the providers
+	out, _ = Search(context.Background(), []Provider{second, first}, Query{})
+	if out[0].Source != "second" || out[0].Title != "Live" || out[1].Title != "song" || out[1].Source != "second" {
+		t.Errorf("reversed order: %+v", out)
+	}
+	best, err := Lookup(context.Background(), []Provider{second, first}, Query{})
+	if err != nil || best.Title != "Live" {
+		t.Errorf("Lookup = %+v, %v", best, err)
+	}
+}
+
+func TestSearchFailures(t *testing.T) {
+	if _, err := Search(context.Background(), []Provider{fake{name: "a"}, fake{name: "b", err: errors.New("down")}}, Query{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("one empty, one failing: %v, want ErrNotFound", err)
+	}
+	down := errors.New("down")
+	_, err := Search(context.Background(), []Provider{fake{name: "a", err: down}, fake{name: "b", err: errors.New("also down")}}, Query{})
+	if !errors.Is(err, down) || errors.Is(err, ErrNotFound) {
+		t.Errorf("all failing: %v", err)
+	}
+}
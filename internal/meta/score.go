@@ -0,0 +1,168 @@
+package meta
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Confident is the score from which a candidate is taken without asking.
+const Confident = 0.75
+
+// Want is what is known of the track looked up: its tags, when it has
+// any, its duration and its file name.
+type Want struct {
+	Artist   string
+	Title    string
+	Album    string
+	Duration time.Duration // 0 when unknown
+	File     string        // base name without extension
+}
+
+// Candidate is a result scored against a Want.
+type Candidate struct {
+	Info
+	Score float64 // 0..1
+}
+
+// Rank scores infos against w, best first; candidates of equal score keep
+// their order.
+func Rank(infos []Info, w Want) []Candidate {
+	out := make([]Candidate, len(infos))
+	for i, in := range infos {
+		out[i] = Candidate{Info: in, Score: Score(in, w)}
+	}
+	slices.SortStableFunc(out, func(a, b Candidate) int {
+		switch {
+		case a.Score > b.Score:
+			return -1
+		case a.Score < b.Score:
+			return 1
+		}
+		return 0
+	})
+	return out
+}
+
+// Score tells how well in matches w, from 0 to 1. Tags are compared by
+// string similarity; without tags the file name stands in for artist and
+// title. A duration far off lowers the score.
+func Score(in Info, w Want) float64 {
+	var sum, weight float64
+	add := func(s, wt float64) {
+		sum += s * wt
+		weight += wt
+	}
+	if w.Title != "" {
+		add(titleSimilarity(in.Title, w.Title), 0.45)
+		if w.Artist != "" {
+			add(similarity(in.Artist, w.Artist), 0.3)
+		}
+		if w.Album != "" && in.Album != "" {
+			add(titleSimilarity(in.Album, w.Album), 0.1)
+		}
+	} else if file := trackNumber.ReplaceAllString(normalize(w.File), ""); file != "" {
+		// "Artist - Title" is the usual file name. A bare title matches
+		// any artist's song of that name, so the artist must be in it too
+		artist := strings.TrimPrefix(normalize(in.Artist), "the ")
+		rest, found := file, 0.0
+		if i := strings.Index(file, artist); artist != "" && i >= 0 {
+			rest, found = file[:i]+" "+file[i+len(artist):], 1
+		}
+		add(titleSimilarity(in.Title, rest), 0.45)
+		add(found, 0.3)
+	}
+	if w.Duration > 0 && in.Duration > 0 {
+		add(durationScore(in.Duration-w.Duration), 0.15)
+	}
+	if weight == 0 {
+		return 0
+	}
+	return sum / weight
+}
+
+// durationScore is 1 up to 3 seconds apart, falling to 0 at 30.
+func durationScore(d time.Duration) float64 {
+	d = max(d, -d)
+	switch {
+	case d <= 3*time.Second:
+		return 1
+	case d >= 30*time.Second:
+		return 0
+	}
+	return 1 - float64(d-3*time.Second)/float64(27*time.Second)
+}
+
+var (
+	trackNumber = regexp.MustCompile(`^(cd ?\d+ )?\d{1,3} `)
+	// Remaster and version notes that only one side may carry
+	extra = regexp.MustCompile(`\s*[(\[][^)\]]*[)\]]`)
+)
+
+// titleSimilarity is similarity, also tried without parenthesized notes
+// such as "(Remastered 2011)".
+func titleSimilarity(a, b string) float64 {
+	return max(similarity(a, b), similarity(extra.ReplaceAllString(a, ""), extra.ReplaceAllString(b, "")))
+}
+
+// similarity is the Sørensen–Dice coefficient of the letter pairs of a
+// and b, after normalizing both.
+func similarity(a, b string) float64 {
+	a, b = normalize(a), normalize(b)
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	pa, pb := bigrams(a), bigrams(b)
+	if len(pa) == 0 || len(pb) == 0 {
+		return 0
+	}
+	common := 0
+	for p, n := range pa {
+		common += min(n, pb[p])
+	}
+	total := 0
+	for _, n := range pa {
+		total += n
+	}
+	for _, n := range pb {
+		total += n
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+func bigrams(s string) map[[2]rune]int {
+	out := map[[2]rune]int{}
+	for _, word := range strings.Fields(s) {
+		r := []rune(word)
+		if len(r) == 1 {
+			out[[2]rune{r[0], 0}]++
+		}
+		for i := 0; i+1 < len(r); i++ {
+			out[[2]rune{r[i], r[i+1]}]++
+		}
+	}
+	return out
+}
+
+// normalize lowercases s and reduces punctuation to single spaces.
+func normalize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if space && b.Len() > 0 {
+				b.WriteByte(' ')
+			}
+			b.WriteRune(r)
+			space = false
+		} else {
+			space = true
+		}
+	}
+	return b.String()
+}
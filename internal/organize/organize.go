@@ -0,0 +1,272 @@
+package organize
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"opentify/internal/library"
+)
+
+// Conflict decides what happens when a target path is already taken.
+type Conflict int
+
+const (
+	// RenameOnConflict appends " (2)", " (3)", ... to the file name.
+	RenameOnConflict Conflict = iota
+	// SkipOnConflict leaves the file where it is.
+	SkipOnConflict
+)
+
+// Status is the outcome planned for a file.
+type Status int
+
+const (
+	Unchanged Status = iota // already in place
+	Move                    // moved to its template path
+	Renamed                 // moved, but with a suffix to avoid a conflict
+	Skipped                 // target taken and SkipOnConflict set
+)
+
+// Op is one planned (or performed) file move.
+type Op struct {
+	From   string
+	To     string
+	Status Status
+	// Sidecars are the lyrics files next to From ("song.lrc"); they move
+	// with the track and keep its new base name.
+	Sidecars []string
+}
+
+// SidecarTo returns where sidecar s of op goes.
+func (op Op) SidecarTo(s string) string {
+	return sidecarPath(op.To, s)
+}
+
+func sidecarPath(track, sidecar string) string {
+	return strings.TrimSuffix(track, filepath.Ext(track)) + filepath.Ext(sidecar)
+}
+
+// sidecars lists the lyrics files with the base name of path, whatever the
+// case of their extension. Folder listings are cached in dirs.
+func sidecars(path string, dirs map[string][]os.DirEntry) []string {
+	dir := filepath.Dir(path)
+	entries, ok := dirs[dir]
+	if !ok {
+		entries, _ = os.ReadDir(dir)
+		dirs[dir] = entries
+	}
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		ext := filepath.Ext(name)
+		if e.Type().IsRegular() && strings.EqualFold(ext, ".lrc") && strings.TrimSuffix(name, ext) == base {
+			out = append(out, filepath.Join(dir, name))
+		}
+	}
+	return out
+}
+
+// Plan computes where each track would go under root. Nothing is touched
+// on disk, so the result doubles as the dry-run preview. CUE sheet tracks
+// are left out: their album image and sheet have to stay together.
+func Plan(root string, tracks []library.Track, t *Template, onConflict Conflict) []Op {
+	files := tracks[:0:0]
+	for _, tr := range tracks {
+		if tr.File == "" {
+			files = append(files, tr)
+		}
+	}
+	tracks = files
+	ops := make([]Op, 0, len(tracks))
+	// Targets are compared case-insensitively so the layout also works on
+	// Windows and macOS file systems.
+	taken := map[string]bool{}
+	for _, tr := range tracks {
+		if filepath.Clean(tr.Path) == filepath.Join(root, t.Expand(tr)) {
+			taken[strings.ToLower(filepath.Clean(tr.Path))] = true
+		}
+	}
+	dirs := map[string][]os.DirEntry{}
+	for _, tr := range tracks {
+		from := filepath.Clean(tr.Path)
+		to := filepath.Join(root, t.Expand(tr))
+		if to == from {
+			ops = append(ops, Op{From: from, To: to, Status: Unchanged})
+			continue
+		}
+		side := sidecars(from, dirs)
+		// A target is free when the track and its sidecars all fit.
+		busy := func(to string) bool {
+			if occupied(to, from, taken) {
+				return true
+			}
+			for _, s := range side {
+				if occupied(sidecarPath(to, s), s, taken) {
+					return true
+				}
+			}
+			return false
+		}
+		st := Move
+		if busy(to) {
+			if onConflict == SkipOnConflict {
+				ops = append(ops, Op{From: from, To: to, Status: Skipped, Sidecars: side})
+				continue
+			}
+			ext := filepath.Ext(to)
+			base := strings.TrimSuffix(to, ext)
+			for n := 2; busy(to); n++ {
+				to = base + " (" + strconv.Itoa(n) + ")" + ext
+			}
+			st = Renamed
+		}
+		taken[strings.ToLower(to)] = true
+		for _, s := range side {
+			taken[strings.ToLower(sidecarPath(to, s))] = true
+		}
+		ops = append(ops, Op{From: from, To: to, Status: st, Sidecars: side})
+	}
+	return ops
+}
+
+// occupied reports whether to is planned for another file or exists on
+// disk as a different file than from (a case-only rename is not a conflict).
+func occupied(to, from string, taken map[string]bool) bool {
+	if taken[strings.ToLower(to)] {
+		return true
+	}
+	fi, err := os.Lstat(to)
+	if err != nil {
+		return false
+	}
+	src, err := os.Lstat(from)
+	return err != nil || !os.SameFile(fi, src)
+}
+
+// Apply performs the moves of ops, sidecars included, and removes folders
+// left empty below root. It stops at the first failure and returns the
+// moves that were done so callers can update references to the files that
+// did move. A track whose sidecar cannot follow it is moved back.
+func Apply(root string, ops []Op, progress func(done, total int)) ([]Op, error) {
+	var done []Op
+	total := 0
+	for _, op := range ops {
+		if op.Status == Move || op.Status == Renamed {
+			total++
+		}
+	}
+	for _, op := range ops {
+		if op.Status != Move && op.Status != Renamed {
+			continue
+		}
+		if err := moveWithSidecars(root, op); err != nil {
+			return done, fmt.Errorf("organize: %s: %w", filepath.Base(op.From), err)
+		}
+		done = append(done, op)
+		pruneEmpty(filepath.Dir(op.From), root)
+		if progress != nil {
+			progress(len(done), total)
+		}
+	}
+	return done, nil
+}
+
+// moveWithSidecars moves the track of op, then its sidecars. On failure
+// the files already moved are put back, so a track never ends up apart
+// from its lyrics. Folders created for it below root are removed again.
+func moveWithSidecars(root string, op Op) error {
+	if err := move(op.From, op.To); err != nil {
+		return err
+	}
+	for i, s := range op.Sidecars {
+		if err := move(s, op.SidecarTo(s)); err != nil {
+			for _, back := range op.Sidecars[:i] {
+				move(op.SidecarTo(back), back)
+			}
+			move(op.To, op.From)
+			pruneEmpty(filepath.Dir(op.To), root)
+			return err
+		}
+	}
+	return nil
+}
+
+func move(from, to string) error {
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		return err
+	}
+	if fi, err := os.Lstat(to); err == nil {
+		if src, err := os.Lstat(from); err != nil || !os.SameFile(fi, src) {
+			return fmt.Errorf("%s already exists", to)
+		}
+	}
+	err := os.Rename(from, to)
+	if err == nil {
+		return nil
+	}
+	// Rename fails across devices; fall back to copy and remove.
+	if cerr := copyFile(from, to); cerr != nil {
+		if !errors.Is(cerr, fs.ErrExist) {
+			os.Remove(to)
+		}
+		return err
+	}
+	return os.Remove(from)
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(to, fi.ModTime(), fi.ModTime())
+}
+
+// pruneEmpty removes dir and its parents while they are empty, stopping at
+// root.
+func pruneEmpty(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil { // fails unless empty
+			return
+		}
+	}
+}
+
+// Renames maps old to new paths for the ops that moved a file.
+func Renames(ops []Op) map[string]string {
+	m := make(map[string]string, len(ops))
+	for _, op := range ops {
+		if op.Status == Move || op.Status == Renamed {
+			m[op.From] = op.To
+		}
+	}
+	return m
+}
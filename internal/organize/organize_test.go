@@ -0,0 +1,108 @@
+package organize
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"opentify/internal/library"
+)
+
+func touch(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(filepath.Base(path)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestPlanAndApplyMoveSidecars(t *testing.T) {
+	root := t.TempDir()
+	tracks := []library.Track{
+		{Path: filepath.Join(root, "in", "x.mp3"), Artist: "Cem Karaca", Title: "Resimdeki Gözyaşları"},
+		{Path: filepath.Join(root, "in", "y.mp3"), Artist: "Cem Karaca", Title: "Resimdeki Gözyaşları"},
+	}
+	touch(t, tracks[0].Path)
+	touch(t, filepath.Join(root, "in", "x.LRC"))
+	touch(t, filepath.Join(root, "in", "x.txt")) // not a sidecar
+	touch(t, tracks[1].Path)
+	touch(t, filepath.Join(root, "in", "y.lrc"))
+
+	tmpl, _ := Parse("{artist}/{title}.{ext}")
+	ops := Plan(root, tracks, tmpl, RenameOnConflict)
+	want := []Op{
+		{From: tracks[0].Path, To: filepath.Join(root, "Cem Karaca", "Resimdeki Gözyaşları.mp3"), Status: Move,
+			Sidecars: []string{filepath.Join(root, "in", "x.LRC")}},
+		{From: tracks[1].Path, To: filepath.Join(root, "Cem Karaca", "Resimdeki Gözyaşları (2).mp3"), Status: Renamed,
+			Sidecars: []string{filepath.Join(root, "in", "y.lrc")}},
+	}
+	if !slices.EqualFunc(ops, want, func(a, b Op) bool {
+		return a.From == b.From && a.To == b.To && a.Status == b.Status && slices.Equal(a.Sidecars, b.Sidecars)
+	}) {
+		t.Fatalf("Plan = %+v\nwant %+v", ops, want)
+	}
+
+	done, err := Apply(root, ops, nil)
+	if err != nil || len(done) != 2 {
+		t.Fatalf("Apply = %d, %v", len(done), err)
+	}
+	for _, p := range []string{
+		"Cem Karaca/Resimdeki Gözyaşları.mp3", "Cem Karaca/Resimdeki Gözyaşları.LRC",
+		"Cem Karaca/Resimdeki Gözyaşları (2).mp3", "Cem Karaca/Resimdeki Gözyaşları (2).lrc",
+		"in/x.txt",
+	} {
+		if !exists(filepath.Join(root, p)) {
+			t.Errorf("%s missing", p)
+		}
+	}
+}
+
+func TestPlanAvoidsSidecarConflicts(t *testing.T) {
+	root := t.TempDir()
+	tr := library.Track{Path: filepath.Join(root, "in", "x.mp3"), Title: "A"}
+	touch(t, tr.Path)
+	touch(t, filepath.Join(root, "in", "x.lrc"))
+	touch(t, filepath.Join(root, "A.lrc")) // lyrics of some other file
+
+	tmpl, _ := Parse("{title}.{ext}")
+	if ops := Plan(root, []library.Track{tr}, tmpl, RenameOnConflict); ops[0].To != filepath.Join(root, "A (2).mp3") {
+		t.Errorf("To = %s", ops[0].To)
+	}
+	if ops := Plan(root, []library.Track{tr}, tmpl, SkipOnConflict); ops[0].Status != Skipped {
+		t.Errorf("Status = %v, want Skipped", ops[0].Status)
+	}
+}
+
+func TestApplyMovesTrackBackWhenSidecarFails(t *testing.T) {
+	root := t.TempDir()
+	tr := library.Track{Path: filepath.Join(root, "in", "x.mp3"), Artist: "B", Title: "A"}
+	touch(t, tr.Path)
+	touch(t, filepath.Join(root, "in", "x.lrc"))
+	touch(t, filepath.Join(root, "in", "x.Lrc"))
+
+	tmpl, _ := Parse("{artist}/{title}.{ext}")
+	ops := Plan(root, []library.Track{tr}, tmpl, RenameOnConflict)
+	// Taken after planning: the second sidecar cannot follow
+	touch(t, filepath.Join(root, "B", "A.lrc"))
+
+	done, err := Apply(root, ops, nil)
+	if err == nil || len(done) != 0 {
+		t.Fatalf("Apply = %d, %v; want a failure", len(done), err)
+	}
+	for _, p := range []string{"in/x.mp3", "in/x.lrc", "in/x.Lrc", "B/A.lrc"} {
+		if !exists(filepath.Join(root, p)) {
+			t.Errorf("%s missing after rollback", p)
+		}
+	}
+	if exists(filepath.Join(root, "B", "A.mp3")) || exists(filepath.Join(root, "B", "A.Lrc")) {
+		t.Error("files left at the target")
+	}
+}
@@ -0,0 +1,220 @@
+// Package organize moves library files into a folder layout described by a
+// tag template such as "{albumartist}/{year} - {album}/{disc}{track:02} {title}.{ext}".
+package organize
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"opentify/internal/library"
+)
+
+// DefaultTemplate is used when no template is configured.
+const DefaultTemplate = "{albumartist}/{year} - {album}/{disc}{track:02} {title}.{ext}"
+
+// Fallbacks for missing tags; an empty folder name would flatten the tree.
+const (
+	UnknownArtist = "Unknown Artist"
+	UnknownAlbum  = "Unknown Album"
+)
+
+// Placeholders understood by templates.
+var placeholders = map[string]bool{
+	"title": true, "artist": true, "albumartist": true, "album": true,
+	"genre": true, "year": true, "track": true, "disc": true, "ext": true,
+	"filename": true,
+}
+
+type part struct {
+	literal string
+	name    string // placeholder, "" for literals
+	width   int    // zero padding for numbers ("{track:02}")
+}
+
+// Template is a parsed path template.
+type Template struct {
+	src   string
+	parts []part
+}
+
+// Parse compiles a template. "/" separates folders on every platform.
+func Parse(s string) (*Template, error) {
+	t := &Template{src: s}
+	rest := strings.TrimSpace(s)
+	if rest == "" {
+		return nil, fmt.Errorf("organize: empty template")
+	}
+	for rest != "" {
+		i := strings.IndexByte(rest, '{')
+		if i < 0 {
+			t.parts = append(t.parts, part{literal: rest})
+			break
+		}
+		if i > 0 {
+			t.parts = append(t.parts, part{literal: rest[:i]})
+		}
+		end := strings.IndexByte(rest[i:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("organize: unclosed %q", rest[i:])
+		}
+		spec := rest[i+1 : i+end]
+		name, format, _ := strings.Cut(spec, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !placeholders[name] {
+			return nil, fmt.Errorf("organize: unknown field {%s}", name)
+		}
+		p := part{name: name}
+		if format != "" {
+			w, err := strconv.Atoi(format)
+			if err != nil || w < 0 || w > 9 {
+				return nil, fmt.Errorf("organize: bad format in {%s}", spec)
+			}
+			p.width = w
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[i+end+1:]
+	}
+	return t, nil
+}
+
+// String returns the template source.
+func (t *Template) String() string { return t.src }
+
+// Expand returns the relative, sanitized path for tr using the OS separator.
+// {disc} is empty for single-disc albums so "{disc}{track:02}" gives "03"
+// or "203".
+func (t *Template) Expand(tr library.Track) string {
+	var b strings.Builder
+	for _, p := range t.parts {
+		if p.name == "" {
+			b.WriteString(p.literal)
+			continue
+		}
+		// Values must not introduce folders of their own.
+		b.WriteString(strings.NewReplacer("/", "-", "\\", "-").Replace(value(p, tr)))
+	}
+	segs := strings.Split(b.String(), "/")
+	out := segs[:0]
+	for i, s := range segs {
+		last := i == len(segs)-1
+		if s = cleanSegment(s, last); s == "" {
+			// Keep the depth of the layout when a field is empty.
+			s = "_"
+		}
+		out = append(out, s)
+	}
+	return filepath.Join(out...)
+}
+
+func value(p part, tr library.Track) string {
+	num := func(n int) string {
+		if n <= 0 {
+			return ""
+		}
+		return fmt.Sprintf("%0*d", p.width, n)
+	}
+	switch p.name {
+	case "title":
+		return tr.DisplayTitle()
+	case "artist":
+		if tr.Artist == "" {
+			return UnknownArtist
+		}
+		return tr.Artist
+	case "albumartist":
+		if a := tr.ResolvedAlbumArtist(); a != "" {
+			return a
+		}
+		return UnknownArtist
+	case "album":
+		if tr.Album == "" {
+			return UnknownAlbum
+		}
+		return tr.Album
+	case "genre":
+		return tr.Genre
+	case "year":
+		return num(tr.Year)
+	case "track":
+		return num(tr.TrackNo)
+	case "disc":
+		if tr.Disc <= 1 {
+			return ""
+		}
+		return num(tr.Disc)
+	case "ext":
+		return tr.Ext()
+	case "filename":
+		base := filepath.Base(tr.Path)
+		return strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return ""
+}
+
+// cleanSegment tidies separators left by empty fields (" - Album" ->
+// "Album") and makes the name valid on Windows, macOS and Linux.
+func cleanSegment(s string, last bool) string {
+	ext := ""
+	if last {
+		if i := strings.LastIndexByte(s, '.'); i > 0 {
+			s, ext = s[:i], s[i:]
+		}
+	}
+	// Trim before sanitizing, which may escape a reserved name with "_".
+	s = strings.TrimFunc(s, func(r rune) bool { return r == '-' || r == '_' || r == '.' || unicode.IsSpace(r) })
+	s = Sanitize(s)
+	if s == "" && ext != "" {
+		s = "_"
+	}
+	return s + Sanitize(ext)
+}
+
+// maxSegment is the longest file name most file systems accept, in bytes.
+const maxSegment = 240
+
+// Sanitize makes a single path element portable: characters reserved on
+// Windows and control characters are replaced, runs of spaces collapsed,
+// trailing dots and spaces removed and reserved device names escaped.
+func Sanitize(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range s {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			continue
+		case r == ':':
+			r = '-'
+		case strings.ContainsRune(`<>"/\|?*`, r):
+			r = '_'
+		}
+		if unicode.IsSpace(r) {
+			if space {
+				continue
+			}
+			space, r = true, ' '
+		} else {
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	s = strings.TrimRight(strings.TrimSpace(b.String()), ". ")
+	if len(s) > maxSegment {
+		cut := maxSegment
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		s = strings.TrimRight(s[:cut], ". ")
+	}
+	base, _, _ := strings.Cut(s, ".")
+	switch strings.ToUpper(base) {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		s = "_" + s
+	}
+	return s
+}
@@ -0,0 +1,91 @@
+package organize
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"opentify/internal/library"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in  string
+		err bool
+	}{
+		{DefaultTemplate, false},
+		{"{Artist}/{ TITLE }", false},
+		{"plain", false},
+		{"", true},
+		{"   ", true},
+		{"{artist", true},
+		{"{composer}", true},
+		{"{track:x}", true},
+		{"{track:10}", true},
+	}
+	for _, tt := range tests {
+		if _, err := Parse(tt.in); (err != nil) != tt.err {
+			t.Errorf("Parse(%q) = %v, want error %v", tt.in, err, tt.err)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	full := library.Track{
+		Path: "/in/x.MP3", Title: "Gülpembe", Artist: "Barış Manço", AlbumArtist: "Barış Manço",
+		Album: "Sahibinden İhtiyaçtan", Genre: "Rock", Year: 1985, TrackNo: 3, Disc: 1,
+	}
+	tests := []struct {
+		tmpl string
+		tr   library.Track
+		want string // "/" separated
+	}{
+		{DefaultTemplate, full, "Barış Manço/1985 - Sahibinden İhtiyaçtan/03 Gülpembe.mp3"},
+		{DefaultTemplate, library.Track{Path: "/in/x.flac", Title: "A", TrackNo: 7, Disc: 2}, "Unknown Artist/Unknown Album/207 A.flac"},
+		{DefaultTemplate, library.Track{Path: "/in/Some Song.ogg"}, "Unknown Artist/Unknown Album/Some Song.ogg"},
+		{DefaultTemplate, library.Track{Path: "/in/x.mp3", Title: "A", Compilation: true, Album: "Hits"}, "Various Artists/Hits/A.mp3"},
+		{"{genre}/{title}.{ext}", library.Track{Path: "/in/x.mp3", Title: "A"}, "_/A.mp3"},
+		{"{filename}.{ext}", library.Track{Path: "/in/old name.wav"}, "old name.wav"},
+		{"{track:3}", library.Track{TrackNo: 5}, "005"},
+		// Values cannot add folders
+		{"{artist}/{title}.{ext}", library.Track{Path: "/in/x.mp3", Artist: "AC/DC", Title: `Who\Me`}, "AC-DC/Who-Me.mp3"},
+		// Reserved characters and names, control characters, spaces
+		{"{artist}/{title}.{ext}", library.Track{Path: "/in/x.mp3", Artist: "CON", Title: "Why?  <Not>:\tNow*"}, "_CON/Why_ _Not_-Now_.mp3"},
+		{"{album}/{title}.{ext}", library.Track{Path: "/in/x.mp3", Album: "...", Title: ".hidden."}, "_/hidden.mp3"},
+		{"{artist}/{title}.{ext}", library.Track{Path: "/in/x.mp3", Artist: "nul.txt", Title: ""}, "_nul.txt/x.mp3"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.tmpl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filepath.ToSlash(tmpl.Expand(tt.tr)); got != tt.want {
+			t.Errorf("%s with %q = %q, want %q", tt.tmpl, tt.tr.Title, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Normal Name", "Normal Name"},
+		{"a:b", "a-b"},
+		{`<>"/\|?*`, "________"},
+		{"a\x00b\x1fc\x7f", "abc"},
+		{"  a \t\n b  ", "a b"},
+		{"name. . ", "name"},
+		{"com1", "_com1"},
+		{"LPT9.log", "_LPT9.log"},
+		{"CONSOLE", "CONSOLE"},
+	}
+	for _, tt := range tests {
+		if got := Sanitize(tt.in); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	// Long names are cut on a rune boundary
+	long := Sanitize(strings.Repeat("ş", 200))
+	if len(long) > maxSegment || !strings.HasPrefix(strings.Repeat("ş", 200), long) {
+		t.Errorf("long name cut to %d bytes: %q", len(long), long)
+	}
+}
@@ -0,0 +1,215 @@
+// Package paths decides where Opentify keeps its files: in the XDG base
+// directories (or what the platform has instead), or next to the
+// executable in portable mode.
+package paths
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const appName = "opentify"
+
+// Dirs are the folders of the app's files.
+type Dirs struct {
+	Config string // user data: profiles, see state.Profiles
+	Data   string // library index and listening history
+	Cache  string // artwork thumbnails and fingerprints, safe to delete
+	Music  string // default music folder
+
+	Portable bool
+}
+
+func (d Dirs) State() string        { return filepath.Join(d.Config, "state.json") }
+func (d Dirs) Library() string      { return filepath.Join(d.Data, "library.json") }
+func (d Dirs) History() string      { return filepath.Join(d.Data, "history.jsonl") }
+func (d Dirs) Artwork() string      { return filepath.Join(d.Cache, "artwork") }
+func (d Dirs) Fingerprints() string { return filepath.Join(d.Cache, "fingerprints") }
+func (d Dirs) Meta() string         { return filepath.Join(d.Cache, "meta") }
+
+// PortableFlag reports whether args, the command line without the program
+// name, ask for portable mode. Other arguments are left alone, as the
+// platform may add its own.
+func PortableFlag(args []string) bool {
+	for _, a := range args {
+		if a == "--portable" || a == "-portable" {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns the folders to use. In portable mode everything lives
+// in the folder of the executable, in the layout older versions used in
+// the working directory: data/, data/cache/ and musicdb/.
+func Resolve(portable bool) (Dirs, error) {
+	if portable {
+		exe, err := exeDir()
+		if err != nil {
+			return Dirs{}, err
+		}
+		return legacyDirs(exe, true), nil
+	}
+	config, err := os.UserConfigDir()
+	if err != nil {
+		return Dirs{}, err
+	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return Dirs{}, err
+	}
+	data, err := dataHome()
+	if err != nil {
+		return Dirs{}, err
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return Dirs{}, err
+	}
+	return Dirs{
+		Config: filepath.Join(config, appName),
+		Data:   filepath.Join(data, appName),
+		Cache:  filepath.Join(cache, appName),
+		Music:  filepath.Join(home, "Music", "Opentify"),
+	}, nil
+}
+
+// Create makes the folders of the app's own files; the music folder is up
+// to the caller, as a setting may replace it.
+func (d Dirs) Create() error {
+	for _, dir := range []string{d.Config, d.Data, d.Cache} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dataHome is $XDG_DATA_HOME, ~/.local/share by default. Platforms without
+// a separate data folder use the config folder (Application Support,
+// AppData\Roaming).
+func dataHome() (string, error) {
+	switch runtime.GOOS {
+	case "windows", "darwin", "ios", "plan9":
+		return os.UserConfigDir()
+	}
+	if d := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(d) {
+		return d, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
+
+func exeDir() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if p, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = p
+	}
+	return filepath.Dir(exe), nil
+}
+
+// legacyDirs is the layout under base used by older versions and by
+// portable mode.
+func legacyDirs(base string, portable bool) Dirs {
+	data := filepath.Join(base, "data")
+	return Dirs{
+		Config:   data,
+		Data:     data,
+		Cache:    filepath.Join(data, "cache"),
+		Music:    filepath.Join(base, "musicdb"),
+		Portable: portable,
+	}
+}
+
+// MigrateLegacy moves the files of older versions, which kept them in
+// data/ under the working directory, into d, where state.OpenProfiles takes
+// them over. It runs once: only when d has no state or profiles yet and
+// data/state.json exists in the working directory or next
+// to the executable. It returns the folder data/ was found in, "" when
+// nothing was migrated; the paths in the moved files are relative to it.
+// Caches are moved when that is cheap and left behind otherwise.
+func MigrateLegacy(d Dirs) (root string, err error) {
+	if d.Portable {
+		return "", nil
+	}
+	for _, f := range []string{d.State(), filepath.Join(d.Config, "profiles")} {
+		if _, err := os.Stat(f); !errors.Is(err, fs.ErrNotExist) {
+			return "", nil
+		}
+	}
+	var bases []string
+	if wd, err := os.Getwd(); err == nil {
+		bases = append(bases, wd)
+	}
+	if exe, err := exeDir(); err == nil {
+		bases = append(bases, exe)
+	}
+	for _, base := range bases {
+		old := legacyDirs(base, false)
+		if _, err := os.Stat(old.State()); err != nil {
+			continue
+		}
+		if err := d.Create(); err != nil {
+			return "", err
+		}
+		// State last, so that an interrupted migration is retried
+		for _, f := range []string{old.Library(), old.History()} {
+			if err := moveFile(f, filepath.Join(d.Data, filepath.Base(f))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+		for _, c := range []string{old.Artwork(), old.Fingerprints()} {
+			_ = os.Rename(c, filepath.Join(d.Cache, filepath.Base(c)))
+		}
+		entries, _ := os.ReadDir(old.Config)
+		for _, e := range entries {
+			// Backups and files set aside by state.Load
+			if name := e.Name(); strings.HasPrefix(name, "state.json.") {
+				_ = moveFile(filepath.Join(old.Config, name), filepath.Join(d.Config, name))
+			}
+		}
+		if err := moveFile(old.State(), d.State()); err != nil {
+			return "", err
+		}
+		return base, nil
+	}
+	return "", nil
+}
+
+// moveFile renames src to dst, copying across file systems.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	in.Close()
+	return os.Remove(src)
+}
@@ -4,20 +4,15 @@ package player
 
 import (
 	"errors"
-	"fmt"
-	"os"
-	"path/filepath"
-	"strings"
+	"math"
 	"sync"
 	"time"
 
 	"github.com/faiface/beep"
 	"github.com/faiface/beep/effects"
-	"github.com/faiface/beep/flac"
-	"github.com/faiface/beep/mp3"
 	"github.com/faiface/beep/speaker"
-	"github.com/faiface/beep/vorbis"
-	"github.com/faiface/beep/wav"
+
+	"opentify/internal/audio"
 )
 
 var (
@@ -29,6 +24,7 @@ var (
 type Player struct {
 	mu      sync.Mutex
 	stream  beep.StreamSeekCloser // original decoder stream (seekable)
+	win     *window               // playable range of stream
 	play    beep.Streamer         // resampled wrapper used for actual playback
 	vol     *effects.Volume       // volume wrapper
 	volNorm float64               // [0..1]
@@ -36,8 +32,59 @@ type Player struct {
 	sr      beep.SampleRate // original file's sample rate
 	started bool
 	current string
+	file    string // file behind current; differs for CUE tracks
+
+	gen        int // bumped on Load so stale end callbacks are ignored
+	onFinished func()
+	// advancedTo is the segment the window moved on to by itself; the
+	// following Load of it keeps playing instead of reopening the file.
+	advancedTo string
+}
+
+// window limits playback to [start, end) of the decoder stream, in source
+// samples. For whole files start is 0 and end the stream length. When next
+// begins exactly at end in the same file the window moves on without
+// interrupting the audio (gapless CUE tracks). The fields are guarded by
+// the speaker lock.
+type window struct {
+	src        beep.StreamSeeker
+	start, end int
+	next       *span
+	gen        int
+	onAdvance  func(gen int, path string) // called with the speaker locked
+}
+
+type span struct {
+	path       string
+	start, end int
+}
+
+func (w *window) Stream(samples [][2]float64) (int, bool) {
+	n := 0
+	for n < len(samples) {
+		pos := w.src.Position()
+		if pos >= w.end {
+			if w.next == nil || w.next.start != w.end {
+				break
+			}
+			nx := w.next
+			w.next = nil
+			w.start, w.end = nx.start, nx.end
+			w.gen++
+			w.onAdvance(w.gen, nx.path)
+			continue
+		}
+		m, ok := w.src.Stream(samples[n : n+min(len(samples)-n, w.end-pos)])
+		n += m
+		if !ok {
+			break
+		}
+	}
+	return n, n > 0
 }
 
+func (w *window) Err() error { return w.src.Err() }
+
 func New() *Player { return &Player{volNorm: 1} }
 
 func (p *Player) volDB() float64 {
@@ -70,41 +117,65 @@ func (p *Player) Volume() float64 {
 	return p.volNorm
 }
 
-func (p *Player) decodeFile(path string) (beep.StreamSeekCloser, beep.Format, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, beep.Format{}, err
-	}
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".mp3":
-		st, format, err := mp3.Decode(f)
-		if err != nil {
-			_ = f.Close()
-		}
-		return st, format, err
-	case ".wav":
-		st, format, err := wav.Decode(f)
-		if err != nil {
-			_ = f.Close()
-		}
-		return st, format, err
-	case ".flac":
-		st, format, err := flac.Decode(f)
-		if err != nil {
-			_ = f.Close()
-		}
-		return st, format, err
-	case ".ogg":
-		st, format, err := vorbis.Decode(f)
-		if err != nil {
-			_ = f.Close()
-		}
-		return st, format, err
-	default:
-		_ = f.Close()
-		return nil, beep.Format{}, fmt.Errorf("desteklenmeyen format: %s", ext)
+// chain rebuilds the resample/volume wrappers around the window and
+// appends the end-of-track callback. Callers hold p.mu (and the speaker lock
+// when the chain is live).
+func (p *Player) chain() beep.Streamer {
+	p.play = beep.Resample(4, p.sr, speakerSR, p.win)
+	p.vol = &effects.Volume{Streamer: p.play, Base: 10, Volume: p.volDB()}
+	w := p.win
+	// The callback runs inside the speaker goroutine with the speaker locked,
+	// so hand off to a new goroutine before touching the player.
+	return beep.Seq(p.vol, beep.Callback(func() {
+		gen := w.gen
+		go p.finished(gen)
+	}))
+}
+
+// finished rewinds the track that just ended and notifies the listener.
+func (p *Player) finished(gen int) {
+	p.mu.Lock()
+	if gen != p.gen || p.stream == nil || p.ctrl == nil {
+		p.mu.Unlock()
+		return
+	}
+	speaker.Lock()
+	p.ctrl.Paused = true
+	_ = p.stream.Seek(p.win.start)
+	p.ctrl.Streamer = p.chain()
+	speaker.Unlock()
+	p.started = false
+	fn := p.onFinished
+	p.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// advanced records that the window moved on to the next segment by itself
+// and notifies the listener as if the previous track had finished.
+func (p *Player) advanced(gen int, path string) {
+	p.mu.Lock()
+	if gen <= p.gen {
+		p.mu.Unlock()
+		return
 	}
+	p.gen = gen
+	p.current = path
+	p.advancedTo = path
+	fn := p.onFinished
+	p.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+// SetOnFinished registers fn to be called when the loaded track plays to
+// its end. fn runs on its own goroutine.
+func (p *Player) SetOnFinished(fn func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onFinished = fn
 }
 
 func ensureSpeaker() {
@@ -114,9 +185,22 @@ func ensureSpeaker() {
 }
 
 func (p *Player) Load(path string) error {
+	return p.LoadSegment(path, path, 0, 0)
+}
+
+// LoadSegment loads the range start..end of file under the name path, as
+// used for CUE sheet tracks; end 0 plays to the end of file. Loading the
+// segment playback has already moved on to (see SetNext) keeps playing.
+func (p *Player) LoadSegment(path, file string, start, end time.Duration) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
+	if p.advancedTo != "" && p.advancedTo == path && p.current == path && p.stream != nil {
+		p.advancedTo = ""
+		return nil
+	}
+	p.advancedTo = ""
+
 	// Stop current playback and release previous stream
 	if p.stream != nil {
 		if p.ctrl != nil {
@@ -128,9 +212,10 @@ func (p *Player) Load(path string) error {
 		p.stream = nil
 		p.play = nil
 		p.ctrl = nil
+		p.win = nil
 	}
 
-	st, format, err := p.decodeFile(path)
+	st, format, err := audio.Decode(file)
 	if err != nil {
 		return err
 	}
@@ -139,19 +224,64 @@ func (p *Player) Load(path string) error {
 
 	ensureSpeaker()
 
+	p.gen++
+	p.win = &window{src: st, gen: p.gen, onAdvance: func(gen int, path string) { go p.advanced(gen, path) }}
+	p.win.start, p.win.end = p.span(start, end)
+	if p.win.start > 0 {
+		if err := st.Seek(p.win.start); err != nil {
+			_ = st.Close()
+			p.stream, p.win = nil, nil
+			return err
+		}
+	}
+
 	// Prepare resampled playback stream to match fixed speaker sample rate
-	p.play = beep.Resample(4, p.sr, speakerSR, p.stream)
-	p.vol = &effects.Volume{Streamer: p.play, Base: 10, Volume: p.volDB()}
-	p.ctrl = &beep.Ctrl{Streamer: p.vol, Paused: true}
+	p.ctrl = &beep.Ctrl{Streamer: p.chain(), Paused: true}
 
 	// Ensure no stale streamers remain in the mixer (single-player app)
 	speaker.Clear()
 
 	p.started = false
 	p.current = path
+	p.file = file
 	return nil
 }
 
+// span converts a time range of the loaded stream to samples; end 0 means
+// the end of the stream. Callers hold p.mu.
+func (p *Player) span(start, end time.Duration) (int, int) {
+	l := p.stream.Len()
+	if l <= 0 {
+		l = math.MaxInt
+	}
+	s := min(max(0, p.sr.N(start)), l)
+	e := l
+	if end > 0 {
+		e = min(p.sr.N(end), l)
+	}
+	return s, max(s, e)
+}
+
+// SetNext announces the segment that will be played after the current one.
+// When it starts exactly where the current segment ends in the same file,
+// playback continues into it without a gap; anything else is ignored and
+// the next Load opens it normally. An empty path clears it.
+func (p *Player) SetNext(path, file string, start, end time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.win == nil {
+		return
+	}
+	var next *span
+	if path != "" && file == p.file && path != p.current {
+		s, e := p.span(start, end)
+		next = &span{path: path, start: s, end: e}
+	}
+	speaker.Lock()
+	p.win.next = next
+	speaker.Unlock()
+}
+
 func (p *Player) Play() {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -188,11 +318,9 @@ func (p *Player) Stop() {
 	speaker.Unlock()
 	speaker.Lock()
 	defer speaker.Unlock()
-	_ = p.stream.Seek(0)
+	_ = p.stream.Seek(p.win.start)
 	// Reset resampler state after seek-to-start
-	p.play = beep.Resample(4, p.sr, speakerSR, p.stream)
-	p.vol = &effects.Volume{Streamer: p.play, Base: 10, Volume: p.volDB()}
-	p.ctrl.Streamer = p.vol
+	p.ctrl.Streamer = p.chain()
 	p.started = false
 }
 
@@ -219,11 +347,13 @@ func (p *Player) Duration() (time.Duration, error) {
 	if p.stream == nil {
 		return 0, errors.New("akış yok")
 	}
-	l := p.stream.Len()
-	if l <= 0 || p.sr == 0 {
+	speaker.Lock()
+	start, end := p.win.start, p.win.end
+	speaker.Unlock()
+	if end == math.MaxInt || p.sr == 0 {
 		return 0, errors.New("uzunluk bilinmiyor")
 	}
-	return time.Duration(float64(time.Second) * float64(l) / float64(p.sr)), nil
+	return p.sr.D(end - start), nil
 }
 
 // Position returns current playback position.
@@ -233,8 +363,29 @@ func (p *Player) Position() (time.Duration, error) {
 	if p.stream == nil || p.sr == 0 {
 		return 0, errors.New("akış yok")
 	}
-	pos := p.stream.Position()
-	return time.Duration(float64(time.Second) * float64(pos) / float64(p.sr)), nil
+	speaker.Lock()
+	pos := p.stream.Position() - p.win.start
+	speaker.Unlock()
+	return p.sr.D(max(0, pos)), nil
+}
+
+// seek moves to the sample returned by target for the current window,
+// clamped to it. Callers hold p.mu.
+func (p *Player) seek(target func(pos, start, end int) int) error {
+	speaker.Lock()
+	defer speaker.Unlock()
+	w := p.win
+	// Some decoders (e.g., mp3) panic if seeking to exactly the length;
+	// clamp to [start, end-1]
+	t := max(w.start, min(target(p.stream.Position(), w.start, w.end), w.end-1))
+	if err := p.stream.Seek(t); err != nil {
+		return err
+	}
+	// Reset resampler after seek
+	if p.ctrl != nil {
+		p.ctrl.Streamer = p.chain()
+	}
+	return nil
 }
 
 // SeekRatio seeks to given ratio [0,1] of the track length.
@@ -250,30 +401,10 @@ func (p *Player) SeekRatio(r float64) error {
 	if r > 1 {
 		r = 1
 	}
-	l := p.stream.Len()
-	if l <= 0 {
+	if p.stream.Len() <= 0 {
 		return errors.New("uzunluk bilinmiyor")
 	}
-	// Some decoders (e.g., mp3) panic if seeking to exactly l; clamp to [0, l-1]
-	target := int(float64(l-1) * r)
-	if target < 0 {
-		target = 0
-	}
-	if target >= l {
-		target = l - 1
-	}
-	speaker.Lock()
-	defer speaker.Unlock()
-	if err := p.stream.Seek(target); err != nil {
-		return err
-	}
-	// Reset resampler after seek
-	p.play = beep.Resample(4, p.sr, speakerSR, p.stream)
-	p.vol = &effects.Volume{Streamer: p.play, Base: 10, Volume: p.volDB()}
-	if p.ctrl != nil {
-		p.ctrl.Streamer = p.vol
-	}
-	return nil
+	return p.seek(func(_, start, end int) int { return start + int(float64(end-1-start)*r) })
 }
 
 // SeekBy moves relative by the given duration (positive or negative).
@@ -283,27 +414,8 @@ func (p *Player) SeekBy(d time.Duration) error {
 	if p.stream == nil || p.sr == 0 {
 		return errors.New("akış yok")
 	}
-	cur := p.stream.Position()
 	delta := int(float64(p.sr) * d.Seconds())
-	target := cur + delta
-	if target < 0 {
-		target = 0
-	}
-	l := p.stream.Len()
-	if l > 0 && target >= l {
-		target = l - 1
-	}
-	speaker.Lock()
-	defer speaker.Unlock()
-	if err := p.stream.Seek(target); err != nil {
-		return err
-	}
-	p.play = beep.Resample(4, p.sr, speakerSR, p.stream)
-	p.vol = &effects.Volume{Streamer: p.play, Base: 10, Volume: p.volDB()}
-	if p.ctrl != nil {
-		p.ctrl.Streamer = p.vol
-	}
-	return nil
+	return p.seek(func(pos, _, _ int) int { return pos + delta })
 }
 
 // SeekTo moves to the absolute position given by duration.
@@ -313,23 +425,6 @@ func (p *Player) SeekTo(d time.Duration) error {
 	if p.stream == nil || p.sr == 0 {
 		return errors.New("akış yok")
 	}
-	target := int(float64(p.sr) * d.Seconds())
-	if target < 0 {
-		target = 0
-	}
-	l := p.stream.Len()
-	if l > 0 && target >= l {
-		target = l - 1
-	}
-	speaker.Lock()
-	defer speaker.Unlock()
-	if err := p.stream.Seek(target); err != nil {
-		return err
-	}
-	p.play = beep.Resample(4, p.sr, speakerSR, p.stream)
-	p.vol = &effects.Volume{Streamer: p.play, Base: 10, Volume: p.volDB()}
-	if p.ctrl != nil {
-		p.ctrl.Streamer = p.vol
-	}
-	return nil
+	off := int(float64(p.sr) * d.Seconds())
+	return p.seek(func(_, start, _ int) int { return start + off })
 }
@@ -23,3 +23,8 @@ func (p *Player) Position() (time.Duration, error) { return 0, nil }
 func (p *Player) SeekRatio(r float64) error        { return nil }
 func (p *Player) SeekBy(d time.Duration) error     { return nil }
 func (p *Player) SeekTo(d time.Duration) error     { return nil }
+func (p *Player) SetOnFinished(fn func())          {}
+
+// CUE sheet segments
+func (p *Player) LoadSegment(path, file string, start, end time.Duration) error { return nil }
+func (p *Player) SetNext(path, file string, start, end time.Duration)           {}
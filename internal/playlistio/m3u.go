@@ -0,0 +1,90 @@
+package playlistio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseM3U reads plain and extended M3U. "#EXTINF:<seconds>,Artist -
+// Title" lines describe the entry that follows; "#PLAYLIST:" names the
+// list.
+func parseM3U(s string) *Playlist {
+	pl := &Playlist{}
+	var info Entry
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXTINF:"):
+			info = parseExtinf(line[len("#EXTINF:"):])
+		case strings.HasPrefix(line, "#PLAYLIST:"):
+			pl.Title = strings.TrimSpace(line[len("#PLAYLIST:"):])
+		case strings.HasPrefix(line, "#EXTALB:"):
+			info.Album = strings.TrimSpace(line[len("#EXTALB:"):])
+		case strings.HasPrefix(line, "#"):
+		default:
+			info.Location = line
+			pl.Entries = append(pl.Entries, info)
+			info = Entry{}
+		}
+	}
+	return pl
+}
+
+// parseExtinf parses the part after "#EXTINF:". Attributes some players
+// put between the duration and the comma (tvg-name="..." etc.) are
+// skipped.
+func parseExtinf(s string) Entry {
+	var e Entry
+	// The title starts after the first comma outside quoted attributes
+	cut, quoted := -1, false
+	for i, r := range s {
+		if r == '"' {
+			quoted = !quoted
+		} else if r == ',' && !quoted {
+			cut = i
+			break
+		}
+	}
+	if cut < 0 {
+		return e
+	}
+	head, name := s[:cut], s[cut+1:]
+	if f := strings.Fields(head); len(f) > 0 {
+		if sec, err := strconv.ParseFloat(f[0], 64); err == nil && sec > 0 {
+			e.Duration = time.Duration(sec * float64(time.Second))
+		}
+	}
+	name = strings.TrimSpace(name)
+	if artist, title, ok := strings.Cut(name, " - "); ok {
+		e.Artist, e.Title = strings.TrimSpace(artist), strings.TrimSpace(title)
+	} else {
+		e.Title = name
+	}
+	return e
+}
+
+func writeM3U(w io.Writer, pl *Playlist) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "#EXTM3U")
+	if pl.Title != "" {
+		fmt.Fprintln(bw, "#PLAYLIST:"+pl.Title)
+	}
+	for _, e := range pl.Entries {
+		sec := -1
+		if e.Duration > 0 {
+			sec = int(e.Duration.Round(time.Second) / time.Second)
+		}
+		name := e.Title
+		if e.Artist != "" {
+			name = e.Artist + " - " + e.Title
+		}
+		fmt.Fprintf(bw, "#EXTINF:%d,%s\n", sec, name)
+		fmt.Fprintln(bw, e.Location)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,98 @@
+package playlistio
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"opentify/internal/dupes"
+	"opentify/internal/library"
+)
+
+// Result is a playlist file mapped onto the library.
+type Result struct {
+	Paths     []string // library paths of the matched entries, in order
+	Unmatched []Entry
+}
+
+// Match finds the library track of every entry. dir is the folder of the
+// playlist file that relative locations are resolved against. An entry
+// whose file is not in the library is matched by its artist/title, then by
+// its file name; ambiguous matches prefer the closest duration.
+func Match(pl *Playlist, dir string, tracks []library.Track) Result {
+	byAbs := map[string]string{}
+	byFold := map[string]string{} // case-insensitive file systems, moved drives
+	byKey := map[string][]library.Track{}
+	byBase := map[string][]library.Track{}
+	for _, t := range tracks {
+		if abs, err := filepath.Abs(t.Path); err == nil {
+			byAbs[abs] = t.Path
+			byFold[strings.ToLower(abs)] = t.Path
+		}
+		byKey[dupes.Key(t)] = append(byKey[dupes.Key(t)], t)
+		base := strings.ToLower(filepath.Base(t.Path))
+		byBase[base] = append(byBase[base], t)
+	}
+
+	var res Result
+	for _, e := range pl.Entries {
+		p, local := localPath(e.Location, dir)
+		if local {
+			if found, ok := byAbs[p]; ok {
+				res.Paths = append(res.Paths, found)
+				continue
+			}
+			if found, ok := byFold[strings.ToLower(p)]; ok {
+				res.Paths = append(res.Paths, found)
+				continue
+			}
+		}
+		if e.Title != "" {
+			if t, ok := closest(byKey[dupes.Key(library.Track{Artist: e.Artist, Title: e.Title})], e.Duration); ok {
+				res.Paths = append(res.Paths, t.Path)
+				continue
+			}
+		}
+		if local {
+			// The last element of a Windows path even on other systems
+			base := p[strings.LastIndexAny(p, `/\`)+1:]
+			if t, ok := closest(byBase[strings.ToLower(base)], e.Duration); ok {
+				res.Paths = append(res.Paths, t.Path)
+				continue
+			}
+			// Untagged files are keyed by their "Artist - Title" file name
+			key := dupes.Key(library.Track{Path: base})
+			if t, ok := closest(byKey[key], e.Duration); ok {
+				res.Paths = append(res.Paths, t.Path)
+				continue
+			}
+		}
+		res.Unmatched = append(res.Unmatched, e)
+	}
+	return res
+}
+
+// closest picks the candidate whose duration is nearest to d, or the only
+// candidate when d is unknown. ok is false for no or several equally good
+// candidates without a duration to decide.
+func closest(cands []library.Track, d time.Duration) (library.Track, bool) {
+	switch {
+	case len(cands) == 0:
+		return library.Track{}, false
+	case len(cands) == 1:
+		return cands[0], true
+	case d <= 0:
+		return library.Track{}, false
+	}
+	best, bestDiff := 0, time.Duration(-1)
+	for i, t := range cands {
+		diff := t.Duration - d
+		if diff < 0 {
+			diff = -diff
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best, bestDiff = i, diff
+		}
+	}
+	return cands[best], true
+}
@@ -0,0 +1,164 @@
+// Package playlistio reads and writes the playlist files other players
+// use (M3U/M3U8, PLS and XSPF) and maps their entries onto the library.
+package playlistio
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"opentify/internal/library"
+	"opentify/internal/textenc"
+)
+
+// Playlist file formats.
+const (
+	M3U  = "m3u"
+	M3U8 = "m3u8"
+	PLS  = "pls"
+	XSPF = "xspf"
+)
+
+// ErrFormat is returned for files that are not a supported playlist.
+var ErrFormat = errors.New("playlistio: unsupported playlist format")
+
+// Playlist is the content of a playlist file.
+type Playlist struct {
+	Title   string
+	Entries []Entry
+}
+
+// Entry is a track of a playlist file. Location is a path or URL as
+// written in the file; the other fields are hints some formats carry.
+type Entry struct {
+	Location string
+	Title    string
+	Artist   string
+	Album    string
+	Duration time.Duration // 0 when unknown
+}
+
+// Label describes e for reports: "Artist - Title" when known, otherwise
+// its location.
+func (e Entry) Label() string {
+	switch {
+	case e.Title != "" && e.Artist != "":
+		return e.Artist + " - " + e.Title
+	case e.Title != "":
+		return e.Title
+	}
+	return e.Location
+}
+
+// FormatOf returns the format of a playlist file by its extension, "" if
+// it is not one.
+func FormatOf(path string) string {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case M3U, M3U8, PLS, XSPF:
+		return ext
+	}
+	return ""
+}
+
+// ReadFile reads the playlist at path.
+func ReadFile(path string) (*Playlist, error) {
+	format := FormatOf(path)
+	if format == "" {
+		return nil, ErrFormat
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(format, b)
+}
+
+// Parse parses a playlist in format. Text formats are decoded like other
+// sidecar files, so Windows-1254 M3Us from older players read correctly.
+func Parse(format string, b []byte) (*Playlist, error) {
+	switch format {
+	case M3U, M3U8:
+		return parseM3U(textenc.Decode(b)), nil
+	case PLS:
+		return parsePLS(textenc.Decode(b)), nil
+	case XSPF:
+		return parseXSPF(b)
+	}
+	return nil, ErrFormat
+}
+
+// Write writes pl to w in format. M3U8 and M3U are both written as UTF-8
+// since every player in use today reads that.
+func Write(w io.Writer, format string, pl *Playlist) error {
+	switch format {
+	case M3U, M3U8:
+		return writeM3U(w, pl)
+	case PLS:
+		return writePLS(w, pl)
+	case XSPF:
+		return writeXSPF(w, pl)
+	}
+	return ErrFormat
+}
+
+// FromTracks builds a playlist of tracks to be saved in dir. Locations are
+// relative to dir when relative is set and it is possible, absolute
+// otherwise. CUE sheet tracks keep their "#n" suffix.
+func FromTracks(title string, tracks []library.Track, dir string, relative bool) *Playlist {
+	pl := &Playlist{Title: title}
+	absDir, _ := filepath.Abs(dir)
+	for _, t := range tracks {
+		loc, _ := filepath.Abs(t.Path)
+		if relative {
+			if rel, err := filepath.Rel(absDir, loc); err == nil {
+				loc = rel
+			}
+		}
+		pl.Entries = append(pl.Entries, Entry{
+			Location: filepath.ToSlash(loc),
+			Title:    t.DisplayTitle(),
+			Artist:   t.Artist,
+			Album:    t.Album,
+			Duration: t.Duration,
+		})
+	}
+	return pl
+}
+
+// localPath turns a location into a file path resolved against dir, the
+// folder of the playlist. ok is false for remote URLs.
+func localPath(loc, dir string) (string, bool) {
+	loc = strings.TrimSpace(loc)
+	if loc == "" {
+		return "", false
+	}
+	if u, err := url.Parse(loc); err == nil && len(u.Scheme) > 1 {
+		// One-letter schemes are Windows drive letters
+		if u.Scheme != "file" {
+			return "", false
+		}
+		p := u.Path
+		if u.Fragment != "" {
+			p += "#" + u.Fragment // CUE track
+		}
+		if len(p) > 2 && p[0] == '/' && p[2] == ':' {
+			p = p[1:] // file:///C:/...
+		}
+		return filepath.FromSlash(p), true
+	}
+	// Playlists written on Windows use backslashes
+	loc = filepath.FromSlash(strings.ReplaceAll(loc, `\`, "/"))
+	if !filepath.IsAbs(loc) && !isDrivePath(loc) {
+		loc = filepath.Join(dir, loc)
+	}
+	return filepath.Clean(loc), true
+}
+
+// isDrivePath reports whether p starts with a Windows drive letter.
+func isDrivePath(p string) bool {
+	return len(p) >= 3 && p[1] == ':' && (p[2] == '/' || p[2] == '\\')
+}
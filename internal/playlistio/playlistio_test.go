@@ -0,0 +1,169 @@
+package playlistio
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"opentify/internal/library"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		format string
+		in     string
+		want   *Playlist
+	}{
+		{M3U, "#EXTM3U\r\n#PLAYLIST:Yol\r\n#EXTINF:270,Barış Manço - Gülpembe\r\nmusic/gulpembe.mp3\r\n\r\n# comment\r\nother.flac\r\n",
+			&Playlist{Title: "Yol", Entries: []Entry{
+				{Location: "music/gulpembe.mp3", Artist: "Barış Manço", Title: "Gülpembe", Duration: 270 * time.Second},
+				{Location: "other.flac"},
+			}}},
+		{M3U, "#EXTINF:-1 tvg-name=\"x, y\" tvg-logo=\"z\",Radio\nhttp://radio.example/stream\n",
+			&Playlist{Entries: []Entry{{Location: "http://radio.example/stream", Title: "Radio"}}}},
+		{M3U8, "#EXTINF:185.5,Cem Karaca - Tamirci Çırağı\n#EXTALB:Yoksulluk Kader Olamaz\nC:\\Müzik\\tamirci.mp3\n",
+			&Playlist{Entries: []Entry{{Location: `C:\Müzik\tamirci.mp3`, Artist: "Cem Karaca", Title: "Tamirci Çırağı",
+				Album: "Yoksulluk Kader Olamaz", Duration: 185500 * time.Millisecond}}}},
+		// Windows-1254 from an older player
+		{M3U, "#EXTINF:10,Bar\xfd\xfe Man\xe7o - D\xf6nence\nd.mp3\n",
+			&Playlist{Entries: []Entry{{Location: "d.mp3", Artist: "Barış Manço", Title: "Dönence", Duration: 10 * time.Second}}}},
+		{PLS, "[playlist]\nFile2=b.mp3\nTitle2=B\nLength2=-1\nfile1=a.mp3\nTitle1=Art - A\nLength1=61\nTitle3=no file\nNumberOfEntries=3\nVersion=2\nX-GNOME-Title=Liste\n",
+			&Playlist{Title: "Liste", Entries: []Entry{
+				{Location: "a.mp3", Artist: "Art", Title: "A", Duration: 61 * time.Second},
+				{Location: "b.mp3", Title: "B"},
+			}}},
+		{XSPF, `<?xml version="1.0"?><playlist version="1" xmlns="http://xspf.org/ns/0/"><title>X</title><trackList>
+			<track><location>m%C3%BCzik/a%20b.flac</location><title>A B</title><creator>C</creator><album>D</album><duration>61000</duration></track>
+			<track><location>file:///home/u/x.mp3</location></track>
+			<track><location>album.cue#3</location></track>
+			<track><title>Only a title</title></track>
+			<track></track>
+			</trackList></playlist>`,
+			&Playlist{Title: "X", Entries: []Entry{
+				{Location: "müzik/a b.flac", Title: "A B", Artist: "C", Album: "D", Duration: 61 * time.Second},
+				{Location: "file:///home/u/x.mp3"},
+				{Location: "album.cue#3"},
+				{Title: "Only a title"},
+			}}},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.format, []byte(tt.in))
+		if err != nil {
+			t.Errorf("%s %.30q: %v", tt.format, tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s %.30q =\n%+v, want\n%+v", tt.format, tt.in, got, tt.want)
+		}
+	}
+	if _, err := Parse("wpl", nil); err != ErrFormat {
+		t.Errorf("Parse(wpl) = %v, want ErrFormat", err)
+	}
+	if _, err := Parse(XSPF, []byte("<playlist")); err == nil {
+		t.Error("broken XSPF parsed")
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	pl := &Playlist{Title: "Karışık", Entries: []Entry{
+		{Location: "müzik/Barış Manço - Gülpembe.mp3", Artist: "Barış Manço", Title: "Gülpembe", Duration: 270 * time.Second},
+		{Location: "/abs/a b.flac", Title: "Only title"},
+		{Location: "C:/Müzik/x.ogg", Artist: "X", Title: "Y"},
+		{Location: "album.cue#3", Title: "Z", Duration: 61400 * time.Millisecond},
+	}}
+	for _, format := range []string{M3U, M3U8, PLS, XSPF} {
+		var b bytes.Buffer
+		if err := Write(&b, format, pl); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Parse(format, b.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		want := *pl
+		want.Entries = nil
+		for _, e := range pl.Entries {
+			if format != XSPF {
+				e.Duration = e.Duration.Round(time.Second)
+			}
+			switch {
+			case format == XSPF && e.Location == "/abs/a b.flac":
+				e.Location = "file:///abs/a%20b.flac"
+			case format == XSPF && e.Location == "C:/Müzik/x.ogg":
+				e.Location = "file:///C:/M%C3%BCzik/x.ogg"
+			}
+			want.Entries = append(want.Entries, e)
+		}
+		if !reflect.DeepEqual(got, &want) {
+			t.Errorf("%s round trip:\n%s\n%+v, want\n%+v", format, b.Bytes(), got, &want)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	dir := filepath.FromSlash("/home/u/lists")
+	tests := []struct {
+		loc   string
+		want  string
+		local bool
+	}{
+		{"a.mp3", "/home/u/lists/a.mp3", true},
+		{"../music/a.mp3", "/home/u/music/a.mp3", true},
+		{`..\music\a.mp3`, "/home/u/music/a.mp3", true},
+		{"/srv/a.mp3", "/srv/a.mp3", true},
+		{"file:///srv/a%20b.mp3", "/srv/a b.mp3", true},
+		{"file:///srv/album.cue#2", "/srv/album.cue#2", true},
+		{"http://example.com/a.mp3", "", false},
+		{"  ", "", false},
+	}
+	for _, tt := range tests {
+		got, local := localPath(tt.loc, dir)
+		if local != tt.local || got != filepath.FromSlash(tt.want) {
+			t.Errorf("localPath(%q) = %q, %v, want %q, %v", tt.loc, got, local, tt.want, tt.local)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tracks := []library.Track{
+		{Path: "/lib/Barış Manço/Gülpembe.flac", Artist: "Barış Manço", Title: "Gülpembe", Duration: 270 * time.Second},
+		{Path: "/lib/yt/Barış Manço - Gülpembe (Official Video).mp3", Artist: "Barış Manço", Title: "Gülpembe (Official Video)", Duration: 290 * time.Second},
+		{Path: "/lib/Cem Karaca/Resimdeki Gözyaşları.mp3", Artist: "Cem Karaca", Title: "Resimdeki Gözyaşları"},
+		{Path: "/lib/untagged/Tarkan - Yolla.mp3"},
+		{Path: "/lib/a/Same.mp3"},
+		{Path: "/lib/b/Same.mp3"},
+	}
+	pl := &Playlist{Entries: []Entry{
+		{Location: "../lib/Barış Manço/Gülpembe.flac"},                                             // relative path
+		{Location: "/LIB/cem karaca/resimdeki gözyaşları.mp3"},                                     // other case
+		{Location: "x.mp3", Artist: "barış manço", Title: "GÜLPEMBE", Duration: 288 * time.Second}, // tags, nearest length
+		{Location: `D:\Old\Resimdeki Gözyaşları.mp3`},                                              // file name
+		{Location: "/gone/Tarkan - Yolla.mp3"},                                                     // "Artist - Title" file name
+		{Location: "/gone/Same.mp3"},                                                               // ambiguous
+		{Location: "http://radio.example/stream", Title: "Radio"},
+	}}
+	res := Match(pl, "/lists", tracks)
+	want := []string{tracks[0].Path, tracks[2].Path, tracks[1].Path, tracks[2].Path, tracks[3].Path}
+	if !reflect.DeepEqual(res.Paths, want) {
+		t.Errorf("Paths =\n%q, want\n%q", res.Paths, want)
+	}
+	if len(res.Unmatched) != 2 || res.Unmatched[0].Location != "/gone/Same.mp3" || res.Unmatched[1].Label() != "Radio" {
+		t.Errorf("Unmatched = %+v", res.Unmatched)
+	}
+}
+
+func TestFromTracks(t *testing.T) {
+	tracks := []library.Track{
+		{Path: "/m/lists/../music/a.mp3", Title: "A", Artist: "X", Duration: time.Minute},
+		{Path: "/m/music/album.cue#2"},
+	}
+	pl := FromTracks("L", tracks, "/m/lists", true)
+	if pl.Entries[0].Location != "../music/a.mp3" || pl.Entries[1].Location != "../music/album.cue#2" || pl.Entries[1].Title != "album" {
+		t.Errorf("relative = %+v", pl.Entries)
+	}
+	if pl := FromTracks("L", tracks, "/m/lists", false); pl.Entries[0].Location != "/m/music/a.mp3" {
+		t.Errorf("absolute = %+v", pl.Entries)
+	}
+}
@@ -0,0 +1,95 @@
+package playlistio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parsePLS reads a PLS file: FileN, TitleN and LengthN keys of the
+// [playlist] section, in N order.
+func parsePLS(s string) *Playlist {
+	pl := &Playlist{}
+	entries := map[int]*Entry{}
+	for _, line := range strings.Split(s, "\n") {
+		key, val, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		key, val = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(val)
+		if key == "x-gnome-title" || key == "x-title" {
+			pl.Title = val
+			continue
+		}
+		var field string
+		for _, f := range []string{"file", "title", "length"} {
+			if strings.HasPrefix(key, f) {
+				field = f
+			}
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(key, field))
+		if field == "" || err != nil {
+			continue
+		}
+		e := entries[n]
+		if e == nil {
+			e = &Entry{}
+			entries[n] = e
+		}
+		switch field {
+		case "file":
+			e.Location = val
+		case "title":
+			if artist, title, ok := strings.Cut(val, " - "); ok {
+				e.Artist, e.Title = strings.TrimSpace(artist), strings.TrimSpace(title)
+			} else {
+				e.Title = val
+			}
+		case "length":
+			if sec, err := strconv.Atoi(val); err == nil && sec > 0 {
+				e.Duration = time.Duration(sec) * time.Second
+			}
+		}
+	}
+	nums := make([]int, 0, len(entries))
+	for n, e := range entries {
+		if e.Location != "" {
+			nums = append(nums, n)
+		}
+	}
+	sort.Ints(nums)
+	for _, n := range nums {
+		pl.Entries = append(pl.Entries, *entries[n])
+	}
+	return pl
+}
+
+func writePLS(w io.Writer, pl *Playlist) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "[playlist]")
+	if pl.Title != "" {
+		fmt.Fprintln(bw, "X-GNOME-Title="+pl.Title)
+	}
+	for i, e := range pl.Entries {
+		n := i + 1
+		fmt.Fprintf(bw, "File%d=%s\n", n, e.Location)
+		name := e.Title
+		if e.Artist != "" {
+			name = e.Artist + " - " + e.Title
+		}
+		if name != "" {
+			fmt.Fprintf(bw, "Title%d=%s\n", n, name)
+		}
+		sec := -1
+		if e.Duration > 0 {
+			sec = int(e.Duration.Round(time.Second) / time.Second)
+		}
+		fmt.Fprintf(bw, "Length%d=%d\n", n, sec)
+	}
+	fmt.Fprintf(bw, "NumberOfEntries=%d\nVersion=2\n", len(pl.Entries))
+	return bw.Flush()
+}
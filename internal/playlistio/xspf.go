@@ -0,0 +1,95 @@
+package playlistio
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+type xspfTrack struct {
+	Location []string `xml:"location"`
+	Title    string   `xml:"title,omitempty"`
+	Creator  string   `xml:"creator,omitempty"`
+	Album    string   `xml:"album,omitempty"`
+	Duration int64    `xml:"duration,omitempty"` // milliseconds
+}
+
+// parseXSPF reads an XSPF playlist. Locations are URIs; relative ones are
+// unescaped into plain paths.
+func parseXSPF(b []byte) (*Playlist, error) {
+	var x xspfPlaylist
+	if err := xml.Unmarshal(b, &x); err != nil {
+		return nil, err
+	}
+	pl := &Playlist{Title: strings.TrimSpace(x.Title)}
+	for _, t := range x.Tracks {
+		e := Entry{
+			Title:    strings.TrimSpace(t.Title),
+			Artist:   strings.TrimSpace(t.Creator),
+			Album:    strings.TrimSpace(t.Album),
+			Duration: time.Duration(t.Duration) * time.Millisecond,
+		}
+		if len(t.Location) > 0 {
+			e.Location = strings.TrimSpace(t.Location[0])
+			if u, err := url.Parse(e.Location); err == nil && u.Scheme == "" {
+				e.Location = u.Path
+				if u.Fragment != "" {
+					e.Location += "#" + u.Fragment
+				}
+			}
+		}
+		if e.Location != "" || e.Title != "" {
+			pl.Entries = append(pl.Entries, e)
+		}
+	}
+	return pl, nil
+}
+
+func writeXSPF(w io.Writer, pl *Playlist) error {
+	x := xspfPlaylist{Version: "1", Title: pl.Title}
+	for _, e := range pl.Entries {
+		x.Tracks = append(x.Tracks, xspfTrack{
+			Location: []string{locationURI(e.Location)},
+			Title:    e.Title,
+			Creator:  e.Artist,
+			Album:    e.Album,
+			Duration: e.Duration.Milliseconds(),
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(x); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// locationURI turns a slash-separated path into a URI: file:// for
+// absolute paths, an escaped relative reference otherwise.
+func locationURI(loc string) string {
+	u := &url.URL{Path: loc}
+	if isDrivePath(loc) {
+		u.Scheme, u.Path = "file", "/"+loc
+	} else if filepath.IsAbs(filepath.FromSlash(loc)) {
+		u.Scheme = "file"
+	}
+	s := u.String()
+	if u.Scheme == "file" && !strings.HasPrefix(s, "file://") {
+		s = "file://" + strings.TrimPrefix(s, "file:")
+	}
+	return s
+}
@@ -0,0 +1,291 @@
+// Package queue keeps the play order of the local player, including the
+// shuffle and repeat modes.
+package queue
+
+import (
+	"math/rand"
+	"sort"
+
+	"opentify/internal/shuffle"
+)
+
+// Shuffle modes, as stored in the settings.
+const (
+	ShuffleOff      = ""
+	ShuffleRandom   = "random"   // every pick is independent; tracks may repeat
+	ShuffleExhaust  = "exhaust"  // each track once before any repeats
+	ShuffleAlbum    = "album"    // albums in random order, tracks in order
+	ShuffleWeighted = "weighted" // favours liked, high rated, not recently played
+)
+
+// Repeat modes, as stored in the settings.
+const (
+	RepeatOff = "off"
+	RepeatAll = "all"
+	RepeatOne = "one"
+)
+
+// Info is what the shuffle modes need to know about a track.
+type Info struct {
+	Album  string // album key; tracks with the same key are kept together
+	Disc   int
+	Track  int
+	Weight float64 // for ShuffleWeighted
+}
+
+// Queue is the play order built from a list of tracks. The order is
+// generated up front (or, for ShuffleRandom, as it is played) and kept,
+// so going back returns to the tracks actually played. It is not safe for
+// concurrent use.
+type Queue struct {
+	items   []string
+	order   []string
+	pos     int
+	shuffle string
+	Repeat  string
+	rng     *rand.Rand
+	info    func(path string) Info
+}
+
+// New returns a queue over paths positioned at paths[start]; a start out
+// of range lets the shuffle pick the first track. seed makes the order
+// reproducible; info may be nil when no mode needs it.
+func New(paths []string, start int, mode, repeat string, seed int64, info func(path string) Info) *Queue {
+	if info == nil {
+		info = func(string) Info { return Info{} }
+	}
+	q := &Queue{
+		items:   append([]string(nil), paths...),
+		shuffle: mode,
+		Repeat:  repeat,
+		rng:     rand.New(rand.NewSource(seed)),
+		info:    info,
+	}
+	first := ""
+	if start >= 0 && start < len(paths) {
+		first = paths[start]
+	}
+	q.order = q.cycle(first)
+	if q.shuffle == ShuffleOff && first != "" {
+		q.pos = start
+	}
+	return q
+}
+
+// Len is the number of tracks the queue was built from.
+func (q *Queue) Len() int { return len(q.items) }
+
+// Shuffle returns the shuffle mode.
+func (q *Queue) Shuffle() string { return q.shuffle }
+
+// Current returns the track at the current position.
+func (q *Queue) Current() (string, bool) {
+	if q.pos < 0 || q.pos >= len(q.order) {
+		return "", false
+	}
+	return q.order[q.pos], true
+}
+
+// Peek returns the track that would follow when the current one ends,
+// without moving.
+func (q *Queue) Peek() (string, bool) {
+	if q.Repeat == RepeatOne {
+		return q.Current()
+	}
+	if q.pos+1 < len(q.order) {
+		return q.order[q.pos+1], true
+	}
+	if !q.canExtend() {
+		return "", false
+	}
+	q.order = append(q.order, q.cycle("")...)
+	return q.order[q.pos+1], q.pos+1 < len(q.order)
+}
+
+// Next moves on. ended is set when the current track played to its end,
+// which is the only case repeat-one keeps it. ok is false at the end of
+// the queue.
+func (q *Queue) Next(ended bool) (string, bool) {
+	if ended && q.Repeat == RepeatOne {
+		return q.Current()
+	}
+	if q.pos+1 >= len(q.order) {
+		if !q.canExtend() {
+			return "", false
+		}
+		q.order = append(q.order, q.cycle("")...)
+		if q.pos+1 >= len(q.order) {
+			return "", false
+		}
+	}
+	q.pos++
+	return q.order[q.pos], true
+}
+
+// Prev moves back to the track played before the current one.
+func (q *Queue) Prev() (string, bool) {
+	if q.pos <= 0 {
+		if q.Repeat == RepeatAll && q.shuffle == ShuffleOff && len(q.order) > 0 {
+			q.pos = len(q.order) - 1
+			return q.order[q.pos], true
+		}
+		return "", false
+	}
+	q.pos--
+	return q.order[q.pos], true
+}
+
+// SetShuffle switches the shuffle mode. The tracks already played stay
+// where they are; the rest of the queue is reordered after the current
+// track.
+func (q *Queue) SetShuffle(mode string) {
+	if mode == q.shuffle {
+		return
+	}
+	q.shuffle = mode
+	cur, ok := q.Current()
+	if !ok {
+		q.order, q.pos = q.cycle(""), 0
+		return
+	}
+	if mode == ShuffleOff {
+		// Continue in list order after the current track.
+		for i, p := range q.items {
+			if p == cur {
+				q.order, q.pos = append([]string(nil), q.items...), i
+				return
+			}
+		}
+	}
+	// Tracks already passed are not queued again in this pass.
+	passed := map[string]bool{}
+	for _, p := range q.order[:q.pos] {
+		passed[p] = true
+	}
+	rest := q.cycle(cur)
+	if mode != ShuffleRandom {
+		kept := rest[:0]
+		for _, p := range rest {
+			if !passed[p] {
+				kept = append(kept, p)
+			}
+		}
+		rest = kept
+	}
+	q.order = append(q.order[:q.pos], rest...)
+}
+
+// Rename replaces moved tracks (old path -> new path).
+func (q *Queue) Rename(m map[string]string) {
+	for _, s := range [][]string{q.items, q.order} {
+		for i, p := range s {
+			if np, ok := m[p]; ok {
+				s[i] = np
+			}
+		}
+	}
+}
+
+// canExtend reports whether another cycle follows the end of the order.
+func (q *Queue) canExtend() bool {
+	if len(q.items) == 0 {
+		return false
+	}
+	if q.Repeat == RepeatAll {
+		return true
+	}
+	// True random has no natural end; it stops after as many tracks as
+	// the list has.
+	return q.shuffle == ShuffleRandom && len(q.order) < len(q.items)
+}
+
+// cycle returns one pass over the items in the current mode, starting with
+// first when it is set.
+func (q *Queue) cycle(first string) []string {
+	var out []string
+	switch q.shuffle {
+	case ShuffleOff:
+		return append(out, q.items...)
+	case ShuffleRandom:
+		p := first
+		if p == "" {
+			p = q.pick()
+		}
+		return []string{p}
+	case ShuffleAlbum:
+		out = q.albums(first)
+	case ShuffleWeighted:
+		out = shuffle.Weighted(q.items, func(p string) float64 { return q.info(p).Weight }, q.rng)
+	default: // ShuffleExhaust
+		out = append(out, q.items...)
+		q.rng.Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	}
+	if first != "" && q.shuffle != ShuffleAlbum {
+		out = moveFirst(out, first)
+	} else if first == "" && len(q.order) > 0 && len(out) > 1 && out[0] == q.order[len(q.order)-1] {
+		// Do not play the last track of the previous pass twice in a row.
+		out[0], out[len(out)-1] = out[len(out)-1], out[0]
+	}
+	return out
+}
+
+// pick chooses a random track, avoiding the one just played.
+func (q *Queue) pick() string {
+	p := q.items[q.rng.Intn(len(q.items))]
+	if len(q.items) > 1 && len(q.order) > 0 && p == q.order[len(q.order)-1] {
+		p = q.items[q.rng.Intn(len(q.items))]
+	}
+	return p
+}
+
+// albums shuffles the albums and keeps each one in disc/track order. The
+// album of first goes first, starting at first.
+func (q *Queue) albums(first string) []string {
+	groups := map[string][]string{}
+	var keys []string
+	for _, p := range q.items {
+		k := q.info(p).Album
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], p)
+	}
+	for _, g := range groups {
+		sort.SliceStable(g, func(i, j int) bool {
+			a, b := q.info(g[i]), q.info(g[j])
+			if a.Disc != b.Disc {
+				return a.Disc < b.Disc
+			}
+			return a.Track < b.Track
+		})
+	}
+	q.rng.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+	var out []string
+	if first != "" {
+		k := q.info(first).Album
+		g := groups[k]
+		for i, p := range g {
+			if p == first {
+				out = append(out, g[i:]...)
+				break
+			}
+		}
+		delete(groups, k)
+	}
+	for _, k := range keys {
+		out = append(out, groups[k]...)
+	}
+	return out
+}
+
+// moveFirst moves p to the front of s.
+func moveFirst(s []string, p string) []string {
+	for i, v := range s {
+		if v == p {
+			copy(s[1:i+1], s[:i])
+			s[0] = p
+			break
+		}
+	}
+	return s
+}
@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+var testPaths = []string{"a1", "a2", "a3", "b1", "b2", "c1", "c2", "c3", "c4"}
+
+// testInfo puts "b2" before "b1" by track number to show albums are
+// sorted, not kept in list order.
+func testInfo(p string) Info {
+	n := int(p[1] - '0')
+	if p == "b1" {
+		n = 5
+	}
+	return Info{Album: p[:1], Track: n, Weight: 1}
+}
+
+// play returns the current track and the next n-1 ones.
+func play(q *Queue, n int) []string {
+	var out []string
+	if p, ok := q.Current(); ok {
+		out = append(out, p)
+	}
+	for len(out) < n {
+		p, ok := q.Next(false)
+		if !ok {
+			break
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+func isPermutation(a []string) bool {
+	s := slices.Clone(a)
+	slices.Sort(s)
+	return slices.Equal(s, testPaths)
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		mode, repeat string
+		start        int
+		n            int
+		check        func(got []string) bool
+	}{
+		{ShuffleOff, RepeatOff, 2, 20, func(got []string) bool {
+			return slices.Equal(got, testPaths[2:])
+		}},
+		{ShuffleOff, RepeatAll, 7, 4, func(got []string) bool {
+			return strings.Join(got, " ") == "c3 c4 a1 a2"
+		}},
+		{ShuffleExhaust, RepeatOff, 4, 20, func(got []string) bool {
+			return got[0] == "b2" && isPermutation(got)
+		}},
+		{ShuffleExhaust, RepeatAll, 0, 18, func(got []string) bool {
+			// Two full passes, no track twice in a row at the seam
+			return isPermutation(got[:9]) && isPermutation(got[9:]) && got[8] != got[9]
+		}},
+		{ShuffleRandom, RepeatOff, 3, 50, func(got []string) bool {
+			for i := 1; i < len(got); i++ {
+				if got[i] == got[i-1] {
+					return false
+				}
+			}
+			return len(got) == len(testPaths) && got[0] == "b1"
+		}},
+		{ShuffleAlbum, RepeatOff, 5, 20, func(got []string) bool {
+			// The album of the start track from there on, then the
+			// others whole and in track order
+			s := strings.Join(got, " ")
+			return strings.HasPrefix(s, "c1 c2 c3 c4 ") && len(got) == 9 &&
+				(strings.HasSuffix(s, "a1 a2 a3 b2 b1") || strings.HasSuffix(s, "b2 b1 a1 a2 a3"))
+		}},
+		// Tracks before the start in its album wait for the next pass
+		{ShuffleAlbum, RepeatOff, 6, 20, func(got []string) bool {
+			return strings.HasPrefix(strings.Join(got, " "), "c2 c3 c4 ") && len(got) == 8
+		}},
+		{ShuffleWeighted, RepeatOff, 1, 20, func(got []string) bool {
+			return got[0] == "a2" && isPermutation(got)
+		}},
+	}
+	for _, tt := range tests {
+		q := New(testPaths, tt.start, tt.mode, tt.repeat, 42, testInfo)
+		got := play(q, tt.n)
+		if !tt.check(got) {
+			t.Errorf("%s/%s from %d: %v", tt.mode, tt.repeat, tt.start, got)
+		}
+		if again := play(New(testPaths, tt.start, tt.mode, tt.repeat, 42, testInfo), tt.n); !slices.Equal(got, again) {
+			t.Errorf("%s/%s: same seed, other order", tt.mode, tt.repeat)
+		}
+	}
+}
+
+func TestWeightedPrefersHeavyTracks(t *testing.T) {
+	info := func(p string) Info {
+		if p == "c4" {
+			return Info{Weight: 100}
+		}
+		return Info{Weight: 1}
+	}
+	first := 0
+	for seed := range int64(200) {
+		if p, _ := New(testPaths, -1, ShuffleWeighted, RepeatOff, seed, info).Current(); p == "c4" {
+			first++
+		}
+	}
+	if first < 100 {
+		t.Errorf("heavy track first in %d of 200 queues", first)
+	}
+}
+
+func TestRepeatOneAndPrev(t *testing.T) {
+	q := New(testPaths, 0, ShuffleExhaust, RepeatOne, 1, nil)
+	if p, _ := q.Next(true); p != "a1" {
+		t.Errorf("Next after the end with repeat one = %s", p)
+	}
+	if p, _ := q.Peek(); p != "a1" {
+		t.Errorf("Peek with repeat one = %s", p)
+	}
+	next, _ := q.Next(false) // skipping leaves the track
+	if next == "a1" {
+		t.Error("skip kept the track")
+	}
+	if p, _ := q.Prev(); p != "a1" {
+		t.Errorf("Prev = %s, want a1", p)
+	}
+	if p, _ := q.Next(false); p != next {
+		t.Errorf("Next after Prev = %s, want %s again", p, next)
+	}
+	if _, ok := New(testPaths, 0, ShuffleOff, RepeatOff, 1, nil).Prev(); ok {
+		t.Error("Prev before the first track")
+	}
+	if p, _ := New(testPaths, 0, ShuffleOff, RepeatAll, 1, nil).Prev(); p != "c4" {
+		t.Errorf("Prev with repeat all = %s, want c4", p)
+	}
+}
+
+func TestSetShuffle(t *testing.T) {
+	q := New(testPaths, 0, ShuffleOff, RepeatOff, 7, testInfo)
+	played := play(q, 3) // a1 a2 a3
+	q.SetShuffle(ShuffleExhaust)
+	if p, _ := q.Current(); p != "a3" {
+		t.Fatalf("current %s after switching, want a3", p)
+	}
+	rest := play(q, 20)[1:]
+	for _, p := range rest {
+		if slices.Contains(played, p) {
+			t.Errorf("%s queued again after switching: %v", p, rest)
+		}
+	}
+	if len(rest) != 6 {
+		t.Errorf("rest %v, want the 6 unplayed tracks", rest)
+	}
+	q = New(testPaths, 4, ShuffleExhaust, RepeatOff, 7, testInfo)
+	q.Next(false)
+	cur, _ := q.Current()
+	q.SetShuffle(ShuffleOff)
+	i := slices.Index(testPaths, cur)
+	if got := play(q, 20); !slices.Equal(got, testPaths[i:]) {
+		t.Errorf("after turning shuffle off: %v, want %v", got, testPaths[i:])
+	}
+}
+
+func TestRename(t *testing.T) {
+	q := New(testPaths, 0, ShuffleOff, RepeatOff, 1, nil)
+	q.Rename(map[string]string{"a1": "x1", "a2": "x2"})
+	if got := play(q, 2); strings.Join(got, " ") != "x1 x2" {
+		t.Errorf("after Rename: %v", got)
+	}
+}
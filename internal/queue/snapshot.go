@@ -0,0 +1,62 @@
+package queue
+
+import "math/rand"
+
+// Snapshot is the state of a queue, kept between sessions.
+type Snapshot struct {
+	Items   []string `json:"items"`
+	Order   []string `json:"order"`
+	Pos     int      `json:"pos"`
+	Shuffle string   `json:"shuffle,omitempty"`
+}
+
+// Snapshot returns the tracks, the play order and the position of q.
+func (q *Queue) Snapshot() Snapshot {
+	return Snapshot{
+		Items:   append([]string(nil), q.items...),
+		Order:   append([]string(nil), q.order...),
+		Pos:     q.pos,
+		Shuffle: q.shuffle,
+	}
+}
+
+// Map returns s with every track passed through fn, for example to turn
+// paths into IDs and back. Tracks fn rejects are left out; the position
+// stays on the current track, or the one after it when that is left out.
+func (s Snapshot) Map(fn func(string) (string, bool)) Snapshot {
+	out := Snapshot{Shuffle: s.Shuffle}
+	for _, p := range s.Items {
+		if p, ok := fn(p); ok {
+			out.Items = append(out.Items, p)
+		}
+	}
+	for i, p := range s.Order {
+		if i == s.Pos {
+			out.Pos = len(out.Order)
+		}
+		if p, ok := fn(p); ok {
+			out.Order = append(out.Order, p)
+		}
+	}
+	return out
+}
+
+// Restore rebuilds a queue from s; the arguments after s are those of New.
+// It returns nil when no track of s is left.
+func Restore(s Snapshot, repeat string, seed int64, info func(path string) Info) *Queue {
+	if len(s.Items) == 0 || len(s.Order) == 0 {
+		return nil
+	}
+	if info == nil {
+		info = func(string) Info { return Info{} }
+	}
+	return &Queue{
+		items:   append([]string(nil), s.Items...),
+		order:   append([]string(nil), s.Order...),
+		pos:     min(max(s.Pos, 0), len(s.Order)-1),
+		shuffle: s.Shuffle,
+		Repeat:  repeat,
+		rng:     rand.New(rand.NewSource(seed)),
+		info:    info,
+	}
+}
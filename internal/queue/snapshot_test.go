@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	q := New(testPaths, 2, ShuffleExhaust, RepeatOff, 3, testInfo)
+	q.Next(false)
+	q.Next(false)
+	b, err := json.Marshal(q.Snapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	r := Restore(s, RepeatOff, 9, testInfo)
+	if r.Shuffle() != ShuffleExhaust || r.Len() != q.Len() {
+		t.Errorf("restored %s with %d tracks", r.Shuffle(), r.Len())
+	}
+	// The restored queue plays the rest of the pass, and goes back,
+	// exactly like the original
+	want, got := play(q, 9), play(r, 9)
+	if !slices.Equal(got, want) {
+		t.Errorf("after restoring: %v, want %v", got, want)
+	}
+	for range 5 {
+		a, _ := q.Prev()
+		b, _ := r.Prev()
+		if a != b {
+			t.Errorf("Prev = %s, want %s", b, a)
+		}
+	}
+	// The snapshot is a copy
+	s.Order[0] = "changed"
+	if p := r.Snapshot().Order[0]; p == "changed" {
+		t.Error("restored queue shares the snapshot")
+	}
+}
+
+func TestSnapshotMap(t *testing.T) {
+	s := Snapshot{Items: []string{"a", "b", "c", "d"}, Order: []string{"d", "b", "a", "c"}, Shuffle: ShuffleExhaust}
+	upper := func(keep ...string) func(string) (string, bool) {
+		return func(p string) (string, bool) { return strings.ToUpper(p), slices.Contains(keep, p) }
+	}
+	tests := []struct {
+		pos  int
+		keep []string
+		want Snapshot
+	}{
+		{1, []string{"a", "b", "c", "d"}, Snapshot{Items: []string{"A", "B", "C", "D"}, Order: []string{"D", "B", "A", "C"}, Pos: 1}},
+		// The current track is gone: the next one is current
+		{1, []string{"a", "c", "d"}, Snapshot{Items: []string{"A", "C", "D"}, Order: []string{"D", "A", "C"}, Pos: 1}},
+		{2, []string{"b", "c"}, Snapshot{Items: []string{"B", "C"}, Order: []string{"B", "C"}, Pos: 1}},
+		{0, nil, Snapshot{}},
+	}
+	for _, tt := range tests {
+		in := s
+		in.Pos = tt.pos
+		got := in.Map(upper(tt.keep...))
+		tt.want.Shuffle = ShuffleExhaust
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Map at %d keeping %v = %+v, want %+v", tt.pos, tt.keep, got, tt.want)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	if q := Restore(Snapshot{}, RepeatOff, 1, nil); q != nil {
+		t.Error("empty snapshot restored")
+	}
+	// A position past the end (its track was left out) is clamped
+	q := Restore(Snapshot{Items: []string{"a", "b"}, Order: []string{"b", "a"}, Pos: 5}, RepeatOff, 1, nil)
+	if p, _ := q.Current(); p != "a" {
+		t.Errorf("current %s, want a", p)
+	}
+	if _, ok := q.Next(false); ok {
+		t.Error("Next at the end without repeat")
+	}
+}
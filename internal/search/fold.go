@@ -0,0 +1,61 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Letters that do not decompose into a base letter plus combining marks.
+var foldSpecial = map[rune]rune{
+	'ı': 'i', 'İ': 'i', 'ø': 'o', 'Ø': 'o', 'ł': 'l', 'Ł': 'l', 'đ': 'd',
+	'Đ': 'd', 'ß': 's', 'æ': 'a', 'Æ': 'a', 'œ': 'o', 'Œ': 'o', 'þ': 't',
+}
+
+// foldRune lower-cases r and strips diacritics ("Ş" -> 's', "é" -> 'e').
+// It always maps one rune to one rune so highlight offsets stay aligned.
+func foldRune(r rune) rune {
+	if r < 0x80 {
+		return unicode.ToLower(r)
+	}
+	if f, ok := foldSpecial[r]; ok {
+		return f
+	}
+	d := norm.NFD.String(string(r))
+	for _, c := range d {
+		if !unicode.Is(unicode.Mn, c) {
+			return unicode.ToLower(c)
+		}
+	}
+	return unicode.ToLower(r)
+}
+
+// Fold lower-cases s and strips diacritics so "Şarkı" and "sarki" compare
+// equal.
+func Fold(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	for _, r := range s {
+		b.WriteRune(foldRune(r))
+	}
+	return b.String()
+}
+
+// foldWithOffsets folds s and returns, for every rune of the result, the byte
+// offset of the originating rune in s (plus a final entry for len(s)).
+func foldWithOffsets(s string) ([]rune, []int) {
+	out := make([]rune, 0, len(s))
+	offs := make([]int, 0, len(s)+1)
+	for i, r := range s {
+		out = append(out, foldRune(r))
+		offs = append(offs, i)
+	}
+	offs = append(offs, len(s))
+	return out, offs
+}
+
+// words splits folded text into alphanumeric words.
+func words(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return !isWordRune(r) })
+}
@@ -0,0 +1,90 @@
+package search
+
+import (
+	"sort"
+	"unicode"
+)
+
+// Span is a byte range [Start, End) of a highlighted part of a string.
+type Span struct{ Start, End int }
+
+// Highlight returns the parts of text matched by the query's positive text
+// terms, sorted and merged. Offsets refer to the original (unfolded) text.
+func (q *Query) Highlight(text string) []Span {
+	if q.Empty() || len(q.positive) == 0 || text == "" {
+		return nil
+	}
+	folded, offs := foldWithOffsets(text)
+	var spans [][2]int // rune ranges
+	addAll := func(needle []rune) {
+		for i := 0; i+len(needle) <= len(folded); i++ {
+			if runesEqual(folded[i:i+len(needle)], needle) {
+				spans = append(spans, [2]int{i, i + len(needle)})
+			}
+		}
+	}
+	type wordPos struct{ start, end int }
+	var ws []wordPos
+	start := -1
+	for i, r := range folded {
+		word := isWordRune(r)
+		if word && start < 0 {
+			start = i
+		}
+		if !word && start >= 0 {
+			ws = append(ws, wordPos{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		ws = append(ws, wordPos{start, len(folded)})
+	}
+
+	for _, t := range q.positive {
+		needle := []rune(t.text)
+		if len(needle) == 0 {
+			continue
+		}
+		before := len(spans)
+		addAll(needle)
+		if t.phrase || len(spans) > before {
+			continue
+		}
+		// No literal hit: mark words that matched with typos.
+		limit := maxTypos(len(needle))
+		for _, w := range ws {
+			wr := folded[w.start:w.end]
+			if editDistance(needle, wr, limit) <= limit {
+				spans = append(spans, [2]int{w.start, w.end})
+			} else if len(wr) > len(needle) && editDistance(needle, wr[:len(needle)], limit) <= limit {
+				spans = append(spans, [2]int{w.start, w.start + len(needle)})
+			}
+		}
+	}
+	if len(spans) == 0 {
+		return nil
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var out []Span
+	cur := spans[0]
+	for _, s := range spans[1:] {
+		if s[0] <= cur[1] {
+			cur[1] = max(cur[1], s[1])
+			continue
+		}
+		out = append(out, Span{offs[cur[0]], offs[cur[1]]})
+		cur = s
+	}
+	return append(out, Span{offs[cur[0]], offs[cur[1]]})
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }
@@ -0,0 +1,270 @@
+package search
+
+import (
+	"sort"
+	"strings"
+)
+
+// Doc is a searchable record. Text holds the free-text fields ("title",
+// "artist", "album", "albumartist", "genre", "file", "ext"), Numbers the
+// numeric ones ("year", "duration" in seconds, ...) and Flags booleans such
+// as "liked".
+type Doc struct {
+	ID      string
+	Text    map[string]string
+	Numbers map[string]float64
+	Flags   map[string]bool
+
+	folded map[string]string
+}
+
+// Result is a matching document and its relevance.
+type Result struct {
+	ID    string
+	Score float64
+}
+
+// Weights of the fields searched by unqualified terms.
+var freeTextWeights = map[string]float64{
+	"title":       1.0,
+	"artist":      0.9,
+	"albumartist": 0.8,
+	"album":       0.8,
+	"file":        0.7,
+	"genre":       0.5,
+}
+
+// filterScore is what a matching non-text condition contributes, so that
+// ranking is driven by text relevance.
+const filterScore = 0.1
+
+func (d *Doc) fold(field string) string {
+	if d.folded == nil {
+		d.folded = make(map[string]string, len(d.Text))
+	}
+	f, ok := d.folded[field]
+	if !ok {
+		f = Fold(d.Text[field])
+		d.folded[field] = f
+	}
+	return f
+}
+
+// Run returns the documents matching q, best first. Documents with equal
+// scores keep their input order. An empty query returns every document.
+func Run(q *Query, docs []Doc) []Result {
+	out := make([]Result, 0, len(docs))
+	for i := range docs {
+		if q.Empty() {
+			out = append(out, Result{ID: docs[i].ID})
+			continue
+		}
+		if score, ok := eval(q.root, &docs[i]); ok {
+			out = append(out, Result{ID: docs[i].ID, Score: score})
+		}
+	}
+	if !q.Empty() {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Score > out[j].Score })
+	}
+	return out
+}
+
+// Match reports whether d satisfies q and its score.
+func (q *Query) Match(d *Doc) (float64, bool) {
+	if q.Empty() {
+		return 0, true
+	}
+	return eval(q.root, d)
+}
+
+func eval(n node, d *Doc) (float64, bool) {
+	switch n := n.(type) {
+	case andNode:
+		total := 0.0
+		for _, c := range n {
+			s, ok := eval(c, d)
+			if !ok {
+				return 0, false
+			}
+			total += s
+		}
+		return total, true
+	case orNode:
+		best, any := 0.0, false
+		for _, c := range n {
+			if s, ok := eval(c, d); ok {
+				any = true
+				if s > best {
+					best = s
+				}
+			}
+		}
+		return best, any
+	case notNode:
+		_, ok := eval(n.n, d)
+		return filterScore, !ok
+	case *term:
+		s := n.score(d)
+		return s, s > 0
+	}
+	return 0, false
+}
+
+func (t *term) score(d *Doc) float64 {
+	switch t.kind {
+	case kindText:
+		if t.field != "" {
+			return matchText(t, d.fold(t.field))
+		}
+		best := 0.0
+		for f, w := range freeTextWeights {
+			if s := matchText(t, d.fold(f)) * w; s > best {
+				best = s
+			}
+		}
+		return best
+	case kindExact:
+		if d.fold(t.field) == t.text {
+			return filterScore
+		}
+	case kindBool:
+		if d.Flags[t.field] == t.flag {
+			return filterScore
+		}
+	case kindNumber, kindDuration:
+		v, ok := d.Numbers[t.field]
+		if !ok || (t.kind == kindDuration && v <= 0) {
+			return 0
+		}
+		if compare(v, t) {
+			return filterScore
+		}
+	}
+	return 0
+}
+
+func compare(v float64, t *term) bool {
+	switch t.op {
+	case "<":
+		return v < t.num
+	case "<=":
+		return v <= t.num
+	case ">":
+		return v > t.num
+	case ">=":
+		return v >= t.num
+	case "..":
+		return v >= t.num && v <= t.num2
+	}
+	if t.kind == kindDuration {
+		return v >= t.num && v < t.num+1 // whole seconds
+	}
+	return v == t.num
+}
+
+// matchText scores a text term against a folded field value:
+// 1 exact word, 0.9 word prefix, 0.75 substring, below that typo matches.
+func matchText(t *term, folded string) float64 {
+	if folded == "" {
+		return 0
+	}
+	if t.phrase {
+		if strings.Contains(folded, t.text) {
+			return 1
+		}
+		return 0
+	}
+	best := 0.0
+	for _, w := range words(folded) {
+		switch {
+		case w == t.text:
+			return 1
+		case strings.HasPrefix(w, t.text):
+			best = max(best, 0.9)
+		}
+	}
+	if best > 0 {
+		return best
+	}
+	if strings.Contains(folded, t.text) {
+		return 0.75
+	}
+	return fuzzyScore(t.text, words(folded))
+}
+
+// maxTypos is how many edits a query word of n runes may contain.
+func maxTypos(n int) int {
+	switch {
+	case n < 3:
+		return 0
+	case n <= 5:
+		return 1
+	case n <= 10:
+		return 2
+	}
+	return 3
+}
+
+// fuzzyScore matches q against whole words or word prefixes within the
+// allowed edit distance.
+func fuzzyScore(q string, ws []string) float64 {
+	qr := []rune(q)
+	limit := maxTypos(len(qr))
+	if limit == 0 {
+		return 0
+	}
+	best := 0.0
+	for _, w := range ws {
+		wr := []rune(w)
+		if d := editDistance(qr, wr, limit); d <= limit {
+			best = max(best, 0.6*(1-float64(d)/float64(len(qr)+1)))
+		}
+		if len(wr) > len(qr) {
+			if d := editDistance(qr, wr[:len(qr)], limit); d <= limit {
+				best = max(best, 0.5*(1-float64(d)/float64(len(qr)+1)))
+			}
+		}
+	}
+	return best
+}
+
+// editDistance is the optimal string alignment distance (Levenshtein plus
+// adjacent transpositions). It gives up early once limit is exceeded.
+func editDistance(a, b []rune, limit int) int {
+	if abs(len(a)-len(b)) > limit {
+		return limit + 1
+	}
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
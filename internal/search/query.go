@@ -0,0 +1,380 @@
+// Package search implements the local library query language: free text
+// with typo-tolerant, diacritic-insensitive matching, field qualifiers
+// (artist:, year:>2010, duration:<3m, liked:true, ...), quoted phrases and
+// AND/OR/NOT with parentheses.
+package search
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Field kinds understood by the query language.
+const (
+	kindText = iota
+	kindExact
+	kindNumber
+	kindDuration
+	kindBool
+)
+
+type fieldDef struct {
+	name string
+	kind int
+}
+
+// Field names and their aliases (compared after folding).
+var fields = map[string]fieldDef{
+	"title":       {"title", kindText},
+	"baslik":      {"title", kindText},
+	"artist":      {"artist", kindText},
+	"sanatci":     {"artist", kindText},
+	"album":       {"album", kindText},
+	"albumartist": {"albumartist", kindText},
+	"genre":       {"genre", kindText},
+	"tur":         {"genre", kindText},
+	"file":        {"file", kindText},
+	"path":        {"file", kindText},
+	"dosya":       {"file", kindText},
+	"ext":         {"ext", kindExact},
+	"format":      {"ext", kindExact},
+	"year":        {"year", kindNumber},
+	"yil":         {"year", kindNumber},
+	"duration":    {"duration", kindDuration},
+	"sure":        {"duration", kindDuration},
+	"liked":       {"liked", kindBool},
+	"begenildi":   {"liked", kindBool},
+}
+
+// RegisterNumberField adds a numeric field (for example "rating" or
+// "plays") with optional aliases.
+func RegisterNumberField(name string, aliases ...string) {
+	for _, n := range append([]string{name}, aliases...) {
+		fields[Fold(n)] = fieldDef{name, kindNumber}
+	}
+}
+
+// RegisterBoolField adds a boolean flag field with optional aliases.
+func RegisterBoolField(name string, aliases ...string) {
+	for _, n := range append([]string{name}, aliases...) {
+		fields[Fold(n)] = fieldDef{name, kindBool}
+	}
+}
+
+type node interface{}
+
+type (
+	andNode []node
+	orNode  []node
+	notNode struct{ n node }
+)
+
+// term is a single condition. field is "" for free text.
+type term struct {
+	field  string
+	kind   int
+	text   string // folded value for text terms
+	phrase bool
+	op     string // "", "=", "<", "<=", ">", ">="; ".." for ranges
+	num    float64
+	num2   float64
+	flag   bool
+}
+
+// Query is a parsed search expression.
+type Query struct {
+	root     node
+	positive []*term // text terms used for highlighting
+}
+
+// Empty reports whether the query matches everything without ranking.
+func (q *Query) Empty() bool { return q == nil || q.root == nil }
+
+type tokKind int
+
+const (
+	tokTerm tokKind = iota
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind   tokKind
+	raw    string
+	phrase bool
+}
+
+func lex(s string) []token {
+	var toks []token
+	rs := []rune(s)
+	i := 0
+	readQuoted := func() string {
+		i++ // opening quote
+		start := i
+		for i < len(rs) && rs[i] != '"' {
+			i++
+		}
+		v := string(rs[start:i])
+		if i < len(rs) {
+			i++
+		}
+		return v
+	}
+	for i < len(rs) {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			toks = append(toks, token{kind: tokLParen})
+			i++
+		case r == ')':
+			toks = append(toks, token{kind: tokRParen})
+			i++
+		case (r == '-' || r == '!') && i+1 < len(rs) && !unicode.IsSpace(rs[i+1]):
+			toks = append(toks, token{kind: tokNot})
+			i++
+		case r == '"':
+			toks = append(toks, token{kind: tokTerm, raw: readQuoted(), phrase: true})
+		default:
+			start := i
+			for i < len(rs) && !unicode.IsSpace(rs[i]) && rs[i] != '(' && rs[i] != ')' {
+				if rs[i] == ':' && i+1 < len(rs) && rs[i+1] == '"' {
+					prefix := string(rs[start : i+1])
+					i++
+					toks = append(toks, token{kind: tokTerm, raw: prefix + readQuoted(), phrase: true})
+					start = -1
+					break
+				}
+				i++
+			}
+			if start < 0 {
+				continue
+			}
+			w := string(rs[start:i])
+			switch w {
+			case "OR", "|", "||":
+				toks = append(toks, token{kind: tokOr})
+			case "AND", "&&":
+				toks = append(toks, token{kind: tokAnd})
+			case "NOT":
+				toks = append(toks, token{kind: tokNot})
+			default:
+				toks = append(toks, token{kind: tokTerm, raw: w})
+			}
+		}
+	}
+	return toks
+}
+
+type parser struct {
+	toks []token
+	pos  int
+	q    *Query
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.toks) {
+		return token{}, false
+	}
+	return p.toks[p.pos], true
+}
+
+// Parse compiles a query string. Parsing is lenient: unbalanced parentheses
+// and unknown fields never fail, they fall back to plain text matching.
+func Parse(s string) *Query {
+	q := &Query{}
+	p := &parser{toks: lex(s), q: q}
+	var parts []node
+	for p.pos < len(p.toks) {
+		if n := p.parseOr(); n != nil {
+			parts = append(parts, n)
+		}
+		if t, ok := p.peek(); ok && t.kind == tokRParen {
+			p.pos++ // stray ")"
+		}
+	}
+	switch len(parts) {
+	case 0:
+	case 1:
+		q.root = parts[0]
+	default:
+		q.root = andNode(parts)
+	}
+	return q
+}
+
+func (p *parser) parseOr() node {
+	var alts []node
+	for {
+		if n := p.parseAnd(); n != nil {
+			alts = append(alts, n)
+		}
+		t, ok := p.peek()
+		if !ok || t.kind != tokOr {
+			break
+		}
+		p.pos++
+	}
+	switch len(alts) {
+	case 0:
+		return nil
+	case 1:
+		return alts[0]
+	}
+	return orNode(alts)
+}
+
+func (p *parser) parseAnd() node {
+	var items []node
+	for {
+		t, ok := p.peek()
+		if !ok || t.kind == tokOr || t.kind == tokRParen {
+			break
+		}
+		if t.kind == tokAnd {
+			p.pos++
+			continue
+		}
+		if n := p.parseUnary(false); n != nil {
+			items = append(items, n)
+		}
+	}
+	switch len(items) {
+	case 0:
+		return nil
+	case 1:
+		return items[0]
+	}
+	return andNode(items)
+}
+
+func (p *parser) parseUnary(negated bool) node {
+	t, ok := p.peek()
+	if !ok {
+		return nil
+	}
+	p.pos++
+	switch t.kind {
+	case tokNot:
+		n := p.parseUnary(!negated)
+		if n == nil {
+			return nil
+		}
+		return notNode{n}
+	case tokLParen:
+		n := p.parseOr()
+		if t, ok := p.peek(); ok && t.kind == tokRParen {
+			p.pos++
+		}
+		return n
+	case tokTerm:
+		tm := parseTerm(t.raw, t.phrase)
+		if tm == nil {
+			return nil
+		}
+		if !negated && tm.kind == kindText {
+			p.q.positive = append(p.q.positive, tm)
+		}
+		return tm
+	}
+	return nil
+}
+
+func parseTerm(raw string, phrase bool) *term {
+	if name, val, ok := strings.Cut(raw, ":"); ok && name != "" {
+		if def, known := fields[Fold(name)]; known {
+			return fieldTerm(def, val, phrase)
+		}
+	}
+	text := Fold(strings.TrimSpace(raw))
+	if text == "" {
+		return nil
+	}
+	return &term{kind: kindText, text: text, phrase: phrase || strings.ContainsRune(text, ' ')}
+}
+
+func fieldTerm(def fieldDef, val string, phrase bool) *term {
+	t := &term{field: def.name, kind: def.kind}
+	switch def.kind {
+	case kindText, kindExact:
+		t.text = Fold(strings.TrimSpace(val))
+		t.phrase = phrase || strings.ContainsRune(t.text, ' ')
+		if t.text == "" {
+			return nil
+		}
+	case kindBool:
+		switch Fold(strings.TrimSpace(val)) {
+		case "", "true", "yes", "1", "evet", "var":
+			t.flag = true
+		case "false", "no", "0", "hayir", "yok":
+			t.flag = false
+		default:
+			return nil
+		}
+	case kindNumber, kindDuration:
+		parse := parseNumber
+		if def.kind == kindDuration {
+			parse = parseDurationValue
+		}
+		if a, b, ok := strings.Cut(val, ".."); ok {
+			lo, ok1 := parse(a)
+			hi, ok2 := parse(b)
+			if !ok1 || !ok2 {
+				return nil
+			}
+			t.op, t.num, t.num2 = "..", lo, hi
+			return t
+		}
+		for _, op := range []string{">=", "<=", ">", "<", "="} {
+			if strings.HasPrefix(val, op) {
+				t.op = op
+				val = val[len(op):]
+				break
+			}
+		}
+		if t.op == "" {
+			t.op = "="
+		}
+		n, ok := parse(val)
+		if !ok {
+			return nil
+		}
+		t.num = n
+	}
+	return t
+}
+
+func parseNumber(s string) (float64, bool) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return f, err == nil
+}
+
+// parseDurationValue parses "3m", "2m30s", "3:30", "1:02:03" or plain
+// seconds into seconds.
+func parseDurationValue(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, false
+	}
+	if strings.Contains(s, ":") {
+		secs := 0.0
+		for _, part := range strings.Split(s, ":") {
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return 0, false
+			}
+			secs = secs*60 + n
+		}
+		return secs, true
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d.Seconds(), true
+	}
+	return parseNumber(s)
+}
@@ -0,0 +1,174 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestFold(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"Şarkı", "sarki"},
+		{"İSTANBUL", "istanbul"},
+		{"Café Müller", "cafe muller"},
+		{"Øresund Straße", "oresund strase"},
+		{"Ağrı Dağı", "agri dagi"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := Fold(tt.in); got != tt.want {
+			t.Errorf("Fold(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+var testDocs = []Doc{
+	{ID: "1", Text: map[string]string{"title": "Gülpembe", "artist": "Barış Manço", "album": "Sahibinden İhtiyaçtan", "genre": "Rock", "ext": "mp3"},
+		Numbers: map[string]float64{"year": 1985, "duration": 270}, Flags: map[string]bool{"liked": true}},
+	{ID: "2", Text: map[string]string{"title": "Dönence", "artist": "Barış Manço", "album": "Darısı Başınıza", "genre": "Rock", "ext": "flac"},
+		Numbers: map[string]float64{"year": 1988, "duration": 340}},
+	{ID: "3", Text: map[string]string{"title": "Kara Sevda", "artist": "Cem Karaca", "genre": "Anadolu Rock", "ext": "mp3"},
+		Numbers: map[string]float64{"year": 1975, "duration": 185}, Flags: map[string]bool{"liked": true}},
+	{ID: "4", Text: map[string]string{"title": "Yalnızım Dostum", "artist": "Tarkan", "genre": "Pop", "file": "tarkan/yalnizim.ogg", "ext": "ogg"},
+		Numbers: map[string]float64{"year": 2010}},
+}
+
+func TestQueries(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string // matching IDs, sorted; nil for none
+	}{
+		{"", []string{"1", "2", "3", "4"}},
+		{"baris", []string{"1", "2"}},
+		{"artist:manco", []string{"1", "2"}},
+		{"sanatçı:\"cem karaca\"", []string{"3"}},
+		{"year:>1980", []string{"1", "2", "4"}},
+		{"yil:1975..1985", []string{"1", "3"}},
+		{"duration:<3m10s", []string{"3"}},
+		{"sure:4:30", []string{"1"}},
+		{"liked:true", []string{"1", "3"}},
+		{"liked:hayır", []string{"2", "4"}},
+		{"ext:mp3", []string{"1", "3"}},
+		{"rock -anadolu", []string{"1", "2"}},
+		{"NOT genre:rock", []string{"4"}},
+		{"tarkan OR karaca", []string{"3", "4"}},
+		{"(dönence | gulpembe) liked:true", []string{"1"}},
+		{`"kara sevda"`, []string{"3"}},
+		{`"sevda kara"`, nil},
+		{"dosya:yalnizim", []string{"4"}},
+		{"year:abc", []string{"1", "2", "3", "4"}}, // unparsable value: dropped
+		{"bogus:rock", nil},                        // unknown field: plain text
+		{"(rock", []string{"1", "2", "3"}},         // unbalanced: lenient
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, r := range Run(Parse(tt.query), slices.Clone(testDocs)) {
+			got = append(got, r.ID)
+		}
+		if tt.query != "" {
+			slices.Sort(got)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRanking(t *testing.T) {
+	docs := []Doc{
+		{ID: "typo", Text: map[string]string{"title": "Sevad"}},
+		{ID: "substring", Text: map[string]string{"title": "Karasevda"}},
+		{ID: "album", Text: map[string]string{"album": "Sevda"}}, // exact, in a lighter field
+		{ID: "prefix", Text: map[string]string{"title": "Sevdalım"}},
+		{ID: "exact", Text: map[string]string{"title": "Kara Sevda"}},
+		{ID: "none", Text: map[string]string{"title": "Dönence"}},
+	}
+	var got []string
+	for _, r := range Run(Parse("sevda"), docs) {
+		got = append(got, r.ID)
+	}
+	want := []string{"exact", "prefix", "album", "substring", "typo"}
+	if !slices.Equal(got, want) {
+		t.Errorf("order = %v, want %v", got, want)
+	}
+}
+
+func TestFuzzy(t *testing.T) {
+	tests := []struct {
+		query, text string
+		match       bool
+	}{
+		{"manco", "Barış Manço", true},
+		{"mnaco", "Barış Manço", true}, // transposition
+		{"mango", "Barış Manço", true}, // substitution
+		{"mangoo", "Barış Manço", true},
+		{"mxngx", "Barış Manço", false}, // two typos in five runes
+		{"ab", "Abba", true},            // prefix
+		{"xb", "Abba", false},           // too short for typos
+		{"dostm", "Yalnızım Dostum", true},
+	}
+	for _, tt := range tests {
+		d := Doc{Text: map[string]string{"title": tt.text}}
+		if _, ok := Parse(tt.query).Match(&d); ok != tt.match {
+			t.Errorf("%q in %q: %v, want %v", tt.query, tt.text, ok, tt.match)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		limit int
+		want  int
+	}{
+		{"kara", "kara", 2, 0},
+		{"kara", "kraa", 2, 1},
+		{"kara", "kar", 2, 1},
+		{"kara", "sevda", 2, 3}, // over the limit: limit+1
+		{"", "abc", 3, 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance([]rune(tt.a), []rune(tt.b), tt.limit); got != tt.want {
+			t.Errorf("editDistance(%q, %q, %d) = %d, want %d", tt.a, tt.b, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestParseDurationValue(t *testing.T) {
+	tests := []struct {
+		in   string
+		want float64
+		ok   bool
+	}{
+		{"3m", 180, true},
+		{"2m30s", 150, true},
+		{"3:30", 210, true},
+		{"1:02:03", 3723, true},
+		{"95", 95, true},
+		{"", 0, false},
+		{"3:xx", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseDurationValue(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseDurationValue(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		query, text string
+		want        []Span
+	}{
+		{"manco", "Barış Manço", []Span{{8, 14}}},
+		{"bar manco", "Barış Manço", []Span{{0, 3}, {8, 14}}},
+		{"mnaco", "Barış Manço", []Span{{8, 14}}},
+		{"-manco", "Barış Manço", nil},
+		{"year:>1980", "Barış Manço", nil},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.query).Highlight(tt.text); !slices.Equal(got, tt.want) {
+			t.Errorf("%q in %q = %v, want %v", tt.query, tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Package shuffle orders play queues randomly.
+package shuffle
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// Weighted returns paths in a random order in which tracks with a larger
+// weight tend to come earlier (weighted sampling without replacement).
+// Equal weights give a uniform shuffle; weights <= 0 are treated as tiny.
+func Weighted(paths []string, weight func(path string) float64, r *rand.Rand) []string {
+	type keyed struct {
+		path string
+		key  float64
+	}
+	ks := make([]keyed, len(paths))
+	for i, p := range paths {
+		w := weight(p)
+		if w <= 0 {
+			w = 1e-6
+		}
+		u := rand.Float64
+		if r != nil {
+			u = r.Float64
+		}
+		// Efraimidis–Spirakis: sort by u^(1/w), here as log(u)/w.
+		ks[i] = keyed{p, math.Log(1-u()) / w}
+	}
+	sort.SliceStable(ks, func(i, j int) bool { return ks[i].key > ks[j].key })
+	out := make([]string, len(ks))
+	for i, k := range ks {
+		out[i] = k.path
+	}
+	return out
+}
+
+// RatingWeight is the weight of a track rated stars (0..5) in a weighted
+// shuffle. Unrated tracks sit between two and three stars.
+func RatingWeight(stars int) float64 {
+	if stars <= 0 {
+		return 2.5
+	}
+	return float64(stars)
+}
+
+// recentFor is how long a played track keeps a lowered weight.
+const recentFor = 14 * 24 * time.Hour
+
+// Weight combines the rating, the like and how recently a track was played
+// into its weight for a smart shuffle: liked tracks count half again as
+// much, and a track played just now a fifth as much as one not played for
+// two weeks or never.
+func Weight(stars int, liked bool, lastPlayed, now time.Time) float64 {
+	w := RatingWeight(stars)
+	if liked {
+		w *= 1.5
+	}
+	if !lastPlayed.IsZero() {
+		age := min(max(now.Sub(lastPlayed), 0), recentFor)
+		w *= 0.2 + 0.8*float64(age)/float64(recentFor)
+	}
+	return w
+}
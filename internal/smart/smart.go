@@ -0,0 +1,312 @@
+// Package smart evaluates rule-based (smart) playlists against the library
+// index and the user's listening data.
+package smart
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"opentify/internal/library"
+	"opentify/internal/search"
+	"opentify/internal/state"
+)
+
+// Item is a library track together with the per-user data rules may refer
+// to. Fields that are not tracked yet are simply left zero.
+type Item struct {
+	library.Track
+	Liked      bool
+	Rating     int
+	Plays      int
+	LastPlayed time.Time
+}
+
+// Kind of value a rule field holds; it decides which operators apply.
+type Kind int
+
+const (
+	Text Kind = iota
+	Number
+	Date
+	Bool
+)
+
+// Rule operators.
+const (
+	OpContains    = "contains"
+	OpNotContains = "not_contains"
+	OpIs          = "is"
+	OpIsNot       = "is_not"
+	OpStartsWith  = "starts_with"
+	OpGreater     = "gt"
+	OpLess        = "lt"
+	OpBetween     = "between"
+	OpInLast      = "in_last"     // days
+	OpNotInLast   = "not_in_last" // days, also matches "never"
+	OpBefore      = "before"      // YYYY-MM-DD
+	OpAfter       = "after"       // YYYY-MM-DD
+)
+
+// FieldKind returns the value kind of a rule field.
+func FieldKind(field string) Kind {
+	switch field {
+	case state.FieldYear, state.FieldDuration, state.FieldPlays, state.FieldRating:
+		return Number
+	case state.FieldAdded, state.FieldLastPlayed:
+		return Date
+	case state.FieldLiked:
+		return Bool
+	}
+	return Text
+}
+
+// Ops lists the operators valid for a field kind, in display order.
+func Ops(k Kind) []string {
+	switch k {
+	case Number:
+		return []string{OpIs, OpIsNot, OpGreater, OpLess, OpBetween}
+	case Date:
+		return []string{OpInLast, OpNotInLast, OpBefore, OpAfter}
+	case Bool:
+		return []string{OpIs}
+	}
+	return []string{OpContains, OpNotContains, OpIs, OpIsNot, OpStartsWith}
+}
+
+// Evaluate returns the paths of items matching pl, sorted and limited as
+// configured. A playlist without rules matches every item.
+func Evaluate(name string, pl state.SmartPlaylist, items []Item) []string {
+	now := time.Now()
+	var hits []Item
+	for _, it := range items {
+		if matches(pl, it, now) {
+			hits = append(hits, it)
+		}
+	}
+	sortItems(name, pl, hits)
+	if pl.Limit > 0 && len(hits) > pl.Limit {
+		hits = hits[:pl.Limit]
+	}
+	out := make([]string, len(hits))
+	for i, it := range hits {
+		out[i] = it.Path
+	}
+	return out
+}
+
+func matches(pl state.SmartPlaylist, it Item, now time.Time) bool {
+	if len(pl.Rules) == 0 {
+		return true
+	}
+	any := pl.Match == "any"
+	for _, r := range pl.Rules {
+		ok := Match(r, it, now)
+		if any && ok {
+			return true
+		}
+		if !any && !ok {
+			return false
+		}
+	}
+	return !any
+}
+
+// Match reports whether a single rule holds for it. Rules with an unknown
+// operator or an unparsable value never match.
+func Match(r state.Rule, it Item, now time.Time) bool {
+	switch FieldKind(r.Field) {
+	case Number:
+		return matchNumber(r, numberValue(r.Field, it))
+	case Date:
+		return matchDate(r, dateValue(r.Field, it), now)
+	case Bool:
+		return it.Liked == parseBool(r.Value)
+	}
+	v := search.Fold(textValue(r.Field, it))
+	want := search.Fold(strings.TrimSpace(r.Value))
+	switch r.Op {
+	case OpContains:
+		return strings.Contains(v, want)
+	case OpNotContains:
+		return !strings.Contains(v, want)
+	case OpIs:
+		return v == want
+	case OpIsNot:
+		return v != want
+	case OpStartsWith:
+		return strings.HasPrefix(v, want)
+	}
+	return false
+}
+
+func textValue(field string, it Item) string {
+	switch field {
+	case state.FieldTitle:
+		return it.DisplayTitle()
+	case state.FieldArtist:
+		return it.Artist
+	case state.FieldAlbumArtist:
+		return it.ResolvedAlbumArtist()
+	case state.FieldAlbum:
+		return it.Album
+	case state.FieldGenre:
+		return it.Genre
+	case state.FieldExt:
+		return it.Ext()
+	}
+	return ""
+}
+
+func numberValue(field string, it Item) float64 {
+	switch field {
+	case state.FieldYear:
+		return float64(it.Year)
+	case state.FieldDuration:
+		return it.Duration.Seconds()
+	case state.FieldPlays:
+		return float64(it.Plays)
+	case state.FieldRating:
+		return float64(it.Rating)
+	}
+	return 0
+}
+
+func dateValue(field string, it Item) time.Time {
+	if field == state.FieldLastPlayed {
+		return it.LastPlayed
+	}
+	return it.Added
+}
+
+func matchNumber(r state.Rule, v float64) bool {
+	a, err := parseNumber(r.Field, r.Value)
+	if err != nil {
+		return false
+	}
+	switch r.Op {
+	case OpIs:
+		if r.Field == state.FieldDuration {
+			return v >= a && v < a+1
+		}
+		return v == a
+	case OpIsNot:
+		return v != a
+	case OpGreater:
+		return v > a
+	case OpLess:
+		return v < a
+	case OpBetween:
+		b, err := parseNumber(r.Field, r.Value2)
+		if err != nil {
+			return false
+		}
+		if a > b {
+			a, b = b, a
+		}
+		return v >= a && v <= b
+	}
+	return false
+}
+
+// parseNumber accepts "3:30" for durations in addition to plain numbers.
+func parseNumber(field, s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if field == state.FieldDuration && strings.Contains(s, ":") {
+		secs := 0.0
+		for _, part := range strings.Split(s, ":") {
+			n, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return 0, err
+			}
+			secs = secs*60 + n
+		}
+		return secs, nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func matchDate(r state.Rule, t, now time.Time) bool {
+	switch r.Op {
+	case OpInLast, OpNotInLast:
+		days, err := strconv.ParseFloat(strings.TrimSpace(r.Value), 64)
+		if err != nil {
+			return false
+		}
+		recent := !t.IsZero() && now.Sub(t) <= time.Duration(days*24*float64(time.Hour))
+		return recent == (r.Op == OpInLast)
+	case OpBefore, OpAfter:
+		d, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(r.Value), time.Local)
+		if err != nil || t.IsZero() {
+			return false
+		}
+		if r.Op == OpBefore {
+			return t.Before(d)
+		}
+		return !t.Before(d.AddDate(0, 0, 1))
+	}
+	return false
+}
+
+func parseBool(s string) bool {
+	switch search.Fold(strings.TrimSpace(s)) {
+	case "false", "no", "0", "hayir":
+		return false
+	}
+	return true
+}
+
+// sortItems orders hits by pl.Sort. Without a sort field the library order
+// (by path) is kept. "random" is seeded by the playlist name so the order
+// only changes when the matching set does.
+func sortItems(name string, pl state.SmartPlaylist, hits []Item) {
+	if pl.Sort == "random" {
+		h := fnv.New64a()
+		h.Write([]byte(name))
+		rand.New(rand.NewSource(int64(h.Sum64()))).Shuffle(len(hits), func(i, j int) {
+			hits[i], hits[j] = hits[j], hits[i]
+		})
+		return
+	}
+	var less func(a, b *Item) bool
+	switch pl.Sort {
+	case state.FieldTitle:
+		less = func(a, b *Item) bool { return search.Fold(a.DisplayTitle()) < search.Fold(b.DisplayTitle()) }
+	case state.FieldArtist:
+		less = func(a, b *Item) bool { return search.Fold(a.PrimaryArtist()) < search.Fold(b.PrimaryArtist()) }
+	case state.FieldAlbum:
+		less = func(a, b *Item) bool {
+			if fa, fb := search.Fold(a.Album), search.Fold(b.Album); fa != fb {
+				return fa < fb
+			}
+			if a.Disc != b.Disc {
+				return a.Disc < b.Disc
+			}
+			return a.TrackNo < b.TrackNo
+		}
+	case state.FieldYear:
+		less = func(a, b *Item) bool { return a.Year < b.Year }
+	case state.FieldDuration:
+		less = func(a, b *Item) bool { return a.Duration < b.Duration }
+	case state.FieldPlays:
+		less = func(a, b *Item) bool { return a.Plays < b.Plays }
+	case state.FieldRating:
+		less = func(a, b *Item) bool { return a.Rating < b.Rating }
+	case state.FieldAdded:
+		less = func(a, b *Item) bool { return a.Added.Before(b.Added) }
+	case state.FieldLastPlayed:
+		less = func(a, b *Item) bool { return a.LastPlayed.Before(b.LastPlayed) }
+	default:
+		less = func(a, b *Item) bool { return filepath.ToSlash(a.Path) < filepath.ToSlash(b.Path) }
+	}
+	sort.SliceStable(hits, func(i, j int) bool {
+		if pl.Desc {
+			return less(&hits[j], &hits[i])
+		}
+		return less(&hits[i], &hits[j])
+	})
+}
@@ -0,0 +1,109 @@
+package smart
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"opentify/internal/library"
+	"opentify/internal/state"
+)
+
+var now = time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+
+var testItems = []Item{
+	{Track: library.Track{Path: "a.mp3", Title: "Gülpembe", Artist: "Barış Manço", Album: "Sahibinden İhtiyaçtan", Genre: "Rock", Year: 1985,
+		Duration: 270 * time.Second, Added: now.AddDate(0, -1, 0)}, Liked: true, Plays: 12, LastPlayed: now.AddDate(0, 0, -2)},
+	{Track: library.Track{Path: "b.flac", Title: "Dönence", Artist: "Barış Manço", Genre: "Rock", Year: 1988,
+		Duration: 340 * time.Second, Added: now.AddDate(-1, 0, 0)}, Plays: 3, LastPlayed: now.AddDate(0, -2, 0)},
+	{Track: library.Track{Path: "c.mp3", Title: "Kara Sevda", Artist: "Cem Karaca", Genre: "Anadolu Rock", Year: 1975,
+		Duration: 185 * time.Second, Added: now.AddDate(0, 0, -3)}, Liked: true},
+	{Track: library.Track{Path: "d/Yalnızım.ogg", Artist: "Tarkan", Genre: "Pop", Year: 2010, Added: now.AddDate(-2, 0, 0)}, Rating: 4},
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		rule state.Rule
+		want []string
+	}{
+		{state.Rule{Field: state.FieldArtist, Op: OpContains, Value: "manco"}, []string{"a.mp3", "b.flac"}},
+		{state.Rule{Field: state.FieldArtist, Op: OpNotContains, Value: "Barış"}, []string{"c.mp3", "d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldGenre, Op: OpIs, Value: "ROCK"}, []string{"a.mp3", "b.flac"}},
+		{state.Rule{Field: state.FieldGenre, Op: OpIsNot, Value: "rock"}, []string{"c.mp3", "d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldTitle, Op: OpStartsWith, Value: "yalniz"}, []string{"d/Yalnızım.ogg"}}, // file name without a title tag
+		{state.Rule{Field: state.FieldExt, Op: OpIs, Value: "mp3"}, []string{"a.mp3", "c.mp3"}},
+		{state.Rule{Field: state.FieldYear, Op: OpBetween, Value: "1990", Value2: "1970"}, []string{"a.mp3", "b.flac", "c.mp3"}},
+		{state.Rule{Field: state.FieldYear, Op: OpGreater, Value: "1985"}, []string{"b.flac", "d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldYear, Op: OpIsNot, Value: "1985"}, []string{"b.flac", "c.mp3", "d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldDuration, Op: OpIs, Value: "4:30"}, []string{"a.mp3"}},
+		{state.Rule{Field: state.FieldDuration, Op: OpLess, Value: "200"}, []string{"c.mp3", "d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldPlays, Op: OpGreater, Value: "5"}, []string{"a.mp3"}},
+		{state.Rule{Field: state.FieldRating, Op: OpIs, Value: "4"}, []string{"d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldLiked, Op: OpIs, Value: "true"}, []string{"a.mp3", "c.mp3"}},
+		{state.Rule{Field: state.FieldLiked, Op: OpIs, Value: "hayır"}, []string{"b.flac", "d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldAdded, Op: OpInLast, Value: "7"}, []string{"c.mp3"}},
+		{state.Rule{Field: state.FieldLastPlayed, Op: OpInLast, Value: "30"}, []string{"a.mp3"}},
+		{state.Rule{Field: state.FieldLastPlayed, Op: OpNotInLast, Value: "30"}, []string{"b.flac", "c.mp3", "d/Yalnızım.ogg"}}, // never played counts
+		{state.Rule{Field: state.FieldAdded, Op: OpBefore, Value: "2023-06-16"}, []string{"b.flac", "d/Yalnızım.ogg"}},
+		{state.Rule{Field: state.FieldLastPlayed, Op: OpAfter, Value: "2024-06-01"}, []string{"a.mp3"}},
+		{state.Rule{Field: state.FieldYear, Op: OpIs, Value: "abc"}, nil},
+		{state.Rule{Field: state.FieldAdded, Op: OpBefore, Value: "15.06.2023"}, nil},
+		{state.Rule{Field: state.FieldGenre, Op: "regex", Value: "rock"}, nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, it := range testItems {
+			if Match(tt.rule, it, now) {
+				got = append(got, it.Path)
+			}
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%+v = %v, want %v", tt.rule, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rock := state.Rule{Field: state.FieldGenre, Op: OpContains, Value: "rock"}
+	liked := state.Rule{Field: state.FieldLiked, Op: OpIs, Value: "true"}
+	tests := []struct {
+		name string
+		pl   state.SmartPlaylist
+		want []string
+	}{
+		{"no rules", state.SmartPlaylist{}, []string{"a.mp3", "b.flac", "c.mp3", "d/Yalnızım.ogg"}},
+		{"all", state.SmartPlaylist{Match: "all", Rules: []state.Rule{rock, liked}}, []string{"a.mp3", "c.mp3"}},
+		{"any", state.SmartPlaylist{Match: "any", Rules: []state.Rule{rock, liked}}, []string{"a.mp3", "b.flac", "c.mp3"}},
+		{"by year", state.SmartPlaylist{Rules: []state.Rule{rock}, Sort: state.FieldYear}, []string{"c.mp3", "a.mp3", "b.flac"}},
+		{"by plays, desc, limited", state.SmartPlaylist{Sort: state.FieldPlays, Desc: true, Limit: 2}, []string{"a.mp3", "b.flac"}},
+		{"by title", state.SmartPlaylist{Sort: state.FieldTitle}, []string{"b.flac", "a.mp3", "c.mp3", "d/Yalnızım.ogg"}},
+	}
+	for _, tt := range tests {
+		if got := Evaluate("test", tt.pl, slices.Clone(testItems)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRandomSortIsSeededByName(t *testing.T) {
+	var items []Item
+	for i := range 30 {
+		items = append(items, Item{Track: library.Track{Path: fmt.Sprintf("%02d.mp3", i)}})
+	}
+	pl := state.SmartPlaylist{Sort: "random"}
+	first := Evaluate("Karışık", pl, slices.Clone(items))
+	if again := Evaluate("Karışık", pl, slices.Clone(items)); !slices.Equal(first, again) {
+		t.Errorf("same name, other order:\n%v\n%v", first, again)
+	}
+	if other := Evaluate("Başka", pl, slices.Clone(items)); slices.Equal(first, other) {
+		t.Error("other name, same order")
+	}
+	sorted := slices.Clone(first)
+	slices.Sort(sorted)
+	for i, p := range sorted {
+		if p != items[i].Path {
+			t.Fatalf("not a permutation: %v", first)
+		}
+	}
+}
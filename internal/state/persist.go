@@ -0,0 +1,285 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// CurrentVersion is the schema version of the state files written by this
+// build.
+const CurrentVersion = 1
+
+// migrations upgrade the JSON document of a state file by one version,
+// keyed by the version they upgrade from. Version 0 has the shape of
+// version 1 but refers to tracks by path, which takes the library to fix;
+// it goes through the migrations from 1 on and then MigrateIDs.
+var migrations = map[int]func(doc map[string]json.RawMessage) error{}
+
+// Backups of the state file are kept as path.bak1 (newest) to
+// path.bak<backupCount>, taken at most once per backupInterval.
+const (
+	backupCount    = 5
+	backupInterval = time.Hour
+)
+
+// ErrNewerVersion is returned for state files of a newer schema than this
+// build knows. Such a file is neither read nor written over, as that would
+// drop what the newer build stores.
+var ErrNewerVersion = errors.New("state: file written by a newer version")
+
+// decode parses a state file, bringing it up to CurrentVersion.
+func decode(b []byte) (*State, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	version := 0
+	if v, ok := doc["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, fmt.Errorf("version: %w", err)
+		}
+	}
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("%w (version %d, this build reads up to %d)", ErrNewerVersion, version, CurrentVersion)
+	}
+	if version < CurrentVersion {
+		for v := max(version, 1); v < CurrentVersion; v++ {
+			if m := migrations[v]; m != nil {
+				if err := m(doc); err != nil {
+					return nil, fmt.Errorf("migrating from version %d: %w", v, err)
+				}
+			}
+		}
+		if version >= 1 {
+			doc["version"] = json.RawMessage(strconv.Itoa(CurrentVersion))
+		}
+		var err error
+		if b, err = json.Marshal(doc); err != nil {
+			return nil, err
+		}
+	}
+	var s State
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	s.normalize()
+	return &s, nil
+}
+
+// checkNotNewer fails with ErrNewerVersion when the state file at path is
+// of a newer schema, before it is replaced.
+func checkNotNewer(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil // nothing to lose; writing reports real trouble
+	}
+	var doc struct {
+		Version int `json:"version"`
+	}
+	if json.Unmarshal(b, &doc) == nil && doc.Version > CurrentVersion {
+		return fmt.Errorf("%s: %w", path, ErrNewerVersion)
+	}
+	return nil
+}
+
+// backups returns the backup files of path, newest first.
+func backups(path string) []string {
+	var out []string
+	for i := 1; i <= backupCount; i++ {
+		out = append(out, path+".bak"+strconv.Itoa(i))
+	}
+	return out
+}
+
+// writeFile replaces path with b atomically: b goes to a temporary file in
+// the same folder that is synced and renamed over path, so a crash leaves
+// either the old or the new file. The old file is kept as the newest
+// backup when the last one is older than backupInterval.
+func writeFile(path string, b []byte) error {
+	return replaceFile(path, b, true)
+}
+
+// replaceFile is writeFile, taking backups only when backup is set.
+func replaceFile(path string, b []byte, backup bool) error {
+	if err := EnsureDir(path); err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0o644)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if backup {
+		// A failed backup does not stop the save
+		_ = rotate(path)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	// Make the rename itself durable; not supported everywhere
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// rotate shifts the backups of path by one and keeps the current file as
+// the newest, if a backup is due.
+func rotate(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return nil // nothing to back up yet
+	}
+	baks := backups(path)
+	if fi, err := os.Stat(baks[0]); err == nil && time.Since(fi.ModTime()) < backupInterval {
+		return nil
+	}
+	for i := len(baks) - 1; i > 0; i-- {
+		if err := os.Rename(baks[i-1], baks[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// A hard link keeps path in place until the new file replaces it
+	if err := os.Link(path, baks[0]); err == nil {
+		return nil
+	}
+	return copyFile(path, baks[0])
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Saver writes the state in the background, at most once per delay, so
+// that frequent changes do not each cost a disk write.
+type Saver struct {
+	path  string
+	delay time.Duration
+
+	// OnError is called, from the saving goroutine, when a background
+	// write fails.
+	OnError func(error)
+
+	writing sync.Mutex // serializes writes, guards path
+	mu      sync.Mutex // guards data and timer
+	data    []byte
+	timer   *time.Timer
+}
+
+func NewSaver(path string, delay time.Duration) *Saver {
+	return &Saver{path: path, delay: delay}
+}
+
+// Save encodes s right away, on the caller's goroutine, and schedules the
+// write. Only encoding errors are returned; see OnError.
+func (sv *Saver) Save(s *State) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.data = b
+	if sv.timer == nil {
+		sv.timer = time.AfterFunc(sv.delay, func() {
+			if err := sv.write(); err != nil && sv.OnError != nil {
+				sv.OnError(err)
+			}
+		})
+	}
+	return nil
+}
+
+// Flush writes a pending save now, for example before exiting.
+func (sv *Saver) Flush() error {
+	sv.mu.Lock()
+	if sv.timer != nil {
+		sv.timer.Stop()
+	}
+	sv.mu.Unlock()
+	return sv.write()
+}
+
+// SetPath writes a pending save to the old file and saves to path from
+// then on, for example after switching profiles.
+func (sv *Saver) SetPath(path string) error {
+	sv.mu.Lock()
+	if sv.timer != nil {
+		sv.timer.Stop()
+	}
+	sv.mu.Unlock()
+	sv.writing.Lock()
+	defer sv.writing.Unlock()
+	err := sv.writePending()
+	sv.path = path
+	return err
+}
+
+func (sv *Saver) write() error {
+	sv.writing.Lock()
+	defer sv.writing.Unlock()
+	return sv.writePending()
+}
+
+// writePending writes the data of the last Save. The caller holds
+// sv.writing, which also guards sv.path.
+func (sv *Saver) writePending() error {
+	// Take the data only now, so a write that waited for the one before
+	// it does not put older data back.
+	sv.mu.Lock()
+	b := sv.data
+	sv.data, sv.timer = nil, nil
+	sv.mu.Unlock()
+	if b == nil {
+		return nil
+	}
+	err := checkNotNewer(sv.path)
+	if err == nil {
+		err = writeFile(sv.path, b)
+	}
+	if err != nil {
+		// Keep the data for the next attempt unless there is newer
+		sv.mu.Lock()
+		if sv.data == nil {
+			sv.data = b
+		}
+		sv.mu.Unlock()
+	}
+	return err
+}
@@ -0,0 +1,257 @@
+package state
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewerVersionIsLeftAlone(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	newer := []byte(`{"version": ` + strconv.Itoa(CurrentVersion+1) + `, "liked": {"a": true}, "future": {"x": 1}}`)
+	if err := os.WriteFile(path, newer, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// An older backup must not be loaded in its place
+	if err := os.WriteFile(path+".bak1", []byte(`{"version": 1}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(path); !errors.Is(err, ErrNewerVersion) {
+		t.Fatalf("Load = %v, want ErrNewerVersion", err)
+	}
+	if _, err := os.Stat(path + ".corrupt"); err == nil {
+		t.Error("file of a newer version moved aside as corrupt")
+	}
+	if err := Save(path, Default()); !errors.Is(err, ErrNewerVersion) {
+		t.Errorf("Save = %v, want ErrNewerVersion", err)
+	}
+	sv := NewSaver(path, time.Hour)
+	if err := sv.Save(Default()); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Flush(); !errors.Is(err, ErrNewerVersion) {
+		t.Errorf("Saver.Flush = %v, want ErrNewerVersion", err)
+	}
+	if b, _ := os.ReadFile(path); !bytes.Equal(b, newer) {
+		t.Errorf("file changed to %s", b)
+	}
+}
+
+func TestOlderVersionLoads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte(`{"version": 1, "liked": {"a": true}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path)
+	if err != nil || !s.Liked["a"] {
+		t.Fatalf("Load = %+v, %v", s, err)
+	}
+	if err := Save(path, s); err != nil {
+		t.Errorf("Save = %v", err)
+	}
+}
+
+func TestLoadRecovery(t *testing.T) {
+	good := `{"version": 1, "liked": {"a": true}}`
+	tests := []struct {
+		name      string
+		file      string            // "" for no state file
+		baks      map[string]string // suffix -> content
+		recovered string            // backup expected in Recovered
+		wantErr   bool
+	}{
+		{name: "missing"},
+		{name: "good", file: good},
+		{name: "corrupt, first backup good", file: "{", baks: map[string]string{".bak1": good}, recovered: ".bak1"},
+		{name: "corrupt, skips bad backups", file: `{"version": "x"}`, baks: map[string]string{".bak1": "", ".bak2": "{", ".bak3": good}, recovered: ".bak3"},
+		{name: "corrupt, no backup", file: "{", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "state.json")
+			if tt.file != "" {
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for suffix, b := range tt.baks {
+				if err := os.WriteFile(path+suffix, []byte(b), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s, err := Load(path)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Load = %+v, want an error", s)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			} else {
+				want := ""
+				if tt.recovered != "" {
+					want = path + tt.recovered
+				}
+				if s.Recovered != want {
+					t.Errorf("Recovered = %q, want %q", s.Recovered, want)
+				}
+				if tt.file != "" && !s.Liked["a"] {
+					t.Errorf("state = %+v", s)
+				}
+			}
+			// An unreadable file is set aside, never left to be saved over
+			_, cerr := os.Stat(path + ".corrupt")
+			if corrupt := tt.recovered != "" || tt.wantErr; corrupt != (cerr == nil) {
+				t.Errorf("%s.corrupt exists: %v, want %v", path, cerr == nil, corrupt)
+			}
+			if tt.recovered != "" || tt.wantErr {
+				if _, err := os.Stat(path); err == nil {
+					t.Error("unreadable file still in place")
+				}
+			}
+		})
+	}
+}
+
+func TestWriteFileRotatesBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sub", "state.json")
+	write := func(s string) {
+		t.Helper()
+		if err := writeFile(path, []byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	age := func(file string) {
+		t.Helper()
+		old := time.Now().Add(-2 * backupInterval)
+		if err := os.Chtimes(file, old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := func(contents ...string) {
+		t.Helper()
+		files := append([]string{path}, backups(path)...)
+		for i, f := range files {
+			b, err := os.ReadFile(f)
+			if i >= len(contents) {
+				if err == nil {
+					t.Errorf("%s = %q, want no file", f, b)
+				}
+				continue
+			}
+			if string(b) != contents[i] {
+				t.Errorf("%s = %q, %v, want %q", f, b, err, contents[i])
+			}
+		}
+	}
+
+	write("1") // creates the folder; nothing to back up
+	want("1")
+	write("2")
+	want("2", "1")
+	write("3") // the newest backup is recent
+	want("3", "1")
+	for i := 4; i <= backupCount+3; i++ {
+		age(path + ".bak1")
+		write(strconv.Itoa(i))
+	}
+	// Only backupCount backups are kept; "1" is gone
+	want("8", "7", "6", "5", "4", "3")
+}
+
+func TestWriteFileIsAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	if err := writeFile(path, []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o644 {
+		t.Errorf("stat = %v, %v", fi, err)
+	}
+	// A failed replace leaves the target and no temporary file behind
+	target := filepath.Join(dir, "taken")
+	if err := os.Mkdir(target, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(target, []byte("x")); err == nil {
+		t.Error("replacing a folder succeeded")
+	}
+	if fi, err := os.Stat(target); err != nil || !fi.IsDir() {
+		t.Errorf("target = %v, %v", fi, err)
+	}
+	if tmps, _ := filepath.Glob(filepath.Join(dir, "*.tmp*")); len(tmps) != 0 {
+		t.Errorf("temporary files left: %v", tmps)
+	}
+}
+
+func TestSaverDebounces(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	sv := NewSaver(path, 200*time.Millisecond)
+	for _, id := range []string{"a", "b", "c"} {
+		s := Default()
+		s.Liked[id] = true
+		if err := sv.Save(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path); err == nil {
+		t.Fatal("written before the delay")
+	}
+	var s *State
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			var err error
+			if s, err = Load(path); err != nil {
+				t.Fatal(err)
+			}
+			break
+		}
+	}
+	if s == nil || !s.Liked["c"] || s.Liked["a"] {
+		t.Fatalf("saved %+v, want the last state", s)
+	}
+	// A second write would have backed up the first
+	if _, err := os.Stat(path + ".bak1"); err == nil {
+		t.Error("the saves were not coalesced into one write")
+	}
+}
+
+func TestSaverFlush(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	sv := NewSaver(path, time.Hour)
+	if err := sv.Flush(); err != nil {
+		t.Errorf("Flush with nothing pending = %v", err)
+	}
+	s := Default()
+	s.Liked["a"] = true
+	if err := sv.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Load(path); err != nil || !got.Liked["a"] {
+		t.Errorf("after Flush: %+v, %v", got, err)
+	}
+
+	// A failed write keeps the data for the next attempt
+	blocked := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocked, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sv = NewSaver(filepath.Join(blocked, "state.json"), time.Hour)
+	if err := sv.Save(s); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := sv.Flush(); err == nil {
+			t.Error("Flush into a file succeeded")
+		}
+	}
+}
@@ -0,0 +1,256 @@
+package state
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Playlist errors.
+var (
+	ErrNoPlaylist     = errors.New("state: no such playlist")
+	ErrPlaylistExists = errors.New("state: playlist already exists")
+	ErrPlaylistName   = errors.New("state: empty playlist name")
+	ErrPlaylistIndex  = errors.New("state: playlist index out of range")
+)
+
+// PlaylistInfo is what a playlist has besides its tracks.
+type PlaylistInfo struct {
+	Description string    `json:"description,omitempty"`
+	Cover       string    `json:"cover,omitempty"` // image file
+	Created     time.Time `json:"created,omitempty"`
+	Modified    time.Time `json:"modified,omitempty"`
+}
+
+// PlaylistNames returns the names of the playlists, sorted.
+func (s *State) PlaylistNames() []string {
+	names := make([]string, 0, len(s.Playlists))
+	for name := range s.Playlists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Playlist returns the track IDs and details of a playlist.
+func (s *State) Playlist(name string) ([]string, PlaylistInfo, bool) {
+	ids, ok := s.Playlists[name]
+	return ids, s.PlaylistInfo[name], ok
+}
+
+// CreatePlaylist adds an empty playlist. The name is trimmed; the name
+// actually used is returned.
+func (s *State) CreatePlaylist(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ErrPlaylistName
+	}
+	if _, ok := s.Playlists[name]; ok {
+		return name, ErrPlaylistExists
+	}
+	t := time.Now()
+	s.Playlists[name] = []string{}
+	s.PlaylistInfo[name] = PlaylistInfo{Created: t, Modified: t}
+	return name, nil
+}
+
+// RenamePlaylist gives a playlist a new name, keeping its details.
+func (s *State) RenamePlaylist(old, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	ids, ok := s.Playlists[old]
+	switch {
+	case !ok:
+		return "", ErrNoPlaylist
+	case name == "":
+		return "", ErrPlaylistName
+	case name == old:
+		return name, nil
+	}
+	if _, ok := s.Playlists[name]; ok {
+		return name, ErrPlaylistExists
+	}
+	info := s.PlaylistInfo[old]
+	info.Modified = time.Now()
+	delete(s.Playlists, old)
+	delete(s.PlaylistInfo, old)
+	s.Playlists[name] = ids
+	s.PlaylistInfo[name] = info
+	return name, nil
+}
+
+// DuplicatePlaylist copies a playlist under a free name derived from its
+// own ("Ad (kopya)", "Ad (kopya 2)", ...) and returns that name.
+func (s *State) DuplicatePlaylist(name string) (string, error) {
+	ids, ok := s.Playlists[name]
+	if !ok {
+		return "", ErrNoPlaylist
+	}
+	dup := name + " (kopya)"
+	for i := 2; ; i++ {
+		if _, taken := s.Playlists[dup]; !taken {
+			break
+		}
+		dup = name + " (kopya " + strconv.Itoa(i) + ")"
+	}
+	t := time.Now()
+	info := s.PlaylistInfo[name]
+	info.Created, info.Modified = t, t
+	s.Playlists[dup] = append([]string{}, ids...)
+	s.PlaylistInfo[dup] = info
+	return dup, nil
+}
+
+// DeletePlaylist removes a playlist.
+func (s *State) DeletePlaylist(name string) error {
+	if _, ok := s.Playlists[name]; !ok {
+		return ErrNoPlaylist
+	}
+	delete(s.Playlists, name)
+	delete(s.PlaylistInfo, name)
+	return nil
+}
+
+// AddToPlaylist appends the tracks (IDs) that are not in the playlist yet
+// and returns how many were added.
+func (s *State) AddToPlaylist(name string, ids ...string) (int, error) {
+	cur, ok := s.Playlists[name]
+	if !ok {
+		return 0, ErrNoPlaylist
+	}
+	have := map[string]bool{}
+	for _, p := range cur {
+		have[p] = true
+	}
+	added := 0
+	for _, p := range ids {
+		if have[p] {
+			continue
+		}
+		have[p] = true
+		cur = append(cur, p)
+		added++
+	}
+	if added > 0 {
+		s.Playlists[name] = cur
+		s.touch(name)
+	}
+	return added, nil
+}
+
+// Contains reports whether track id is in the playlist.
+func (s *State) Contains(name, id string) bool {
+	for _, p := range s.Playlists[name] {
+		if p == id {
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveFromPlaylist removes the entries at the given indexes.
+func (s *State) RemoveFromPlaylist(name string, idx ...int) error {
+	cur, ok := s.Playlists[name]
+	if !ok {
+		return ErrNoPlaylist
+	}
+	drop := map[int]bool{}
+	for _, i := range idx {
+		if i < 0 || i >= len(cur) {
+			return ErrPlaylistIndex
+		}
+		drop[i] = true
+	}
+	out := make([]string, 0, len(cur)-len(drop))
+	for i, p := range cur {
+		if !drop[i] {
+			out = append(out, p)
+		}
+	}
+	s.Playlists[name] = out
+	s.touch(name)
+	return nil
+}
+
+// MovePlaylistEntry moves the entry at from so that it ends up at to.
+func (s *State) MovePlaylistEntry(name string, from, to int) error {
+	cur, ok := s.Playlists[name]
+	if !ok {
+		return ErrNoPlaylist
+	}
+	if from < 0 || from >= len(cur) || to < 0 || to >= len(cur) {
+		return ErrPlaylistIndex
+	}
+	if from == to {
+		return nil
+	}
+	p := cur[from]
+	if from < to {
+		copy(cur[from:to], cur[from+1:to+1])
+	} else {
+		copy(cur[to+1:from+1], cur[to:from])
+	}
+	cur[to] = p
+	s.touch(name)
+	return nil
+}
+
+// DedupePlaylist drops repeated entries, keeping the first of each, and
+// returns how many were removed.
+func (s *State) DedupePlaylist(name string) (int, error) {
+	cur, ok := s.Playlists[name]
+	if !ok {
+		return 0, ErrNoPlaylist
+	}
+	seen := map[string]bool{}
+	out := cur[:0]
+	for _, p := range cur {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		out = append(out, p)
+	}
+	n := len(cur) - len(out)
+	if n > 0 {
+		s.Playlists[name] = out
+		s.touch(name)
+	}
+	return n, nil
+}
+
+// SetPlaylistDescription sets the free text shown under the playlist name.
+func (s *State) SetPlaylistDescription(name, desc string) error {
+	if _, ok := s.Playlists[name]; !ok {
+		return ErrNoPlaylist
+	}
+	info := s.PlaylistInfo[name]
+	info.Description = strings.TrimSpace(desc)
+	s.PlaylistInfo[name] = info
+	s.touch(name)
+	return nil
+}
+
+// SetPlaylistCover sets the image file shown for the playlist; "" goes
+// back to the artwork of its tracks.
+func (s *State) SetPlaylistCover(name, image string) error {
+	if _, ok := s.Playlists[name]; !ok {
+		return ErrNoPlaylist
+	}
+	info := s.PlaylistInfo[name]
+	info.Cover = image
+	s.PlaylistInfo[name] = info
+	s.touch(name)
+	return nil
+}
+
+// touch updates the modification time of a playlist.
+func (s *State) touch(name string) {
+	info := s.PlaylistInfo[name]
+	info.Modified = time.Now()
+	if info.Created.IsZero() {
+		info.Created = info.Modified
+	}
+	s.PlaylistInfo[name] = info
+}
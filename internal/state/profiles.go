@@ -0,0 +1,322 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Profile errors.
+var (
+	ErrNoProfile     = errors.New("state: no such profile")
+	ErrProfileExists = errors.New("state: profile already exists")
+	ErrProfileName   = errors.New("state: invalid profile name")
+	ErrProfileInUse  = errors.New("state: profile in use")
+)
+
+// DefaultProfile is the profile the data of single-user versions moves to.
+const DefaultProfile = "Varsayılan"
+
+// Profiles are the named users of one installation. Each has a folder
+// under <config>/profiles/ for its state file and one under
+// <data>/profiles/ for its other files, such as the listening history. The
+// library index is shared. profiles.json remembers the current profile
+// and the settings that belong to the installation rather than a user.
+type Profiles struct {
+	config, data string
+
+	mu   sync.Mutex
+	meta profilesMeta
+}
+
+type profilesMeta struct {
+	Current    string `json:"current"`
+	AskOnStart bool   `json:"ask_on_start,omitempty"`
+	MusicDir   string `json:"music_dir,omitempty"` // "" for the default
+}
+
+// OpenProfiles reads the profiles kept under the config and data folders.
+// The state file of a single-user version (<config>/state.json) becomes
+// DefaultProfile; without any profile DefaultProfile is created.
+func OpenProfiles(config, data string) (*Profiles, error) {
+	p := &Profiles{config: config, data: data}
+	b, err := os.ReadFile(p.metaFile())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil && json.Unmarshal(b, &p.meta) != nil {
+		// Nothing in it that cannot be picked again
+		p.meta = profilesMeta{}
+	}
+	names := p.List()
+	if len(names) == 0 {
+		if err := p.adopt(DefaultProfile); err != nil {
+			return nil, err
+		}
+		names = []string{DefaultProfile}
+	}
+	if !p.exists(p.meta.Current) {
+		p.meta.Current = names[0]
+		if err := p.saveMeta(); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+func (p *Profiles) metaFile() string { return filepath.Join(p.config, "profiles.json") }
+
+func (p *Profiles) saveMeta() error {
+	b, err := json.MarshalIndent(p.meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(p.metaFile(), b, false)
+}
+
+// adopt creates profile name from the files of a single-user version, or
+// empty when there are none.
+func (p *Profiles) adopt(name string) error {
+	if err := os.MkdirAll(p.ConfigDir(name), 0o755); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(p.DataDir(name), 0o755); err != nil {
+		return err
+	}
+	if err := moveIfExists(filepath.Join(p.data, "history.jsonl"), filepath.Join(p.DataDir(name), "history.jsonl")); err != nil {
+		return err
+	}
+	entries, _ := os.ReadDir(p.config)
+	for _, e := range entries {
+		// Backups and files set aside by Load
+		if n := e.Name(); strings.HasPrefix(n, "state.json.") {
+			_ = moveIfExists(filepath.Join(p.config, n), filepath.Join(p.ConfigDir(name), n))
+		}
+	}
+	// The music folder was a setting of single-user versions
+	if b, err := os.ReadFile(filepath.Join(p.config, "state.json")); err == nil {
+		var old struct {
+			Settings struct {
+				MusicDir string `json:"music_dir"`
+			} `json:"settings"`
+		}
+		if json.Unmarshal(b, &old) == nil && p.meta.MusicDir == "" {
+			p.meta.MusicDir = old.Settings.MusicDir
+		}
+	}
+	return moveIfExists(filepath.Join(p.config, "state.json"), p.StateFile(name))
+}
+
+func moveIfExists(src, dst string) error {
+	err := os.Rename(src, dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// ConfigDir is the folder of profile name's state file.
+func (p *Profiles) ConfigDir(name string) string {
+	return filepath.Join(p.config, "profiles", name)
+}
+
+// DataDir is the folder of profile name's other files.
+func (p *Profiles) DataDir(name string) string {
+	return filepath.Join(p.data, "profiles", name)
+}
+
+// StateFile is the state file of profile name.
+func (p *Profiles) StateFile(name string) string {
+	return filepath.Join(p.ConfigDir(name), "state.json")
+}
+
+// List returns the names of the profiles, sorted.
+func (p *Profiles) List() []string {
+	entries, _ := os.ReadDir(filepath.Join(p.config, "profiles"))
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && validProfileName(e.Name()) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *Profiles) exists(name string) bool {
+	if !validProfileName(name) {
+		return false
+	}
+	fi, err := os.Stat(p.ConfigDir(name))
+	return err == nil && fi.IsDir()
+}
+
+// validProfileName accepts names that are usable as a folder name on
+// every platform.
+func validProfileName(name string) bool {
+	return name != "" && name == strings.TrimSpace(name) && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\:*?"<>|`)
+}
+
+func (p *Profiles) checkNew(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if !validProfileName(name) {
+		return "", ErrProfileName
+	}
+	if p.exists(name) {
+		return name, ErrProfileExists
+	}
+	return name, nil
+}
+
+// Current returns the profile in use.
+func (p *Profiles) Current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.meta.Current
+}
+
+// SetCurrent makes name the profile in use, also on the next start.
+func (p *Profiles) SetCurrent(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.exists(name) {
+		return ErrNoProfile
+	}
+	p.meta.Current = name
+	return p.saveMeta()
+}
+
+// AskOnStart reports whether the profile is picked at every start.
+func (p *Profiles) AskOnStart() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.meta.AskOnStart
+}
+
+func (p *Profiles) SetAskOnStart(ask bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.meta.AskOnStart = ask
+	return p.saveMeta()
+}
+
+// MusicDir returns the music folder of the installation, "" for the
+// default one.
+func (p *Profiles) MusicDir() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.meta.MusicDir
+}
+
+func (p *Profiles) SetMusicDir(dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.meta.MusicDir = dir
+	return p.saveMeta()
+}
+
+// Create adds an empty profile. The name is trimmed; the name actually
+// used is returned.
+func (p *Profiles) Create(name string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	name, err := p.checkNew(name)
+	if err != nil {
+		return name, err
+	}
+	if err := os.MkdirAll(p.DataDir(name), 0o755); err != nil {
+		return name, err
+	}
+	return name, Save(p.StateFile(name), Default())
+}
+
+// Rename gives a profile a new name. The caller moves its own use of the
+// profile's files (see Saver.SetPath) when it renames the current one.
+func (p *Profiles) Rename(old, name string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.exists(old) {
+		return "", ErrNoProfile
+	}
+	name, err := p.checkNew(name)
+	if err != nil {
+		return name, err
+	}
+	if err := os.Rename(p.ConfigDir(old), p.ConfigDir(name)); err != nil {
+		return name, err
+	}
+	if err := moveIfExists(p.DataDir(old), p.DataDir(name)); err != nil {
+		return name, err
+	}
+	if p.meta.Current == old {
+		p.meta.Current = name
+		return name, p.saveMeta()
+	}
+	return name, nil
+}
+
+// Duplicate copies a profile under a free name derived from its own,
+// which is returned.
+func (p *Profiles) Duplicate(name string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.exists(name) {
+		return "", ErrNoProfile
+	}
+	dup := name + " (kopya)"
+	for i := 2; p.exists(dup); i++ {
+		dup = name + " (kopya " + strconv.Itoa(i) + ")"
+	}
+	if err := copyDir(p.ConfigDir(name), p.ConfigDir(dup)); err != nil {
+		return dup, err
+	}
+	return dup, copyDir(p.DataDir(name), p.DataDir(dup))
+}
+
+// Delete removes a profile with all its files. The current profile cannot
+// be deleted.
+func (p *Profiles) Delete(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.exists(name) {
+		return ErrNoProfile
+	}
+	if name == p.meta.Current {
+		return ErrProfileInUse
+	}
+	if err := os.RemoveAll(p.ConfigDir(name)); err != nil {
+		return err
+	}
+	return os.RemoveAll(p.DataDir(name))
+}
+
+// copyDir copies the files directly in src to dst. Backups of the state
+// file stay with the original.
+func copyDir(src, dst string) error {
+	if err := os.MkdirAll(dst, 0o755); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || strings.HasPrefix(e.Name(), "state.json.") {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
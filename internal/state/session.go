@@ -0,0 +1,57 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"opentify/internal/queue"
+)
+
+// Session is where the user left off: the track and queue of the player,
+// the volume, the page shown and the layout of the window. Tracks are
+// referred to by ID, so moved files are found again and deleted ones
+// drop out.
+type Session struct {
+	Track    string          `json:"track,omitempty"` // the selected track
+	Position time.Duration   `json:"position,omitempty"`
+	Queue    *queue.Snapshot `json:"queue,omitempty"`
+	Volume   float64         `json:"volume"`
+
+	Page     string `json:"page,omitempty"`
+	Playlist string `json:"playlist,omitempty"` // of the Playlist and Akıllı pages
+	Search   string `json:"search,omitempty"`
+
+	Width  float32   `json:"width,omitempty"`
+	Height float32   `json:"height,omitempty"`
+	Splits []float64 `json:"splits,omitempty"` // offsets of the split panes
+}
+
+// LoadSession reads the session saved at path; it returns nil when there
+// is none.
+func LoadSession(path string) (*Session, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var s Session
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveSession writes s to path. Sessions are saved often and are easily
+// lost, so no backups are kept.
+func SaveSession(path string, s *Session) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, b, false)
+}
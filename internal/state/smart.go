@@ -0,0 +1,53 @@
+package state
+
+// SmartPlaylist is a rule-based playlist whose tracks are computed from the
+// library every time it is shown.
+type SmartPlaylist struct {
+	Match string `json:"match"` // "all" or "any"
+	Rules []Rule `json:"rules"`
+	Limit int    `json:"limit,omitempty"` // 0 = unlimited
+	Sort  string `json:"sort,omitempty"`  // see SmartSortFields
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Rule is a single smart playlist condition, e.g. {"year", "between",
+// "1990", "1999"} or {"last_played", "in_last", "30", ""}.
+type Rule struct {
+	Field  string `json:"field"`
+	Op     string `json:"op"`
+	Value  string `json:"value,omitempty"`
+	Value2 string `json:"value2,omitempty"`
+}
+
+// Smart playlist rule fields.
+const (
+	FieldTitle       = "title"
+	FieldArtist      = "artist"
+	FieldAlbumArtist = "albumartist"
+	FieldAlbum       = "album"
+	FieldGenre       = "genre"
+	FieldExt         = "ext"
+	FieldYear        = "year"
+	FieldDuration    = "duration" // seconds
+	FieldPlays       = "plays"
+	FieldRating      = "rating" // 0..5
+	FieldLiked       = "liked"
+	FieldAdded       = "added"
+	FieldLastPlayed  = "last_played"
+)
+
+// SmartSortFields lists the accepted SmartPlaylist.Sort values.
+var SmartSortFields = []string{"", FieldTitle, FieldArtist, FieldAlbum, FieldYear, FieldDuration, FieldPlays, FieldRating, FieldAdded, FieldLastPlayed, "random"}
+
+// normalizeSmart fills defaults for playlists loaded from older files.
+func normalizeSmart(m map[string]SmartPlaylist) {
+	for name, pl := range m {
+		if pl.Match != "any" {
+			pl.Match = "all"
+		}
+		if pl.Limit < 0 {
+			pl.Limit = 0
+		}
+		m[name] = pl
+	}
+}
@@ -3,29 +3,107 @@ package state
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"time"
 )
 
+// State is the user's data. Tracks are referred to by their library ID
+// (library.Track.ID), which survives moving and retagging files.
 type State struct {
-	Playlists map[string][]string `json:"playlists"`
-	Liked     map[string]bool     `json:"liked"`
-	Settings  Settings            `json:"settings"`
+	// Version is the schema version of the file, see CurrentVersion.
+	// Version 0 referred to tracks by path, see MigrateIDs.
+	Version int `json:"version"`
+
+	// Recovered is the backup the state was loaded from when the file
+	// itself was corrupt.
+	Recovered string `json:"-"`
+
+	Playlists      map[string][]string      `json:"playlists"`
+	PlaylistInfo   map[string]PlaylistInfo  `json:"playlist_info,omitempty"`
+	SmartPlaylists map[string]SmartPlaylist `json:"smart_playlists"`
+	Liked          map[string]bool          `json:"liked"`
+	Settings       Settings                 `json:"settings"`
+
+	// Ratings holds 0..5 stars per track. A track missing here falls back
+	// to the rating in its tags; an explicit 0 clears that.
+	Ratings map[string]int `json:"ratings"`
+
+	// LyricsOffsets shifts the lyrics of a track, in milliseconds; positive
+	// values show lines later.
+	LyricsOffsets map[string]int `json:"lyrics_offsets,omitempty"`
+
+	// Stats sums up the listening history per track.
+	Stats map[string]PlayStats `json:"stats,omitempty"`
+
+	// Matches are the online metadata the user picked for a track, which
+	// replace the automatic lookup.
+	Matches map[string]Match `json:"matches,omitempty"`
+}
+
+// Match is the metadata chosen for a track, see internal/meta.
+type Match struct {
+	Title   string `json:"title"`
+	Artist  string `json:"artist,omitempty"`
+	Album   string `json:"album,omitempty"`
+	Artwork string `json:"artwork,omitempty"` // URL
+	Source  string `json:"source,omitempty"`  // provider
+}
+
+// PlayStats are the listening statistics of a track.
+type PlayStats struct {
+	Plays      int       `json:"plays,omitempty"`
+	Skips      int       `json:"skips,omitempty"`
+	LastPlayed time.Time `json:"last_played,omitempty"`
 }
 
 type Settings struct {
 	DownloadFormat string `json:"download_format"` // "mp3" or "mp4"
 	Theme          string `json:"theme"`           // "light" or "dark"
+
+	OrganizeTemplate string `json:"organize_template,omitempty"` // library layout, see internal/organize
+	RatingTags       bool   `json:"rating_tags,omitempty"`       // also write ratings into POPM/RATING tags
+
+	DiscordOff bool `json:"discord_off,omitempty"` // no Discord Rich Presence
+
+	Shuffle string `json:"shuffle,omitempty"` // "", "random", "exhaust", "album" or "weighted", see internal/queue
+	Repeat  string `json:"repeat,omitempty"`  // "off", "all" or "one"
+
+	// MetaProviders are the metadata providers in the order they are
+	// preferred, see internal/meta; empty for the default order.
+	MetaProviders []MetaProvider `json:"meta_providers,omitempty"`
+}
+
+// MetaProvider is a metadata provider in Settings.MetaProviders.
+type MetaProvider struct {
+	Name string `json:"name"`
+	Off  bool   `json:"off,omitempty"`
+}
+
+// clone returns a copy of set that shares nothing with it.
+func (set Settings) clone() Settings {
+	set.MetaProviders = slices.Clone(set.MetaProviders)
+	return set
 }
 
 func Default() *State {
 	return &State{
-		Playlists: map[string][]string{},
-		Liked:     map[string]bool{},
+		Version:        CurrentVersion,
+		Playlists:      map[string][]string{},
+		PlaylistInfo:   map[string]PlaylistInfo{},
+		SmartPlaylists: map[string]SmartPlaylist{},
+		Liked:          map[string]bool{},
+		Ratings:        map[string]int{},
+		LyricsOffsets:  map[string]int{},
+		Stats:          map[string]PlayStats{},
+		Matches:        map[string]Match{},
 		Settings: Settings{
 			DownloadFormat: "mp3",
 			Theme:          "light",
+			Repeat:         "off",
 		},
 	}
 }
@@ -38,24 +116,79 @@ func EnsureDir(path string) error {
 	return os.MkdirAll(d, 0o755)
 }
 
+// Load reads the state at path. A missing file gives the default state. A
+// file that cannot be decoded is moved aside to path+".corrupt" and the
+// newest good backup is loaded instead (see Recovered); an error is only
+// returned when there is none. A file of a newer schema is left alone and
+// fails with ErrNewerVersion.
 func Load(path string) (*State, error) {
 	b, err := os.ReadFile(path)
-	if err != nil {
-		if errors.Is(err, fs.ErrNotExist) {
-			return Default(), nil
+	if errors.Is(err, fs.ErrNotExist) {
+		return Default(), nil
+	}
+	if err == nil {
+		var s *State
+		if s, err = decode(b); err == nil {
+			return s, nil
+		}
+		err = fmt.Errorf("%s: %w", path, err)
+		if errors.Is(err, ErrNewerVersion) {
+			// Not corrupt, and older backups would lose the newer data
+			return nil, err
 		}
-		return nil, err
+		_ = os.Rename(path, path+".corrupt")
 	}
-	var s State
-	if err := json.Unmarshal(b, &s); err != nil {
-		return nil, err
+	for _, bak := range backups(path) {
+		b, rerr := os.ReadFile(bak)
+		if rerr != nil {
+			continue
+		}
+		if s, derr := decode(b); derr == nil {
+			s.Recovered = bak
+			return s, nil
+		}
 	}
+	return nil, err
+}
+
+// Parse decodes the content of a state file, as Load does for a file.
+func Parse(b []byte) (*State, error) {
+	return decode(b)
+}
+
+// normalize fills what older files lack and resets invalid settings.
+func (s *State) normalize() {
 	if s.Playlists == nil {
 		s.Playlists = map[string][]string{}
 	}
+	if s.PlaylistInfo == nil {
+		s.PlaylistInfo = map[string]PlaylistInfo{}
+	}
+	if s.SmartPlaylists == nil {
+		s.SmartPlaylists = map[string]SmartPlaylist{}
+	}
+	normalizeSmart(s.SmartPlaylists)
 	if s.Liked == nil {
 		s.Liked = map[string]bool{}
 	}
+	if s.Ratings == nil {
+		// State from before ratings: liked tracks start with five stars.
+		s.Ratings = map[string]int{}
+		for p, ok := range s.Liked {
+			if ok {
+				s.Ratings[p] = 5
+			}
+		}
+	}
+	if s.LyricsOffsets == nil {
+		s.LyricsOffsets = map[string]int{}
+	}
+	if s.Stats == nil {
+		s.Stats = map[string]PlayStats{}
+	}
+	if s.Matches == nil {
+		s.Matches = map[string]Match{}
+	}
 	// Defaults for settings
 	if s.Settings.DownloadFormat != "mp3" && s.Settings.DownloadFormat != "mp4" {
 		s.Settings.DownloadFormat = "mp3"
@@ -63,16 +196,198 @@ func Load(path string) (*State, error) {
 	if s.Settings.Theme != "dark" && s.Settings.Theme != "light" {
 		s.Settings.Theme = "light"
 	}
-	return &s, nil
+	switch s.Settings.Shuffle {
+	case "", "random", "exhaust", "album", "weighted":
+	default:
+		s.Settings.Shuffle = ""
+	}
+	if s.Settings.Repeat != "all" && s.Settings.Repeat != "one" {
+		s.Settings.Repeat = "off"
+	}
+}
+
+// MigrateIDs rewrites data of version 0, which referred to tracks by file
+// path, to track IDs. id returns the ID of the track at a path. It reports
+// whether anything was migrated.
+func (s *State) MigrateIDs(id func(path string) string) bool {
+	if s.Version >= 1 {
+		return false
+	}
+	s.RemapIDs(id)
+	s.Version = CurrentVersion
+	return true
+}
+
+// RemapIDs replaces every track reference r with id(r), for example to
+// move data into another library.
+func (s *State) RemapIDs(id func(string) string) {
+	for name, refs := range s.Playlists {
+		for i, r := range refs {
+			refs[i] = id(r)
+		}
+		s.Playlists[name] = refs
+	}
+	s.Liked = rekey(s.Liked, id)
+	s.Ratings = rekey(s.Ratings, id)
+	s.LyricsOffsets = rekey(s.LyricsOffsets, id)
+	s.Stats = rekey(s.Stats, id)
+	s.Matches = rekey(s.Matches, id)
+}
+
+func rekey[V any](m map[string]V, id func(string) string) map[string]V {
+	out := make(map[string]V, len(m))
+	for k, v := range m {
+		out[id(k)] = v
+	}
+	return out
+}
+
+// RecordPlay adds a play of track id that started at at to its statistics.
+// Only counted plays raise the play count and last-played time.
+func (s *State) RecordPlay(id string, at time.Time, counted, skipped bool) {
+	ps := s.Stats[id]
+	if counted {
+		ps.Plays++
+		if at.After(ps.LastPlayed) {
+			ps.LastPlayed = at
+		}
+	}
+	if skipped {
+		ps.Skips++
+	}
+	s.Stats[id] = ps
+}
+
+// Rating returns the stars of track id, falling back to tagged when the
+// user has not rated it.
+func (s *State) Rating(id string, tagged int) int {
+	if r, ok := s.Ratings[id]; ok {
+		return r
+	}
+	return tagged
+}
+
+// RemoveTracks drops the tracks with the given IDs from every playlist, the
+// likes, the ratings, the lyrics offsets and the play statistics. It reports
+// whether anything changed.
+func (s *State) RemoveTracks(ids []string) bool {
+	drop := map[string]bool{}
+	for _, id := range ids {
+		drop[id] = true
+	}
+	changed := false
+	for name, ps := range s.Playlists {
+		out := ps[:0]
+		for _, p := range ps {
+			if drop[p] {
+				changed = true
+				continue
+			}
+			out = append(out, p)
+		}
+		s.Playlists[name] = out
+	}
+	for p := range drop {
+		if _, ok := s.Liked[p]; ok {
+			delete(s.Liked, p)
+			changed = true
+		}
+		if _, ok := s.Ratings[p]; ok {
+			delete(s.Ratings, p)
+			changed = true
+		}
+		if _, ok := s.LyricsOffsets[p]; ok {
+			delete(s.LyricsOffsets, p)
+			changed = true
+		}
+		if _, ok := s.Stats[p]; ok {
+			delete(s.Stats, p)
+			changed = true
+		}
+		if _, ok := s.Matches[p]; ok {
+			delete(s.Matches, p)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// MergeInto points every playlist entry of the tracks dups at the track
+// survivor, dropping entries that would repeat it, and moves their likes,
+// ratings, play statistics and chosen metadata onto survivor; the higher
+// rating wins. It reports whether anything changed.
+func (s *State) MergeInto(survivor string, dups []string) bool {
+	gone := map[string]bool{}
+	for _, p := range dups {
+		if p != survivor {
+			gone[p] = true
+		}
+	}
+	changed := false
+	for name, paths := range s.Playlists {
+		out := paths[:0]
+		seen := false
+		for _, p := range paths {
+			if gone[p] {
+				p = survivor
+				changed = true
+			}
+			if p == survivor {
+				if seen {
+					changed = true
+					continue
+				}
+				seen = true
+			}
+			out = append(out, p)
+		}
+		s.Playlists[name] = out
+	}
+	for p := range gone {
+		if s.Liked[p] {
+			delete(s.Liked, p)
+			s.Liked[survivor] = true
+			changed = true
+		}
+		if r, ok := s.Ratings[p]; ok {
+			if r > s.Ratings[survivor] {
+				s.Ratings[survivor] = r
+			}
+			delete(s.Ratings, p)
+			changed = true
+		}
+		if ps, ok := s.Stats[p]; ok {
+			sum := s.Stats[survivor]
+			sum.Plays += ps.Plays
+			sum.Skips += ps.Skips
+			if ps.LastPlayed.After(sum.LastPlayed) {
+				sum.LastPlayed = ps.LastPlayed
+			}
+			delete(s.Stats, p)
+			s.Stats[survivor] = sum
+			changed = true
+		}
+		if m, ok := s.Matches[p]; ok {
+			if _, have := s.Matches[survivor]; !have {
+				s.Matches[survivor] = m
+			}
+			delete(s.Matches, p)
+			changed = true
+		}
+	}
+	return changed
 }
 
+// Save writes s to path at once, replacing the file atomically, unless the
+// file is of a newer schema (ErrNewerVersion). Use a Saver for frequent
+// saves.
 func Save(path string, s *State) error {
-	if err := EnsureDir(path); err != nil {
+	if err := checkNotNewer(path); err != nil {
 		return err
 	}
 	b, err := json.MarshalIndent(s, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, b, 0o644)
+	return writeFile(path, b)
 }
@@ -0,0 +1,440 @@
+package state
+
+import (
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Change tells subscribers which parts of the state changed.
+type Change uint
+
+const (
+	ChangeSettings Change = 1 << iota
+	ChangeLiked
+	ChangeRatings
+	ChangePlaylists // tracks and details of playlists
+	ChangeSmartPlaylists
+	ChangeStats
+	ChangeLyricsOffsets
+	ChangeMatches
+
+	ChangeAll Change = 1<<iota - 1
+)
+
+// Store guards a State for use from several goroutines. Reads return
+// copies; every change is announced to the subscribers, which is also how
+// the state gets saved (see Saver).
+type Store struct {
+	mu sync.RWMutex
+	s  *State
+
+	subMu   sync.Mutex
+	subs    []subscriber
+	nextSub int
+}
+
+type subscriber struct {
+	id int
+	fn func(Change)
+}
+
+func NewStore(s *State) *Store {
+	return &Store{s: s}
+}
+
+// Subscribe calls fn after every change, on the goroutine that made it and
+// without the store locked. The returned func cancels the subscription.
+func (st *Store) Subscribe(fn func(Change)) (cancel func()) {
+	st.subMu.Lock()
+	defer st.subMu.Unlock()
+	st.nextSub++
+	id := st.nextSub
+	st.subs = append(st.subs, subscriber{id, fn})
+	return func() {
+		st.subMu.Lock()
+		defer st.subMu.Unlock()
+		st.subs = slices.DeleteFunc(st.subs, func(s subscriber) bool { return s.id == id })
+	}
+}
+
+func (st *Store) notify(c Change) {
+	st.subMu.Lock()
+	subs := slices.Clone(st.subs)
+	st.subMu.Unlock()
+	for _, s := range subs {
+		s.fn(c)
+	}
+}
+
+// View calls fn with the state locked for reading, for reads of many
+// tracks at once. fn must neither modify s nor keep references into it.
+func (st *Store) View(fn func(s *State)) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	fn(st.s)
+}
+
+// Update calls fn with the state locked for writing and announces c unless
+// fn fails.
+func (st *Store) Update(c Change, fn func(s *State) error) error {
+	var err error
+	st.update(c, func(s *State) bool {
+		err = fn(s)
+		return err == nil
+	})
+	return err
+}
+
+// update announces c if fn reports a change.
+func (st *Store) update(c Change, fn func(s *State) bool) {
+	st.mu.Lock()
+	changed := fn(st.s)
+	st.mu.Unlock()
+	if changed {
+		st.notify(c)
+	}
+}
+
+// Snapshot returns a deep copy of the state.
+func (st *Store) Snapshot() *State {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	c := *st.s
+	c.Playlists = make(map[string][]string, len(st.s.Playlists))
+	for name, ids := range st.s.Playlists {
+		c.Playlists[name] = slices.Clone(ids)
+	}
+	c.SmartPlaylists = make(map[string]SmartPlaylist, len(st.s.SmartPlaylists))
+	for name, pl := range st.s.SmartPlaylists {
+		pl.Rules = slices.Clone(pl.Rules)
+		c.SmartPlaylists[name] = pl
+	}
+	c.PlaylistInfo = maps.Clone(st.s.PlaylistInfo)
+	c.Liked = maps.Clone(st.s.Liked)
+	c.Ratings = maps.Clone(st.s.Ratings)
+	c.LyricsOffsets = maps.Clone(st.s.LyricsOffsets)
+	c.Stats = maps.Clone(st.s.Stats)
+	c.Matches = maps.Clone(st.s.Matches)
+	c.Settings = st.s.Settings.clone()
+	return &c
+}
+
+// Replace swaps in another state, for example another profile's, and
+// announces that everything changed.
+func (st *Store) Replace(s *State) {
+	st.update(ChangeAll, func(old *State) bool {
+		st.s = s
+		return true
+	})
+}
+
+// Save hands the state to sv.
+func (st *Store) Save(sv *Saver) error {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return sv.Save(st.s)
+}
+
+// MigrateIDs is State.MigrateIDs; see there.
+func (st *Store) MigrateIDs(id func(path string) string) bool {
+	var migrated bool
+	st.update(ChangeAll, func(s *State) bool {
+		migrated = s.MigrateIDs(id)
+		return migrated
+	})
+	return migrated
+}
+
+func (st *Store) Settings() Settings {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.s.Settings.clone()
+}
+
+// UpdateSettings changes the settings through fn.
+func (st *Store) UpdateSettings(fn func(set *Settings)) {
+	st.update(ChangeSettings, func(s *State) bool {
+		old := s.Settings.clone()
+		fn(&s.Settings)
+		return !reflect.DeepEqual(s.Settings, old)
+	})
+}
+
+func (st *Store) Liked(id string) bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.s.Liked[id]
+}
+
+// SetLiked likes or unlikes track id.
+func (st *Store) SetLiked(id string, liked bool) {
+	st.update(ChangeLiked, func(s *State) bool {
+		if s.Liked[id] == liked {
+			return false
+		}
+		if liked {
+			s.Liked[id] = true
+		} else {
+			delete(s.Liked, id)
+		}
+		return true
+	})
+}
+
+// ToggleLiked flips the like of track id and returns the new value.
+func (st *Store) ToggleLiked(id string) bool {
+	var liked bool
+	st.update(ChangeLiked, func(s *State) bool {
+		liked = !s.Liked[id]
+		if liked {
+			s.Liked[id] = true
+		} else {
+			delete(s.Liked, id)
+		}
+		return true
+	})
+	return liked
+}
+
+// Rating is State.Rating.
+func (st *Store) Rating(id string, tagged int) int {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.s.Rating(id, tagged)
+}
+
+// SetRating gives track id 0..5 stars; 0 overrides a rating in its tags.
+func (st *Store) SetRating(id string, stars int) {
+	st.update(ChangeRatings, func(s *State) bool {
+		if r, ok := s.Ratings[id]; ok && r == stars {
+			return false
+		}
+		s.Ratings[id] = stars
+		return true
+	})
+}
+
+func (st *Store) Stats(id string) PlayStats {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.s.Stats[id]
+}
+
+// RecordPlay is State.RecordPlay.
+func (st *Store) RecordPlay(id string, at time.Time, counted, skipped bool) {
+	st.update(ChangeStats, func(s *State) bool {
+		s.RecordPlay(id, at, counted, skipped)
+		return true
+	})
+}
+
+// LyricsOffset returns the lyrics offset of track id in milliseconds.
+func (st *Store) LyricsOffset(id string) int {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.s.LyricsOffsets[id]
+}
+
+// SetLyricsOffset sets the lyrics offset of track id; 0 removes it.
+func (st *Store) SetLyricsOffset(id string, ms int) {
+	st.update(ChangeLyricsOffsets, func(s *State) bool {
+		if s.LyricsOffsets[id] == ms {
+			return false
+		}
+		if ms == 0 {
+			delete(s.LyricsOffsets, id)
+		} else {
+			s.LyricsOffsets[id] = ms
+		}
+		return true
+	})
+}
+
+// Match returns the metadata the user picked for track id.
+func (st *Store) Match(id string) (Match, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	m, ok := st.s.Matches[id]
+	return m, ok
+}
+
+// SetMatch remembers m as the metadata of track id.
+func (st *Store) SetMatch(id string, m Match) {
+	st.update(ChangeMatches, func(s *State) bool {
+		if old, ok := s.Matches[id]; ok && old == m {
+			return false
+		}
+		s.Matches[id] = m
+		return true
+	})
+}
+
+// ClearMatch goes back to the automatic lookup for track id.
+func (st *Store) ClearMatch(id string) {
+	st.update(ChangeMatches, func(s *State) bool {
+		if _, ok := s.Matches[id]; !ok {
+			return false
+		}
+		delete(s.Matches, id)
+		return true
+	})
+}
+
+// RemoveTracks is State.RemoveTracks.
+func (st *Store) RemoveTracks(ids []string) bool {
+	var changed bool
+	st.update(ChangeAll&^ChangeSettings, func(s *State) bool {
+		changed = s.RemoveTracks(ids)
+		return changed
+	})
+	return changed
+}
+
+// MergeInto is State.MergeInto.
+func (st *Store) MergeInto(survivor string, dups []string) bool {
+	var changed bool
+	st.update(ChangePlaylists|ChangeLiked|ChangeRatings|ChangeStats|ChangeMatches, func(s *State) bool {
+		changed = s.MergeInto(survivor, dups)
+		return changed
+	})
+	return changed
+}
+
+func (st *Store) PlaylistNames() []string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return st.s.PlaylistNames()
+}
+
+// Playlist returns a copy of the track IDs and the details of a playlist.
+func (st *Store) Playlist(name string) ([]string, PlaylistInfo, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	ids, info, ok := st.s.Playlist(name)
+	return slices.Clone(ids), info, ok
+}
+
+// CreatePlaylist is State.CreatePlaylist.
+func (st *Store) CreatePlaylist(name string) (string, error) {
+	var out string
+	err := st.Update(ChangePlaylists, func(s *State) (err error) {
+		out, err = s.CreatePlaylist(name)
+		return err
+	})
+	return out, err
+}
+
+// RenamePlaylist is State.RenamePlaylist.
+func (st *Store) RenamePlaylist(old, name string) (string, error) {
+	var out string
+	err := st.Update(ChangePlaylists, func(s *State) (err error) {
+		out, err = s.RenamePlaylist(old, name)
+		return err
+	})
+	return out, err
+}
+
+// DuplicatePlaylist is State.DuplicatePlaylist.
+func (st *Store) DuplicatePlaylist(name string) (string, error) {
+	var out string
+	err := st.Update(ChangePlaylists, func(s *State) (err error) {
+		out, err = s.DuplicatePlaylist(name)
+		return err
+	})
+	return out, err
+}
+
+// DeletePlaylist is State.DeletePlaylist.
+func (st *Store) DeletePlaylist(name string) error {
+	return st.Update(ChangePlaylists, func(s *State) error { return s.DeletePlaylist(name) })
+}
+
+// AddToPlaylist is State.AddToPlaylist.
+func (st *Store) AddToPlaylist(name string, ids ...string) (int, error) {
+	var n int
+	var err error
+	st.update(ChangePlaylists, func(s *State) bool {
+		n, err = s.AddToPlaylist(name, ids...)
+		return err == nil && n > 0
+	})
+	return n, err
+}
+
+// RemoveFromPlaylist is State.RemoveFromPlaylist.
+func (st *Store) RemoveFromPlaylist(name string, idx ...int) error {
+	return st.Update(ChangePlaylists, func(s *State) error { return s.RemoveFromPlaylist(name, idx...) })
+}
+
+// MovePlaylistEntry is State.MovePlaylistEntry.
+func (st *Store) MovePlaylistEntry(name string, from, to int) error {
+	return st.Update(ChangePlaylists, func(s *State) error { return s.MovePlaylistEntry(name, from, to) })
+}
+
+// DedupePlaylist is State.DedupePlaylist.
+func (st *Store) DedupePlaylist(name string) (int, error) {
+	var n int
+	err := st.Update(ChangePlaylists, func(s *State) (err error) {
+		n, err = s.DedupePlaylist(name)
+		return err
+	})
+	return n, err
+}
+
+// SetPlaylistDescription is State.SetPlaylistDescription.
+func (st *Store) SetPlaylistDescription(name, desc string) error {
+	return st.Update(ChangePlaylists, func(s *State) error { return s.SetPlaylistDescription(name, desc) })
+}
+
+// SetPlaylistCover is State.SetPlaylistCover.
+func (st *Store) SetPlaylistCover(name, image string) error {
+	return st.Update(ChangePlaylists, func(s *State) error { return s.SetPlaylistCover(name, image) })
+}
+
+// SmartPlaylistNames returns the names of the smart playlists, sorted.
+func (st *Store) SmartPlaylistNames() []string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	names := make([]string, 0, len(st.s.SmartPlaylists))
+	for name := range st.s.SmartPlaylists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SmartPlaylist returns a copy of a smart playlist.
+func (st *Store) SmartPlaylist(name string) (SmartPlaylist, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	pl, ok := st.s.SmartPlaylists[name]
+	pl.Rules = slices.Clone(pl.Rules)
+	return pl, ok
+}
+
+// PutSmartPlaylist stores pl under name, replacing the smart playlist
+// oldName when it is renamed; oldName is "" for a new one.
+func (st *Store) PutSmartPlaylist(oldName, name string, pl SmartPlaylist) {
+	st.update(ChangeSmartPlaylists, func(s *State) bool {
+		if oldName != "" && oldName != name {
+			delete(s.SmartPlaylists, oldName)
+		}
+		pl.Rules = slices.Clone(pl.Rules)
+		s.SmartPlaylists[name] = pl
+		return true
+	})
+}
+
+// DeleteSmartPlaylist removes a smart playlist.
+func (st *Store) DeleteSmartPlaylist(name string) {
+	st.update(ChangeSmartPlaylists, func(s *State) bool {
+		if _, ok := s.SmartPlaylists[name]; !ok {
+			return false
+		}
+		delete(s.SmartPlaylists, name)
+		return true
+	})
+}
@@ -0,0 +1,156 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStoreChanges(t *testing.T) {
+	tests := []struct {
+		name string
+		op   func(st *Store)
+		want []Change // notifications, in order
+	}{
+		{"like", func(st *Store) { st.SetLiked("a", true) }, []Change{ChangeLiked}},
+		{"like again", func(st *Store) { st.SetLiked("a", true); st.SetLiked("a", true) }, []Change{ChangeLiked}},
+		{"unlike unliked", func(st *Store) { st.SetLiked("x", false) }, nil},
+		{"toggle", func(st *Store) { st.ToggleLiked("a"); st.ToggleLiked("a") }, []Change{ChangeLiked, ChangeLiked}},
+		{"rating", func(st *Store) { st.SetRating("a", 4); st.SetRating("a", 4); st.SetRating("a", 0) }, []Change{ChangeRatings, ChangeRatings}},
+		{"settings", func(st *Store) {
+			st.UpdateSettings(func(s *Settings) { s.Theme = "dark" })
+			st.UpdateSettings(func(s *Settings) { s.Theme = "dark" })
+		}, []Change{ChangeSettings}},
+		{"lyrics offset", func(st *Store) {
+			st.SetLyricsOffset("a", 250)
+			st.SetLyricsOffset("a", 250)
+			st.SetLyricsOffset("a", 0)
+		}, []Change{ChangeLyricsOffsets, ChangeLyricsOffsets}},
+		{"play", func(st *Store) { st.RecordPlay("a", time.Now(), true, false) }, []Change{ChangeStats}},
+		{"playlists", func(st *Store) {
+			st.CreatePlaylist("Yol")
+			st.CreatePlaylist("Yol") // exists: no change
+			st.AddToPlaylist("Yol", "a", "b")
+			st.AddToPlaylist("Yol", "a") // already there
+			st.AddToPlaylist("Yok", "a") // no such playlist
+			st.RenamePlaylist("Yol", "Yollar")
+		}, []Change{ChangePlaylists, ChangePlaylists, ChangePlaylists}},
+		{"smart playlists", func(st *Store) {
+			st.PutSmartPlaylist("", "Rock", SmartPlaylist{})
+			st.DeleteSmartPlaylist("Pop")
+			st.DeleteSmartPlaylist("Rock")
+		}, []Change{ChangeSmartPlaylists, ChangeSmartPlaylists}},
+		{"remove tracks", func(st *Store) {
+			st.SetLiked("a", true)
+			st.RemoveTracks([]string{"b"})
+			st.RemoveTracks([]string{"a"})
+		}, []Change{ChangeLiked, ChangeAll &^ ChangeSettings}},
+		{"failed update", func(st *Store) {
+			st.Update(ChangeAll, func(*State) error { return errors.New("no") })
+		}, nil},
+	}
+	for _, tt := range tests {
+		st := NewStore(Default())
+		var got []Change
+		st.Subscribe(func(c Change) { got = append(got, c) })
+		tt.op(st)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: notified %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSubscribeCancel(t *testing.T) {
+	st := NewStore(Default())
+	var a, b int
+	cancelA := st.Subscribe(func(Change) { a++ })
+	st.Subscribe(func(Change) { b++ })
+	st.SetLiked("x", true)
+	cancelA()
+	cancelA() // twice is harmless
+	st.SetLiked("y", true)
+	if a != 1 || b != 2 {
+		t.Errorf("calls %d and %d, want 1 and 2", a, b)
+	}
+}
+
+// Subscribers run without the store locked, so they may read it.
+func TestSubscriberMayReadStore(t *testing.T) {
+	st := NewStore(Default())
+	var liked bool
+	st.Subscribe(func(Change) { liked = st.Liked("a") })
+	done := make(chan struct{})
+	go func() {
+		st.SetLiked("a", true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deadlock")
+	}
+	if !liked {
+		t.Error("subscriber did not see the change")
+	}
+}
+
+func TestSnapshotIsDeep(t *testing.T) {
+	st := NewStore(Default())
+	st.CreatePlaylist("Yol")
+	st.AddToPlaylist("Yol", "a")
+	st.PutSmartPlaylist("", "Rock", SmartPlaylist{Rules: []Rule{{Field: FieldGenre, Op: "contains", Value: "rock"}}})
+	st.SetLiked("a", true)
+	snap := st.Snapshot()
+
+	st.AddToPlaylist("Yol", "b")
+	st.SetLiked("b", true)
+	st.SetRating("a", 5)
+	snap.Playlists["Yol"][0] = "changed"
+	snap.SmartPlaylists["Rock"].Rules[0].Value = "changed"
+
+	if ids, _, _ := st.Playlist("Yol"); !slices.Equal(ids, []string{"a", "b"}) {
+		t.Errorf("store playlist %v", ids)
+	}
+	if pl, _ := st.SmartPlaylist("Rock"); pl.Rules[0].Value != "rock" {
+		t.Error("snapshot shares smart playlist rules")
+	}
+	if len(snap.Playlists["Yol"]) != 1 || snap.Liked["b"] || len(snap.Ratings) != 0 {
+		t.Errorf("snapshot changed with the store: %v %v %v", snap.Playlists, snap.Liked, snap.Ratings)
+	}
+	// Copies handed out are not the store's either
+	ids, _, _ := st.Playlist("Yol")
+	ids[0] = "changed"
+	if ids, _, _ := st.Playlist("Yol"); ids[0] != "a" {
+		t.Error("Playlist returned the store's slice")
+	}
+}
+
+func TestStoreConcurrentUse(t *testing.T) {
+	st := NewStore(Default())
+	var mu sync.Mutex
+	notified := 0
+	st.Subscribe(func(c Change) {
+		mu.Lock()
+		notified++
+		mu.Unlock()
+	})
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				st.SetLiked(fmt.Sprint(i, "-", j), true)
+				st.Snapshot()
+				st.View(func(s *State) { _ = len(s.Liked) })
+			}
+		}()
+	}
+	wg.Wait()
+	if n := len(st.Snapshot().Liked); n != 400 || notified != 400 {
+		t.Errorf("%d liked, %d notifications, want 400", n, notified)
+	}
+}
@@ -0,0 +1,41 @@
+package tags
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// AudioRange returns the byte range [start, end) of the file at path that
+// holds the audio stream: a leading ID3v2 tag, FLAC metadata blocks and a
+// trailing ID3v1 tag are left out, so editing tags does not move it. Other
+// formats span the whole file.
+func AudioRange(path string) (start, end int64, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	end = fi.Size()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		if tag, err := readID3v2(f); err == nil && tag != nil {
+			start = int64(tag.Size)
+		}
+		if _, ok := readID3v1(f); ok {
+			end -= 128
+		}
+	case ".flac":
+		if _, pos, err := readFLACBlocks(f, func(byte) bool { return false }); err == nil {
+			start = pos
+		}
+	}
+	if start > end {
+		start = end
+	}
+	return start, end, nil
+}
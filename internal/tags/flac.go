@@ -0,0 +1,323 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image"
+	_ "image/jpeg" // picture dimensions
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	flacStreamInfo    = 0
+	flacPadding       = 1
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+type flacBlock struct {
+	Type byte
+	Data []byte
+}
+
+// readFLACBlocks returns the metadata blocks selected by keep and the offset
+// of the first audio frame. A leading ID3v2 tag is skipped.
+func readFLACBlocks(f *os.File, keep func(typ byte) bool) ([]flacBlock, int64, error) {
+	start := int64(0)
+	if tag, err := readID3v2(f); err == nil && tag != nil {
+		start = int64(tag.Size)
+	}
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	var magic [4]byte
+	if _, err := io.ReadFull(f, magic[:]); err != nil || string(magic[:]) != "fLaC" {
+		return nil, 0, errors.New("tags: not a flac stream")
+	}
+	pos := start + 4
+	var blocks []flacBlock
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(f, hdr[:]); err != nil {
+			return nil, 0, err
+		}
+		last := hdr[0]&0x80 != 0
+		typ := hdr[0] & 0x7f
+		size := int64(hdr[1])<<16 | int64(hdr[2])<<8 | int64(hdr[3])
+		pos += 4 + size
+		if keep(typ) {
+			data := make([]byte, size)
+			if _, err := io.ReadFull(f, data); err != nil {
+				return nil, 0, err
+			}
+			blocks = append(blocks, flacBlock{Type: typ, Data: data})
+		} else if _, err := f.Seek(size, io.SeekCurrent); err != nil {
+			return nil, 0, err
+		}
+		if last {
+			break
+		}
+	}
+	return blocks, pos, nil
+}
+
+func readFLAC(f *os.File, withPics bool) (Tags, []Picture, error) {
+	blocks, audio, err := readFLACBlocks(f, func(typ byte) bool {
+		return typ == flacStreamInfo || typ == flacVorbisComment || (withPics && typ == flacPicture)
+	})
+	if err != nil {
+		return Tags{}, nil, err
+	}
+	var t Tags
+	var pics []Picture
+	for _, b := range blocks {
+		switch b.Type {
+		case flacStreamInfo:
+			if len(b.Data) < 18 {
+				continue
+			}
+			x := binary.BigEndian.Uint64(b.Data[10:18])
+			t.SampleRate = int(x >> 44)
+			t.Channels = int((x>>41)&7) + 1
+			total := x & 0xfffffffff
+			if t.SampleRate > 0 && total > 0 {
+				secs := float64(total) / float64(t.SampleRate)
+				t.Duration = time.Duration(secs * float64(time.Second))
+				if fi, err := f.Stat(); err == nil {
+					t.Bitrate = int(float64(fi.Size()-audio) * 8 / secs / 1000)
+				}
+			}
+		case flacVorbisComment:
+			pics = append(pics, parseVorbisComment(b.Data, &t, withPics)...)
+		case flacPicture:
+			if p, ok := parseFLACPicture(b.Data); ok {
+				pics = append(pics, p)
+			}
+		}
+	}
+	return t, pics, nil
+}
+
+// parseVorbisComment decodes a little-endian Vorbis comment block into t and
+// returns any METADATA_BLOCK_PICTURE entries when withPics is set.
+func parseVorbisComment(d []byte, t *Tags, withPics bool) []Picture {
+	_, fields := vorbisFields(d)
+	var pics []Picture
+	for _, kv := range fields {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		if strings.EqualFold(k, "METADATA_BLOCK_PICTURE") {
+			if !withPics {
+				continue
+			}
+			if p, ok := decodeVorbisPicture(v); ok {
+				pics = append(pics, p)
+			}
+			continue
+		}
+		t.applyVorbis(k, v)
+	}
+	return pics
+}
+
+// vorbisFields splits a Vorbis comment payload into vendor and KEY=value pairs.
+func vorbisFields(d []byte) (string, []string) {
+	rd := func() (string, bool) {
+		if len(d) < 4 {
+			return "", false
+		}
+		n := int(binary.LittleEndian.Uint32(d))
+		if n < 0 || 4+n > len(d) {
+			return "", false
+		}
+		s := string(d[4 : 4+n])
+		d = d[4+n:]
+		return s, true
+	}
+	vendor, ok := rd()
+	if !ok || len(d) < 4 {
+		return vendor, nil
+	}
+	count := int(binary.LittleEndian.Uint32(d))
+	d = d[4:]
+	var out []string
+	for i := 0; i < count; i++ {
+		s, ok := rd()
+		if !ok {
+			break
+		}
+		out = append(out, s)
+	}
+	return vendor, out
+}
+
+func parseFLACPicture(d []byte) (Picture, bool) {
+	u32 := func() (int, bool) {
+		if len(d) < 4 {
+			return 0, false
+		}
+		v := int(binary.BigEndian.Uint32(d))
+		d = d[4:]
+		return v, true
+	}
+	str := func() (string, bool) {
+		n, ok := u32()
+		if !ok || n < 0 || n > len(d) {
+			return "", false
+		}
+		s := string(d[:n])
+		d = d[n:]
+		return s, true
+	}
+	typ, ok := u32()
+	if !ok {
+		return Picture{}, false
+	}
+	mime, ok1 := str()
+	desc, ok2 := str()
+	if !ok1 || !ok2 || len(d) < 20 {
+		return Picture{}, false
+	}
+	d = d[16:] // width, height, depth, colours
+	n, ok := u32()
+	if !ok || n > len(d) {
+		return Picture{}, false
+	}
+	return Picture{MIME: mime, Type: byte(typ), Description: desc, Data: d[:n]}, true
+}
+
+// encodeFLACPicture builds a FLAC PICTURE block payload (also used, base64
+// encoded, for Vorbis METADATA_BLOCK_PICTURE).
+func encodeFLACPicture(p Picture) []byte {
+	var w, h, depth int
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(p.Data)); err == nil {
+		w, h, depth = cfg.Width, cfg.Height, 24
+	}
+	mime := p.MIME
+	if mime == "" {
+		mime = http.DetectContentType(p.Data)
+	}
+	var b bytes.Buffer
+	u32 := func(v int) { binary.Write(&b, binary.BigEndian, uint32(v)) }
+	u32(int(p.Type))
+	u32(len(mime))
+	b.WriteString(mime)
+	u32(len(p.Description))
+	b.WriteString(p.Description)
+	u32(w)
+	u32(h)
+	u32(depth)
+	u32(0) // colours, only used by indexed images
+	u32(len(p.Data))
+	b.Write(p.Data)
+	return b.Bytes()
+}
+
+func encodeVorbisPicture(p Picture) string {
+	return base64.StdEncoding.EncodeToString(encodeFLACPicture(p))
+}
+
+func decodeVorbisPicture(v string) (Picture, bool) {
+	raw, err := base64.StdEncoding.DecodeString(v)
+	if err != nil {
+		return Picture{}, false
+	}
+	return parseFLACPicture(raw)
+}
+
+// encodeVorbisComment builds a Vorbis comment payload (without the Ogg
+// packet header and framing bit).
+func encodeVorbisComment(vendor string, fields []string) []byte {
+	var b bytes.Buffer
+	str := func(s string) {
+		binary.Write(&b, binary.LittleEndian, uint32(len(s)))
+		b.WriteString(s)
+	}
+	str(vendor)
+	binary.Write(&b, binary.LittleEndian, uint32(len(fields)))
+	for _, f := range fields {
+		str(f)
+	}
+	return b.Bytes()
+}
+
+// flacPaddingSize is the padding left after rewritten metadata so later
+// edits of similar size do not move the audio again.
+const flacPaddingSize = 4096
+
+// writeFLAC copies src to dst with a new Vorbis comment block and, when
+// cover is set, new front cover PICTURE blocks. Existing padding is
+// replaced and a leading ID3v2 tag (not part of the format) is dropped.
+func writeFLAC(src, dst *os.File, t Tags, cover *Picture) error {
+	// Covers some taggers put in the comments go too; the new one is a
+	// PICTURE block
+	var dropCovers *Picture
+	if cover != nil {
+		dropCovers = &Picture{}
+	}
+	return rewriteFLAC(src, dst, func(fields []string) []string { return editVorbis(fields, t, dropCovers, true) }, cover)
+}
+
+// rewriteFLAC is writeFLAC with the comment fields produced by edit.
+func rewriteFLAC(src, dst *os.File, edit func(fields []string) []string, cover *Picture) error {
+	blocks, audio, err := readFLACBlocks(src, func(byte) bool { return true })
+	if err != nil {
+		return err
+	}
+	var out []flacBlock
+	vendor, fields := "opentify", []string(nil)
+	for _, b := range blocks {
+		switch b.Type {
+		case flacPadding:
+			continue
+		case flacVorbisComment:
+			vendor, fields = vorbisFields(b.Data)
+			continue
+		case flacPicture:
+			if p, ok := parseFLACPicture(b.Data); cover != nil && (!ok || isCover(p.Type)) {
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	if len(out) == 0 || out[0].Type != flacStreamInfo {
+		return errors.New("tags: flac without STREAMINFO")
+	}
+	// The comment block goes right after STREAMINFO, pictures at the end.
+	comment := flacBlock{Type: flacVorbisComment, Data: encodeVorbisComment(vendor, edit(fields))}
+	out = append([]flacBlock{out[0], comment}, out[1:]...)
+	if cover != nil && len(cover.Data) > 0 {
+		c := *cover
+		c.Type = 3
+		out = append(out, flacBlock{Type: flacPicture, Data: encodeFLACPicture(c)})
+	}
+	out = append(out, flacBlock{Type: flacPadding, Data: make([]byte, flacPaddingSize)})
+
+	w := bufio.NewWriter(dst)
+	w.WriteString("fLaC")
+	for i, b := range out {
+		if len(b.Data) >= 1<<24 {
+			return errors.New("tags: flac metadata block too large")
+		}
+		hdr := [4]byte{b.Type, byte(len(b.Data) >> 16), byte(len(b.Data) >> 8), byte(len(b.Data))}
+		if i == len(out)-1 {
+			hdr[0] |= 0x80
+		}
+		w.Write(hdr[:])
+		w.Write(b.Data)
+	}
+	if err := copyAudio(w, src, audio, -1); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,758 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// id3Frame is a single ID3v2 frame with its ID normalised to v2.4 and its
+// payload already de-unsynchronised.
+type id3Frame struct {
+	ID   string
+	Data []byte
+	// Flags are the v2.4 frame flags of a frame that cannot be decoded
+	// (compressed or encrypted), zero otherwise. Such a frame is kept as
+	// stored, Data being its raw payload, so rewriting the tag keeps it.
+	Flags uint16
+}
+
+// opaque reports whether f is kept as stored rather than decoded.
+func (f id3Frame) opaque() bool { return f.Flags&0x000c != 0 }
+
+// id3Tag is a parsed ID3v2 tag.
+type id3Tag struct {
+	Major  byte
+	Size   int // bytes occupied in the file, header and footer included
+	Frames []id3Frame
+}
+
+// v2.2 three-letter frame IDs and their v2.4 equivalents. Frames missing
+// here (CRM, EQU, RVA, LNK and experimental ones) keep their v2.2 ID, which
+// makes writeMP3 refuse the file rather than lose them.
+var id3v22IDs = map[string]string{
+	"TT2": "TIT2", "TP1": "TPE1", "TP2": "TPE2", "TAL": "TALB", "TRK": "TRCK",
+	"TPA": "TPOS", "TYE": "TYER", "TCO": "TCON", "TCP": "TCMP", "COM": "COMM",
+	"ULT": "USLT", "SLT": "SYLT", "POP": "POPM", "TXX": "TXXX", "PIC": "APIC",
+	"TCM": "TCOM", "TT3": "TIT3", "TT1": "TIT1", "TP3": "TPE3", "TLE": "TLEN",
+	"TP4": "TPE4", "TBP": "TBPM", "TCR": "TCOP", "TDA": "TDAT", "TDY": "TDLY",
+	"TEN": "TENC", "TFT": "TFLT", "TIM": "TIME", "TKE": "TKEY", "TLA": "TLAN",
+	"TMT": "TMED", "TOA": "TOPE", "TOF": "TOFN", "TOL": "TOLY", "TOR": "TORY",
+	"TOT": "TOAL", "TPB": "TPUB", "TRC": "TSRC", "TRD": "TRDA", "TSI": "TSIZ",
+	"TSS": "TSSE", "TXT": "TEXT", "TS2": "TSO2", "TSA": "TSOA", "TSC": "TSOC",
+	"TSP": "TSOP", "TST": "TSOT", "IPL": "IPLS", "UFI": "UFID", "WXX": "WXXX",
+	"WAF": "WOAF", "WAR": "WOAR", "WAS": "WOAS", "WCM": "WCOM", "WCP": "WCOP",
+	"WPB": "WPUB", "BUF": "RBUF", "CNT": "PCNT", "CRA": "AENC", "ETC": "ETCO",
+	"GEO": "GEOB", "MCI": "MCDI", "MLL": "MLLT", "REV": "RVRB", "STC": "SYTC",
+}
+
+func syncsafe(b []byte) int {
+	return int(b[0]&0x7f)<<21 | int(b[1]&0x7f)<<14 | int(b[2]&0x7f)<<7 | int(b[3]&0x7f)
+}
+
+// unsync reverses ID3 unsynchronisation (0xFF 0x00 -> 0xFF).
+func unsync(b []byte) []byte {
+	if !bytes.Contains(b, []byte{0xff, 0x00}) {
+		return b
+	}
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0x00 {
+			i++
+		}
+	}
+	return out
+}
+
+// readID3v2 parses an ID3v2 tag at the start of r. It returns (nil, nil)
+// when no tag is present.
+func readID3v2(r io.ReadSeeker) (*id3Tag, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var hdr [10]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if string(hdr[:3]) != "ID3" {
+		return nil, nil
+	}
+	major := hdr[3]
+	flags := hdr[5]
+	size := syncsafe(hdr[6:10])
+	tag := &id3Tag{Major: major, Size: 10 + size}
+	if flags&0x10 != 0 {
+		tag.Size += 10 // footer
+	}
+	if major < 2 || major > 4 {
+		return tag, nil
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if major < 4 && flags&0x80 != 0 {
+		body = unsync(body)
+	}
+	if major >= 3 && flags&0x40 != 0 && len(body) >= 4 {
+		var ext int
+		if major == 4 {
+			ext = syncsafe(body[:4])
+		} else {
+			ext = int(binary.BigEndian.Uint32(body[:4])) + 4
+		}
+		if ext > len(body) {
+			return tag, nil
+		}
+		body = body[ext:]
+	}
+
+	for len(body) > 0 {
+		var id string
+		var fsize, hsize int
+		var fflags uint16
+		if major == 2 {
+			if len(body) < 6 {
+				break
+			}
+			id = string(body[:3])
+			fsize = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+			hsize = 6
+		} else {
+			if len(body) < 10 {
+				break
+			}
+			id = string(body[:4])
+			if major == 4 {
+				fsize = syncsafe(body[4:8])
+			} else {
+				fsize = int(binary.BigEndian.Uint32(body[4:8]))
+			}
+			fflags = binary.BigEndian.Uint16(body[8:10])
+			hsize = 10
+		}
+		if id[0] == 0 || fsize <= 0 || hsize+fsize > len(body) {
+			break // padding or malformed frame
+		}
+		data := body[hsize : hsize+fsize]
+		body = body[hsize+fsize:]
+
+		if major == 2 {
+			if nid, ok := id3v22IDs[id]; ok {
+				if nid == "APIC" {
+					data = convertPIC(data)
+				}
+				id = nid
+			}
+		}
+		switch major {
+		case 3:
+			if fflags&0x00c0 != 0 { // compressed or encrypted
+				if f, ok := opaqueV23(id, fflags, data); ok {
+					tag.Frames = append(tag.Frames, f)
+				}
+				continue
+			}
+			if fflags&0x0020 != 0 && len(data) > 0 { // grouping identity
+				data = data[1:]
+			}
+		case 4:
+			if fflags&0x000c != 0 { // compressed or encrypted
+				tag.Frames = append(tag.Frames, id3Frame{ID: id, Data: append([]byte(nil), data...), Flags: fflags})
+				continue
+			}
+			if fflags&0x0040 != 0 && len(data) > 0 { // grouping identity
+				data = data[1:]
+			}
+			if fflags&0x0001 != 0 && len(data) >= 4 { // data length indicator
+				data = data[4:]
+			}
+			if fflags&0x0002 != 0 {
+				data = unsync(data)
+			}
+		}
+		tag.Frames = append(tag.Frames, id3Frame{ID: id, Data: append([]byte(nil), data...)})
+	}
+	if major == 3 || major == 2 {
+		tag.upgradeDate()
+	}
+	return tag, nil
+}
+
+// opaqueV23 converts a compressed or encrypted v2.3 frame to the v2.4
+// layout, in which the extra header bytes come in another order and the
+// decompressed size is syncsafe.
+func opaqueV23(id string, fflags uint16, data []byte) (id3Frame, bool) {
+	var size, method, group []byte
+	take := func(n int) []byte {
+		if len(data) < n {
+			return nil
+		}
+		b := data[:n]
+		data = data[n:]
+		return b
+	}
+	if fflags&0x0080 != 0 {
+		if size = take(4); size == nil {
+			return id3Frame{}, false
+		}
+	}
+	if fflags&0x0040 != 0 {
+		if method = take(1); method == nil {
+			return id3Frame{}, false
+		}
+	}
+	if fflags&0x0020 != 0 {
+		if group = take(1); group == nil {
+			return id3Frame{}, false
+		}
+	}
+	// Status flags move one bit to the right
+	f := id3Frame{ID: id, Flags: fflags >> 1 & 0x7000}
+	if group != nil {
+		f.Flags |= 0x0040
+		f.Data = append(f.Data, group...)
+	}
+	if method != nil {
+		f.Flags |= 0x0004
+		f.Data = append(f.Data, method...)
+	}
+	if size != nil {
+		f.Flags |= 0x0008 | 0x0001 // compressed, with data length indicator
+		var dli [4]byte
+		putSyncsafe(dli[:], int(binary.BigEndian.Uint32(size)))
+		f.Data = append(f.Data, dli[:]...)
+	}
+	f.Data = append(f.Data, data...)
+	return f, true
+}
+
+// convertPIC rewrites a v2.2 PIC payload ("JPG" image format) to APIC layout.
+func convertPIC(d []byte) []byte {
+	if len(d) < 5 {
+		return d
+	}
+	mime := "image/" + strings.ToLower(string(d[1:4]))
+	if mime == "image/jpg" {
+		mime = "image/jpeg"
+	}
+	out := []byte{d[0]}
+	out = append(out, mime...)
+	out = append(out, 0)
+	return append(out, d[4:]...)
+}
+
+// upgradeDate folds v2.3 TYER into a v2.4 TDRC frame.
+func (t *id3Tag) upgradeDate() {
+	for i, f := range t.Frames {
+		if f.ID == "TYER" {
+			t.Frames[i].ID = "TDRC"
+		}
+	}
+}
+
+func (t *id3Tag) frame(id string) []byte {
+	for _, f := range t.Frames {
+		if f.ID == id && !f.opaque() {
+			return f.Data
+		}
+	}
+	return nil
+}
+
+func (t *id3Tag) text(id string) string {
+	vals := decodeTextFrame(t.frame(id))
+	return strings.Join(vals, "; ")
+}
+
+// txxx returns the value of a user defined text frame by description.
+func (t *id3Tag) txxx(desc string) string {
+	for _, f := range t.Frames {
+		if f.ID != "TXXX" || f.opaque() || len(f.Data) < 1 {
+			continue
+		}
+		d, rest := splitEncoded(f.Data[0], f.Data[1:])
+		if strings.EqualFold(d, desc) {
+			return decodeString(f.Data[0], rest)
+		}
+	}
+	return ""
+}
+
+// decodeTextFrame decodes a T*** frame into its (possibly multiple) values.
+func decodeTextFrame(d []byte) []string {
+	if len(d) < 1 {
+		return nil
+	}
+	s := decodeString(d[0], d[1:])
+	parts := strings.Split(s, "\x00")
+	out := parts[:0]
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// decodeString converts ID3 encoded bytes (0 latin1, 1 utf16 bom, 2 utf16be, 3 utf8).
+func decodeString(enc byte, b []byte) string {
+	switch enc {
+	case 0:
+		r := make([]rune, len(b))
+		for i, c := range b {
+			r[i] = rune(c)
+		}
+		return strings.TrimRight(string(r), "\x00")
+	case 1, 2:
+		return strings.TrimRight(decodeUTF16(b, enc == 2), "\x00")
+	default:
+		return strings.TrimRight(string(b), "\x00")
+	}
+}
+
+func decodeUTF16(b []byte, bigEndian bool) string {
+	var u []uint16
+	be := bigEndian
+	var out strings.Builder
+	flush := func() {
+		out.WriteString(string(utf16.Decode(u)))
+		u = u[:0]
+	}
+	for i := 0; i+1 < len(b); i += 2 {
+		switch {
+		case b[i] == 0xff && b[i+1] == 0xfe:
+			be = false
+			continue
+		case b[i] == 0xfe && b[i+1] == 0xff:
+			be = true
+			continue
+		}
+		var c uint16
+		if be {
+			c = uint16(b[i])<<8 | uint16(b[i+1])
+		} else {
+			c = uint16(b[i+1])<<8 | uint16(b[i])
+		}
+		if c == 0 {
+			flush()
+			out.WriteByte(0)
+			be = bigEndian
+			continue
+		}
+		u = append(u, c)
+	}
+	flush()
+	return out.String()
+}
+
+// splitEncoded splits a NUL terminated string in encoding enc from the rest.
+func splitEncoded(enc byte, b []byte) (string, []byte) {
+	if enc == 1 || enc == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return decodeString(enc, b[:i]), b[i+2:]
+			}
+		}
+		return decodeString(enc, b), nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return decodeString(enc, b[:i]), b[i+1:]
+	}
+	return decodeString(enc, b), nil
+}
+
+// parseAPIC decodes an APIC payload.
+func parseAPIC(d []byte) (Picture, bool) {
+	if len(d) < 4 {
+		return Picture{}, false
+	}
+	enc := d[0]
+	i := bytes.IndexByte(d[1:], 0)
+	if i < 0 {
+		return Picture{}, false
+	}
+	mime := string(d[1 : 1+i])
+	rest := d[2+i:]
+	if len(rest) < 1 {
+		return Picture{}, false
+	}
+	ptype := rest[0]
+	desc, data := splitEncoded(enc, rest[1:])
+	if len(data) == 0 {
+		return Picture{}, false
+	}
+	if mime == "" || !strings.Contains(mime, "/") {
+		mime = "image/" + strings.ToLower(mime)
+	}
+	return Picture{MIME: mime, Type: ptype, Description: desc, Data: data}, true
+}
+
+// genre resolves ID3v1 numeric references such as "(17)" or "17".
+func genre(s string) string {
+	s = strings.TrimSpace(s)
+	for strings.HasPrefix(s, "(") {
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			break
+		}
+		ref := s[1:end]
+		rest := strings.TrimSpace(s[end+1:])
+		if rest != "" && !strings.HasPrefix(rest, "(") {
+			return rest // "(17)Rock" -> refinement wins
+		}
+		if n, err := strconv.Atoi(ref); err == nil && n >= 0 && n < len(id3v1Genres) {
+			return id3v1Genres[n]
+		}
+		s = rest
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(id3v1Genres) {
+		return id3v1Genres[n]
+	}
+	return s
+}
+
+func (t *id3Tag) apply(out *Tags) {
+	out.Title = t.text("TIT2")
+	out.Artist = t.text("TPE1")
+	out.AlbumArtist = t.text("TPE2")
+	out.Album = t.text("TALB")
+	if g := decodeTextFrame(t.frame("TCON")); len(g) > 0 {
+		for i := range g {
+			g[i] = genre(g[i])
+		}
+		out.Genre = strings.Join(g, "; ")
+	}
+	out.Year = parseYear(t.text("TDRC"))
+	if out.Year == 0 {
+		out.Year = parseYear(t.text("TDOR"))
+	}
+	out.Track, out.TrackTotal = parsePair(t.text("TRCK"))
+	out.Disc, out.DiscTotal = parsePair(t.text("TPOS"))
+	out.Compilation = parseBool(t.text("TCMP"))
+	out.Rating = t.rating()
+	if out.AlbumArtist == "" {
+		out.AlbumArtist = t.txxx("ALBUMARTIST")
+	}
+}
+
+func (t *id3Tag) pictures() []Picture {
+	var out []Picture
+	for _, f := range t.Frames {
+		if f.ID != "APIC" || f.opaque() {
+			continue
+		}
+		if p, ok := parseAPIC(f.Data); ok {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// readID3v1 parses the trailing 128 byte ID3v1 tag, if any.
+func readID3v1(f *os.File) (Tags, bool) {
+	fi, err := f.Stat()
+	if err != nil || fi.Size() < 128 {
+		return Tags{}, false
+	}
+	b := make([]byte, 128)
+	if _, err := f.ReadAt(b, fi.Size()-128); err != nil || string(b[:3]) != "TAG" {
+		return Tags{}, false
+	}
+	field := func(d []byte) string {
+		if i := bytes.IndexByte(d, 0); i >= 0 {
+			d = d[:i]
+		}
+		return strings.TrimSpace(decodeString(0, d))
+	}
+	t := Tags{
+		Title:  field(b[3:33]),
+		Artist: field(b[33:63]),
+		Album:  field(b[63:93]),
+		Year:   parseYear(field(b[93:97])),
+	}
+	if b[125] == 0 && b[126] != 0 {
+		t.Track = int(b[126])
+	}
+	if g := int(b[127]); g < len(id3v1Genres) {
+		t.Genre = id3v1Genres[g]
+	}
+	return t, true
+}
+
+func readMP3(f *os.File, withPics bool) (Tags, []Picture, error) {
+	var t Tags
+	var pics []Picture
+	tag, err := readID3v2(f)
+	if err != nil {
+		return Tags{}, nil, err
+	}
+	start := int64(0)
+	if tag != nil {
+		start = int64(tag.Size)
+		tag.apply(&t)
+		if withPics {
+			pics = tag.pictures()
+		}
+	}
+	if t.Title == "" && t.Artist == "" {
+		if v1, ok := readID3v1(f); ok {
+			v1.AlbumArtist = t.AlbumArtist
+			if t.Track != 0 {
+				v1.Track, v1.TrackTotal = t.Track, t.TrackTotal
+			}
+			t = v1
+		}
+	}
+	mp3Properties(f, start, &t)
+	return t, pics, nil
+}
+
+var id3v1Genres = []string{
+	"Blues", "Classic Rock", "Country", "Dance", "Disco", "Funk", "Grunge",
+	"Hip-Hop", "Jazz", "Metal", "New Age", "Oldies", "Other", "Pop", "R&B",
+	"Rap", "Reggae", "Rock", "Techno", "Industrial", "Alternative", "Ska",
+	"Death Metal", "Pranks", "Soundtrack", "Euro-Techno", "Ambient",
+	"Trip-Hop", "Vocal", "Jazz+Funk", "Fusion", "Trance", "Classical",
+	"Instrumental", "Acid", "House", "Game", "Sound Clip", "Gospel", "Noise",
+	"Alternative Rock", "Bass", "Soul", "Punk", "Space", "Meditative",
+	"Instrumental Pop", "Instrumental Rock", "Ethnic", "Gothic", "Darkwave",
+	"Techno-Industrial", "Electronic", "Pop-Folk", "Eurodance", "Dream",
+	"Southern Rock", "Comedy", "Cult", "Gangsta", "Top 40", "Christian Rap",
+	"Pop/Funk", "Jungle", "Native American", "Cabaret", "New Wave",
+	"Psychedelic", "Rave", "Showtunes", "Trailer", "Lo-Fi", "Tribal",
+	"Acid Punk", "Acid Jazz", "Polka", "Retro", "Musical", "Rock & Roll",
+	"Hard Rock", "Folk", "Folk-Rock", "National Folk", "Swing", "Fast Fusion",
+	"Bebop", "Latin", "Revival", "Celtic", "Bluegrass", "Avantgarde",
+	"Gothic Rock", "Progressive Rock", "Psychedelic Rock", "Symphonic Rock",
+	"Slow Rock", "Big Band", "Chorus", "Easy Listening", "Acoustic", "Humour",
+	"Speech", "Chanson", "Opera", "Chamber Music", "Sonata", "Symphony",
+	"Booty Bass", "Primus", "Porn Groove", "Satire", "Slow Jam", "Club",
+	"Tango", "Samba", "Folklore", "Ballad", "Power Ballad", "Rhythmic Soul",
+	"Freestyle", "Duet", "Punk Rock", "Drum Solo", "A capella", "Euro-House",
+	"Dance Hall", "Goa", "Drum & Bass", "Club-House", "Hardcore Techno",
+	"Terror", "Indie", "BritPop", "Negerpunk", "Polsk Punk", "Beat",
+	"Christian Gangsta Rap", "Heavy Metal", "Black Metal", "Crossover",
+	"Contemporary Christian", "Christian Rock", "Merengue", "Salsa",
+	"Thrash Metal", "Anime", "JPop", "Synthpop", "Abstract", "Art Rock",
+	"Baroque", "Bhangra", "Big Beat", "Breakbeat", "Chillout", "Downtempo",
+	"Dub", "EBM", "Eclectic", "Electro", "Electroclash", "Emo", "Experimental",
+	"Garage", "Global", "IDM", "Illbient", "Industro-Goth", "Jam Band",
+	"Krautrock", "Leftfield", "Lounge", "Math Rock", "New Romantic",
+	"Nu-Breakz", "Post-Punk", "Post-Rock", "Psytrance", "Shoegaze",
+	"Space Rock", "Trop Rock", "World Music", "Neoclassical", "Audiobook",
+	"Audio Theatre", "Neue Deutsche Welle", "Podcast", "Indie Rock",
+	"G-Funk", "Dubstep", "Garage Rock", "Psybient",
+}
+
+// Frames Write replaces in an ID3v2 tag.
+var id3Managed = map[string]bool{
+	"TIT2": true, "TPE1": true, "TPE2": true, "TALB": true, "TCON": true,
+	"TRCK": true, "TPOS": true, "TCMP": true,
+}
+
+// v2.3 frames with no v2.4 counterpart are dropped on upgrade; the rest
+// are renamed.
+var id3v23Only = map[string]string{
+	"TDAT": "", "TIME": "", "TRDA": "", "TSIZ": "", "EQUA": "", "RVAD": "",
+	"TORY": "TDOR", "IPLS": "TIPL",
+}
+
+// id3PaddingSize is the padding written after a rebuilt tag.
+const id3PaddingSize = 2048
+
+// textFrame builds a UTF-8 v2.4 text frame; multiple values are NUL separated.
+func textFrame(id string, vals ...string) id3Frame {
+	return id3Frame{ID: id, Data: append([]byte{3}, strings.Join(vals, "\x00")...)}
+}
+
+// v24Frames returns the frames of tag as they are written into a v2.4 tag:
+// v2.3-only frames are renamed or dropped.
+func (t *id3Tag) v24Frames() []id3Frame {
+	var out []id3Frame
+	for _, f := range t.Frames {
+		if nid, ok := id3v23Only[f.ID]; ok && t.Major < 4 {
+			if nid == "" {
+				continue
+			}
+			f.ID = nid
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+// editID3 returns the frames of tag (may be nil) with the fields managed
+// by Write replaced by t and, when cover is set, the front cover replaced.
+func editID3(tag *id3Tag, t Tags, cover *Picture) []id3Frame {
+	var out []id3Frame
+	if tag != nil {
+		for _, f := range tag.v24Frames() {
+			switch {
+			case id3Managed[f.ID]:
+				continue
+			case f.opaque():
+				// Kept unless it is replaced for sure; the type of an
+				// opaque APIC is unknown, so it stays
+				if f.ID == "TDRC" && t.Year > 0 {
+					continue
+				}
+			case f.ID == "TDRC":
+				if t.Year == 0 || parseYear(tag.text("TDRC")) != t.Year {
+					continue
+				}
+			case f.ID == "TXXX" && len(f.Data) > 0:
+				if d, _ := splitEncoded(f.Data[0], f.Data[1:]); strings.EqualFold(d, "ALBUMARTIST") {
+					continue
+				}
+			case f.ID == "APIC" && cover != nil:
+				if p, ok := parseAPIC(f.Data); !ok || isCover(p.Type) {
+					continue
+				}
+			}
+			out = append(out, f)
+		}
+	}
+	add := func(id string, vals ...string) {
+		if len(vals) > 0 && vals[0] != "" {
+			out = append(out, textFrame(id, vals...))
+		}
+	}
+	add("TIT2", splitValues(t.Title)...)
+	add("TPE1", splitValues(t.Artist)...)
+	add("TPE2", splitValues(t.AlbumArtist)...)
+	add("TALB", strings.TrimSpace(t.Album))
+	add("TCON", splitValues(t.Genre)...)
+	if t.Year > 0 && (tag == nil || tag.frame("TDRC") == nil || parseYear(tag.text("TDRC")) != t.Year) {
+		add("TDRC", strconv.Itoa(t.Year))
+	}
+	add("TRCK", pairString(t.Track, t.TrackTotal))
+	add("TPOS", pairString(t.Disc, t.DiscTotal))
+	if t.Compilation {
+		add("TCMP", "1")
+	}
+	if cover != nil && len(cover.Data) > 0 {
+		d := []byte{3}
+		d = append(d, cover.MIME...)
+		d = append(d, 0, 3)
+		d = append(d, cover.Description...)
+		d = append(d, 0)
+		out = append(out, id3Frame{ID: "APIC", Data: append(d, cover.Data...)})
+	}
+	return out
+}
+
+func putSyncsafe(b []byte, n int) {
+	b[0], b[1], b[2], b[3] = byte(n>>21)&0x7f, byte(n>>14)&0x7f, byte(n>>7)&0x7f, byte(n)&0x7f
+}
+
+// encodeID3v24 serialises frames as an ID3v2.4 tag with trailing padding.
+func encodeID3v24(frames []id3Frame, padding int) []byte {
+	var body bytes.Buffer
+	for _, f := range frames {
+		var hdr [10]byte
+		copy(hdr[:4], f.ID)
+		putSyncsafe(hdr[4:8], len(f.Data))
+		binary.BigEndian.PutUint16(hdr[8:10], f.Flags)
+		body.Write(hdr[:])
+		body.Write(f.Data)
+	}
+	body.Write(make([]byte, padding))
+	out := make([]byte, 10, 10+body.Len())
+	copy(out, "ID3\x04\x00\x00")
+	putSyncsafe(out[6:10], body.Len())
+	return append(out, body.Bytes()...)
+}
+
+// encodeID3v1 builds a 128 byte ID3v1.1 tag; text is latin1 and truncated.
+func encodeID3v1(t Tags) []byte {
+	b := make([]byte, 128)
+	copy(b, "TAG")
+	field := func(dst []byte, s string) {
+		i := 0
+		for _, r := range s {
+			if i == len(dst) {
+				break
+			}
+			if r > 0xff {
+				r = '?'
+			}
+			dst[i] = byte(r)
+			i++
+		}
+	}
+	field(b[3:33], t.Title)
+	field(b[33:63], t.Artist)
+	field(b[63:93], t.Album)
+	if t.Year > 0 {
+		field(b[93:97], strconv.Itoa(t.Year))
+	}
+	if t.Track > 0 && t.Track < 256 {
+		b[126] = byte(t.Track)
+	}
+	b[127] = 0xff
+	for i, g := range id3v1Genres {
+		if vals := splitValues(t.Genre); len(vals) > 0 && strings.EqualFold(g, vals[0]) {
+			b[127] = byte(i)
+		}
+	}
+	return b
+}
+
+// writeMP3 copies src to dst with a rebuilt ID3v2.4 tag. An existing ID3v1
+// trailer is rewritten to match so players that prefer it agree.
+func writeMP3(src, dst *os.File, t Tags, cover *Picture) error {
+	return rewriteMP3(src, dst, func(tag *id3Tag) []id3Frame { return editID3(tag, t, cover) }, &t)
+}
+
+// rewriteMP3 copies src to dst with an ID3v2.4 tag made of the frames
+// returned by edit for the existing tag (nil if there is none). With v1
+// set an existing ID3v1 trailer is rewritten from it, otherwise it is
+// copied as it is.
+func rewriteMP3(src, dst *os.File, edit func(tag *id3Tag) []id3Frame, v1 *Tags) error {
+	tag, err := readID3v2(src)
+	if err != nil {
+		return err
+	}
+	start := int64(0)
+	if tag != nil {
+		if tag.Major < 2 || tag.Major > 4 {
+			return fmt.Errorf("tags: unsupported ID3v2.%d tag", tag.Major)
+		}
+		start = int64(tag.Size)
+		for _, f := range tag.Frames {
+			if len(f.ID) != 4 {
+				return fmt.Errorf("tags: ID3v2.2 frame %s has no v2.4 equivalent", f.ID)
+			}
+		}
+	}
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	end := fi.Size()
+	_, hasV1 := readID3v1(src)
+	if hasV1 && v1 != nil {
+		end -= 128
+	}
+	w := bufio.NewWriter(dst)
+	w.Write(encodeID3v24(edit(tag), id3PaddingSize))
+	if err := copyAudio(w, src, start, end-start); err != nil {
+		return err
+	}
+	if hasV1 && v1 != nil {
+		w.Write(encodeID3v1(*v1))
+	}
+	return w.Flush()
+}
@@ -0,0 +1,129 @@
+package tags
+
+import (
+	"bufio"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SyncedLine is one timed line of an ID3 SYLT frame.
+type SyncedLine struct {
+	Time time.Duration
+	Text string
+}
+
+// Lyrics holds the embedded lyrics of a file. Text comes from ID3 USLT or
+// Vorbis LYRICS/UNSYNCEDLYRICS and may itself be in LRC format; Synced
+// comes from ID3 SYLT frames with millisecond timestamps.
+type Lyrics struct {
+	Text   string
+	Synced []SyncedLine
+}
+
+// ReadLyrics returns the lyrics embedded in the file at path. Files without
+// lyrics yield zero-valued Lyrics and no error.
+func ReadLyrics(path string) (Lyrics, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Lyrics{}, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		tag, err := readID3v2(f)
+		if err != nil || tag == nil {
+			return Lyrics{}, err
+		}
+		return tag.lyrics(), nil
+	case ".flac":
+		blocks, _, err := readFLACBlocks(f, func(typ byte) bool { return typ == flacVorbisComment })
+		if err != nil {
+			return Lyrics{}, err
+		}
+		for _, b := range blocks {
+			if b.Type == flacVorbisComment {
+				return vorbisLyrics(b.Data), nil
+			}
+		}
+		return Lyrics{}, nil
+	case ".ogg":
+		packets, _, err := readOggPackets(bufio.NewReader(f), 2)
+		if err != nil {
+			return Lyrics{}, err
+		}
+		if c := packets[1]; len(c) > 7 && c[0] == 3 && string(c[1:7]) == "vorbis" {
+			return vorbisLyrics(c[7:]), nil
+		}
+		return Lyrics{}, nil
+	}
+	return Lyrics{}, ErrUnsupported
+}
+
+func vorbisLyrics(d []byte) Lyrics {
+	_, fields := vorbisFields(d)
+	var l Lyrics
+	for _, kv := range fields {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(k) {
+		case "LYRICS", "UNSYNCEDLYRICS", "UNSYNCED LYRICS":
+			if strings.TrimSpace(v) != "" && l.Text == "" {
+				l.Text = v
+			}
+		}
+	}
+	return l
+}
+
+// lyrics collects the first USLT text and the longest SYLT frame that
+// uses millisecond timestamps.
+func (t *id3Tag) lyrics() Lyrics {
+	var l Lyrics
+	for _, f := range t.Frames {
+		switch f.ID {
+		case "USLT":
+			// encoding, language[3], description, text
+			if len(f.Data) < 5 || l.Text != "" {
+				continue
+			}
+			_, rest := splitEncoded(f.Data[0], f.Data[4:])
+			l.Text = strings.ReplaceAll(decodeString(f.Data[0], rest), "\r\n", "\n")
+		case "SYLT":
+			if lines := parseSYLT(f.Data); len(lines) > len(l.Synced) {
+				l.Synced = lines
+			}
+		}
+	}
+	return l
+}
+
+// parseSYLT decodes a SYLT payload: encoding, language[3], timestamp
+// format, content type, description, then text/timestamp pairs. Only
+// absolute millisecond timestamps (format 2) are supported; MPEG frame
+// timestamps would need the stream's frame rate.
+func parseSYLT(d []byte) []SyncedLine {
+	if len(d) < 6 || d[4] != 2 {
+		return nil
+	}
+	enc := d[0]
+	_, rest := splitEncoded(enc, d[6:])
+	var out []SyncedLine
+	for len(rest) > 0 {
+		var text string
+		text, rest = splitEncoded(enc, rest)
+		if len(rest) < 4 {
+			break
+		}
+		ms := binary.BigEndian.Uint32(rest)
+		rest = rest[4:]
+		// Lines often start with "\n" to mark a new line of the lyrics.
+		text = strings.TrimLeft(text, "\r\n")
+		out = append(out, SyncedLine{Time: time.Duration(ms) * time.Millisecond, Text: text})
+	}
+	return out
+}
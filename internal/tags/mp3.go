@@ -0,0 +1,147 @@
+package tags
+
+import (
+	"encoding/binary"
+	"os"
+	"time"
+)
+
+var (
+	mp3Bitrates = [2][3][15]int{
+		{ // MPEG-1: layer I, II, III
+			{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+			{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+		},
+		{ // MPEG-2 and 2.5
+			{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+			{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		},
+	}
+	mp3SampleRates = [3][3]int{
+		{44100, 48000, 32000}, // MPEG-1
+		{22050, 24000, 16000}, // MPEG-2
+		{11025, 12000, 8000},  // MPEG-2.5
+	}
+)
+
+type mp3Header struct {
+	version    int // 0 = MPEG-1, 1 = MPEG-2, 2 = MPEG-2.5
+	layer      int // 1..3
+	bitrate    int // kbit/s
+	sampleRate int
+	mono       bool
+}
+
+func parseMP3Header(b []byte) (mp3Header, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return mp3Header{}, false
+	}
+	var h mp3Header
+	switch (b[1] >> 3) & 3 {
+	case 3:
+		h.version = 0
+	case 2:
+		h.version = 1
+	case 0:
+		h.version = 2
+	default:
+		return h, false
+	}
+	l := (b[1] >> 1) & 3
+	if l == 0 {
+		return h, false
+	}
+	h.layer = 4 - int(l)
+	bi := int(b[2] >> 4)
+	si := int((b[2] >> 2) & 3)
+	if bi == 0 || bi == 15 || si == 3 {
+		return h, false
+	}
+	tbl := 0
+	if h.version > 0 {
+		tbl = 1
+	}
+	h.bitrate = mp3Bitrates[tbl][h.layer-1][bi]
+	h.sampleRate = mp3SampleRates[h.version][si]
+	h.mono = (b[3]>>6)&3 == 3
+	return h, true
+}
+
+func (h mp3Header) samplesPerFrame() int {
+	switch {
+	case h.layer == 1:
+		return 384
+	case h.layer == 3 && h.version > 0:
+		return 576
+	}
+	return 1152
+}
+
+// mp3Properties fills duration and bitrate from the first frame, using the
+// Xing/Info or VBRI header for VBR files and the file size otherwise.
+func mp3Properties(f *os.File, start int64, t *Tags) {
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	buf := make([]byte, 64*1024)
+	n, _ := f.ReadAt(buf, start)
+	buf = buf[:n]
+	off := -1
+	var h mp3Header
+	for i := 0; i+4 <= len(buf); i++ {
+		if hh, ok := parseMP3Header(buf[i:]); ok {
+			h, off = hh, i
+			break
+		}
+	}
+	if off < 0 {
+		return
+	}
+	t.SampleRate = h.sampleRate
+	t.Channels = 2
+	if h.mono {
+		t.Channels = 1
+	}
+	audioBytes := fi.Size() - start - int64(off)
+	if _, ok := readID3v1(f); ok {
+		audioBytes -= 128
+	}
+
+	// Side information size decides where a Xing/Info header lives.
+	side := 32
+	switch {
+	case h.version == 0 && h.mono:
+		side = 17
+	case h.version > 0 && !h.mono:
+		side = 17
+	case h.version > 0 && h.mono:
+		side = 9
+	}
+	frames := 0
+	if x := off + 4 + side; x+12 <= len(buf) {
+		if tag := string(buf[x : x+4]); tag == "Xing" || tag == "Info" {
+			if binary.BigEndian.Uint32(buf[x+4:x+8])&1 != 0 {
+				frames = int(binary.BigEndian.Uint32(buf[x+8 : x+12]))
+			}
+		}
+	}
+	if v := off + 36; frames == 0 && v+18 <= len(buf) && string(buf[v:v+4]) == "VBRI" {
+		frames = int(binary.BigEndian.Uint32(buf[v+14 : v+18]))
+	}
+	if frames > 0 && h.sampleRate > 0 {
+		secs := float64(frames) * float64(h.samplesPerFrame()) / float64(h.sampleRate)
+		t.Duration = time.Duration(secs * float64(time.Second))
+		if secs > 0 {
+			t.Bitrate = int(float64(audioBytes) * 8 / secs / 1000)
+		}
+		return
+	}
+	if h.bitrate > 0 {
+		t.Bitrate = h.bitrate
+		secs := float64(audioBytes) * 8 / float64(h.bitrate*1000)
+		t.Duration = time.Duration(secs * float64(time.Second))
+	}
+}
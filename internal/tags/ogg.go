@@ -0,0 +1,285 @@
+package tags
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+type oggPage struct {
+	HeaderType byte
+	Granule    uint64
+	Serial     uint32
+	Seq        uint32
+	Lacing     []byte
+	Data       []byte
+}
+
+func readOggPage(r io.Reader) (oggPage, error) {
+	var hdr [27]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return oggPage{}, err
+	}
+	if string(hdr[:4]) != "OggS" {
+		return oggPage{}, errors.New("tags: bad ogg page")
+	}
+	p := oggPage{
+		HeaderType: hdr[5],
+		Granule:    binary.LittleEndian.Uint64(hdr[6:14]),
+		Serial:     binary.LittleEndian.Uint32(hdr[14:18]),
+		Seq:        binary.LittleEndian.Uint32(hdr[18:22]),
+	}
+	p.Lacing = make([]byte, hdr[26])
+	if _, err := io.ReadFull(r, p.Lacing); err != nil {
+		return oggPage{}, err
+	}
+	n := 0
+	for _, l := range p.Lacing {
+		n += int(l)
+	}
+	p.Data = make([]byte, n)
+	if _, err := io.ReadFull(r, p.Data); err != nil {
+		return oggPage{}, err
+	}
+	return p, nil
+}
+
+// readOggPackets reads the first n packets of the first logical stream.
+// It also returns the number of pages they occupied.
+func readOggPackets(r io.Reader, n int) ([][]byte, int, error) {
+	var packets [][]byte
+	var cur []byte
+	pages := 0
+	for len(packets) < n {
+		p, err := readOggPage(r)
+		if err != nil {
+			return nil, 0, err
+		}
+		pages++
+		off := 0
+		for _, l := range p.Lacing {
+			cur = append(cur, p.Data[off:off+int(l)]...)
+			off += int(l)
+			if l < 255 {
+				packets = append(packets, cur)
+				cur = nil
+				if len(packets) == n {
+					break
+				}
+			}
+		}
+	}
+	return packets, pages, nil
+}
+
+func readOgg(f *os.File, withPics bool) (Tags, []Picture, error) {
+	packets, _, err := readOggPackets(bufio.NewReader(f), 2)
+	if err != nil {
+		return Tags{}, nil, err
+	}
+	id, comment := packets[0], packets[1]
+	if len(id) < 16 || string(id[1:7]) != "vorbis" || id[0] != 1 {
+		return Tags{}, nil, ErrUnsupported
+	}
+	var t Tags
+	t.Channels = int(id[11])
+	t.SampleRate = int(binary.LittleEndian.Uint32(id[12:16]))
+	var pics []Picture
+	if len(comment) > 7 && comment[0] == 3 && string(comment[1:7]) == "vorbis" {
+		pics = parseVorbisComment(comment[7:], &t, withPics)
+	}
+	if g := lastGranule(f); g > 0 && t.SampleRate > 0 {
+		secs := float64(g) / float64(t.SampleRate)
+		t.Duration = time.Duration(secs * float64(time.Second))
+		if fi, err := f.Stat(); err == nil && secs > 0 {
+			t.Bitrate = int(float64(fi.Size()) * 8 / secs / 1000)
+		}
+	}
+	return t, pics, nil
+}
+
+// lastGranule returns the granule position of the final page in the file.
+func lastGranule(f *os.File) uint64 {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0
+	}
+	size := fi.Size()
+	n := int64(64 * 1024)
+	if n > size {
+		n = size
+	}
+	buf := make([]byte, n)
+	if _, err := f.ReadAt(buf, size-n); err != nil && !errors.Is(err, io.EOF) {
+		return 0
+	}
+	i := bytes.LastIndex(buf, []byte("OggS"))
+	if i < 0 || i+14 > len(buf) {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(buf[i+6 : i+14])
+}
+
+var oggCRCTable = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+func oggCRC(crc uint32, b []byte) uint32 {
+	for _, c := range b {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^c]
+	}
+	return crc
+}
+
+// writeOggPage serialises p with a freshly computed checksum.
+func writeOggPage(w io.Writer, p oggPage) error {
+	hdr := make([]byte, 27, 27+len(p.Lacing))
+	copy(hdr, "OggS")
+	hdr[5] = p.HeaderType
+	binary.LittleEndian.PutUint64(hdr[6:14], p.Granule)
+	binary.LittleEndian.PutUint32(hdr[14:18], p.Serial)
+	binary.LittleEndian.PutUint32(hdr[18:22], p.Seq)
+	hdr[26] = byte(len(p.Lacing))
+	hdr = append(hdr, p.Lacing...)
+	binary.LittleEndian.PutUint32(hdr[22:26], oggCRC(oggCRC(0, hdr), p.Data))
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(p.Data)
+	return err
+}
+
+// paginate lays packets out on pages of the given stream starting at seq.
+// Header pages carry granule 0, pages on which no packet ends -1.
+func paginate(packets [][]byte, serial, seq uint32) []oggPage {
+	type segment struct {
+		data []byte
+		end  bool
+	}
+	var segs []segment
+	for _, pkt := range packets {
+		for len(pkt) >= 255 {
+			segs = append(segs, segment{data: pkt[:255]})
+			pkt = pkt[255:]
+		}
+		segs = append(segs, segment{data: pkt, end: true})
+	}
+	var pages []oggPage
+	cont := false
+	for len(segs) > 0 {
+		n := min(len(segs), 255)
+		p := oggPage{Serial: serial, Seq: seq, Granule: ^uint64(0)}
+		if cont {
+			p.HeaderType = 1
+		}
+		for _, s := range segs[:n] {
+			p.Lacing = append(p.Lacing, byte(len(s.data)))
+			p.Data = append(p.Data, s.data...)
+			if s.end {
+				p.Granule = 0
+			}
+		}
+		cont = !segs[n-1].end
+		segs = segs[n:]
+		pages = append(pages, p)
+		seq++
+	}
+	return pages
+}
+
+// writeOgg copies an Ogg Vorbis file with a new comment header. The comment
+// and setup headers are repaginated and the sequence numbers of the pages
+// that follow are shifted when the header page count changes.
+func writeOgg(src, dst *os.File, t Tags, cover *Picture) error {
+	return rewriteOgg(src, dst, func(fields []string) []string { return editVorbis(fields, t, cover, true) })
+}
+
+// rewriteOgg is writeOgg with the comment fields produced by edit.
+func rewriteOgg(src, dst *os.File, edit func(fields []string) []string) error {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(src)
+	first, err := readOggPage(r)
+	if err != nil {
+		return err
+	}
+	if first.HeaderType&2 == 0 || len(first.Data) < 7 || string(first.Data[1:7]) != "vorbis" {
+		return ErrUnsupported
+	}
+	var packets [][]byte
+	var cur []byte
+	oldPages := 0
+	for len(packets) < 2 {
+		p, err := readOggPage(r)
+		if err != nil {
+			return err
+		}
+		if p.Serial != first.Serial {
+			return errors.New("tags: multiplexed ogg streams are not supported")
+		}
+		oldPages++
+		off := 0
+		for i, l := range p.Lacing {
+			cur = append(cur, p.Data[off:off+int(l)]...)
+			off += int(l)
+			if l < 255 {
+				packets = append(packets, cur)
+				cur = nil
+				if len(packets) == 2 && i != len(p.Lacing)-1 {
+					return errors.New("tags: audio shares a page with the vorbis headers")
+				}
+			}
+		}
+	}
+	comment, setup := packets[0], packets[1]
+	if len(comment) < 7 || comment[0] != 3 || string(comment[1:7]) != "vorbis" {
+		return errors.New("tags: missing vorbis comment header")
+	}
+	vendor, fields := vorbisFields(comment[7:])
+	packet := append([]byte("\x03vorbis"), encodeVorbisComment(vendor, edit(fields))...)
+	packet = append(packet, 1) // framing bit
+	headers := paginate([][]byte{packet, setup}, first.Serial, first.Seq+1)
+	delta := len(headers) - oldPages
+
+	w := bufio.NewWriter(dst)
+	if err := writeOggPage(w, first); err != nil {
+		return err
+	}
+	for _, p := range headers {
+		if err := writeOggPage(w, p); err != nil {
+			return err
+		}
+	}
+	for {
+		p, err := readOggPage(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if p.Serial == first.Serial {
+			p.Seq = uint32(int64(p.Seq) + int64(delta))
+		}
+		if err := writeOggPage(w, p); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,147 @@
+package tags
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// popmEmail owns the POPM frame written by WriteRating. Most players read
+// the rating Windows Media Player stores, so it is used for compatibility.
+const popmEmail = "Windows Media Player 9 Series"
+
+// popmValues are the POPM bytes written for 0..5 stars.
+var popmValues = [6]byte{0, 1, 64, 128, 196, 255}
+
+// popmStars maps a POPM rating byte onto stars.
+func popmStars(b byte) int {
+	switch {
+	case b == 0:
+		return 0
+	case b < 32:
+		return 1
+	case b < 96:
+		return 2
+	case b < 160:
+		return 3
+	case b < 224:
+		return 4
+	}
+	return 5
+}
+
+// parsePOPM splits a POPM frame into owner, rating byte and the play
+// counter bytes that follow.
+func parsePOPM(d []byte) (email string, rating byte, counter []byte, ok bool) {
+	i := bytes.IndexByte(d, 0)
+	if i < 0 || i+1 >= len(d) {
+		return "", 0, nil, false
+	}
+	return string(d[:i]), d[i+1], d[i+2:], true
+}
+
+// rating returns the stars of the POPM frame written by WriteRating or,
+// failing that, of the first POPM frame.
+func (t *id3Tag) rating() int {
+	stars, found := 0, false
+	for _, f := range t.Frames {
+		if f.ID != "POPM" || f.opaque() {
+			continue
+		}
+		email, r, _, ok := parsePOPM(f.Data)
+		if !ok {
+			continue
+		}
+		if email == popmEmail {
+			return popmStars(r)
+		}
+		if !found {
+			stars, found = popmStars(r), true
+		}
+	}
+	return stars
+}
+
+// vorbisStars reads a RATING comment. Taggers disagree on the scale: values
+// up to 5 are taken as stars, larger ones as a percentage.
+func vorbisStars(s string) int {
+	v, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || v <= 0 {
+		return 0
+	}
+	if v > 5 {
+		v = v / 20
+	}
+	return max(1, min(5, int(v+0.5)))
+}
+
+// WriteRating stores stars (0..5, 0 removes the rating) in the file at
+// path: a POPM frame for MP3, a RATING comment (1..5) for FLAC and Ogg.
+// Other metadata is left untouched; the file is replaced the same way as
+// by Write.
+func WriteRating(path string, stars int) error {
+	if stars < 0 || stars > 5 {
+		return fmt.Errorf("tags: rating %d out of range", stars)
+	}
+	want, err := Read(path)
+	if err != nil {
+		return err
+	}
+	want.Rating = stars
+	editVorbisRating := func(fields []string) []string {
+		var out []string
+		for _, kv := range fields {
+			k, _, _ := strings.Cut(kv, "=")
+			if strings.EqualFold(k, "RATING") || strings.EqualFold(k, "FMPS_RATING") {
+				continue
+			}
+			out = append(out, kv)
+		}
+		if stars > 0 {
+			out = append(out, "RATING="+strconv.Itoa(stars))
+		}
+		return out
+	}
+	var write func(src, dst *os.File) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		write = func(src, dst *os.File) error {
+			return rewriteMP3(src, dst, func(tag *id3Tag) []id3Frame { return editPOPM(tag, stars) }, nil)
+		}
+	case ".flac":
+		write = func(src, dst *os.File) error { return rewriteFLAC(src, dst, editVorbisRating, nil) }
+	case ".ogg":
+		write = func(src, dst *os.File) error { return rewriteOgg(src, dst, editVorbisRating) }
+	default:
+		return ErrUnsupported
+	}
+	return replaceFile(path, write, want, nil)
+}
+
+// editPOPM returns the frames of tag (may be nil) with our POPM frame set
+// to stars. The play counter of an existing frame is kept when it stays.
+func editPOPM(tag *id3Tag, stars int) []id3Frame {
+	var out []id3Frame
+	var counter []byte
+	if tag != nil {
+		for _, f := range tag.v24Frames() {
+			if f.ID == "POPM" && !f.opaque() {
+				// Removing the rating drops other players' frames too, or
+				// theirs would be read back instead.
+				if email, _, c, ok := parsePOPM(f.Data); ok && (email == popmEmail || stars == 0) {
+					counter = c
+					continue
+				}
+			}
+			out = append(out, f)
+		}
+	}
+	if stars > 0 {
+		d := append([]byte(popmEmail), 0, popmValues[stars])
+		out = append(out, id3Frame{ID: "POPM", Data: append(d, counter...)})
+	}
+	return out
+}
@@ -0,0 +1,178 @@
+// Package tags reads embedded metadata (ID3v2/ID3v1, FLAC and Ogg Vorbis
+// comments, RIFF INFO) and basic stream properties from local audio files
+// without decoding the audio itself.
+package tags
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupported is returned for formats that carry no readable tags.
+var ErrUnsupported = errors.New("tags: unsupported format")
+
+// Tags holds the textual metadata and stream properties of a file.
+type Tags struct {
+	Title       string
+	Artist      string
+	AlbumArtist string
+	Album       string
+	Genre       string
+	Year        int
+	Track       int
+	TrackTotal  int
+	Disc        int
+	DiscTotal   int
+	Compilation bool
+	Rating      int // 0..5 stars from POPM or RATING; read only, see WriteRating
+
+	// Stream properties; zero when unknown.
+	Duration   time.Duration
+	SampleRate int
+	Channels   int
+	Bitrate    int // kbit/s, average
+}
+
+// Picture is an embedded cover image.
+type Picture struct {
+	MIME        string
+	Type        byte // APIC/FLAC picture type, 3 = front cover
+	Description string
+	Data        []byte
+}
+
+// Read returns the tags and stream properties of the file at path.
+// Files without tags yield zero-valued Tags and no error.
+func Read(path string) (Tags, error) {
+	t, _, err := read(path, false)
+	return t, err
+}
+
+// ReadPicture returns the preferred embedded picture (front cover if present).
+func ReadPicture(path string) (*Picture, error) {
+	_, pics, err := read(path, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(pics) == 0 {
+		return nil, errors.New("tags: no picture")
+	}
+	for i := range pics {
+		if pics[i].Type == 3 {
+			return &pics[i], nil
+		}
+	}
+	return &pics[0], nil
+}
+
+func read(path string, withPics bool) (Tags, []Picture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Tags{}, nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		return readMP3(f, withPics)
+	case ".flac":
+		return readFLAC(f, withPics)
+	case ".ogg":
+		return readOgg(f, withPics)
+	case ".wav":
+		t, err := readWAV(f)
+		return t, nil, err
+	}
+	return Tags{}, nil, ErrUnsupported
+}
+
+// parsePair parses "3/12" style values used by track and disc fields.
+func parsePair(s string) (n, total int) {
+	s = strings.TrimSpace(s)
+	a, b, _ := strings.Cut(s, "/")
+	n, _ = strconv.Atoi(strings.TrimSpace(a))
+	total, _ = strconv.Atoi(strings.TrimSpace(b))
+	return n, total
+}
+
+// parseYear extracts a four digit year from "2014", "2014-05-02" and similar.
+func parseYear(s string) int {
+	s = strings.TrimSpace(s)
+	if len(s) < 4 {
+		return 0
+	}
+	y, err := strconv.Atoi(s[:4])
+	if err != nil || y < 1000 {
+		return 0
+	}
+	return y
+}
+
+func parseBool(s string) bool {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
+
+// applyVorbis maps a Vorbis comment field onto t. Used by FLAC and Ogg.
+func (t *Tags) applyVorbis(key, val string) {
+	switch strings.ToUpper(key) {
+	case "TITLE":
+		t.Title = joinValue(t.Title, val)
+	case "ARTIST":
+		t.Artist = joinValue(t.Artist, val)
+	case "ALBUMARTIST", "ALBUM ARTIST", "ALBUM_ARTIST":
+		t.AlbumArtist = joinValue(t.AlbumArtist, val)
+	case "ALBUM":
+		t.Album = val
+	case "GENRE":
+		t.Genre = joinValue(t.Genre, val)
+	case "DATE", "YEAR", "ORIGINALDATE":
+		if t.Year == 0 {
+			t.Year = parseYear(val)
+		}
+	case "TRACKNUMBER":
+		n, total := parsePair(val)
+		t.Track = n
+		if total > 0 {
+			t.TrackTotal = total
+		}
+	case "TRACKTOTAL", "TOTALTRACKS":
+		t.TrackTotal, _ = strconv.Atoi(strings.TrimSpace(val))
+	case "DISCNUMBER":
+		n, total := parsePair(val)
+		t.Disc = n
+		if total > 0 {
+			t.DiscTotal = total
+		}
+	case "DISCTOTAL", "TOTALDISCS":
+		t.DiscTotal, _ = strconv.Atoi(strings.TrimSpace(val))
+	case "COMPILATION":
+		t.Compilation = parseBool(val)
+	case "RATING":
+		t.Rating = vorbisStars(val)
+	case "FMPS_RATING":
+		if t.Rating == 0 {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil && v > 0 {
+				t.Rating = max(1, min(5, int(v*5+0.5)))
+			}
+		}
+	}
+}
+
+// joinValue appends repeated multi-value fields using "; ".
+func joinValue(cur, val string) string {
+	val = strings.TrimSpace(val)
+	if cur == "" {
+		return val
+	}
+	if val == "" {
+		return cur
+	}
+	return cur + "; " + val
+}
@@ -0,0 +1,92 @@
+package tags
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// readWAV reads the fmt/data chunks for duration and the LIST/INFO chunk
+// for basic text tags.
+func readWAV(f *os.File) (Tags, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(f, hdr[:]); err != nil {
+		return Tags{}, err
+	}
+	if string(hdr[:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return Tags{}, errors.New("tags: not a wave file")
+	}
+	var t Tags
+	byteRate := 0
+	for {
+		var ch [8]byte
+		if _, err := io.ReadFull(f, ch[:]); err != nil {
+			break
+		}
+		id := string(ch[:4])
+		size := int64(binary.LittleEndian.Uint32(ch[4:]))
+		next := size + size&1
+		switch id {
+		case "fmt ":
+			b := make([]byte, size)
+			if _, err := io.ReadFull(f, b); err != nil || len(b) < 12 {
+				return t, err
+			}
+			t.Channels = int(binary.LittleEndian.Uint16(b[2:4]))
+			t.SampleRate = int(binary.LittleEndian.Uint32(b[4:8]))
+			byteRate = int(binary.LittleEndian.Uint32(b[8:12]))
+			t.Bitrate = byteRate * 8 / 1000
+			next -= size
+		case "data":
+			if byteRate > 0 {
+				t.Duration = time.Duration(float64(size) / float64(byteRate) * float64(time.Second))
+			}
+		case "LIST":
+			b := make([]byte, size)
+			if _, err := io.ReadFull(f, b); err != nil {
+				return t, nil
+			}
+			if len(b) >= 4 && string(b[:4]) == "INFO" {
+				parseRIFFInfo(b[4:], &t)
+			}
+			next -= size
+		}
+		if _, err := f.Seek(next, io.SeekCurrent); err != nil {
+			break
+		}
+	}
+	return t, nil
+}
+
+func parseRIFFInfo(b []byte, t *Tags) {
+	for len(b) >= 8 {
+		id := string(b[:4])
+		n := int(binary.LittleEndian.Uint32(b[4:8]))
+		if 8+n > len(b) {
+			return
+		}
+		v := strings.TrimRight(string(b[8:8+n]), "\x00 ")
+		switch id {
+		case "INAM":
+			t.Title = v
+		case "IART":
+			t.Artist = v
+		case "IPRD":
+			t.Album = v
+		case "IGNR":
+			t.Genre = v
+		case "ICRD":
+			t.Year = parseYear(v)
+		case "ITRK", "IPRT":
+			t.Track, t.TrackTotal = parsePair(v)
+		}
+		n += n & 1
+		if 8+n > len(b) {
+			return
+		}
+		b = b[8+n:]
+	}
+}
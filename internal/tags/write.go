@@ -0,0 +1,293 @@
+package tags
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Write stores the textual fields of t (title, artists, album, genre, year,
+// track/disc numbers and compilation flag) in the file at path. Empty fields
+// remove the corresponding tag; any other metadata in the file is kept.
+//
+// cover nil leaves embedded artwork alone, a cover with data replaces the
+// front cover and a cover without data removes it.
+//
+// The file is rewritten into a temporary file next to it, which is read
+// back and checked before it atomically replaces the original.
+// MP3 (ID3v2.4), FLAC and Ogg Vorbis are supported.
+func Write(path string, t Tags, cover *Picture) error {
+	var write func(src, dst *os.File) error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3":
+		write = func(src, dst *os.File) error { return writeMP3(src, dst, t, cover) }
+	case ".flac":
+		write = func(src, dst *os.File) error { return writeFLAC(src, dst, t, cover) }
+	case ".ogg":
+		write = func(src, dst *os.File) error { return writeOgg(src, dst, t, cover) }
+	default:
+		return ErrUnsupported
+	}
+	return replaceFile(path, write, t, cover)
+}
+
+// CanWrite reports whether Write supports the file type of path.
+func CanWrite(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".mp3", ".flac", ".ogg":
+		return true
+	}
+	return false
+}
+
+// replaceFile runs write into a temporary file in the same directory,
+// verifies the result and renames it over path.
+func replaceFile(path string, write func(src, dst *os.File) error, want Tags, cover *Picture) (err error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	fi, err := src.Stat()
+	if err != nil {
+		return err
+	}
+	before, _, err := read(path, false)
+	if err != nil {
+		return err
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(filepath.Base(path), ext)
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+base+"-*.tmp"+ext)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err = write(src, tmp); err != nil {
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	after, pics, err := read(tmp.Name(), cover != nil)
+	if err != nil {
+		return fmt.Errorf("tags: verify: %w", err)
+	}
+	if err = verify(want, cover, after, pics, before.Duration); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), fi.Mode().Perm()); err != nil {
+		return err
+	}
+	src.Close()
+	return os.Rename(tmp.Name(), path)
+}
+
+// verify checks that the rewritten file reads back as intended (pics are
+// its pictures, read when cover is set) and that the audio is still all
+// there.
+func verify(want Tags, cover *Picture, got Tags, pics []Picture, duration time.Duration) error {
+	norm := func(s string) string { return strings.Join(splitValues(s), "; ") }
+	// Empty fields are not checked: MP3 readers may fill them from ID3v1.
+	check := func(name, want, got string) error {
+		if want = norm(want); want != "" && want != got {
+			return fmt.Errorf("tags: verify: %s %q, want %q", name, got, want)
+		}
+		return nil
+	}
+	checkNum := func(name string, want, got int) error {
+		if want != 0 && want != got {
+			return fmt.Errorf("tags: verify: %s %d, want %d", name, got, want)
+		}
+		return nil
+	}
+	// ID3 readers resolve numeric genres ("17" is Rock)
+	genres := func(s string) string {
+		vals := splitValues(s)
+		for i := range vals {
+			vals[i] = genre(vals[i])
+		}
+		return strings.Join(vals, "; ")
+	}
+	if err := errors.Join(
+		check("title", want.Title, got.Title),
+		check("artist", want.Artist, got.Artist),
+		check("album artist", want.AlbumArtist, got.AlbumArtist),
+		check("album", want.Album, got.Album),
+		check("genre", genres(want.Genre), genres(got.Genre)),
+		checkNum("year", want.Year, got.Year),
+		checkNum("track", want.Track, got.Track),
+		checkNum("disc", want.Disc, got.Disc),
+	); err != nil {
+		return err
+	}
+	if want.Compilation && !got.Compilation {
+		return errors.New("tags: verify: compilation flag lost")
+	}
+	if cover != nil {
+		found := false
+		for _, p := range pics {
+			if isCover(p.Type) {
+				if len(cover.Data) == 0 || !bytes.Equal(p.Data, cover.Data) {
+					return errors.New("tags: verify: cover not replaced")
+				}
+				found = true
+			}
+		}
+		if len(cover.Data) > 0 && !found {
+			return errors.New("tags: verify: cover missing")
+		}
+	}
+	if want.Rating != got.Rating {
+		return fmt.Errorf("tags: verify: rating %d, want %d", got.Rating, want.Rating)
+	}
+	if d := got.Duration - duration; d > time.Second || d < -time.Second {
+		return errors.New("tags: verify: audio length changed")
+	}
+	return nil
+}
+
+// splitValues splits a "; " joined multi-value field.
+func splitValues(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ";") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// pairString formats "3/12" style values; total 0 gives just "3".
+func pairString(n, total int) string {
+	if n <= 0 {
+		return ""
+	}
+	if total > 0 {
+		return strconv.Itoa(n) + "/" + strconv.Itoa(total)
+	}
+	return strconv.Itoa(n)
+}
+
+// copyAudio copies n bytes from src at off to dst, or everything up to EOF
+// when n < 0, and fails on short copies.
+func copyAudio(dst io.Writer, src *os.File, off, n int64) error {
+	if _, err := src.Seek(off, io.SeekStart); err != nil {
+		return err
+	}
+	if n < 0 {
+		fi, err := src.Stat()
+		if err != nil {
+			return err
+		}
+		n = fi.Size() - off
+	}
+	c, err := io.Copy(dst, io.LimitReader(src, n))
+	if err != nil {
+		return err
+	}
+	if c != n {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// Vorbis comment keys managed by Write.
+var vorbisManaged = map[string]bool{
+	"TITLE": true, "ARTIST": true, "ALBUMARTIST": true, "ALBUM ARTIST": true,
+	"ALBUM_ARTIST": true, "ALBUM": true, "GENRE": true, "TRACKNUMBER": true,
+	"TRACKTOTAL": true, "TOTALTRACKS": true, "DISCNUMBER": true,
+	"DISCTOTAL": true, "TOTALDISCS": true, "COMPILATION": true,
+}
+
+// editVorbis returns fields with the managed keys replaced by the values of
+// t. A DATE whose year is unchanged is kept so full dates survive. With
+// pictures set, METADATA_BLOCK_PICTURE entries are handled for cover (Ogg).
+func editVorbis(fields []string, t Tags, cover *Picture, pictures bool) []string {
+	var out []string
+	for _, kv := range fields {
+		k, v, _ := strings.Cut(kv, "=")
+		key := strings.ToUpper(k)
+		switch {
+		case vorbisManaged[key]:
+			continue
+		case key == "DATE" || key == "YEAR":
+			if t.Year == 0 || parseYear(v) != t.Year {
+				continue
+			}
+		case pictures && cover != nil && key == "METADATA_BLOCK_PICTURE":
+			if p, ok := decodeVorbisPicture(v); !ok || isCover(p.Type) {
+				continue
+			}
+		}
+		out = append(out, kv)
+	}
+	add := func(key, val string) {
+		if val != "" {
+			out = append(out, key+"="+val)
+		}
+	}
+	for _, v := range splitValues(t.Title) {
+		add("TITLE", v)
+	}
+	for _, v := range splitValues(t.Artist) {
+		add("ARTIST", v)
+	}
+	for _, v := range splitValues(t.AlbumArtist) {
+		add("ALBUMARTIST", v)
+	}
+	add("ALBUM", strings.TrimSpace(t.Album))
+	for _, v := range splitValues(t.Genre) {
+		add("GENRE", v)
+	}
+	if t.Year > 0 && !hasVorbisKey(out, "DATE") && !hasVorbisKey(out, "YEAR") {
+		add("DATE", strconv.Itoa(t.Year))
+	}
+	if t.Track > 0 {
+		add("TRACKNUMBER", strconv.Itoa(t.Track))
+		if t.TrackTotal > 0 {
+			add("TRACKTOTAL", strconv.Itoa(t.TrackTotal))
+		}
+	}
+	if t.Disc > 0 {
+		add("DISCNUMBER", strconv.Itoa(t.Disc))
+		if t.DiscTotal > 0 {
+			add("DISCTOTAL", strconv.Itoa(t.DiscTotal))
+		}
+	}
+	if t.Compilation {
+		add("COMPILATION", "1")
+	}
+	if pictures && cover != nil && len(cover.Data) > 0 {
+		add("METADATA_BLOCK_PICTURE", encodeVorbisPicture(*cover))
+	}
+	return out
+}
+
+func hasVorbisKey(fields []string, key string) bool {
+	for _, kv := range fields {
+		if k, _, _ := strings.Cut(kv, "="); strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// isCover reports whether a picture type is replaced by a new front cover
+// (front cover or the generic "other" type many taggers use).
+func isCover(typ byte) bool { return typ == 3 || typ == 0 }
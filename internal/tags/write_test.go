@@ -0,0 +1,456 @@
+package tags
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// id3v23Frame builds a v2.3 frame.
+func id3v23Frame(id string, flags uint16, data []byte) []byte {
+	b := []byte(id)
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	b = binary.BigEndian.AppendUint16(b, flags)
+	return append(b, data...)
+}
+
+// id3Header builds an ID3v2 tag header for a body of n bytes.
+func id3Header(major byte, n int) []byte {
+	b := []byte{'I', 'D', '3', major, 0, 0, 0, 0, 0, 0}
+	putSyncsafe(b[6:], n)
+	return b
+}
+
+// mp3Audio is n MPEG-1 layer III frames at 128 kbit/s, 44.1 kHz.
+func mp3Audio(n int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xff, 0xfb, 0x90, 0x00})
+	for i := 4; i < len(frame); i++ {
+		frame[i] = byte(i)
+	}
+	return bytes.Repeat(frame, n)
+}
+
+func writeFixture(t *testing.T, name string, b []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+var testCover = &Picture{MIME: "image/png", Type: 3, Data: []byte("\x89PNG not really")}
+
+var testTags = Tags{
+	Title: "Gülpembe", Artist: "Barış Manço", AlbumArtist: "Barış Manço; Kurtalan Ekspres",
+	Album: "Sahibinden İhtiyaçtan", Genre: "Rock; Anadolu Rock", Year: 1985,
+	Track: 3, TrackTotal: 10, Disc: 1, DiscTotal: 2, Compilation: true,
+}
+
+// checkTags compares the fields Write manages.
+func checkTags(t *testing.T, got, want Tags) {
+	t.Helper()
+	got.Duration, got.SampleRate, got.Channels, got.Bitrate = 0, 0, 0, 0
+	if got != want {
+		t.Errorf("tags = %+v\nwant   %+v", got, want)
+	}
+}
+
+func TestWriteMP3(t *testing.T) {
+	audio := mp3Audio(40)
+	compressed := []byte{0, 0, 0, 42, 0x78, 0x9c, 1, 2, 3} // decompressed size, then zlib data
+	encrypted := []byte{0x80, 9, 8, 7, 6}                  // method, then ciphertext
+	body := slices.Concat(
+		id3v23Frame("TIT2", 0, []byte("\x00Old")),
+		id3v23Frame("TYER", 0, []byte("\x001999")),
+		id3v23Frame("COMM", 0x0080, compressed),
+		id3v23Frame("PRIV", 0x0040, encrypted),
+		id3v23Frame("TXXX", 0, []byte("\x00MOOD\x00calm")),
+		id3v23Frame("APIC", 0, []byte("\x00image/jpeg\x00\x03\x00old cover")),
+		id3v23Frame("APIC", 0, []byte("\x00image/jpeg\x00\x08\x00artist photo")),
+	)
+	v1 := encodeID3v1(Tags{Title: "Old"})
+	path := writeFixture(t, "a.mp3", slices.Concat(id3Header(3, len(body)), body, audio, v1))
+	before, _ := Read(path)
+
+	if err := Write(path, testTags, testCover); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTags(t, got, testTags)
+	if got.Duration != before.Duration || got.Duration == 0 {
+		t.Errorf("duration %v, was %v", got.Duration, before.Duration)
+	}
+	if pic, err := ReadPicture(path); err != nil || !bytes.Equal(pic.Data, testCover.Data) {
+		t.Errorf("cover = %+v, %v", pic, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	tag, err := readID3v2(f)
+	if err != nil || tag.Major != 4 {
+		t.Fatalf("tag = %+v, %v", tag, err)
+	}
+	want := map[string]id3Frame{
+		// v2.4 order: data length indicator (syncsafe 42) after the flags
+		"COMM": {ID: "COMM", Flags: 0x0009, Data: []byte{0, 0, 0, 42, 0x78, 0x9c, 1, 2, 3}},
+		"PRIV": {ID: "PRIV", Flags: 0x0004, Data: encrypted},
+	}
+	for _, fr := range tag.Frames {
+		if w, ok := want[fr.ID]; ok {
+			if fr.Flags != w.Flags || !bytes.Equal(fr.Data, w.Data) {
+				t.Errorf("%s = %x %x, want %x %x", fr.ID, fr.Flags, fr.Data, w.Flags, w.Data)
+			}
+			delete(want, fr.ID)
+		}
+	}
+	for id := range want {
+		t.Errorf("%s frame lost", id)
+	}
+	if tag.txxx("MOOD") != "calm" {
+		t.Error("TXXX frame lost")
+	}
+	var pics []string
+	for _, p := range tag.pictures() {
+		pics = append(pics, string(p.Data))
+	}
+	if !slices.Equal(pics, []string{"artist photo", string(testCover.Data)}) {
+		t.Errorf("pictures %q", pics)
+	}
+
+	// Audio and the rewritten ID3v1 trailer follow the tag
+	b, _ := os.ReadFile(path)
+	if !bytes.Equal(b[tag.Size:len(b)-128], audio) {
+		t.Error("audio changed")
+	}
+	if v1, ok := readID3v1(f); !ok || v1.Title != "Gülpembe" || v1.Artist != "Bar?? Manço" {
+		t.Errorf("ID3v1 = %+v", v1)
+	}
+}
+
+func TestWriteMP3KeepsOpaqueV24Frames(t *testing.T) {
+	frame := func(id string, flags uint16, data []byte) []byte {
+		b := []byte(id)
+		var size [4]byte
+		putSyncsafe(size[:], len(data))
+		b = append(b, size[:]...)
+		b = binary.BigEndian.AppendUint16(b, flags)
+		return append(b, data...)
+	}
+	raw := []byte{0x01, 0, 0, 1, 0, 0xde, 0xad} // group, DLI, data
+	body := slices.Concat(frame("TIT2", 0, []byte("\x03Old")), frame("GEOB", 0x4049, raw))
+	path := writeFixture(t, "a.mp3", slices.Concat(id3Header(4, len(body)), body, mp3Audio(10)))
+	if err := Write(path, Tags{Title: "New"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(path)
+	if !bytes.Contains(b, frame("GEOB", 0x4049, raw)) {
+		t.Error("compressed GEOB frame not written back as stored")
+	}
+}
+
+func TestWriteMP3RefusesUnknownV22Frames(t *testing.T) {
+	frame := func(id string, data string) []byte {
+		return append([]byte{id[0], id[1], id[2], 0, 0, byte(len(data))}, data...)
+	}
+	body := slices.Concat(frame("TT2", "\x00Old"), frame("XYZ", "private"))
+	orig := slices.Concat(id3Header(2, len(body)), body, mp3Audio(10))
+	path := writeFixture(t, "a.mp3", orig)
+	if err := Write(path, Tags{Title: "New"}, nil); err == nil || !strings.Contains(err.Error(), "XYZ") {
+		t.Errorf("Write = %v, want an error naming XYZ", err)
+	}
+	if b, _ := os.ReadFile(path); !bytes.Equal(b, orig) {
+		t.Error("file changed")
+	}
+}
+
+// flacFile builds a FLAC stream of one second with the given metadata
+// blocks after STREAMINFO.
+func flacFile(blocks []flacBlock, audio []byte) []byte {
+	info := make([]byte, 34)
+	binary.BigEndian.PutUint64(info[10:18], 44100<<44|1<<41|15<<36|44100)
+	blocks = append([]flacBlock{{Type: flacStreamInfo, Data: info}}, blocks...)
+	b := []byte("fLaC")
+	for i, bl := range blocks {
+		typ := bl.Type
+		if i == len(blocks)-1 {
+			typ |= 0x80
+		}
+		b = append(b, typ, byte(len(bl.Data)>>16), byte(len(bl.Data)>>8), byte(len(bl.Data)))
+		b = append(b, bl.Data...)
+	}
+	return append(b, audio...)
+}
+
+func TestWriteFLAC(t *testing.T) {
+	audio := bytes.Repeat([]byte{0xff, 0xf8, 1, 2}, 500)
+	app := flacBlock{Type: 2, Data: []byte("TEST application data")}
+	seek := flacBlock{Type: 3, Data: make([]byte, 18)}
+	comment := flacBlock{Type: flacVorbisComment, Data: encodeVorbisComment("vendor x", []string{
+		"TITLE=Old", "DATE=1985-05-01", "MOOD=calm",
+		"METADATA_BLOCK_PICTURE=" + encodeVorbisPicture(Picture{Type: 3, MIME: "image/png", Data: []byte("old")}),
+	})}
+	other := flacBlock{Type: flacPicture, Data: encodeFLACPicture(Picture{Type: 8, MIME: "image/png", Data: []byte("artist")})}
+	path := writeFixture(t, "a.flac", flacFile([]flacBlock{seek, comment, app, other, {Type: flacPadding, Data: make([]byte, 100)}}, audio))
+
+	if err := Write(path, testTags, testCover); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTags(t, got, testTags)
+	if got.Duration != time.Second {
+		t.Errorf("duration %v", got.Duration)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	blocks, off, err := readFLACBlocks(f, func(byte) bool { return true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var types []byte
+	var fields []string
+	var pics []string
+	for _, b := range blocks {
+		types = append(types, b.Type)
+		switch b.Type {
+		case 2, 3:
+			if want := map[byte]flacBlock{2: app, 3: seek}[b.Type]; !bytes.Equal(b.Data, want.Data) {
+				t.Errorf("block %d changed", b.Type)
+			}
+		case flacVorbisComment:
+			var vendor string
+			vendor, fields = vorbisFields(b.Data)
+			if vendor != "vendor x" {
+				t.Errorf("vendor %q", vendor)
+			}
+		case flacPicture:
+			p, _ := parseFLACPicture(b.Data)
+			pics = append(pics, string(p.Data))
+		}
+	}
+	if want := []byte{flacStreamInfo, flacVorbisComment, 3, 2, flacPicture, flacPicture, flacPadding}; !bytes.Equal(types, want) {
+		t.Errorf("blocks %v, want %v", types, want)
+	}
+	for _, kv := range []string{"MOOD=calm", "DATE=1985-05-01", "ARTIST=Barış Manço", "GENRE=Anadolu Rock"} {
+		if !slices.Contains(fields, kv) {
+			t.Errorf("%s missing from %q", kv, fields)
+		}
+	}
+	for _, kv := range fields {
+		if strings.HasPrefix(kv, "METADATA_BLOCK_PICTURE=") || kv == "TITLE=Old" {
+			t.Errorf("%.30s kept", kv)
+		}
+	}
+	if !slices.Equal(pics, []string{"artist", string(testCover.Data)}) {
+		t.Errorf("pictures %q", pics)
+	}
+	b, _ := os.ReadFile(path)
+	if !bytes.Equal(b[off:], audio) {
+		t.Error("audio changed")
+	}
+}
+
+// oggFile builds a one second Ogg Vorbis stream: headers, then audio pages.
+func oggFile(comment []string, audioPages int) []byte {
+	id := []byte("\x01vorbis")
+	id = binary.LittleEndian.AppendUint32(id, 0)
+	id = append(id, 2)
+	id = binary.LittleEndian.AppendUint32(id, 44100)
+	id = append(id, make([]byte, 12)...)
+	id = append(id, 0xb8, 1)
+	commentPkt := append([]byte("\x03vorbis"), encodeVorbisComment("vendor x", comment)...)
+	commentPkt = append(commentPkt, 1)
+	setup := append([]byte("\x05vorbis"), bytes.Repeat([]byte{7}, 700)...)
+
+	var b bytes.Buffer
+	first := paginate([][]byte{id}, 99, 0)[0]
+	first.HeaderType, first.Granule = 2, 0
+	writeOggPage(&b, first)
+	headers := paginate([][]byte{commentPkt, setup}, 99, 1)
+	for _, p := range headers {
+		writeOggPage(&b, p)
+	}
+	seq := uint32(1 + len(headers))
+	for i := range audioPages {
+		p := paginate([][]byte{bytes.Repeat([]byte{byte(i)}, 300)}, 99, seq)[0]
+		p.Granule = uint64(44100 * (i + 1) / audioPages)
+		if i == audioPages-1 {
+			p.HeaderType |= 4
+		}
+		writeOggPage(&b, p)
+		seq++
+	}
+	return b.Bytes()
+}
+
+// oggPages reads all pages of b, checking their checksums.
+func oggPages(t *testing.T, b []byte) []oggPage {
+	t.Helper()
+	var pages []oggPage
+	r := bytes.NewReader(b)
+	for r.Len() > 0 {
+		start := len(b) - r.Len()
+		p, err := readOggPage(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw := slices.Clone(b[start : len(b)-r.Len()])
+		crc := binary.LittleEndian.Uint32(raw[22:26])
+		clear(raw[22:26])
+		if oggCRC(0, raw) != crc {
+			t.Errorf("page %d: bad checksum", p.Seq)
+		}
+		pages = append(pages, p)
+	}
+	return pages
+}
+
+func TestWriteOgg(t *testing.T) {
+	orig := oggFile([]string{"TITLE=Old", "MOOD=calm", "TRACKNUMBER=9"}, 3)
+	path := writeFixture(t, "a.ogg", orig)
+	origPages := oggPages(t, orig)
+
+	// A large cover moves the comment header onto more pages
+	cover := &Picture{MIME: "image/png", Type: 3, Data: bytes.Repeat([]byte("x"), 100_000)}
+	if err := Write(path, testTags, cover); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkTags(t, got, testTags)
+	if got.Duration != time.Second {
+		t.Errorf("duration %v", got.Duration)
+	}
+	if pic, err := ReadPicture(path); err != nil || !bytes.Equal(pic.Data, cover.Data) {
+		t.Errorf("cover = %d bytes, %v", len(pic.Data), err)
+	}
+
+	b, _ := os.ReadFile(path)
+	pages := oggPages(t, b)
+	if len(pages) <= len(origPages) {
+		t.Fatalf("%d pages, was %d", len(pages), len(origPages))
+	}
+	for i, p := range pages {
+		if p.Seq != uint32(i) || p.Serial != 99 {
+			t.Errorf("page %d: seq %d serial %d", i, p.Seq, p.Serial)
+		}
+	}
+	// The audio pages are the same but for their numbers
+	tail, origTail := pages[len(pages)-3:], origPages[len(origPages)-3:]
+	for i := range tail {
+		if !bytes.Equal(tail[i].Data, origTail[i].Data) || tail[i].Granule != origTail[i].Granule || tail[i].HeaderType != origTail[i].HeaderType {
+			t.Errorf("audio page %d changed", i)
+		}
+	}
+	packets, _, err := readOggPackets(bytes.NewReader(b), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, fields := vorbisFields(packets[1][7:])
+	if !slices.Contains(fields, "MOOD=calm") || slices.Contains(fields, "TRACKNUMBER=9") {
+		t.Errorf("fields %.200q", fields)
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sizes   []int
+		lacing  [][]int // segment sizes per page
+		granule []uint64
+		cont    []bool
+	}{
+		{"empty packet", []int{0}, [][]int{{0}}, []uint64{0}, []bool{false}},
+		{"exactly 255", []int{255}, [][]int{{255, 0}}, []uint64{0}, []bool{false}},
+		{"two packets", []int{10, 300}, [][]int{{10, 255, 45}}, []uint64{0}, []bool{false}},
+		// 255 segments fill a page; the packet goes on, with no end on
+		// the first page
+		{"spans pages", []int{255*255 + 5}, [][]int{repeatInt(255, 255), {5}}, []uint64{^uint64(0), 0}, []bool{false, true}},
+		{"ends on a full page", []int{254*255 + 1, 3}, [][]int{append(repeatInt(255, 254), 1), {3}}, []uint64{0, 0}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		var packets [][]byte
+		for i, n := range tt.sizes {
+			packets = append(packets, bytes.Repeat([]byte{byte(i + 1)}, n))
+		}
+		pages := paginate(packets, 7, 3)
+		if len(pages) != len(tt.lacing) {
+			t.Errorf("%s: %d pages, want %d", tt.name, len(pages), len(tt.lacing))
+			continue
+		}
+		var joined []byte
+		for i, p := range pages {
+			var lacing []int
+			for _, l := range p.Lacing {
+				lacing = append(lacing, int(l))
+			}
+			if !slices.Equal(lacing, tt.lacing[i]) {
+				t.Errorf("%s: page %d lacing %v, want %v", tt.name, i, lacing, tt.lacing[i])
+			}
+			if p.Granule != tt.granule[i] || (p.HeaderType&1 != 0) != tt.cont[i] || p.Seq != uint32(3+i) || p.Serial != 7 {
+				t.Errorf("%s: page %d = granule %d, type %d, seq %d", tt.name, i, p.Granule, p.HeaderType, p.Seq)
+			}
+			joined = append(joined, p.Data...)
+		}
+		if !bytes.Equal(joined, slices.Concat(packets...)) {
+			t.Errorf("%s: data changed", tt.name)
+		}
+	}
+}
+
+func repeatInt(v, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = v
+	}
+	return out
+}
+
+func TestVerify(t *testing.T) {
+	want := Tags{Title: "A", Genre: "Rock", AlbumArtist: "B", Disc: 2, Compilation: true}
+	cover := &Picture{Type: 3, Data: []byte("new")}
+	tests := []struct {
+		name string
+		got  Tags
+		pics []Picture
+		ok   bool
+	}{
+		{"all there", want, []Picture{{Type: 3, Data: []byte("new")}}, true},
+		{"numeric genre", Tags{Title: "A", Genre: "17", AlbumArtist: "B", Disc: 2, Compilation: true}, []Picture{{Type: 3, Data: []byte("new")}}, true},
+		{"genre lost", Tags{Title: "A", AlbumArtist: "B", Disc: 2, Compilation: true}, []Picture{{Type: 3, Data: []byte("new")}}, false},
+		{"album artist lost", Tags{Title: "A", Genre: "Rock", Disc: 2, Compilation: true}, []Picture{{Type: 3, Data: []byte("new")}}, false},
+		{"disc lost", Tags{Title: "A", Genre: "Rock", AlbumArtist: "B", Compilation: true}, []Picture{{Type: 3, Data: []byte("new")}}, false},
+		{"compilation lost", Tags{Title: "A", Genre: "Rock", AlbumArtist: "B", Disc: 2}, []Picture{{Type: 3, Data: []byte("new")}}, false},
+		{"cover missing", want, nil, false},
+		{"old cover left", want, []Picture{{Type: 3, Data: []byte("old")}, {Type: 3, Data: []byte("new")}}, false},
+		{"other pictures", want, []Picture{{Type: 8, Data: []byte("x")}, {Type: 3, Data: []byte("new")}}, true},
+	}
+	for _, tt := range tests {
+		if err := verify(want, cover, tt.got, tt.pics, 0); (err == nil) != tt.ok {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+	if err := verify(Tags{}, &Picture{}, Tags{}, []Picture{{Type: 3, Data: []byte("old")}}, 0); err == nil {
+		t.Error("removed cover still there")
+	}
+}
@@ -0,0 +1,40 @@
+// Package textenc decodes small text files (lyrics, CUE sheets, playlists) whose
+// encoding is not declared.
+package textenc
+
+import (
+	"bytes"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+)
+
+// Decode converts b to a string: UTF-8 and UTF-16 with a BOM are
+// recognised, anything that is not valid UTF-8 is read as Windows-1254
+// (Turkish), which also covers plain Latin-1 text.
+func Decode(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return string(b[3:])
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}), bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		be := b[0] == 0xfe
+		b = b[2:]
+		u := make([]uint16, len(b)/2)
+		for i := range u {
+			if be {
+				u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+			} else {
+				u[i] = uint16(b[2*i+1])<<8 | uint16(b[2*i])
+			}
+		}
+		return string(utf16.Decode(u))
+	case utf8.Valid(b):
+		return string(b)
+	}
+	s, err := charmap.Windows1254.NewDecoder().Bytes(b)
+	if err != nil {
+		return string(b)
+	}
+	return string(s)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/library"
+	"opentify/internal/lyrics"
+	"opentify/internal/state"
+)
+
+// lyricsOffsetStep is how far one press of the offset buttons moves the
+// lyrics.
+const lyricsOffsetStep = 250 * time.Millisecond
+
+// newLyricsPanel builds the lyrics area shown under "Şimdi Çalıyor". load
+// switches to the lyrics of path ("" clears the panel); update highlights
+// and scrolls to the line at the given playback position. Tapping a synced
+// line calls seek with its time. Both must run on the UI thread.
+func newLyricsPanel(lib *library.Index, st *state.Store, seek func(time.Duration)) (fyne.CanvasObject, func(path string), func(pos time.Duration)) {
+	var (
+		path  string
+		lyr   lyrics.Lyrics
+		cur   = -1
+		lines []*widget.Label
+		gen   int // bumped on load so slow reads for older tracks are dropped
+	)
+	status := widget.NewLabel("")
+	status.Wrapping = fyne.TextWrapWord
+	linesBox := container.NewVBox()
+	scroll := container.NewVScroll(linesBox)
+
+	offsetLbl := widget.NewLabel("")
+	offset := func() time.Duration { return time.Duration(st.LyricsOffset(lib.ID(path))) * time.Millisecond }
+	showOffset := func() {
+		offsetLbl.SetText(fmt.Sprintf("Kaydırma: %+.2f sn", offset().Seconds()))
+	}
+	var update func(pos time.Duration)
+	shift := func(d time.Duration) {
+		if path == "" {
+			return
+		}
+		ms := int((offset() + d) / time.Millisecond)
+		if id := lib.ID(path); id != "" {
+			st.SetLyricsOffset(id, ms)
+		}
+		showOffset()
+	}
+	earlier := widget.NewButtonWithIcon("", theme.ContentRemoveIcon(), func() { shift(-lyricsOffsetStep) })
+	later := widget.NewButtonWithIcon("", theme.ContentAddIcon(), func() { shift(lyricsOffsetStep) })
+	offsetBox := container.NewHBox(earlier, offsetLbl, later)
+	offsetBox.Hide()
+
+	highlight := func(i int, on bool) {
+		if i < 0 || i >= len(lines) {
+			return
+		}
+		l := lines[i]
+		l.TextStyle.Bold = on
+		if on {
+			l.Importance = widget.HighImportance
+		} else {
+			l.Importance = widget.MediumImportance
+		}
+		l.Refresh()
+	}
+
+	show := func(l lyrics.Lyrics) {
+		lyr, cur, lines = l, -1, nil
+		linesBox.RemoveAll()
+		scroll.ScrollToTop()
+		offsetBox.Hide()
+		switch {
+		case l.Empty():
+			status.SetText("Bu parça için şarkı sözü bulunamadı. Aynı adlı bir .lrc dosyası ekleyebilirsiniz.")
+			status.Show()
+		case !l.Synced:
+			status.Hide()
+			text := ""
+			for i, ln := range l.Lines {
+				if i > 0 {
+					text += "\n"
+				}
+				text += ln.Text
+			}
+			plain := widget.NewLabel(text)
+			plain.Wrapping = fyne.TextWrapWord
+			linesBox.Add(plain)
+		default:
+			status.Hide()
+			offsetBox.Show()
+			showOffset()
+			for _, ln := range l.Lines {
+				lbl := widget.NewLabel(ln.Text)
+				lbl.Wrapping = fyne.TextWrapWord
+				at := ln.Time
+				// The flat button behind the label makes the whole line tappable.
+				btn := widget.NewButton("", func() {
+					seek(at + offset())
+					update(at + offset())
+				})
+				btn.Importance = widget.LowImportance
+				lines = append(lines, lbl)
+				linesBox.Add(container.NewStack(btn, lbl))
+			}
+		}
+		linesBox.Refresh()
+	}
+
+	update = func(pos time.Duration) {
+		if !lyr.Synced {
+			return
+		}
+		i := lyr.At(pos - offset())
+		if i == cur {
+			return
+		}
+		highlight(cur, false)
+		highlight(i, true)
+		cur = i
+		if i < 0 {
+			scroll.ScrollToTop()
+			return
+		}
+		// Keep the current line about a third from the top.
+		row := linesBox.Objects[i]
+		y := row.Position().Y - scroll.Size().Height/3 + row.Size().Height/2
+		scroll.ScrollToOffset(fyne.NewPos(0, max(0, y)))
+	}
+
+	load := func(p string) {
+		path = p
+		gen++
+		g := gen
+		if p == "" {
+			show(lyrics.Lyrics{})
+			status.SetText("")
+			return
+		}
+		go func() {
+			var l lyrics.Lyrics
+			var err error
+			// CUE sheet tracks are virtual paths into an album image
+			if t, ok := lib.Get(p); ok && t.File != "" {
+				l, err = lyrics.LoadSegment(t.File, t.Start, t.End)
+			} else {
+				l, err = lyrics.Load(p)
+			}
+			fyne.Do(func() {
+				if g != gen {
+					return
+				}
+				show(l)
+				if err != nil {
+					status.SetText("Şarkı sözleri okunamadı: " + err.Error())
+				}
+			})
+		}()
+	}
+
+	header := container.NewBorder(nil, nil,
+		widget.NewLabelWithStyle("Şarkı Sözleri", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), offsetBox)
+	return container.NewBorder(container.NewVBox(widget.NewSeparator(), header, status), nil, nil, nil, scroll), load, update
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"image"
-	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
@@ -19,11 +20,22 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 
+	"opentify/internal/artwork"
+	"opentify/internal/backup"
 	"opentify/internal/discord"
+	"opentify/internal/dupes"
+	"opentify/internal/history"
+	"opentify/internal/library"
 	"opentify/internal/meta"
+	"opentify/internal/paths"
 	"opentify/internal/player"
+	"opentify/internal/queue"
+	"opentify/internal/search"
+	"opentify/internal/shuffle"
+	"opentify/internal/smart"
 	"opentify/internal/state"
 	"opentify/internal/streaming"
+	"opentify/internal/tags"
 	"opentify/internal/video"
 )
 
@@ -34,6 +46,35 @@ func ensureDir(dir string) error {
 	return nil
 }
 
+// musicDir is the folder scanned for music: the one set for the
+// installation, if any, otherwise the default.
+func musicDir(dirs paths.Dirs, profiles *state.Profiles) string {
+	if d := profiles.MusicDir(); d != "" && !dirs.Portable {
+		return d
+	}
+	return dirs.Music
+}
+
+// historyFile is the listening history of profile name.
+func historyFile(profiles *state.Profiles, name string) string {
+	return filepath.Join(profiles.DataDir(name), "history.jsonl")
+}
+
+// migrateHistory gives the plays of logs from before track IDs the ID of
+// their file, as State.MigrateIDs does for the state; files already gone
+// become lost tracks of lib.
+func migrateHistory(hist *history.Log, lib *library.Index) {
+	changed, err := hist.AssignIDs(lib.IDFor)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "history:", err)
+	}
+	if changed {
+		if err := lib.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "library:", err)
+		}
+	}
+}
+
 // loadResource loads a local file into a Fyne resource (returns nil on error).
 func loadResource(path string) fyne.Resource {
 	b, err := os.ReadFile(path)
@@ -43,36 +84,20 @@ func loadResource(path string) fyne.Resource {
 	return fyne.NewStaticResource(filepath.Base(path), b)
 }
 
-func isMedia(path string) bool {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".mp3", ".wav", ".flac", ".ogg", ".mp4":
-		return true
+func main() {
+	dirs, err := paths.Resolve(paths.PortableFlag(os.Args[1:]))
+	if err != nil {
+		// No home folder to speak of: keep everything next to the binary
+		fmt.Fprintln(os.Stderr, "paths:", err)
+		dirs, _ = paths.Resolve(true)
 	}
-	return false
-}
-
-func scanMusic(dir string) ([]string, error) {
-	var files []string
-	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.Mode().IsRegular() && isMedia(p) {
-			files = append(files, p)
+	if file, ok := exportFlag(os.Args[1:]); ok {
+		if err := exportBackup(dirs, file); err != nil {
+			fmt.Fprintln(os.Stderr, "backup:", err)
+			os.Exit(1)
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		return
 	}
-	sort.Strings(files)
-	return files, nil
-}
-
-func main() {
-	const dbDir = "musicdb"
-	_ = ensureDir(dbDir)
 
 	a := app.New()
 	w := a.NewWindow("Opentify")
@@ -86,24 +111,117 @@ func main() {
 
 	p := player.New()
 
-	// Initialize Discord Rich Presence
+	// Older versions kept their files in data/ under the working directory
+	legacyRoot, err := paths.MigrateLegacy(dirs)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("Eski veriler taşınamadı: %w", err), w)
+	}
+	if err := dirs.Create(); err != nil {
+		dialog.ShowError(err, w)
+	}
+
+	// Each profile has its own state and history; the library is shared
+	profiles, err := state.OpenProfiles(dirs.Config, dirs.Data)
+	if err != nil {
+		dialog.ShowError(fmt.Errorf("Profiller açılamadı: %w", err), w)
+		w.ShowAndRun()
+		return
+	}
+	// loadProfile reads the state of profile name. Unreadable state with no
+	// good backup starts over, keeping the file aside as state.json.corrupt.
+	loadProfile := func(name string) *state.State {
+		loaded, err := state.Load(profiles.StateFile(name))
+		if errors.Is(err, state.ErrNewerVersion) {
+			dialog.ShowError(errors.New("Kullanıcı verisi Opentify'ın daha yeni bir sürümüyle kaydedilmiş. Dosyaya dokunulmadan varsayılanlarla başlanıyor; değişiklikler kaydedilmeyecek."), w)
+			return state.Default()
+		}
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("Kullanıcı verisi okunamadı, varsayılanlarla başlanıyor: %w", err), w)
+			return state.Default()
+		}
+		if loaded.Recovered != "" {
+			dialog.ShowInformation("Kullanıcı verisi kurtarıldı", profiles.StateFile(name)+" bozuktu; "+filepath.Base(loaded.Recovered)+" yedeğinden yüklendi.", w)
+		}
+		return loaded
+	}
+	st := state.NewStore(loadProfile(profiles.Current()))
+	// Every change is written in the background, at most every 2 seconds
+	stateSaver := state.NewSaver(profiles.StateFile(profiles.Current()), 2*time.Second)
+	stateSaver.OnError = func(err error) {
+		fmt.Fprintln(os.Stderr, "state:", err)
+		if errors.Is(err, state.ErrNewerVersion) {
+			return // told at startup, and again at every change would not help
+		}
+		fyne.Do(func() { dialog.ShowError(fmt.Errorf("Kullanıcı verisi kaydedilemedi: %w", err), w) })
+	}
+	st.Subscribe(func(state.Change) {
+		if err := st.Save(stateSaver); err != nil {
+			fmt.Fprintln(os.Stderr, "state:", err)
+		}
+	})
+	// Migrated users keep their musicdb/ folder
+	if legacyRoot != "" {
+		if fi, err := os.Stat(filepath.Join(legacyRoot, "musicdb")); err == nil && fi.IsDir() && profiles.MusicDir() == "" {
+			if err := profiles.SetMusicDir(filepath.Join(legacyRoot, "musicdb")); err != nil {
+				fmt.Fprintln(os.Stderr, "profiles:", err)
+			}
+		}
+	}
+	dbDir := musicDir(dirs, profiles)
+
+	// Initialize Discord Rich Presence, unless the profile turned it off
 	dc := discord.Get()
+	dc.SetEnabled(!st.Settings().DiscordOff)
 	if err := dc.Connect(); err != nil {
 		// Non-fatal: just log and continue without Discord integration
 		fmt.Fprintf(os.Stderr, "Discord bağlantısı kurulamadı: %v\n", err)
 	}
 	defer dc.Disconnect()
+	_ = ensureDir(dbDir)
 
-	files, err := scanMusic(dbDir)
+	lib, err := library.Open(dirs.Library())
+	if err != nil {
+		// Non-fatal: a corrupt index is rebuilt by the scan below
+		fmt.Fprintf(os.Stderr, "Kütüphane dizini okunamadı: %v\n", err)
+	}
+	// Paths in migrated files are relative to the old working directory
+	var rebased map[string]string
+	if legacyRoot != "" {
+		if rebased, err = lib.Rebase(legacyRoot); err != nil {
+			fmt.Fprintln(os.Stderr, "library:", err)
+		}
+	}
+	files, err := lib.Scan(dbDir)
 	if err != nil {
 		dialog.ShowError(err, w)
 	}
+	art := artwork.New(dirs.Artwork(), albumThumbSize, 512)
+	metaCache := meta.NewCache(dirs.Meta(), metaCacheSize)
 
-	st, _ := state.Load("data/state.json")
-	_ = state.EnsureDir("data/state.json")
+	// State from before track IDs refers to files by path
+	if st.MigrateIDs(func(path string) string {
+		if p, ok := rebased[path]; ok {
+			path = p
+		}
+		return lib.IDFor(path)
+	}) {
+		if err := lib.Save(); err != nil {
+			fmt.Fprintln(os.Stderr, "library:", err)
+		}
+	}
+	hist, err := history.Open(historyFile(profiles, profiles.Current()))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Dinleme geçmişi okunamadı: %v\n", err)
+	}
+	if len(rebased) > 0 {
+		if err := hist.Rename(rebased); err != nil {
+			fmt.Fprintln(os.Stderr, "history:", err)
+		}
+	}
+	migrateHistory(hist, lib)
 
 	// Apply theme from settings
-	if strings.ToLower(st.Settings.Theme) == "dark" {
+	if strings.ToLower(st.Settings().Theme) == "dark" {
 		a.Settings().SetTheme(theme.DarkTheme())
 	} else {
 		a.Settings().SetTheme(theme.LightTheme())
@@ -128,9 +246,275 @@ func main() {
 	var vplayer *video.Player
 	var videoBox *fyne.Container
 	var suppressSelect bool
+	var query *search.Query // parsed local search, also used for highlighting
 	var applyView func()
 	var refreshPlaylists func()
+	var updateInfo func(path string)
+	var loadLyrics func(path string)
+	var playLocal func(path string)
+	var setRating func(path string, stars int)
+	var ratingStars *starRating
+	// Play queue for local files; auto-advances when a track ends. Shuffled
+	// orders are seeded once per session so the same list shuffles the same
+	// way until the app is restarted.
+	var pq *queue.Queue
+	sessionSeed := time.Now().UnixNano()
+	queueInfo := func(path string) queue.Info {
+		t, _ := lib.Get(path)
+		album := path // untagged tracks are albums of their own
+		if t.Album != "" {
+			album = t.PrimaryArtist() + "\x00" + t.Album
+			if t.AlbumArtist != "" {
+				album = t.AlbumArtist + "\x00" + t.Album
+			}
+		}
+		return queue.Info{
+			Album:  album,
+			Disc:   t.Disc,
+			Track:  t.TrackNo,
+			Weight: shuffle.Weight(st.Rating(t.ID, t.Rating), st.Liked(t.ID), st.Stats(t.ID).LastPlayed, time.Now()),
+		}
+	}
+	newQueue := func(paths []string, start int, mode string) *queue.Queue {
+		return queue.New(paths, start, mode, st.Settings().Repeat, sessionSeed, queueInfo)
+	}
+	// Listening history of the audio player
+	var listening history.Session
+	logPlay := func(e history.Entry) {
+		e.ID = lib.ID(e.Path)
+		if err := hist.Append(e); err != nil {
+			fmt.Fprintln(os.Stderr, "history:", err)
+		}
+		if e.ID != "" {
+			st.RecordPlay(e.ID, e.Start, e.Counted, e.Skipped)
+		}
+	}
+	// beginPlay starts the history entry of the track just loaded into the
+	// audio player, closing the previous one as skipped.
+	beginPlay := func(path string) {
+		dur, _ := p.Duration()
+		if e, ok := listening.Begin(path, dur, time.Now()); ok {
+			logPlay(e)
+		}
+	}
+	endPlay := func(how history.Outcome) {
+		if e, ok := listening.End(how); ok {
+			logPlay(e)
+		}
+	}
+
+	// showInfo shows the online metadata of the local file path, unless
+	// another track was picked meanwhile.
+	showInfo := func(path string, info meta.Info) {
+		if selected != path {
+			return
+		}
+		titleLbl.SetText(info.Title)
+		artistLbl.SetText(info.Artist)
+		albumLbl.SetText(info.Album)
+		// Update Discord presence with metadata
+		_ = dc.UpdatePresence(path, info.Artist, info.Title, false)
+		if info.Artwork == "" {
+			return
+		}
+		go func() {
+			img, err := downloadImage(metaCache, info.Artwork)
+			if err != nil || img == nil {
+				return
+			}
+			fyne.Do(func() {
+				if selected == path {
+					cover.Image = img
+					cover.Refresh()
+				}
+			})
+		}()
+	}
+	updateInfo = func(path string) {
+		// Show indexed tags right away; the online lookup may refine them
+		t, ok := lib.Get(path)
+		if ok && t.Title != "" {
+			titleLbl.SetText(t.Title)
+			artistLbl.SetText(t.Artist)
+			albumLbl.SetText(t.Album)
+		}
+		// A match the user picked needs no lookup
+		if m, chosen := st.Match(t.ID); ok && chosen {
+			showInfo(path, matchInfo(m))
+			return
+		}
+		want, q := lookupFor(lib, path)
+		providers := metaProviders(st.Settings())
+		if len(providers) == 0 {
+			return
+		}
+		identity := path
+		if ok && t.ID != "" {
+			identity = t.ID
+		}
+		key := meta.CacheKey(identity, q, providers)
+		ctx, cancel := context.WithTimeout(context.Background(), 7*time.Second)
+		go func() {
+			defer cancel()
+			infos, err := metaCache.Search(ctx, providers, key, q)
+			if err != nil {
+				return
+			}
+			// Unlikely matches would show another song's cover; the
+			// user can still pick one with "Eşleşmeyi Düzelt"
+			if best := meta.Rank(infos, want)[0]; best.Score >= meta.Confident {
+				fyne.Do(func() { showInfo(path, best.Info) })
+			}
+		}()
+	}
+
+	// loadAudio loads path into the player; CUE sheet tracks play their
+	// range of the album image.
+	loadAudio := func(path string) error {
+		if t, ok := lib.Get(path); ok && t.File != "" {
+			return p.LoadSegment(path, t.File, t.Start, t.End)
+		}
+		return p.Load(path)
+	}
 
+	// announceNext lets the next CUE track of the same image follow the
+	// current one without a gap.
+	announceNext := func() {
+		if pq == nil {
+			return
+		}
+		if cur, ok := pq.Current(); !ok || cur != selected {
+			return
+		}
+		if next, ok := pq.Peek(); ok {
+			if t, ok := lib.Get(next); ok && t.File != "" {
+				p.SetNext(t.Path, t.File, t.Start, t.End)
+				return
+			}
+		}
+		p.SetNext("", "", 0, 0)
+	}
+
+	playLocal = func(path string) {
+		selected = path
+		currentTrack.SetText(fileLabel(lib, selected))
+		ratingStars.SetValue(trackRating(lib, st, selected))
+
+		ext := strings.ToLower(filepath.Ext(selected))
+		if ext == ".mp4" {
+			// Stop audio player if playing
+			if p.IsPlaying() {
+				p.Stop()
+			}
+
+			visualShow(true)
+			updateInfo(selected)
+			loadLyrics("")
+			endPlay(history.Skipped)
+
+			// Initialize video player if needed
+			if vplayer == nil {
+				vp, err := video.New()
+				if err == nil {
+					vplayer = vp
+					// Setup video visual once
+					if vis := vplayer.Visual(); vis != nil {
+						videoBox.Objects = []fyne.CanvasObject{vis}
+						videoBox.Refresh()
+					}
+				}
+			}
+
+			if vplayer != nil {
+				_ = vplayer.Load(selected)
+				_ = vplayer.Play()
+				toggleBtn.SetText("⏸")
+			}
+			progress.Enable()
+			updateInfo(selected)
+			return
+		}
+
+		// Audio playback
+		// Stop video player if playing
+		if vplayer != nil && vplayer.IsPlaying() {
+			vplayer.Stop()
+		}
+
+		visualShow(false)
+		if err := loadAudio(selected); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		progress.Enable()
+		p.Play()
+		beginPlay(selected)
+		toggleBtn.SetText("⏸")
+		announceNext()
+		updateInfo(selected)
+		loadLyrics(selected)
+	}
+
+	// playQueue replaces the queue with paths and starts playing at start,
+	// in the shuffle mode of the settings. shuffled asks for a shuffle even
+	// when it is off (then each track plays once) and lets it pick the
+	// first track.
+	playQueue := func(paths []string, start int, shuffled bool) {
+		if len(paths) == 0 {
+			return
+		}
+		mode := st.Settings().Shuffle
+		if shuffled {
+			if mode == queue.ShuffleOff {
+				mode = queue.ShuffleExhaust
+			}
+			start = -1
+		} else if start < 0 || start >= len(paths) {
+			start = 0
+		}
+		pq = newQueue(paths, start, mode)
+		if cur, ok := pq.Current(); ok {
+			playLocal(cur)
+		}
+	}
+	// playNext moves on in the queue; ended is set when the current track
+	// played to its end, so repeat-one applies.
+	playNext := func(ended bool) {
+		if pq == nil {
+			toggleBtn.SetText("▶")
+			return
+		}
+		next, ok := pq.Next(ended)
+		if !ok {
+			toggleBtn.SetText("▶")
+			return
+		}
+		playLocal(next)
+	}
+	// playPrev restarts the current track when it has been playing for a
+	// few seconds, otherwise goes back to the previous one.
+	playPrev := func() {
+		if pos, err := p.Position(); pq == nil || (err == nil && pos > 3*time.Second) {
+			_ = p.SeekTo(0)
+			return
+		}
+		if prev, ok := pq.Prev(); ok {
+			playLocal(prev)
+		} else {
+			_ = p.SeekTo(0)
+		}
+	}
+	p.SetOnFinished(func() {
+		fyne.Do(func() {
+			endPlay(history.Completed)
+			playNext(true)
+		})
+	})
+
+	// Playlist view editing; the view follows the playlist order unless a
+	// search query ranks it.
+	var showRowMenu func(id widget.ListItemID, pos fyne.Position)
+	var movePlaylistEntry func(from, to int)
 	list := widget.NewList(
 		func() int {
 			if showingOnline {
@@ -138,18 +522,41 @@ func main() {
 			}
 			return len(view)
 		},
-		func() fyne.CanvasObject { return widget.NewLabel("") },
+		func() fyne.CanvasObject {
+			rt := widget.NewRichText()
+			rt.Truncation = fyne.TextTruncateEllipsis
+			return newTrackRow(container.NewBorder(nil, nil, nil, newStarRating(nil), rt))
+		},
 		func(i widget.ListItemID, o fyne.CanvasObject) {
+			row := o.(*trackRow)
+			row.id = i
+			row.OnDrop, row.OnMenu = nil, nil
+			// Border layout keeps the centre object first, then the right one.
+			box := row.content.(*fyne.Container)
+			rt := box.Objects[0].(*widget.RichText)
+			stars := box.Objects[1].(*starRating)
 			if showingOnline {
 				if i >= 0 && i < len(onlineTracks) {
 					track := onlineTracks[i]
 					text := fmt.Sprintf("%s - %s [%s]", track.Title, track.Artist, track.Duration)
-					o.(*widget.Label).SetText(text)
+					rt.Segments = highlightSegments(text, nil)
+					rt.Refresh()
+					stars.Hide()
 				}
 			} else {
+				row.OnMenu = showRowMenu
+				// Reordering only makes sense in the playlist's own order
+				if currentPage == "Playlist" && query.Empty() {
+					row.OnDrop = movePlaylistEntry
+				}
 				if i >= 0 && i < len(view) {
-					base := filepath.Base(view[i])
-					o.(*widget.Label).SetText(base)
+					path := view[i]
+					text := rowLabel(lib, path)
+					rt.Segments = highlightSegments(text, query.Highlight(text))
+					rt.Refresh()
+					stars.SetValue(trackRating(lib, st, path))
+					stars.OnChanged = func(n int) { setRating(path, n) }
+					stars.Show()
 				}
 			}
 		},
@@ -158,29 +565,6 @@ func main() {
 		if suppressSelect {
 			return
 		}
-		updateInfo := func(path string) {
-			base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
-			ctx, cancel := context.WithTimeout(context.Background(), 7*time.Second)
-			go func() {
-				defer cancel()
-				if info, err := meta.Lookup(ctx, base); err == nil {
-					fyne.Do(func() {
-						titleLbl.SetText(info.Title)
-						artistLbl.SetText(info.Artist)
-						albumLbl.SetText(info.Album)
-						if info.Artwork != "" {
-							if img, e := downloadImage(info.Artwork); e == nil && img != nil {
-								cover.Image = img
-								cover.Refresh()
-							}
-						}
-						// Update Discord presence with metadata
-						_ = dc.UpdatePresence(path, info.Artist, info.Title, false)
-					})
-				}
-			}()
-		}
-
 		// Handle online track selection
 		if showingOnline {
 			if id < 0 || id >= len(onlineTracks) {
@@ -201,7 +585,7 @@ func main() {
 			}
 			visualShow(false)
 
-			preferred := strings.ToLower(st.Settings.DownloadFormat)
+			preferred := strings.ToLower(st.Settings().DownloadFormat)
 			if preferred == "mp4" {
 				// Prefer video flow
 				if downloaded, localPath := streaming.IsDownloadedVideo(track, dbDir); downloaded {
@@ -239,7 +623,7 @@ func main() {
 						})
 						return
 					}
-					if f, e := scanMusic(dbDir); e == nil {
+					if f, e := lib.Scan(dbDir); e == nil {
 						files = f
 					}
 					fyne.Do(func() {
@@ -293,7 +677,7 @@ func main() {
 					})
 					return
 				}
-				if f, e := scanMusic(dbDir); e == nil {
+				if f, e := lib.Scan(dbDir); e == nil {
 					files = f
 				}
 				fyne.Do(func() {
@@ -312,60 +696,88 @@ func main() {
 			return
 		}
 
-		// Handle local file selection
+		// Handle local file selection: queue the visible list from here on
 		if id >= 0 && id < len(view) {
-			selected = view[id]
-			currentTrack.SetText(filepath.Base(selected))
-
-			ext := strings.ToLower(filepath.Ext(selected))
-			if ext == ".mp4" {
-				// Stop audio player if playing
-				if p.IsPlaying() {
-					p.Stop()
-				}
-
-				visualShow(true)
-				updateInfo(selected)
-
-				// Initialize video player if needed
-				if vplayer == nil {
-					vp, err := video.New()
-					if err == nil {
-						vplayer = vp
-						// Setup video visual once
-						if vis := vplayer.Visual(); vis != nil {
-							videoBox.Objects = []fyne.CanvasObject{vis}
-							videoBox.Refresh()
-						}
-					}
-				}
+			pq = newQueue(view, id, st.Settings().Shuffle)
+			playLocal(view[id])
+		}
+	}
 
-				if vplayer != nil {
-					_ = vplayer.Load(selected)
-					_ = vplayer.Play()
-					toggleBtn.SetText("⏸")
-				}
-				progress.Enable()
-				updateInfo(selected)
+	// setRating stores the stars of path and, when enabled in the settings,
+	// writes them into the file's tags in the background.
+	setRating = func(path string, stars int) {
+		id := lib.ID(path)
+		if id == "" {
+			return
+		}
+		st.SetRating(id, stars)
+		if path == selected {
+			ratingStars.SetValue(stars)
+		}
+		if t, _ := lib.Get(path); !st.Settings().RatingTags || t.File != "" || !tags.CanWrite(path) {
+			return
+		}
+		go func() {
+			if err := tags.WriteRating(path, stars); err != nil {
+				fyne.Do(func() { dialog.ShowError(fmt.Errorf("puan dosyaya yazılamadı: %w", err), w) })
 				return
 			}
-
-			// Audio playback
-			// Stop video player if playing
-			if vplayer != nil && vplayer.IsPlaying() {
-				vplayer.Stop()
+			if err := lib.Refresh(path); err != nil {
+				fmt.Fprintln(os.Stderr, "library:", err)
 			}
+		}()
+	}
 
-			visualShow(false)
-			if err := p.Load(selected); err != nil {
-				dialog.ShowError(err, w)
-				return
+	// playlistIndex maps a row of the playlist view to its playlist entry;
+	// entries of missing files have no row.
+	playlistIndex := func(row widget.ListItemID) int {
+		want, n := lib.ID(view[row]), 0
+		for _, p := range view[:row] {
+			if p == view[row] {
+				n++ // earlier repeats of the same track
 			}
-			progress.Enable()
-			p.Play()
-			toggleBtn.SetText("⏸")
-			updateInfo(selected)
 		}
+		ids, _, _ := st.Playlist(currentPlaylist)
+		for i, id := range ids {
+			if id == want {
+				if n == 0 {
+					return i
+				}
+				n--
+			}
+		}
+		return -1
+	}
+	movePlaylistEntry = func(from, to int) {
+		to = min(to, len(view)-1)
+		if from == to || from < 0 || from >= len(view) {
+			return
+		}
+		_ = st.MovePlaylistEntry(currentPlaylist, playlistIndex(from), playlistIndex(to))
+	}
+	showRowMenu = func(id widget.ListItemID, pos fyne.Position) {
+		if id < 0 || id >= len(view) {
+			return
+		}
+		path := view[id]
+		items := []*fyne.MenuItem{
+			fyne.NewMenuItem("Çal", func() {
+				pq = newQueue(view, id, st.Settings().Shuffle)
+				playLocal(path)
+			}),
+			addToPlaylistMenu(w, st, []string{lib.ID(path)}),
+		}
+		if currentPage == "Playlist" {
+			up := fyne.NewMenuItem("Yukarı taşı", func() { movePlaylistEntry(id, id-1) })
+			up.Disabled = !query.Empty() || id <= 0
+			down := fyne.NewMenuItem("Aşağı taşı", func() { movePlaylistEntry(id, id+1) })
+			down.Disabled = !query.Empty() || id >= len(view)-1
+			remove := fyne.NewMenuItem("Listeden kaldır", func() {
+				_ = st.RemoveFromPlaylist(currentPlaylist, playlistIndex(id))
+			})
+			items = append(items, fyne.NewMenuItemSeparator(), up, down, remove)
+		}
+		widget.ShowPopUpMenuAtPosition(fyne.NewMenu("", items...), w.Canvas(), pos)
 	}
 
 	// Video gömme geçici olarak devre dışı; MP4'ler sistem oynatıcıda açılır.
@@ -376,12 +788,13 @@ func main() {
 	toggleBtn = widget.NewButton("▶", nil)
 
 	refreshBtn := widget.NewButtonWithIcon("Yenile", theme.ViewRefreshIcon(), func() {
-		f, err := scanMusic(dbDir)
+		f, err := lib.Scan(dbDir)
 		if err != nil {
 			dialog.ShowError(err, w)
 			return
 		}
 		files = f
+		art.ClearMisses()
 		applyView()
 		list.Refresh()
 	})
@@ -400,52 +813,118 @@ func main() {
 		if selected == "" {
 			return
 		}
-		st.Liked[selected] = !st.Liked[selected]
-		_ = state.Save("data/state.json", st)
+		if id := lib.ID(selected); id != "" {
+			st.ToggleLiked(id)
+		}
+	})
+	ratingStars = newStarRating(func(n int) {
+		if selected == "" || showingOnline {
+			ratingStars.SetValue(0)
+			return
+		}
+		setRating(selected, n)
 	})
 	addToPlBtn := widget.NewButton("Listeye Ekle", func() {
-		if selected == "" {
+		if selected == "" || lib.ID(selected) == "" {
 			return
 		}
 		// Build a dialog that lists existing playlists and allows creating a new one
 		var dlg dialog.Dialog
-		// existing playlists buttons
-		names := make([]string, 0, len(st.Playlists))
-		for name := range st.Playlists {
-			names = append(names, name)
+		add := func(name string) {
+			n, err := st.AddToPlaylist(name, lib.ID(selected))
+			if err != nil {
+				dialog.ShowError(playlistError(err), w)
+				return
+			}
+			dlg.Hide()
+			if n == 0 {
+				dialog.ShowInformation("Playliste Ekle", fmt.Sprintf("Parça zaten %q listesinde.", name), w)
+			}
 		}
-		sort.Strings(names)
+		// existing playlists buttons
 		items := []fyne.CanvasObject{widget.NewLabel("Bir playlist seçin:")}
-		for _, name := range names {
+		for _, name := range st.PlaylistNames() {
 			n := name
-			items = append(items, widget.NewButton(n, func() {
-				st.Playlists[n] = append(st.Playlists[n], selected)
-				_ = state.Save("data/state.json", st)
-				refreshPlaylists()
-				dlg.Hide()
-			}))
+			items = append(items, widget.NewButton(n, func() { add(n) }))
 		}
 		items = append(items, widget.NewSeparator(), widget.NewLabel("Yeni playlist:"))
 		nameEntry := widget.NewEntry()
 		items = append(items, nameEntry)
 		items = append(items, widget.NewButton("Oluştur ve ekle", func() {
-			name := strings.TrimSpace(nameEntry.Text)
-			if name == "" {
+			name, err := st.CreatePlaylist(nameEntry.Text)
+			if errors.Is(err, state.ErrPlaylistName) {
 				return
 			}
-			if _, ok := st.Playlists[name]; !ok {
-				st.Playlists[name] = []string{}
+			// An existing playlist of that name is fine to add to
+			if err != nil && !errors.Is(err, state.ErrPlaylistExists) {
+				dialog.ShowError(playlistError(err), w)
+				return
 			}
-			st.Playlists[name] = append(st.Playlists[name], selected)
-			_ = state.Save("data/state.json", st)
-			refreshPlaylists()
-			dlg.Hide()
+			add(name)
 		}))
 		content := container.NewVBox(items...)
 		dlg = dialog.NewCustom("Playliste Ekle", "Kapat", content, w)
 		dlg.Show()
 	})
 
+	prevBtn := widget.NewButtonWithIcon("", theme.MediaSkipPreviousIcon(), func() {
+		if !showingOnline {
+			playPrev()
+		}
+	})
+	nextBtn := widget.NewButtonWithIcon("", theme.MediaSkipNextIcon(), func() {
+		if !showingOnline {
+			playNext(false)
+		}
+	})
+
+	// Karıştırma ve tekrar kipleri
+	shuffleModes := []struct{ mode, label string }{
+		{queue.ShuffleOff, "Sıralı"},
+		{queue.ShuffleRandom, "Rastgele"},
+		{queue.ShuffleExhaust, "Karışık (tekrarsız)"},
+		{queue.ShuffleAlbum, "Albüm karışık"},
+		{queue.ShuffleWeighted, "Akıllı karışık"},
+	}
+	var shuffleLabels []string
+	for _, m := range shuffleModes {
+		shuffleLabels = append(shuffleLabels, m.label)
+	}
+	shuffleSelect := widget.NewSelect(shuffleLabels, func(label string) {
+		for _, m := range shuffleModes {
+			if m.label != label || m.mode == st.Settings().Shuffle {
+				continue
+			}
+			st.UpdateSettings(func(set *state.Settings) { set.Shuffle = m.mode })
+			if pq != nil {
+				pq.SetShuffle(m.mode)
+				announceNext()
+			}
+		}
+	})
+	for _, m := range shuffleModes {
+		if m.mode == st.Settings().Shuffle {
+			shuffleSelect.SetSelected(m.label)
+		}
+	}
+	repeatLabels := map[string]string{queue.RepeatOff: "Tekrar: Kapalı", queue.RepeatAll: "Tekrar: Tümü", queue.RepeatOne: "Tekrar: Tek"}
+	repeatBtn := widget.NewButtonWithIcon(repeatLabels[st.Settings().Repeat], theme.MediaReplayIcon(), nil)
+	repeatBtn.OnTapped = func() {
+		repeat := queue.RepeatOff
+		switch st.Settings().Repeat {
+		case queue.RepeatOff:
+			repeat = queue.RepeatAll
+		case queue.RepeatAll:
+			repeat = queue.RepeatOne
+		}
+		st.UpdateSettings(func(set *state.Settings) { set.Repeat = repeat })
+		repeatBtn.SetText(repeatLabels[repeat])
+		if pq != nil {
+			pq.Repeat = repeat
+			announceNext()
+		}
+	}
+
 	// Ses seviyesi
 	volSlider := widget.NewSlider(0, 1)
 	volSlider.Step = 0.01
@@ -494,11 +973,15 @@ func main() {
 		if !p.IsPlaying() {
 			cur, _ := p.CurrentFile()
 			if cur != selected {
-				if err := p.Load(selected); err != nil {
+				if err := loadAudio(selected); err != nil {
 					dialog.ShowError(fmt.Errorf("yüklenemedi: %w", err), w)
 					return
 				}
-				currentTrack.SetText(filepath.Base(selected))
+				currentTrack.SetText(fileLabel(lib, selected))
+				beginPlay(selected)
+			} else if listening.Path() != selected {
+				// Restored from the last session, or its play was closed
+				beginPlay(selected)
 			}
 			p.Play()
 			progress.Enable()
@@ -526,6 +1009,30 @@ func main() {
 		}
 	}
 
+	// Tag editor for the selection; other tracks of the view can be ticked
+	// for batch edits.
+	tagsBtn := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() {
+		if showingOnline {
+			return
+		}
+		var sel []string
+		if selected != "" {
+			sel = []string{selected}
+		}
+		showTagEditor(w, view, sel, func(changed []string) {
+			if err := refreshEdited(lib, art, changed); err != nil {
+				fmt.Fprintln(os.Stderr, "library:", err)
+			}
+			applyView()
+			list.Refresh()
+			for _, p := range changed {
+				if p == selected {
+					updateInfo(selected)
+				}
+			}
+		})
+	})
+
 	// Control bar with better layout: fixed-width buttons, flexible progress
 	trackBox := container.NewMax(currentTrack)
 	trackBox.Resize(fyne.NewSize(200, 40)) // Fixed width for track name
@@ -535,9 +1042,9 @@ func main() {
 	controls := container.NewBorder(
 		nil, nil,
 		// Left side: track info and buttons
-		container.NewHBox(trackBox, toggleBtn, likeBtn, addToPlBtn),
-		// Right side: volume
-		container.NewHBox(widget.NewLabel("🔊"), volSlider),
+		container.NewHBox(trackBox, prevBtn, toggleBtn, nextBtn, likeBtn, ratingStars, addToPlBtn, tagsBtn),
+		// Right side: play order and volume
+		container.NewHBox(shuffleSelect, repeatBtn, widget.NewLabel("🔊"), volSlider),
 		// Center: progress bar
 		progressBox,
 	)
@@ -554,7 +1061,9 @@ func main() {
 	}
 	homeBtn := widget.NewButtonWithIcon("Anasayfa", theme.HomeIcon(), func() { currentPage = "Anasayfa"; applyView(); list.Refresh() })
 	exploreBtn := widget.NewButtonWithIcon("Keşfet", theme.SearchIcon(), func() { currentPage = "Keşfet"; applyView(); list.Refresh() })
-likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func() { currentPage = "Beğendiklerim"; applyView(); list.Refresh() })
+	browseBtn := widget.NewButtonWithIcon("Göz At", theme.ListIcon(), func() { currentPage = "Göz At"; applyView(); list.Refresh() })
+	albumsBtn := widget.NewButtonWithIcon("Albümler", theme.GridIcon(), func() { currentPage = "Albümler"; applyView(); list.Refresh() })
+	likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func() { currentPage = "Beğendiklerim"; applyView(); list.Refresh() })
 	addPlBtn := widget.NewButtonWithIcon("Yeni Playlist", theme.ContentAddIcon(), func() {
 		name := widget.NewEntry()
 		d := dialog.NewForm("Yeni Playlist", "Oluştur", "İptal",
@@ -562,33 +1071,71 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 				if !ok {
 					return
 				}
-				n := strings.TrimSpace(name.Text)
-				if n == "" {
+				n, err := st.CreatePlaylist(name.Text)
+				if err != nil {
+					dialog.ShowError(playlistError(err), w)
 					return
 				}
-				if _, ok := st.Playlists[n]; !ok {
-					st.Playlists[n] = []string{}
-				}
-				_ = state.Save("data/state.json", st)
+				currentPage, currentPlaylist = "Playlist", n
+				applyView()
+				list.Refresh()
 			}, w)
 		d.Show()
 	})
+	// saveSmart stores an edited smart playlist, handling renames.
+	saveSmart := func(oldName, newName string, pl state.SmartPlaylist) {
+		st.PutSmartPlaylist(oldName, newName, pl)
+		currentPage, currentPlaylist = "Akıllı", newName
+		applyView()
+		list.Refresh()
+	}
+	editSmart := func(name string) {
+		var remove func()
+		if name != "" {
+			remove = func() {
+				st.DeleteSmartPlaylist(name)
+				if currentPage == "Akıllı" && currentPlaylist == name {
+					currentPage = "Keşfet"
+				}
+				applyView()
+				list.Refresh()
+			}
+		}
+		pl, _ := st.SmartPlaylist(name)
+		showSmartEditor(w, name, pl, saveSmart, remove)
+	}
+	addSmartBtn := widget.NewButtonWithIcon("Yeni Akıllı Liste", theme.SearchReplaceIcon(), func() { editSmart("") })
+	importPlBtn := widget.NewButtonWithIcon("Playlist İçe Aktar", theme.DownloadIcon(), func() {
+		showPlaylistImport(w, lib, st, func(name string) {
+			currentPage, currentPlaylist = "Playlist", name
+			applyView()
+			list.Refresh()
+		})
+	})
 
 	plHeader := container.NewHBox(widget.NewIcon(theme.FolderIcon()), widget.NewLabel("Playlistler"))
 	plBox := container.NewVBox(plHeader)
 	refreshPlaylists = func() {
 		children := []fyne.CanvasObject{plHeader}
-		for name := range st.Playlists {
+		names := st.PlaylistNames()
+		for _, name := range names {
 			plName := name
 			children = append(children, widget.NewButtonWithIcon(plName, theme.FolderIcon(), func() { currentPage = "Playlist"; currentPlaylist = plName; applyView(); list.Refresh() }))
 		}
+		for _, name := range st.SmartPlaylistNames() {
+			plName := name
+			open := widget.NewButtonWithIcon(plName, theme.SearchReplaceIcon(), func() { currentPage = "Akıllı"; currentPlaylist = plName; applyView(); list.Refresh() })
+			edit := widget.NewButtonWithIcon("", theme.DocumentCreateIcon(), func() { editSmart(plName) })
+			edit.Importance = widget.LowImportance
+			children = append(children, container.NewBorder(nil, nil, nil, edit, open))
+		}
 		plBox.Objects = children
 		plBox.Refresh()
 	}
 	refreshPlaylists()
 
 	searchEntry := widget.NewEntry()
-	searchEntry.SetPlaceHolder("Ara...")
+	searchEntry.SetPlaceHolder("Ara... (ör. artist:tarkan year:>2010 -remix)")
 
 	// Declare buttons first
 	var onlineSearchBtn *widget.Button
@@ -645,10 +1192,9 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 		if val == "" {
 			return
 		}
-		st.Settings.DownloadFormat = strings.ToLower(val)
-		_ = state.Save("data/state.json", st)
+		st.UpdateSettings(func(set *state.Settings) { set.DownloadFormat = strings.ToLower(val) })
 	})
-	if strings.ToLower(st.Settings.DownloadFormat) == "mp4" {
+	if strings.ToLower(st.Settings().DownloadFormat) == "mp4" {
 		dlSelect.SetSelected("MP4")
 	} else {
 		dlSelect.SetSelected("MP3")
@@ -658,34 +1204,243 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 		v := strings.ToLower(strings.TrimSpace(val))
 		if v == "koyu" {
 			a.Settings().SetTheme(theme.DarkTheme())
-			st.Settings.Theme = "dark"
+			st.UpdateSettings(func(set *state.Settings) { set.Theme = "dark" })
 		} else {
 			a.Settings().SetTheme(theme.LightTheme())
-			st.Settings.Theme = "light"
+			st.UpdateSettings(func(set *state.Settings) { set.Theme = "light" })
 		}
-		_ = state.Save("data/state.json", st)
 	})
-	if strings.ToLower(st.Settings.Theme) == "dark" {
+	if strings.ToLower(st.Settings().Theme) == "dark" {
 		themeSelect.SetSelected("Koyu")
 	} else {
 		themeSelect.SetSelected("Açık")
 	}
+	organizeBtn := widget.NewButton("Kütüphaneyi Düzenle...", func() {
+		showOrganizer(w, dbDir, lib, st, func(renames map[string]string) {
+			if pq != nil {
+				pq.Rename(renames)
+			}
+			if np, ok := renames[selected]; ok {
+				selected = np
+			}
+			if err := hist.Rename(renames); err != nil {
+				fmt.Fprintln(os.Stderr, "history:", err)
+			}
+			if f, err := lib.Scan(dbDir); err == nil {
+				files = f
+			}
+			applyView()
+			list.Refresh()
+		})
+	})
+	fps := dupes.NewFingerprintCache(dirs.Fingerprints())
+	dupesBtn := widget.NewButton("Kopyaları Bul...", func() {
+		showDuplicates(w, dbDir, lib, st, fps, func(survivor string, removed []string) {
+			gone := map[string]string{}
+			for _, p := range removed {
+				gone[p] = survivor
+			}
+			if pq != nil {
+				pq.Rename(gone)
+			}
+			if _, ok := gone[selected]; ok {
+				selected = survivor
+			}
+			if len(removed) > 0 {
+				if f, err := lib.Scan(dbDir); err == nil {
+					files = f
+				}
+			}
+			applyView()
+			list.Refresh()
+		})
+	})
+	ratingTagsCheck := widget.NewCheck("Puanları dosya etiketlerine de yaz (MP3 POPM, FLAC/OGG RATING)", func(on bool) {
+		st.UpdateSettings(func(set *state.Settings) { set.RatingTags = on })
+	})
+	ratingTagsCheck.SetChecked(st.Settings().RatingTags)
+	healthBtn := widget.NewButton("Kütüphaneyi Denetle...", func() {
+		showHealthCheck(w, dbDir, lib, st, func() {
+			applyView()
+			list.Refresh()
+		})
+	})
+	discordCheck := widget.NewCheck("Çalan parçayı Discord'da göster", func(on bool) {
+		st.UpdateSettings(func(set *state.Settings) { set.DiscordOff = !on })
+		dc.SetEnabled(on)
+		if on {
+			if err := dc.Connect(); err != nil {
+				fmt.Fprintf(os.Stderr, "Discord bağlantısı kurulamadı: %v\n", err)
+			}
+		}
+	})
+	discordCheck.SetChecked(!st.Settings().DiscordOff)
+	providersBox, refreshProviders := newProviderSettings(st)
+	// showSettings brings the controls in line with the settings of a
+	// profile just switched to.
+	showSettings := func() {
+		set := st.Settings()
+		if set.Theme == "dark" {
+			themeSelect.SetSelected("Koyu")
+		} else {
+			themeSelect.SetSelected("Açık")
+		}
+		if set.DownloadFormat == "mp4" {
+			dlSelect.SetSelected("MP4")
+		} else {
+			dlSelect.SetSelected("MP3")
+		}
+		for _, m := range shuffleModes {
+			if m.mode == set.Shuffle {
+				shuffleSelect.SetSelected(m.label)
+			}
+		}
+		repeatBtn.SetText(repeatLabels[set.Repeat])
+		if pq != nil {
+			pq.SetShuffle(set.Shuffle)
+			pq.Repeat = set.Repeat
+			announceNext()
+		}
+		ratingTagsCheck.SetChecked(set.RatingTags)
+		discordCheck.SetChecked(!set.DiscordOff)
+		refreshProviders()
+		dc.SetEnabled(!set.DiscordOff)
+	}
+	setTitle := func() {
+		if len(profiles.List()) > 1 {
+			w.SetTitle("Opentify · " + profiles.Current())
+		} else {
+			w.SetTitle("Opentify")
+		}
+	}
+	var refreshProfiles func()
+	var saveSession func()
+	// release settles the current profile's files: the track playing is
+	// logged as interrupted and pending state is written.
+	release := func() error {
+		endPlay(history.Interrupted)
+		return stateSaver.Flush()
+	}
+	// switchProfile makes name the current profile: what is pending goes to
+	// the old one's files, then its state and history are loaded.
+	switchProfile := func(name string) error {
+		loaded, err := state.Load(profiles.StateFile(name))
+		if err != nil {
+			return err
+		}
+		// The track playing stays in the old profile's history
+		endPlay(history.Interrupted)
+		saveSession()
+		if err := stateSaver.SetPath(profiles.StateFile(name)); err != nil {
+			dialog.ShowError(fmt.Errorf("Kullanıcı verisi kaydedilemedi: %w", err), w)
+		}
+		if err := hist.Switch(historyFile(profiles, name)); err != nil {
+			fmt.Fprintf(os.Stderr, "Dinleme geçmişi okunamadı: %v\n", err)
+		}
+		migrateHistory(hist, lib)
+		if err := profiles.SetCurrent(name); err != nil {
+			return err
+		}
+		st.Replace(loaded)
+		showSettings()
+		refreshProfiles()
+		return nil
+	}
+	var profilesBox fyne.CanvasObject
+	profilesBox, refreshProfiles = newProfileSettings(w, profiles, release, switchProfile, setTitle)
+	backupBtn := widget.NewButton("Yedekle...", func() {
+		showBackupExport(w, func() backup.Data {
+			return backup.Data{
+				Profile:  profiles.Current(),
+				State:    st.Snapshot(),
+				History:  hist.Entries(),
+				Library:  lib,
+				MusicDir: dbDir,
+			}
+		})
+	})
+	restoreBtn := widget.NewButton("Yedekten Geri Yükle...", func() {
+		coverDir := filepath.Join(profiles.DataDir(profiles.Current()), "covers")
+		showBackupImport(w, lib, st, hist, dbDir, coverDir, func(mode backup.Mode) {
+			// The pages redraw through the store's change notification
+			if mode == backup.Replace {
+				showSettings()
+			}
+		})
+	})
+	// Where files are kept, see internal/paths
+	locationText := fmt.Sprintf("Müzik: %s\nKullanıcı verisi: %s\nKütüphane ve geçmiş: %s\nÖnbellek: %s", dbDir, dirs.Config, dirs.Data, dirs.Cache)
+	if dirs.Portable {
+		locationText += "\nTaşınabilir kip: her şey uygulamanın yanında."
+	}
+	locations := widget.NewLabel(locationText)
+	locations.Wrapping = fyne.TextWrapBreak
+	cacheLbl := widget.NewLabel("")
+	showCacheSize := func() {
+		go func() {
+			n := metaCache.Size()
+			fyne.Do(func() {
+				cacheLbl.SetText(fmt.Sprintf("Parça bilgisi ve kapak önbelleği: %.1f MB", float64(n)/(1<<20)))
+			})
+		}()
+	}
+	showCacheSize()
+	clearCacheBtn := widget.NewButton("Önbelleği Temizle", func() {
+		if err := metaCache.Clear(); err != nil {
+			dialog.ShowError(fmt.Errorf("önbellek temizlenemedi: %w", err), w)
+		}
+		showCacheSize()
+	})
 	settingsBox := container.NewVBox(
 		settingsTitle,
 		widget.NewSeparator(),
 		widget.NewLabel("İndirme formatı"), dlSelect,
 		widget.NewSeparator(),
 		widget.NewLabel("Tema"), themeSelect,
+		widget.NewSeparator(),
+		widget.NewLabel("Kütüphane"), organizeBtn, dupesBtn, healthBtn, ratingTagsCheck,
+		widget.NewSeparator(),
+		widget.NewLabel("Discord"), discordCheck,
+		widget.NewSeparator(),
+		widget.NewLabel("Parça bilgisi kaynakları"), providersBox,
+		widget.NewSeparator(),
+		widget.NewLabel("Profiller"), profilesBox,
+		widget.NewSeparator(),
+		widget.NewLabel("Yedek"), container.NewHBox(backupBtn, restoreBtn),
+		widget.NewSeparator(),
+		widget.NewLabel("Konumlar"), locations,
+		container.NewBorder(nil, nil, nil, clearCacheBtn, cacheLbl),
 	)
 
 	// Sayfa içerikleri: Anasayfa ve Keşfet (liste)
-	homeBox := container.NewVBox(
-		widget.NewLabelWithStyle("Opentify'a hoş geldiniz", fyne.TextAlignCenter, fyne.TextStyle{Bold: true}),
-		widget.NewLabel("Müziğinizi keşfetmek için soldan 'Keşfet' sekmesine geçin."),
-	)
-	exploreArea := container.NewBorder(searchBox, nil, nil, nil, list)
+	var homeBox fyne.CanvasObject
+	homeBox, refreshHome := newHomePage(lib, st, hist, dbDir, art, playQueue)
+	playlistHeader, showPlaylist := newPlaylistHeader(w, lib, st, art, playQueue, func(name string) {
+		currentPlaylist = name
+		if name == "" {
+			currentPage = "Keşfet"
+			applyView()
+			list.Refresh()
+		}
+	})
+	playlistHeader.Hide()
+	exploreArea := container.NewBorder(container.NewVBox(playlistHeader, searchBox), nil, nil, nil, list)
+	browsePage, refreshBrowse := newBrowsePage(lib, playQueue)
+	albumPage, refreshAlbums := newAlbumGrid(lib, art, playQueue)
 	settingsBox.Hide()
-	pages := container.NewStack(homeBox, exploreArea, settingsBox)
+	browsePage.Hide()
+	albumPage.Hide()
+	pages := container.NewStack(homeBox, exploreArea, settingsBox, browsePage, albumPage)
+	// showPage makes page the only visible child of pages
+	showPage := func(page fyne.CanvasObject) {
+		for _, o := range pages.Objects {
+			if o == page {
+				o.Show()
+			} else {
+				o.Hide()
+			}
+		}
+	}
 
 	// Sağ panel: kapak + bilgiler
 	cover = canvas.NewImageFromResource(theme.FileImageIcon())
@@ -714,76 +1469,118 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 	titleLbl.Wrapping = fyne.TextTruncate
 	artistLbl.Wrapping = fyne.TextTruncate
 	albumLbl.Wrapping = fyne.TextTruncate
+	fixMatchBtn := widget.NewButton("Eşleşmeyi Düzelt...", func() {
+		path := selected
+		t, ok := lib.Get(path)
+		if !ok || t.ID == "" {
+			dialog.ShowInformation("Eşleşmeyi Düzelt", "Önce kütüphaneden bir parça seçin.", w)
+			return
+		}
+		want, q := lookupFor(lib, path)
+		showFixMatch(w, st, metaCache, t.ID, want, q, metaProviders(st.Settings()),
+			func(info meta.Info) { showInfo(path, info) },
+			func() { updateInfo(path) })
+	})
 	metaInfo := container.NewVBox(
 		widget.NewSeparator(),
 		widget.NewLabelWithStyle("Başlık", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), titleLbl,
 		widget.NewLabelWithStyle("Sanatçı", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), artistLbl,
 		widget.NewLabelWithStyle("Albüm", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}), albumLbl,
+		fixMatchBtn,
 	)
 	infoBox := container.NewBorder(visualStack, metaInfo, nil, nil)
+	var lyricsBox fyne.CanvasObject
+	var updateLyrics func(pos time.Duration)
+	lyricsBox, loadLyrics, updateLyrics = newLyricsPanel(lib, st, func(d time.Duration) { _ = p.SeekTo(d) })
+	nowPlaying := container.NewVSplit(infoBox, lyricsBox)
+	nowPlaying.Offset = 0.55
 	rightPanel := container.NewBorder(
 		widget.NewLabelWithStyle("Şimdi Çalıyor", fyne.TextAlignLeading, fyne.TextStyle{Bold: true}),
 		nil, nil, nil,
-		infoBox,
+		nowPlaying,
 	)
 
+	// filterView ranks paths against the current search query; with an
+	// empty query the original order is kept.
+	filterView := func(paths []string) []string {
+		docs := make([]search.Doc, len(paths))
+		for i, f := range paths {
+			docs[i] = searchDoc(lib, st, f)
+		}
+		res := search.Run(query, docs)
+		out := make([]string, len(res))
+		for i, r := range res {
+			out[i] = r.ID
+		}
+		return out
+	}
+
 	applyView = func() {
 		// Reset online search when switching pages
 		if currentPage != "Keşfet" {
 			showingOnline = false
 		}
 
-		q := strings.ToLower(strings.TrimSpace(searchEntry.Text))
+		query = search.Parse(searchEntry.Text)
+		if currentPage == "Playlist" {
+			showPlaylist(currentPlaylist)
+			playlistHeader.Show()
+		} else {
+			playlistHeader.Hide()
+		}
 		switch currentPage {
 		case "Anasayfa":
-			// Anasayfa: metin göster, listeyi gizle
-			homeBox.Show()
-			exploreArea.Hide()
-			settingsBox.Hide()
+			// Anasayfa: raflar göster, listeyi gizle
+			showPage(homeBox)
+			refreshHome()
 			view = view[:0]
 			list.Refresh()
 			return
 		case "Ayarlar":
-			homeBox.Hide()
-			exploreArea.Hide()
-			settingsBox.Show()
+			showPage(settingsBox)
 			view = view[:0]
 			list.Refresh()
 			return
-		case "Beğendiklerim":
-			homeBox.Hide()
-			exploreArea.Show()
-			settingsBox.Hide()
+		case "Göz At":
+			showPage(browsePage)
+			refreshBrowse()
 			view = view[:0]
+			list.Refresh()
+			return
+		case "Albümler":
+			showPage(albumPage)
+			refreshAlbums()
+			view = view[:0]
+			list.Refresh()
+			return
+		case "Beğendiklerim":
+			showPage(exploreArea)
+			var liked []string
 			for _, f := range files {
-				if st.Liked[f] && (q == "" || strings.Contains(strings.ToLower(filepath.Base(f)), q)) {
-					view = append(view, f)
+				if st.Liked(lib.ID(f)) {
+					liked = append(liked, f)
 				}
 			}
+			// Best rated first
+			sort.SliceStable(liked, func(i, j int) bool {
+				return trackRating(lib, st, liked[i]) > trackRating(lib, st, liked[j])
+			})
+			view = filterView(liked)
 		case "Playlist":
-			homeBox.Hide()
-			exploreArea.Show()
-			settingsBox.Hide()
-			view = view[:0]
-			for _, f := range st.Playlists[currentPlaylist] {
-				if q == "" || strings.Contains(strings.ToLower(filepath.Base(f)), q) {
-					view = append(view, f)
-				}
-			}
+			showPage(exploreArea)
+			ids, _, _ := st.Playlist(currentPlaylist)
+			view = filterView(lib.Paths(ids))
+		case "Akıllı":
+			showPage(exploreArea)
+			pl, _ := st.SmartPlaylist(currentPlaylist)
+			view = filterView(smart.Evaluate(currentPlaylist, pl, smartItems(lib, st)))
 		default: // Keşfet
-			homeBox.Hide()
-			exploreArea.Show()
-			settingsBox.Hide()
+			showPage(exploreArea)
 			// Don't filter online results
 			if showingOnline {
 				return
 			}
-			view = view[:0]
-			for _, f := range files {
-				if q == "" || strings.Contains(strings.ToLower(filepath.Base(f)), q) {
-					view = append(view, f)
-				}
-			}
+			view = filterView(files)
 		}
 		// Try to keep selection if it still exists in current view
 		if selected != "" {
@@ -798,6 +1595,43 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 		}
 	}
 
+	// Redraw what shows the state whenever it changes, wherever the change
+	// came from. Notifications are queued behind the callback that made the
+	// change, so a page it switches to is already current here.
+	st.Subscribe(func(c state.Change) {
+		fyne.Do(func() {
+			if c&(state.ChangePlaylists|state.ChangeSmartPlaylists) != 0 {
+				refreshPlaylists()
+			}
+			var redraw state.Change
+			switch currentPage {
+			case "Anasayfa":
+				if c&state.ChangeStats != 0 {
+					refreshHome()
+				}
+			case "Beğendiklerim":
+				redraw = state.ChangeLiked | state.ChangeRatings
+			case "Playlist":
+				redraw = state.ChangePlaylists
+				if _, _, ok := st.Playlist(currentPlaylist); !ok {
+					currentPage = "Keşfet" // deleted elsewhere
+				}
+			case "Akıllı":
+				// Rules can refer to likes, ratings and plays
+				redraw = state.ChangeSmartPlaylists | state.ChangeLiked | state.ChangeRatings | state.ChangeStats
+				if _, ok := st.SmartPlaylist(currentPlaylist); !ok {
+					currentPage = "Keşfet"
+				}
+			}
+			if c&redraw != 0 {
+				applyView()
+			}
+			if c&(redraw|state.ChangeRatings) != 0 {
+				list.Refresh()
+			}
+		})
+	})
+
 	searchEntry.OnChanged = func(s string) {
 		// Only apply filter for local files, not online
 		if !showingOnline {
@@ -812,10 +1646,14 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 		widget.NewSeparator(),
 		homeBtn,
 		exploreBtn,
+		browseBtn,
+		albumsBtn,
 		likedBtn,
 		settingsBtn,
 		widget.NewSeparator(),
 		addPlBtn,
+		addSmartBtn,
+		importPlBtn,
 		plBox,
 		widget.NewSeparator(),
 		refreshBtn,
@@ -830,6 +1668,124 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 
 	applyView()
 
+	// The session, where the user left off, is kept per profile next to
+	// its history.
+	sessionFile := func() string {
+		return filepath.Join(profiles.DataDir(profiles.Current()), "session.json")
+	}
+	saveSession = func() {
+		sess := &state.Session{
+			Volume: volSlider.Value,
+			Page:   currentPage,
+			Search: searchEntry.Text,
+			Splits: []float64{split.Offset, mid.Offset, nowPlaying.Offset},
+		}
+		if currentPage == "Playlist" || currentPage == "Akıllı" {
+			sess.Playlist = currentPlaylist
+		}
+		size := w.Canvas().Size()
+		sess.Width, sess.Height = size.Width, size.Height
+		if id := lib.ID(selected); id != "" {
+			sess.Track = id
+			if cur, err := p.CurrentFile(); err == nil && cur == selected {
+				sess.Position, _ = p.Position()
+			}
+		}
+		if pq != nil {
+			snap := pq.Snapshot().Map(func(path string) (string, bool) {
+				id := lib.ID(path)
+				return id, id != ""
+			})
+			sess.Queue = &snap
+		}
+		if err := state.SaveSession(sessionFile(), sess); err != nil {
+			fmt.Fprintln(os.Stderr, "session:", err)
+		}
+	}
+	// restoreSession brings back the last session, with the player paused
+	// where it was. Tracks deleted since are left out; without the selected
+	// track the queue starts from its next one.
+	restoreSession := func() {
+		sess, err := state.LoadSession(sessionFile())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "session:", err)
+		}
+		if sess == nil {
+			return
+		}
+		if sess.Width > 0 && sess.Height > 0 {
+			w.Resize(fyne.NewSize(sess.Width, sess.Height))
+		}
+		for i, sp := range []*container.Split{split, mid, nowPlaying} {
+			if i < len(sess.Splits) {
+				sp.SetOffset(sess.Splits[i])
+			}
+		}
+		volSlider.SetValue(sess.Volume)
+		switch sess.Page {
+		case "":
+		case "Playlist":
+			if _, _, ok := st.Playlist(sess.Playlist); ok {
+				currentPage, currentPlaylist = sess.Page, sess.Playlist
+			}
+		case "Akıllı":
+			if _, ok := st.SmartPlaylist(sess.Playlist); ok {
+				currentPage, currentPlaylist = sess.Page, sess.Playlist
+			}
+		default:
+			currentPage = sess.Page
+		}
+		// Also redraws the page
+		searchEntry.SetText(sess.Search)
+		applyView()
+		list.Refresh()
+
+		trackPath := func(id string) (string, bool) {
+			t, ok := lib.ByID(id)
+			return t.Path, ok
+		}
+		if sess.Queue != nil {
+			pq = queue.Restore(sess.Queue.Map(trackPath), st.Settings().Repeat, sessionSeed, queueInfo)
+		}
+		pos := sess.Position
+		track, ok := trackPath(sess.Track)
+		if !ok && pq != nil {
+			track, ok = pq.Current()
+			pos = 0
+		}
+		if !ok || strings.ToLower(filepath.Ext(track)) == ".mp4" {
+			return
+		}
+		if err := loadAudio(track); err != nil {
+			fmt.Fprintln(os.Stderr, "session:", err)
+			return
+		}
+		_ = p.SeekTo(pos)
+		selected = track
+		currentTrack.SetText(fileLabel(lib, track))
+		ratingStars.SetValue(trackRating(lib, st, track))
+		progress.Enable()
+		if dur, err := p.Duration(); err == nil && dur > 0 {
+			updatingProgress = true
+			posLabel.SetText(formatDur(pos))
+			durLabel.SetText(formatDur(dur))
+			progress.SetValue(clamp01(float64(pos) / float64(dur)))
+			updatingProgress = false
+		}
+		announceNext()
+		updateInfo(track)
+		loadLyrics(track)
+		updateLyrics(pos)
+	}
+	restoreSession()
+	w.SetOnClosed(saveSession)
+	// Also save every so often, in case the app does not get to close
+	go func() {
+		for range time.Tick(30 * time.Second) {
+			fyne.Do(saveSession)
+		}
+	}()
+
 	// UI ticker to update audio and video progress
 	ticker := time.NewTicker(200 * time.Millisecond)
 	go func() {
@@ -846,6 +1802,10 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 						durLabel.SetText(formatDur(dur))
 						progress.SetValue(pr)
 						updatingProgress = false
+						updateLyrics(pos)
+						if cur, err := p.CurrentFile(); err == nil {
+							listening.Observe(cur, pos)
+						}
 					})
 				}
 				continue
@@ -868,7 +1828,14 @@ likedBtn := widget.NewButtonWithIcon("Beğendiklerim", theme.InfoIcon(), func()
 		}
 	}()
 
+	if profiles.AskOnStart() && len(profiles.List()) > 1 {
+		chooseProfile(w, profiles, switchProfile)
+	}
 	w.ShowAndRun()
+	endPlay(history.Interrupted)
+	if err := stateSaver.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "state:", err)
+	}
 }
 
 func formatDur(d time.Duration) string {
@@ -881,19 +1848,110 @@ func formatDur(d time.Duration) string {
 	return fmt.Sprintf("%02d:%02d", m, ss)
 }
 
-func downloadImage(u string) (image.Image, error) {
-	resp, err := http.Get(u)
+// downloadImage returns the image at u, through the cache c.
+func downloadImage(c *meta.Cache, u string) (image.Image, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	b, err := c.Image(ctx, u)
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	img, _, err := image.Decode(resp.Body)
+	img, _, err := image.Decode(bytes.NewReader(b))
 	if err != nil {
 		return nil, err
 	}
 	return img, nil
 }
 
+// fileLabel is the file name of path, or the generated name of an untitled
+// CUE sheet track.
+func fileLabel(lib *library.Index, path string) string {
+	if t, ok := lib.Get(path); ok && t.File != "" {
+		return t.DisplayTitle()
+	}
+	return filepath.Base(path)
+}
+
+// rowLabel is the list text for a local file: "Title — Artist" when tagged,
+// otherwise the file name.
+func rowLabel(lib *library.Index, path string) string {
+	t, ok := lib.Get(path)
+	if !ok || t.Title == "" {
+		return fileLabel(lib, path)
+	}
+	if t.Artist != "" {
+		return t.Title + " — " + t.Artist
+	}
+	return t.Title
+}
+
+// highlightSegments renders text with the given byte ranges in bold.
+func highlightSegments(text string, spans []search.Span) []widget.RichTextSegment {
+	var segs []widget.RichTextSegment
+	add := func(s string, style widget.RichTextStyle) {
+		if s != "" {
+			segs = append(segs, &widget.TextSegment{Text: s, Style: style})
+		}
+	}
+	last := 0
+	for _, sp := range spans {
+		add(text[last:sp.Start], widget.RichTextStyleInline)
+		add(text[sp.Start:sp.End], widget.RichTextStyleStrong)
+		last = sp.End
+	}
+	add(text[last:], widget.RichTextStyleInline)
+	return segs
+}
+
+// smartItems collects the library tracks with the per-user data smart
+// playlist rules can refer to.
+func smartItems(lib *library.Index, st *state.Store) []smart.Item {
+	ts := lib.Tracks()
+	items := make([]smart.Item, len(ts))
+	st.View(func(s *state.State) {
+		for i, t := range ts {
+			ps := s.Stats[t.ID]
+			items[i] = smart.Item{Track: t, Liked: s.Liked[t.ID], Rating: s.Rating(t.ID, t.Rating), Plays: ps.Plays, LastPlayed: ps.LastPlayed}
+		}
+	})
+	return items
+}
+
+// trackRating returns the stars of path: the user's rating or the one in
+// the file's tags.
+func trackRating(lib *library.Index, st *state.Store, path string) int {
+	t, _ := lib.Get(path)
+	return st.Rating(t.ID, t.Rating)
+}
+
+// searchDoc describes a local file for the search engine.
+func searchDoc(lib *library.Index, st *state.Store, path string) search.Doc {
+	t, _ := lib.Get(path)
+	d := search.Doc{
+		ID: path,
+		Text: map[string]string{
+			"title":       t.DisplayTitle(),
+			"artist":      t.Artist,
+			"albumartist": t.AlbumArtist,
+			"album":       t.Album,
+			"genre":       t.Genre,
+			"file":        filepath.Base(path),
+			"ext":         t.Ext(),
+		},
+		Numbers: map[string]float64{
+			"duration": t.Duration.Seconds(),
+			"rating":   float64(st.Rating(t.ID, t.Rating)),
+			"plays":    float64(st.Stats(t.ID).Plays),
+		},
+		Flags: map[string]bool{"liked": st.Liked(t.ID)},
+	}
+	if t.Year > 0 {
+		// Untagged files must not match year:<2000
+		d.Numbers["year"] = float64(t.Year)
+	}
+	return d
+}
+
 func clamp01(v float64) float64 {
 	if v < 0 {
 		return 0
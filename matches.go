@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/library"
+	"opentify/internal/meta"
+	"opentify/internal/state"
+)
+
+// metaCacheSize bounds the disk space of online metadata and artwork.
+const metaCacheSize = 256 << 20
+
+// lookupFor describes the local file path for a metadata lookup: what is
+// known of it, to score candidates with, and the query for them.
+func lookupFor(lib *library.Index, path string) (meta.Want, meta.Query) {
+	want := meta.Want{File: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+	q := meta.Query{Term: want.File, Limit: 5}
+	t, ok := lib.Get(path)
+	if !ok {
+		return want, q
+	}
+	want.Duration = t.Duration
+	if t.Title != "" {
+		want.Artist, want.Title, want.Album = t.PrimaryArtist(), t.Title, t.Album
+		q.Artist, q.Title, q.Album = want.Artist, want.Title, want.Album
+	} else if t.File != "" {
+		q.Term = t.PrimaryArtist() + " " + t.DisplayTitle()
+	}
+	return want, q
+}
+
+// matchInfo is a match the user picked, as a lookup result.
+func matchInfo(m state.Match) meta.Info {
+	return meta.Info{Title: m.Title, Artist: m.Artist, Album: m.Album, Artwork: m.Artwork, Source: m.Source}
+}
+
+// showFixMatch lists the candidates of the providers for track id so the
+// user can pick its metadata, which is then remembered; the artwork comes
+// through cache. apply shows the metadata picked; reset, called when the
+// user goes back to the automatic lookup, redoes it.
+func showFixMatch(w fyne.Window, st *state.Store, cache *meta.Cache, id string, want meta.Want, q meta.Query, providers []meta.Provider, apply func(meta.Info), reset func()) {
+	var cands []meta.Candidate
+	chosen := -1
+	thumbs := map[string]image.Image{}
+	loading := map[string]bool{}
+
+	status := widget.NewLabel("")
+	var list *widget.List
+	list = widget.NewList(
+		func() int { return len(cands) },
+		func() fyne.CanvasObject {
+			img := canvas.NewImageFromImage(nil)
+			img.FillMode = canvas.ImageFillContain
+			img.SetMinSize(fyne.NewSize(56, 56))
+			title := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+			title.Truncation = fyne.TextTruncateEllipsis
+			detail := widget.NewLabel("")
+			detail.Truncation = fyne.TextTruncateEllipsis
+			return container.NewBorder(nil, nil, img, nil, container.NewVBox(title, detail))
+		},
+		func(i widget.ListItemID, o fyne.CanvasObject) {
+			c := cands[i]
+			row := o.(*fyne.Container)
+			text := row.Objects[0].(*fyne.Container)
+			img := row.Objects[1].(*canvas.Image)
+			text.Objects[0].(*widget.Label).SetText(c.Title + " — " + c.Artist)
+			parts := []string{c.Source}
+			if c.Album != "" {
+				parts = append(parts, c.Album)
+			}
+			if c.Duration > 0 {
+				parts = append(parts, formatDur(c.Duration))
+			}
+			parts = append(parts, fmt.Sprintf("%%%d uyum", int(c.Score*100+0.5)))
+			text.Objects[1].(*widget.Label).SetText(strings.Join(parts, " · "))
+			img.Image = thumbs[c.Artwork]
+			img.Refresh()
+			if c.Artwork != "" && img.Image == nil && !loading[c.Artwork] {
+				loading[c.Artwork] = true
+				go func(u string) {
+					thumb, err := downloadImage(cache, u)
+					if err != nil {
+						return
+					}
+					fyne.Do(func() {
+						thumbs[u] = thumb
+						list.Refresh()
+					})
+				}(c.Artwork)
+			}
+		},
+	)
+	list.OnSelected = func(i widget.ListItemID) { chosen = i }
+
+	search := func(q meta.Query) {
+		cands, chosen = nil, -1
+		list.UnselectAll()
+		list.Refresh()
+		status.SetText("Aranıyor...")
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			infos, err := meta.Search(ctx, providers, q)
+			fyne.Do(func() {
+				switch {
+				case len(providers) == 0:
+					status.SetText("Tüm parça bilgisi kaynakları kapalı.")
+				case err != nil && len(infos) == 0:
+					status.SetText("Sonuç bulunamadı.")
+				default:
+					cands = meta.Rank(infos, want)
+					status.SetText(fmt.Sprintf("%d aday", len(cands)))
+				}
+				list.Refresh()
+			})
+		}()
+	}
+	entry := widget.NewEntry()
+	entry.SetPlaceHolder("Sanatçı ve parça adı")
+	if q.Title != "" {
+		entry.SetText(strings.TrimSpace(q.Artist + " " + q.Title))
+	} else {
+		entry.SetText(q.Term)
+	}
+	searchAgain := func() {
+		if text := strings.TrimSpace(entry.Text); text != "" {
+			search(meta.Query{Term: text, Limit: 10})
+		}
+	}
+	entry.OnSubmitted = func(string) { searchAgain() }
+	searchBtn := widget.NewButton("Ara", searchAgain)
+
+	var d *dialog.CustomDialog
+	autoBtn := widget.NewButton("Otomatik eşleşmeye dön", func() {
+		st.ClearMatch(id)
+		d.Hide()
+		reset()
+	})
+	if _, ok := st.Match(id); !ok {
+		autoBtn.Disable()
+	}
+	useBtn := widget.NewButton("Kullan", func() {
+		if chosen < 0 || chosen >= len(cands) {
+			return
+		}
+		c := cands[chosen].Info
+		st.SetMatch(id, state.Match{Title: c.Title, Artist: c.Artist, Album: c.Album, Artwork: c.Artwork, Source: c.Source})
+		d.Hide()
+		apply(c)
+	})
+	content := container.NewBorder(
+		container.NewBorder(nil, status, nil, searchBtn, entry),
+		nil, nil, nil,
+		list,
+	)
+	d = dialog.NewCustomWithoutButtons("Eşleşmeyi Düzelt", content, w)
+	d.SetButtons([]fyne.CanvasObject{
+		widget.NewButton("İptal", func() { d.Hide() }),
+		autoBtn,
+		useBtn,
+	})
+	d.Resize(fyne.NewSize(560, 440))
+	d.Show()
+	search(q)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/library"
+	"opentify/internal/organize"
+	"opentify/internal/state"
+)
+
+// showOrganizer opens the "organize library" tool. It previews where every
+// file under root would go for a tag template and, once confirmed, moves
+// them. applied receives the old -> new paths of the files that moved after
+// the index and st have been updated.
+func showOrganizer(w fyne.Window, root string, lib *library.Index, st *state.Store, applied func(renames map[string]string)) {
+	tmplEntry := widget.NewEntry()
+	tmplEntry.SetText(st.Settings().OrganizeTemplate)
+	if tmplEntry.Text == "" {
+		tmplEntry.SetText(organize.DefaultTemplate)
+	}
+	help := widget.NewLabel("Alanlar: {title} {artist} {albumartist} {album} {genre} {year} {track} {disc} {ext} {filename}; sayılar için {track:02}. Klasörler \"/\" ile ayrılır.")
+	help.Wrapping = fyne.TextWrapWord
+	conflictSel := widget.NewSelect([]string{"Sonuna numara ekle", "Dosyayı atla"}, nil)
+	conflictSel.SetSelectedIndex(0)
+
+	var ops []organize.Op
+	var shown []organize.Op // ops that change something
+	summary := widget.NewLabel("Önizlemek için \"Önizle\"ye basın.")
+	rel := func(p string) string {
+		if r, err := filepath.Rel(root, p); err == nil {
+			return r
+		}
+		return p
+	}
+	preview := widget.NewList(
+		func() int { return len(shown) },
+		func() fyne.CanvasObject {
+			from := widget.NewLabel("")
+			from.Truncation = fyne.TextTruncateEllipsis
+			to := widget.NewLabel("")
+			to.Truncation = fyne.TextTruncateEllipsis
+			return container.NewGridWithColumns(2, from, to)
+		},
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			op := shown[id]
+			c := o.(*fyne.Container)
+			c.Objects[0].(*widget.Label).SetText(rel(op.From))
+			to := "→ " + rel(op.To)
+			switch op.Status {
+			case organize.Renamed:
+				to += "  (çakışma, yeniden adlandırıldı)"
+			case organize.Skipped:
+				to = "✕ atlandı: " + rel(op.To) + " mevcut"
+			}
+			if len(op.Sidecars) > 0 && op.Status != organize.Skipped {
+				to += "  + şarkı sözü (.lrc)"
+			}
+			c.Objects[1].(*widget.Label).SetText(to)
+		},
+	)
+
+	var applyBtn *widget.Button
+	previewBtn := widget.NewButton("Önizle", func() {
+		t, err := organize.Parse(tmplEntry.Text)
+		if err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		conflict := organize.RenameOnConflict
+		if conflictSel.SelectedIndex() == 1 {
+			conflict = organize.SkipOnConflict
+		}
+		ops = organize.Plan(root, lib.Tracks(), t, conflict)
+		shown = shown[:0]
+		counts := map[organize.Status]int{}
+		lyrics := 0
+		for _, op := range ops {
+			counts[op.Status]++
+			if op.Status != organize.Unchanged {
+				shown = append(shown, op)
+			}
+			if op.Status == organize.Move || op.Status == organize.Renamed {
+				lyrics += len(op.Sidecars)
+			}
+		}
+		text := fmt.Sprintf("%d taşınacak, %d çakışma numaralandırılacak, %d atlanacak, %d zaten yerinde.",
+			counts[organize.Move]+counts[organize.Renamed], counts[organize.Renamed], counts[organize.Skipped], counts[organize.Unchanged])
+		if lyrics > 0 {
+			text += fmt.Sprintf(" %d şarkı sözü dosyası (.lrc) parçasıyla birlikte taşınacak.", lyrics)
+		}
+		summary.SetText(text)
+		preview.Refresh()
+		if counts[organize.Move]+counts[organize.Renamed] > 0 {
+			applyBtn.Enable()
+		} else {
+			applyBtn.Disable()
+		}
+	})
+	// Any change to the settings invalidates the preview.
+	tmplEntry.OnChanged = func(string) { applyBtn.Disable() }
+	conflictSel.OnChanged = func(string) { applyBtn.Disable() }
+
+	var d dialog.Dialog
+	applyBtn = widget.NewButton("Uygula", func() {
+		dialog.ShowConfirm("Kütüphaneyi düzenle", "Dosyalar önizlemedeki gibi taşınacak. Devam edilsin mi?", func(ok bool) {
+			if !ok {
+				return
+			}
+			st.UpdateSettings(func(set *state.Settings) { set.OrganizeTemplate = tmplEntry.Text })
+			bar := widget.NewProgressBar()
+			prog := dialog.NewCustomWithoutButtons("Dosyalar taşınıyor", bar, w)
+			prog.Show()
+			todo := ops
+			go func() {
+				done, err := organize.Apply(root, todo, func(n, total int) {
+					fyne.Do(func() { bar.SetValue(float64(n) / float64(total)) })
+				})
+				renames := organize.Renames(done)
+				ierr := lib.Move(renames)
+				fyne.Do(func() {
+					prog.Hide()
+					applied(renames)
+					if err != nil {
+						dialog.ShowError(fmt.Errorf("%d dosya taşındı, sonra hata: %w", len(done), err), w)
+					} else if ierr != nil {
+						dialog.ShowError(ierr, w)
+					} else {
+						dialog.ShowInformation("Kütüphaneyi düzenle", fmt.Sprintf("%d dosya taşındı.", len(done)), w)
+					}
+					d.Hide()
+				})
+			}()
+		}, w)
+	})
+	applyBtn.Disable()
+
+	top := container.NewVBox(
+		widget.NewForm(
+			widget.NewFormItem("Şablon", tmplEntry),
+			widget.NewFormItem("Çakışmada", conflictSel),
+		),
+		help,
+		container.NewHBox(previewBtn, applyBtn),
+		summary,
+	)
+	d = dialog.NewCustom("Kütüphaneyi Düzenle", "Kapat", container.NewBorder(top, nil, nil, nil, preview), w)
+	d.Resize(fyne.NewSize(900, 600))
+	d.Show()
+}
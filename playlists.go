@@ -0,0 +1,422 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/artwork"
+	"opentify/internal/library"
+	"opentify/internal/playlistio"
+	"opentify/internal/state"
+)
+
+const playlistCoverSize = 120
+
+// trackRow wraps a row of the track list so it can be dragged to a new
+// position and offers a context menu on right click. Taps still reach the
+// list, which handles selection.
+type trackRow struct {
+	widget.BaseWidget
+	content fyne.CanvasObject
+	id      widget.ListItemID
+	dy      float32
+
+	// OnDrop moves row from to row to; nil disables dragging.
+	OnDrop func(from, to int)
+	// OnMenu opens the context menu of row id at pos.
+	OnMenu func(id widget.ListItemID, pos fyne.Position)
+}
+
+func newTrackRow(content fyne.CanvasObject) *trackRow {
+	r := &trackRow{content: content}
+	r.ExtendBaseWidget(r)
+	return r
+}
+
+func (r *trackRow) Dragged(e *fyne.DragEvent) {
+	if r.OnDrop == nil {
+		return
+	}
+	r.dy += e.Dragged.DY
+	// Lift the row a little so the drag is visible
+	r.content.Move(fyne.NewPos(0, r.dy))
+}
+
+func (r *trackRow) DragEnd() {
+	dy := r.dy
+	r.dy = 0
+	r.content.Move(fyne.NewPos(0, 0))
+	if r.OnDrop == nil {
+		return
+	}
+	// Rows are separated by a padding-wide divider.
+	step := r.Size().Height + theme.Padding()
+	if n := int(math.Round(float64(dy / step))); n != 0 {
+		r.OnDrop(r.id, max(0, r.id+n))
+	}
+}
+
+func (r *trackRow) TappedSecondary(e *fyne.PointEvent) {
+	if r.OnMenu != nil {
+		r.OnMenu(r.id, e.AbsolutePosition)
+	}
+}
+
+func (r *trackRow) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(r.content)
+}
+
+// playlistError turns the state package's playlist errors into messages
+// for the user.
+func playlistError(err error) error {
+	switch {
+	case errors.Is(err, state.ErrPlaylistExists):
+		return errors.New("bu adla bir playlist zaten var")
+	case errors.Is(err, state.ErrPlaylistName):
+		return errors.New("playlist adı boş olamaz")
+	case errors.Is(err, state.ErrNoPlaylist):
+		return errors.New("playlist bulunamadı")
+	}
+	return err
+}
+
+// addToPlaylistMenu is the "Playliste ekle" submenu for the tracks ids, one
+// item per playlist.
+func addToPlaylistMenu(w fyne.Window, st *state.Store, ids []string) *fyne.MenuItem {
+	var items []*fyne.MenuItem
+	for _, name := range st.PlaylistNames() {
+		n := name
+		items = append(items, fyne.NewMenuItem(n, func() {
+			k, err := st.AddToPlaylist(n, ids...)
+			if err != nil {
+				dialog.ShowError(playlistError(err), w)
+				return
+			}
+			if k == 0 {
+				dialog.ShowInformation("Playliste Ekle", fmt.Sprintf("Parça zaten %q listesinde.", n), w)
+			}
+		}))
+	}
+	item := fyne.NewMenuItem("Playliste ekle", nil)
+	if len(items) == 0 {
+		item.Disabled = true
+	}
+	item.ChildMenu = fyne.NewMenu("", items...)
+	return item
+}
+
+// newPlaylistHeader builds the header of the playlist view: cover, name,
+// description and dates, with play buttons and a menu to rename, describe,
+// duplicate, dedupe or delete the playlist. changed is called with the name
+// to show after an edit, "" when the playlist was deleted. The returned
+// func shows a playlist.
+func newPlaylistHeader(w fyne.Window, lib *library.Index, st *state.Store, art *artwork.Cache, play func(paths []string, start int, shuffle bool), changed func(name string)) (fyne.CanvasObject, func(name string)) {
+	var current string
+
+	cover := canvas.NewImageFromResource(theme.MediaMusicIcon())
+	cover.FillMode = canvas.ImageFillContain
+	cover.SetMinSize(fyne.NewSize(playlistCoverSize, playlistCoverSize))
+	nameLbl := widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	nameLbl.Wrapping = fyne.TextTruncate
+	descLbl := widget.NewLabel("")
+	descLbl.Wrapping = fyne.TextWrapWord
+	infoLbl := widget.NewLabel("")
+	infoLbl.Wrapping = fyne.TextTruncate
+
+	setCover := func(name string, info state.PlaylistInfo, paths []string) {
+		cover.File, cover.Image, cover.Resource = "", nil, theme.MediaMusicIcon()
+		if info.Cover != "" {
+			cover.Resource, cover.File = nil, info.Cover
+			cover.Refresh()
+			return
+		}
+		cover.Refresh()
+		var files []string
+		for _, p := range paths {
+			t, _ := lib.Get(p)
+			files = append(files, t.AudioFile())
+			if len(files) == 3 {
+				break
+			}
+		}
+		if len(files) == 0 {
+			return
+		}
+		key := "file:" + files[0]
+		go func() {
+			th, err := art.Thumbnail(key, files)
+			if err != nil {
+				return
+			}
+			fyne.Do(func() {
+				if current != name || cover.File != "" {
+					return
+				}
+				cover.Resource, cover.Image = nil, th
+				cover.Refresh()
+			})
+		}()
+	}
+
+	show := func(name string) {
+		current = name
+		ids, info, _ := st.Playlist(name)
+		paths := lib.Paths(ids)
+		nameLbl.SetText(name)
+		descLbl.SetText(info.Description)
+		if info.Description == "" {
+			descLbl.Hide()
+		} else {
+			descLbl.Show()
+		}
+		var total time.Duration
+		for _, p := range paths {
+			t, _ := lib.Get(p)
+			total += t.Duration
+		}
+		text := fmt.Sprintf("%d parça · %s", len(paths), formatDur(total))
+		if !info.Created.IsZero() {
+			text += " · Oluşturuldu " + info.Created.Format("02.01.2006")
+		}
+		if !info.Modified.IsZero() && !info.Modified.Equal(info.Created) {
+			text += " · Değiştirildi " + info.Modified.Format("02.01.2006 15:04")
+		}
+		infoLbl.SetText(text)
+		setCover(name, info, paths)
+	}
+
+	rename := func() {
+		entry := widget.NewEntry()
+		entry.SetText(current)
+		dialog.ShowForm("Yeniden Adlandır", "Kaydet", "İptal", []*widget.FormItem{widget.NewFormItem("Ad", entry)}, func(ok bool) {
+			if !ok {
+				return
+			}
+			name, err := st.RenamePlaylist(current, entry.Text)
+			if err != nil {
+				dialog.ShowError(playlistError(err), w)
+				return
+			}
+			changed(name)
+		}, w)
+	}
+	describe := func() {
+		_, info, _ := st.Playlist(current)
+		entry := widget.NewMultiLineEntry()
+		entry.SetText(info.Description)
+		entry.SetMinRowsVisible(4)
+		dialog.ShowForm("Açıklama", "Kaydet", "İptal", []*widget.FormItem{widget.NewFormItem("Açıklama", entry)}, func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := st.SetPlaylistDescription(current, entry.Text); err != nil {
+				dialog.ShowError(playlistError(err), w)
+				return
+			}
+			changed(current)
+		}, w)
+	}
+	chooseCover := func() {
+		name := current
+		d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil || r == nil {
+				return
+			}
+			_ = r.Close()
+			if err := st.SetPlaylistCover(name, r.URI().Path()); err != nil {
+				dialog.ShowError(playlistError(err), w)
+				return
+			}
+			changed(name)
+		}, w)
+		d.SetFilter(storage.NewExtensionFileFilter([]string{".jpg", ".jpeg", ".png"}))
+		d.Show()
+	}
+	resetCover := func() {
+		if err := st.SetPlaylistCover(current, ""); err == nil {
+			changed(current)
+		}
+	}
+	duplicate := func() {
+		name, err := st.DuplicatePlaylist(current)
+		if err != nil {
+			dialog.ShowError(playlistError(err), w)
+			return
+		}
+		changed(name)
+	}
+	dedupe := func() {
+		n, err := st.DedupePlaylist(current)
+		if err != nil {
+			dialog.ShowError(playlistError(err), w)
+			return
+		}
+		if n == 0 {
+			dialog.ShowInformation("Tekrarları Kaldır", "Listede tekrar eden parça yok.", w)
+			return
+		}
+		changed(current)
+		dialog.ShowInformation("Tekrarları Kaldır", fmt.Sprintf("%d tekrar kaldırıldı.", n), w)
+	}
+	export := func() { showPlaylistExport(w, lib, st, current) }
+	remove := func() {
+		name := current
+		dialog.ShowConfirm("Playlisti Sil", fmt.Sprintf("%q silinsin mi?", name), func(ok bool) {
+			if !ok {
+				return
+			}
+			if err := st.DeletePlaylist(name); err != nil {
+				dialog.ShowError(playlistError(err), w)
+				return
+			}
+			changed("")
+		}, w)
+	}
+
+	playAll := func(shuffle bool) {
+		ids, _, _ := st.Playlist(current)
+		play(lib.Paths(ids), 0, shuffle)
+	}
+	playBtn := widget.NewButtonWithIcon("Tümünü Çal", theme.MediaPlayIcon(), func() { playAll(false) })
+	shuffleBtn := widget.NewButtonWithIcon("Karıştır", theme.MediaReplayIcon(), func() { playAll(true) })
+	var moreBtn *widget.Button
+	moreBtn = widget.NewButtonWithIcon("", theme.MoreHorizontalIcon(), func() {
+		menu := fyne.NewMenu("",
+			fyne.NewMenuItem("Yeniden adlandır...", rename),
+			fyne.NewMenuItem("Açıklamayı düzenle...", describe),
+			fyne.NewMenuItem("Kapak seç...", chooseCover),
+			fyne.NewMenuItem("Kapağı kaldır", resetCover),
+			fyne.NewMenuItemSeparator(),
+			fyne.NewMenuItem("Kopyasını oluştur", duplicate),
+			fyne.NewMenuItem("Tekrarları kaldır", dedupe),
+			fyne.NewMenuItem("Dışa aktar...", export),
+			fyne.NewMenuItemSeparator(),
+			fyne.NewMenuItem("Sil...", remove),
+		)
+		pos := fyne.CurrentApp().Driver().AbsolutePositionForObject(moreBtn)
+		widget.ShowPopUpMenuAtPosition(menu, w.Canvas(), pos.AddXY(0, moreBtn.Size().Height))
+	})
+
+	header := container.NewBorder(nil, widget.NewSeparator(), cover, nil,
+		container.NewVBox(nameLbl, descLbl, infoLbl, container.NewHBox(playBtn, shuffleBtn, moreBtn)))
+	return header, show
+}
+
+// playlistFormats are the export formats, in display order.
+var playlistFormats = []struct{ format, label string }{
+	{playlistio.M3U8, "M3U8 (UTF-8)"},
+	{playlistio.M3U, "M3U"},
+	{playlistio.PLS, "PLS"},
+	{playlistio.XSPF, "XSPF"},
+}
+
+// showPlaylistImport asks for a playlist file and adds it as a new
+// playlist named after it. Entries that are not in the library are listed
+// afterwards. done receives the name of the new playlist.
+func showPlaylistImport(w fyne.Window, lib *library.Index, st *state.Store, done func(name string)) {
+	d := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+		if err != nil || r == nil {
+			return
+		}
+		_ = r.Close()
+		path := r.URI().Path()
+		pl, err := playlistio.ReadFile(path)
+		if err != nil {
+			dialog.ShowError(fmt.Errorf("playlist okunamadı: %w", err), w)
+			return
+		}
+		res := playlistio.Match(pl, filepath.Dir(path), lib.Tracks())
+		title := strings.TrimSpace(pl.Title)
+		if title == "" {
+			title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		name, err := st.CreatePlaylist(title)
+		for i := 2; errors.Is(err, state.ErrPlaylistExists); i++ {
+			name, err = st.CreatePlaylist(title + " (" + strconv.Itoa(i) + ")")
+		}
+		if err != nil {
+			dialog.ShowError(playlistError(err), w)
+			return
+		}
+		ids := make([]string, 0, len(res.Paths))
+		for _, p := range res.Paths {
+			ids = append(ids, lib.ID(p))
+		}
+		added, _ := st.AddToPlaylist(name, ids...)
+		done(name)
+
+		msg := fmt.Sprintf("%q: %d parça eklendi.", name, added)
+		if len(res.Unmatched) == 0 {
+			dialog.ShowInformation("Playlist İçe Aktar", msg, w)
+			return
+		}
+		var lines []string
+		for _, e := range res.Unmatched {
+			lines = append(lines, e.Label())
+		}
+		missing := widget.NewLabel(strings.Join(lines, "\n"))
+		scroll := container.NewVScroll(missing)
+		scroll.SetMinSize(fyne.NewSize(420, 200))
+		content := container.NewBorder(
+			widget.NewLabel(msg+fmt.Sprintf(" Kütüphanede bulunamayan %d parça:", len(res.Unmatched))),
+			nil, nil, nil, scroll)
+		dialog.ShowCustom("Playlist İçe Aktar", "Tamam", content, w)
+	}, w)
+	d.SetFilter(storage.NewExtensionFileFilter([]string{".m3u", ".m3u8", ".pls", ".xspf"}))
+	d.Show()
+}
+
+// showPlaylistExport asks for a format and path style, then saves the
+// playlist name to a file.
+func showPlaylistExport(w fyne.Window, lib *library.Index, st *state.Store, name string) {
+	var labels []string
+	for _, f := range playlistFormats {
+		labels = append(labels, f.label)
+	}
+	formatSel := widget.NewSelect(labels, nil)
+	formatSel.SetSelectedIndex(0)
+	relative := widget.NewCheck("Göreli yollar (playlist dosyasının klasörüne göre)", nil)
+	relative.SetChecked(true)
+	dialog.ShowForm("Dışa Aktar", "Kaydet...", "İptal", []*widget.FormItem{
+		widget.NewFormItem("Biçim", formatSel),
+		widget.NewFormItem("", relative),
+	}, func(ok bool) {
+		if !ok {
+			return
+		}
+		format := playlistFormats[formatSel.SelectedIndex()].format
+		save := dialog.NewFileSave(func(wc fyne.URIWriteCloser, err error) {
+			if err != nil || wc == nil {
+				return
+			}
+			defer wc.Close()
+			var tracks []library.Track
+			ids, _, _ := st.Playlist(name)
+			for _, id := range ids {
+				// Missing files are kept at their last known path
+				if t, _ := lib.ByID(id); t.Path != "" {
+					tracks = append(tracks, t)
+				}
+			}
+			pl := playlistio.FromTracks(name, tracks, filepath.Dir(wc.URI().Path()), relative.Checked)
+			if err := playlistio.Write(wc, format, pl); err != nil {
+				dialog.ShowError(fmt.Errorf("playlist yazılamadı: %w", err), w)
+			}
+		}, w)
+		save.SetFileName(name + "." + format)
+		save.Show()
+	}, w)
+}
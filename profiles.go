@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/state"
+)
+
+// profileError turns the state package's profile errors into messages for
+// the user.
+func profileError(err error) error {
+	switch {
+	case errors.Is(err, state.ErrProfileExists):
+		return errors.New("bu adla bir profil zaten var")
+	case errors.Is(err, state.ErrProfileName):
+		return errors.New("profil adı boş olamaz, / \\ : * ? \" < > | içeremez ve nokta ile başlayamaz")
+	case errors.Is(err, state.ErrNoProfile):
+		return errors.New("profil bulunamadı")
+	case errors.Is(err, state.ErrProfileInUse):
+		return errors.New("kullanılan profil silinemez; önce başka bir profile geçin")
+	case errors.Is(err, state.ErrNewerVersion):
+		return errors.New("bu profilin verisi Opentify'ın daha yeni bir sürümüyle kaydedilmiş")
+	}
+	return err
+}
+
+// newProfileSettings is the profiles section of the settings page. use
+// switches to a profile, loading its files; release writes out what is
+// pending for the current profile, before its files are copied or moved.
+// changed is called whenever the profiles may have changed; so is refresh,
+// which shows a switch made elsewhere.
+func newProfileSettings(w fyne.Window, profiles *state.Profiles, release func() error, use func(name string) error, changed func()) (box fyne.CanvasObject, refresh func()) {
+	var sel *widget.Select
+	refresh = func() {
+		sel.Options = profiles.List()
+		sel.Selected = profiles.Current()
+		sel.Refresh()
+		changed()
+	}
+	sel = widget.NewSelect(nil, func(name string) {
+		if name == "" || name == profiles.Current() {
+			return
+		}
+		if err := use(name); err != nil {
+			dialog.ShowError(profileError(err), w)
+		}
+		refresh()
+	})
+	refresh()
+
+	askName := func(title, confirm, text string, done func(name string)) {
+		entry := widget.NewEntry()
+		entry.SetText(text)
+		dialog.ShowForm(title, confirm, "İptal", []*widget.FormItem{widget.NewFormItem("Ad", entry)}, func(ok bool) {
+			if ok {
+				done(entry.Text)
+			}
+		}, w)
+	}
+	newBtn := widget.NewButton("Yeni...", func() {
+		askName("Yeni Profil", "Oluştur", "", func(name string) {
+			name, err := profiles.Create(name)
+			if err != nil {
+				dialog.ShowError(profileError(err), w)
+				return
+			}
+			if err := use(name); err != nil {
+				dialog.ShowError(profileError(err), w)
+			}
+			refresh()
+		})
+	})
+	renameBtn := widget.NewButton("Yeniden Adlandır...", func() {
+		old := profiles.Current()
+		askName("Profili Yeniden Adlandır", "Kaydet", old, func(name string) {
+			if err := release(); err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			name, err := profiles.Rename(old, name)
+			if err != nil {
+				dialog.ShowError(profileError(err), w)
+				return
+			}
+			// Reopen the files at their new place
+			if err := use(name); err != nil {
+				dialog.ShowError(profileError(err), w)
+			}
+			refresh()
+		})
+	})
+	duplicateBtn := widget.NewButton("Çoğalt", func() {
+		if err := release(); err != nil {
+			dialog.ShowError(err, w)
+			return
+		}
+		if _, err := profiles.Duplicate(profiles.Current()); err != nil {
+			dialog.ShowError(profileError(err), w)
+		}
+		refresh()
+	})
+	deleteBtn := widget.NewButton("Sil...", func() {
+		var others []string
+		for _, name := range profiles.List() {
+			if name != profiles.Current() {
+				others = append(others, name)
+			}
+		}
+		if len(others) == 0 {
+			dialog.ShowInformation("Profil Sil", "Tek profil silinemez.", w)
+			return
+		}
+		pick := widget.NewSelect(others, nil)
+		pick.SetSelected(others[0])
+		dialog.ShowForm("Profil Sil", "Sil", "İptal", []*widget.FormItem{
+			widget.NewFormItem("Profil", pick),
+			widget.NewFormItem("", widget.NewLabel("Beğeniler, playlistler, geçmiş ve ayarlar kalıcı olarak silinir.")),
+		}, func(ok bool) {
+			if !ok || pick.Selected == "" {
+				return
+			}
+			if err := profiles.Delete(pick.Selected); err != nil {
+				dialog.ShowError(profileError(err), w)
+			}
+			refresh()
+		}, w)
+	})
+	askCheck := widget.NewCheck("Açılışta profil sor", func(on bool) {
+		if err := profiles.SetAskOnStart(on); err != nil {
+			dialog.ShowError(err, w)
+		}
+	})
+	askCheck.SetChecked(profiles.AskOnStart())
+
+	box = container.NewVBox(
+		container.NewBorder(nil, nil, widget.NewLabel("Profil"), nil, sel),
+		container.NewHBox(newBtn, renameBtn, duplicateBtn, deleteBtn),
+		askCheck,
+	)
+	return box, refresh
+}
+
+// chooseProfile asks which profile to use, for starts with "Açılışta
+// profil sor" on.
+func chooseProfile(w fyne.Window, profiles *state.Profiles, use func(name string) error) {
+	sel := widget.NewSelect(profiles.List(), nil)
+	sel.SetSelected(profiles.Current())
+	dialog.ShowForm("Profil Seç", "Aç", "İptal", []*widget.FormItem{widget.NewFormItem("Profil", sel)}, func(ok bool) {
+		if !ok || sel.Selected == "" || sel.Selected == profiles.Current() {
+			return
+		}
+		if err := use(sel.Selected); err != nil {
+			dialog.ShowError(profileError(err), w)
+		}
+	}, w)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"slices"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/meta"
+	"opentify/internal/state"
+)
+
+// providerOrder returns the built-in metadata providers in the order of
+// saved, with those it does not mention on at the end.
+func providerOrder(saved []state.MetaProvider) []state.MetaProvider {
+	var out []state.MetaProvider
+	for _, mp := range saved {
+		if slices.Contains(meta.Names, mp.Name) && !slices.ContainsFunc(out, func(o state.MetaProvider) bool { return o.Name == mp.Name }) {
+			out = append(out, mp)
+		}
+	}
+	for _, name := range meta.Names {
+		if !slices.ContainsFunc(out, func(o state.MetaProvider) bool { return o.Name == name }) {
+			out = append(out, state.MetaProvider{Name: name})
+		}
+	}
+	return out
+}
+
+// metaProviders returns the providers that are on in set, most preferred
+// first.
+func metaProviders(set state.Settings) []meta.Provider {
+	var out []meta.Provider
+	for _, mp := range providerOrder(set.MetaProviders) {
+		if !mp.Off {
+			out = append(out, meta.ByName(mp.Name))
+		}
+	}
+	return out
+}
+
+// newProviderSettings is the metadata section of the settings page: the
+// providers can be turned off and moved up or down in preference. refresh
+// shows settings changed elsewhere.
+func newProviderSettings(st *state.Store) (box fyne.CanvasObject, refresh func()) {
+	rows := container.NewVBox()
+	save := func(order []state.MetaProvider) {
+		st.UpdateSettings(func(set *state.Settings) { set.MetaProviders = order })
+		refresh()
+	}
+	refresh = func() {
+		order := providerOrder(st.Settings().MetaProviders)
+		rows.RemoveAll()
+		for i, mp := range order {
+			check := widget.NewCheck(mp.Name, nil)
+			check.SetChecked(!mp.Off)
+			check.OnChanged = func(on bool) {
+				order[i].Off = !on
+				save(order)
+			}
+			up := widget.NewButtonWithIcon("", theme.MoveUpIcon(), func() {
+				order[i-1], order[i] = order[i], order[i-1]
+				save(order)
+			})
+			down := widget.NewButtonWithIcon("", theme.MoveDownIcon(), func() {
+				order[i], order[i+1] = order[i+1], order[i]
+				save(order)
+			})
+			if i == 0 {
+				up.Disable()
+			}
+			if i == len(order)-1 {
+				down.Disable()
+			}
+			rows.Add(container.NewBorder(nil, nil, nil, container.NewHBox(up, down), check))
+		}
+		rows.Refresh()
+	}
+	refresh()
+	help := widget.NewLabel("Parça bilgisi ve kapak açık sağlayıcılarda aranır; aynı parçayı bulan sağlayıcılardan üstteki tercih edilir.")
+	help.Wrapping = fyne.TextWrapWord
+	return container.NewVBox(rows, help), refresh
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/search"
+)
+
+func init() {
+	search.RegisterNumberField("rating", "puan")
+	search.RegisterNumberField("plays", "çalınma")
+}
+
+// starRating shows 0..5 stars; tapping a star sets the rating, tapping the
+// current one clears it.
+type starRating struct {
+	widget.BaseWidget
+	value     int
+	stars     [5]*canvas.Text
+	OnChanged func(stars int)
+}
+
+func newStarRating(onChanged func(stars int)) *starRating {
+	s := &starRating{OnChanged: onChanged}
+	for i := range s.stars {
+		s.stars[i] = canvas.NewText("☆", theme.Color(theme.ColorNameForeground))
+		s.stars[i].TextSize = theme.TextSize() * 1.2
+	}
+	s.ExtendBaseWidget(s)
+	return s
+}
+
+// SetValue shows v stars without calling OnChanged.
+func (s *starRating) SetValue(v int) {
+	s.value = max(0, min(5, v))
+	for i, t := range s.stars {
+		if i < s.value {
+			t.Text = "★"
+			t.Color = theme.Color(theme.ColorNamePrimary)
+		} else {
+			t.Text = "☆"
+			t.Color = theme.Color(theme.ColorNameForeground)
+		}
+		t.Refresh()
+	}
+}
+
+func (s *starRating) Tapped(e *fyne.PointEvent) {
+	n := len(s.stars)
+	for i, t := range s.stars {
+		if e.Position.X < t.Position().X+t.Size().Width {
+			n = i + 1
+			break
+		}
+	}
+	if n == s.value {
+		n = 0
+	}
+	s.SetValue(n)
+	if s.OnChanged != nil {
+		s.OnChanged(n)
+	}
+}
+
+func (s *starRating) CreateRenderer() fyne.WidgetRenderer {
+	objs := make([]fyne.CanvasObject, len(s.stars))
+	for i, t := range s.stars {
+		objs[i] = t
+	}
+	s.SetValue(s.value)
+	return widget.NewSimpleRenderer(container.NewHBox(objs...))
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/smart"
+	"opentify/internal/state"
+)
+
+// smartFields are the rule fields offered by the editor, in display order.
+var smartFields = []struct{ key, label string }{
+	{state.FieldTitle, "Başlık"},
+	{state.FieldArtist, "Sanatçı"},
+	{state.FieldAlbumArtist, "Albüm sanatçısı"},
+	{state.FieldAlbum, "Albüm"},
+	{state.FieldGenre, "Tür"},
+	{state.FieldExt, "Format"},
+	{state.FieldYear, "Yıl"},
+	{state.FieldDuration, "Süre (sn)"},
+	{state.FieldPlays, "Çalınma sayısı"},
+	{state.FieldLastPlayed, "Son çalınma"},
+	{state.FieldAdded, "Eklenme tarihi"},
+	{state.FieldRating, "Puan"},
+	{state.FieldLiked, "Beğenildi"},
+}
+
+var smartOpLabels = map[string]string{
+	smart.OpContains:    "içerir",
+	smart.OpNotContains: "içermez",
+	smart.OpIs:          "eşittir",
+	smart.OpIsNot:       "eşit değil",
+	smart.OpStartsWith:  "ile başlar",
+	smart.OpGreater:     "büyüktür",
+	smart.OpLess:        "küçüktür",
+	smart.OpBetween:     "arasında",
+	smart.OpInLast:      "son N gün içinde",
+	smart.OpNotInLast:   "son N gün içinde değil",
+	smart.OpBefore:      "öncesinde (YYYY-AA-GG)",
+	smart.OpAfter:       "sonrasında (YYYY-AA-GG)",
+}
+
+var smartSortLabels = map[string]string{
+	"":                    "Dosya yolu",
+	state.FieldTitle:      "Başlık",
+	state.FieldArtist:     "Sanatçı",
+	state.FieldAlbum:      "Albüm",
+	state.FieldYear:       "Yıl",
+	state.FieldDuration:   "Süre",
+	state.FieldPlays:      "Çalınma sayısı",
+	state.FieldRating:     "Puan",
+	state.FieldAdded:      "Eklenme tarihi",
+	state.FieldLastPlayed: "Son çalınma",
+	"random":              "Rastgele",
+}
+
+// labelKey returns the key whose label is l.
+func labelKey(labels map[string]string, l string) string {
+	for k, v := range labels {
+		if v == l {
+			return k
+		}
+	}
+	return ""
+}
+
+// ruleRow is the editor row of a single rule.
+type ruleRow struct {
+	field  *widget.Select
+	op     *widget.Select
+	value  *widget.Entry
+	value2 *widget.Entry
+	box    *fyne.Container
+}
+
+func (r *ruleRow) rule() state.Rule {
+	field := ""
+	for _, f := range smartFields {
+		if f.label == r.field.Selected {
+			field = f.key
+		}
+	}
+	rule := state.Rule{Field: field, Op: labelKey(smartOpLabels, r.op.Selected), Value: strings.TrimSpace(r.value.Text)}
+	if rule.Op == smart.OpBetween {
+		rule.Value2 = strings.TrimSpace(r.value2.Text)
+	}
+	return rule
+}
+
+// showSmartEditor opens the smart playlist editor. name is "" for a new
+// playlist. save receives the (possibly renamed) playlist; remove is nil
+// when there is nothing to delete.
+func showSmartEditor(w fyne.Window, name string, pl state.SmartPlaylist, save func(oldName, newName string, pl state.SmartPlaylist), remove func()) {
+	nameEntry := widget.NewEntry()
+	nameEntry.SetText(name)
+
+	matchSel := widget.NewSelect([]string{"Tüm kurallar", "Herhangi bir kural"}, nil)
+	matchSel.SetSelectedIndex(0)
+	if pl.Match == "any" {
+		matchSel.SetSelectedIndex(1)
+	}
+
+	fieldLabels := make([]string, len(smartFields))
+	for i, f := range smartFields {
+		fieldLabels[i] = f.label
+	}
+
+	var rows []*ruleRow
+	rulesBox := container.NewVBox()
+	addRow := func(r state.Rule) {
+		row := &ruleRow{value: widget.NewEntry(), value2: widget.NewEntry()}
+		row.value2.SetPlaceHolder("bitiş")
+		row.op = widget.NewSelect(nil, func(s string) {
+			if labelKey(smartOpLabels, s) == smart.OpBetween {
+				row.value2.Show()
+			} else {
+				row.value2.Hide()
+			}
+		})
+		row.field = widget.NewSelect(fieldLabels, func(s string) {
+			kind := smart.Text
+			for _, f := range smartFields {
+				if f.label == s {
+					kind = smart.FieldKind(f.key)
+				}
+			}
+			ops := smart.Ops(kind)
+			labels := make([]string, len(ops))
+			for i, op := range ops {
+				labels[i] = smartOpLabels[op]
+			}
+			prev := row.op.Selected
+			row.op.Options = labels
+			row.op.ClearSelected()
+			for _, l := range labels {
+				if l == prev {
+					row.op.SetSelected(l)
+				}
+			}
+			if row.op.Selected == "" {
+				row.op.SetSelectedIndex(0)
+			}
+			if kind == smart.Bool {
+				row.value.SetPlaceHolder("evet / hayır")
+			} else {
+				row.value.SetPlaceHolder("")
+			}
+		})
+		for _, f := range smartFields {
+			if f.key == r.Field {
+				row.field.SetSelected(f.label)
+			}
+		}
+		if row.field.Selected == "" {
+			row.field.SetSelectedIndex(0)
+		}
+		if l, ok := smartOpLabels[r.Op]; ok {
+			row.op.SetSelected(l)
+		}
+		row.value.SetText(r.Value)
+		row.value2.SetText(r.Value2)
+		removeBtn := widget.NewButtonWithIcon("", theme.ContentRemoveIcon(), nil)
+		row.box = container.NewBorder(nil, nil, container.NewHBox(row.field, row.op), removeBtn,
+			container.NewGridWithColumns(2, row.value, row.value2))
+		removeBtn.OnTapped = func() {
+			for i, x := range rows {
+				if x == row {
+					rows = append(rows[:i], rows[i+1:]...)
+					break
+				}
+			}
+			rulesBox.Remove(row.box)
+		}
+		rows = append(rows, row)
+		rulesBox.Add(row.box)
+	}
+	for _, r := range pl.Rules {
+		addRow(r)
+	}
+	if len(pl.Rules) == 0 {
+		addRow(state.Rule{Field: state.FieldGenre, Op: smart.OpContains})
+	}
+	addRuleBtn := widget.NewButtonWithIcon("Kural ekle", theme.ContentAddIcon(), func() {
+		addRow(state.Rule{Field: state.FieldTitle, Op: smart.OpContains})
+	})
+
+	limitEntry := widget.NewEntry()
+	limitEntry.SetPlaceHolder("sınırsız")
+	if pl.Limit > 0 {
+		limitEntry.SetText(strconv.Itoa(pl.Limit))
+	}
+	sortOpts := make([]string, len(state.SmartSortFields))
+	for i, f := range state.SmartSortFields {
+		sortOpts[i] = smartSortLabels[f]
+	}
+	sortSel := widget.NewSelect(sortOpts, nil)
+	sortSel.SetSelected(smartSortLabels[pl.Sort])
+	if sortSel.Selected == "" {
+		sortSel.SetSelectedIndex(0)
+	}
+	descCheck := widget.NewCheck("Azalan", nil)
+	descCheck.SetChecked(pl.Desc)
+
+	form := widget.NewForm(
+		widget.NewFormItem("Ad", nameEntry),
+		widget.NewFormItem("Eşleşme", matchSel),
+		widget.NewFormItem("En fazla", limitEntry),
+		widget.NewFormItem("Sırala", container.NewHBox(sortSel, descCheck)),
+	)
+	content := container.NewVBox(form, widget.NewLabel("Kurallar"), rulesBox, addRuleBtn)
+
+	var dlg dialog.Dialog
+	if remove != nil {
+		content.Add(widget.NewSeparator())
+		content.Add(widget.NewButtonWithIcon("Listeyi sil", theme.DeleteIcon(), func() {
+			dialog.ShowConfirm("Akıllı listeyi sil", "\""+name+"\" silinsin mi?", func(ok bool) {
+				if ok {
+					dlg.Hide()
+					remove()
+				}
+			}, w)
+		}))
+	}
+
+	title := "Yeni Akıllı Liste"
+	if name != "" {
+		title = "Akıllı Listeyi Düzenle"
+	}
+	dlg = dialog.NewCustomConfirm(title, "Kaydet", "İptal", container.NewVScroll(content), func(ok bool) {
+		if !ok {
+			return
+		}
+		newName := strings.TrimSpace(nameEntry.Text)
+		if newName == "" {
+			return
+		}
+		out := state.SmartPlaylist{Match: "all", Sort: labelKey(smartSortLabels, sortSel.Selected), Desc: descCheck.Checked}
+		if matchSel.SelectedIndex() == 1 {
+			out.Match = "any"
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(limitEntry.Text)); err == nil && n > 0 {
+			out.Limit = n
+		}
+		for _, r := range rows {
+			out.Rules = append(out.Rules, r.rule())
+		}
+		save(name, newName, out)
+	}, w)
+	dlg.Resize(fyne.NewSize(640, 480))
+	dlg.Show()
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+
+	"opentify/internal/artwork"
+	"opentify/internal/library"
+	"opentify/internal/tags"
+)
+
+// tagField is one editable text field of the tag editor.
+type tagField struct {
+	label string
+	get   func(t tags.Tags) string
+	set   func(t *tags.Tags, v string)
+	entry *widget.Entry
+	dirty bool
+}
+
+func intText(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// pairText formats track/disc numbers as "3/12".
+func pairText(n, total int) string {
+	if n <= 0 {
+		return ""
+	}
+	if total > 0 {
+		return fmt.Sprintf("%d/%d", n, total)
+	}
+	return strconv.Itoa(n)
+}
+
+func parsePairText(s string) (int, int) {
+	a, b, _ := strings.Cut(strings.TrimSpace(s), "/")
+	n, _ := strconv.Atoi(strings.TrimSpace(a))
+	total, _ := strconv.Atoi(strings.TrimSpace(b))
+	return n, total
+}
+
+// titleFromFilename splits "Artist - Title" file names as produced by
+// yt-dlp and most rippers. artist is "" when there is no separator.
+func titleFromFilename(path string) (artist, title string) {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if a, t, ok := strings.Cut(base, " - "); ok {
+		return strings.TrimSpace(a), strings.TrimSpace(t)
+	}
+	return "", strings.TrimSpace(base)
+}
+
+// showTagEditor opens the track properties dialog. paths are the tracks
+// that can be chosen (usually the current view) and selected the ones
+// initially checked. Fields left untouched keep each file's own value, so
+// several tracks can be edited at once. done receives the rewritten files.
+func showTagEditor(w fyne.Window, paths []string, selected []string, done func(changed []string)) {
+	var editable []string
+	for _, p := range paths {
+		if tags.CanWrite(p) {
+			editable = append(editable, p)
+		}
+	}
+	if len(editable) == 0 {
+		dialog.ShowInformation("Etiketler", "Bu görünümde etiketi düzenlenebilen dosya yok (MP3, FLAC, OGG).", w)
+		return
+	}
+	// checked holds the order in which tracks were picked, 1 for the first;
+	// automatic numbering follows it rather than the list order.
+	checked := map[string]int{}
+	picks := 0
+	check := func(p string, b bool) {
+		switch {
+		case !b:
+			delete(checked, p)
+		case checked[p] == 0:
+			picks++
+			checked[p] = picks
+		}
+	}
+	for _, p := range selected {
+		check(p, true)
+	}
+	cache := map[string]tags.Tags{}
+	readTags := func(p string) tags.Tags {
+		t, ok := cache[p]
+		if !ok {
+			t, _ = tags.Read(p)
+			cache[p] = t
+		}
+		return t
+	}
+
+	fields := []*tagField{
+		{label: "Başlık", get: func(t tags.Tags) string { return t.Title }, set: func(t *tags.Tags, v string) { t.Title = v }},
+		{label: "Sanatçı", get: func(t tags.Tags) string { return t.Artist }, set: func(t *tags.Tags, v string) { t.Artist = v }},
+		{label: "Albüm Sanatçısı", get: func(t tags.Tags) string { return t.AlbumArtist }, set: func(t *tags.Tags, v string) { t.AlbumArtist = v }},
+		{label: "Albüm", get: func(t tags.Tags) string { return t.Album }, set: func(t *tags.Tags, v string) { t.Album = v }},
+		{label: "Tür", get: func(t tags.Tags) string { return t.Genre }, set: func(t *tags.Tags, v string) { t.Genre = v }},
+		{label: "Yıl", get: func(t tags.Tags) string { return intText(t.Year) }, set: func(t *tags.Tags, v string) { t.Year, _ = strconv.Atoi(strings.TrimSpace(v)) }},
+		{label: "Parça", get: func(t tags.Tags) string { return pairText(t.Track, t.TrackTotal) }, set: func(t *tags.Tags, v string) { t.Track, t.TrackTotal = parsePairText(v) }},
+		{label: "Disk", get: func(t tags.Tags) string { return pairText(t.Disc, t.DiscTotal) }, set: func(t *tags.Tags, v string) { t.Disc, t.DiscTotal = parsePairText(v) }},
+	}
+	loading := false
+	form := widget.NewForm()
+	for _, f := range fields {
+		f.entry = widget.NewEntry()
+		f.entry.OnChanged = func(string) {
+			if !loading {
+				f.dirty = true
+			}
+		}
+		form.Append(f.label, f.entry)
+	}
+	autoNumber := widget.NewCheck("Parçaları seçim sırasıyla numarala", nil)
+	fromName := widget.NewCheck("Boş başlık/sanatçıyı dosya adından al (Sanatçı - Başlık)", nil)
+
+	// Artwork: nil cover means "unchanged", empty Data means "remove".
+	var cover *tags.Picture
+	coverImg := canvas.NewImageFromResource(theme.MediaMusicIcon())
+	coverImg.FillMode = canvas.ImageFillContain
+	coverImg.SetMinSize(fyne.NewSize(120, 120))
+	showCover := func(data []byte) {
+		if img, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			coverImg.Image, coverImg.Resource = img, nil
+		} else {
+			coverImg.Image, coverImg.Resource = nil, theme.MediaMusicIcon()
+		}
+		coverImg.Refresh()
+	}
+	chooseCover := widget.NewButtonWithIcon("Kapak seç...", theme.FileImageIcon(), func() {
+		fd := dialog.NewFileOpen(func(r fyne.URIReadCloser, err error) {
+			if err != nil || r == nil {
+				return
+			}
+			defer r.Close()
+			data, err := io.ReadAll(r)
+			if err != nil {
+				dialog.ShowError(err, w)
+				return
+			}
+			cover = &tags.Picture{MIME: http.DetectContentType(data), Type: 3, Data: data}
+			showCover(data)
+		}, w)
+		fd.SetFilter(storage.NewExtensionFileFilter([]string{".jpg", ".jpeg", ".png"}))
+		fd.Show()
+	})
+	removeCover := widget.NewButtonWithIcon("Kapağı kaldır", theme.DeleteIcon(), func() {
+		cover = &tags.Picture{}
+		showCover(nil)
+	})
+
+	var chosen func() []string
+	info := widget.NewLabel("")
+	// reload fills the form with the values shared by the checked tracks.
+	reload := func() {
+		sel := chosen()
+		info.SetText(fmt.Sprintf("%d parça seçili", len(sel)))
+		loading = true
+		for _, f := range fields {
+			if f.dirty {
+				continue // keep what the user typed
+			}
+			val, mixed := "", false
+			for i, p := range sel {
+				v := f.get(readTags(p))
+				if i == 0 {
+					val = v
+				} else if v != val {
+					mixed = true
+				}
+			}
+			if mixed {
+				f.entry.SetText("")
+				f.entry.SetPlaceHolder("(farklı değerler)")
+			} else {
+				f.entry.SetText(val)
+				f.entry.SetPlaceHolder("")
+			}
+		}
+		loading = false
+		if cover == nil {
+			var data []byte
+			if len(sel) > 0 {
+				if pic, err := tags.ReadPicture(sel[0]); err == nil {
+					data = pic.Data
+				}
+			}
+			showCover(data)
+		}
+	}
+	chosen = func() []string {
+		var out []string
+		for _, p := range editable {
+			if checked[p] > 0 {
+				out = append(out, p)
+			}
+		}
+		return out
+	}
+
+	trackList := widget.NewList(
+		func() int { return len(editable) },
+		func() fyne.CanvasObject { return widget.NewCheck("", nil) },
+		func(id widget.ListItemID, o fyne.CanvasObject) {
+			c := o.(*widget.Check)
+			p := editable[id]
+			c.OnChanged = nil
+			c.Text = filepath.Base(p)
+			c.SetChecked(checked[p] > 0)
+			c.Refresh()
+			c.OnChanged = func(b bool) {
+				check(p, b)
+				reload()
+			}
+		},
+	)
+	setAll := func(b bool) {
+		for _, p := range editable {
+			check(p, b)
+		}
+		trackList.Refresh()
+		reload()
+	}
+	left := container.NewBorder(
+		container.NewHBox(widget.NewButton("Tümü", func() { setAll(true) }), widget.NewButton("Hiçbiri", func() { setAll(false) }), info),
+		nil, nil, nil, trackList)
+	right := container.NewVBox(
+		form,
+		autoNumber,
+		fromName,
+		widget.NewSeparator(),
+		container.NewBorder(nil, nil, coverImg, nil, container.NewVBox(chooseCover, removeCover)),
+	)
+	split := container.NewHSplit(left, container.NewVScroll(right))
+	split.Offset = 0.4
+	reload()
+
+	save := func() {
+		sel := chosen()
+		if len(sel) == 0 {
+			return
+		}
+		// Build the new tags up front; the files are written off the UI thread.
+		type job struct {
+			path string
+			t    tags.Tags
+		}
+		if autoNumber.Checked {
+			slices.SortStableFunc(sel, func(a, b string) int { return checked[a] - checked[b] })
+		}
+		jobs := make([]job, len(sel))
+		for i, p := range sel {
+			t := readTags(p)
+			for _, f := range fields {
+				if f.dirty {
+					f.set(&t, strings.TrimSpace(f.entry.Text))
+				}
+			}
+			if autoNumber.Checked {
+				t.Track, t.TrackTotal = i+1, len(sel)
+			}
+			if fromName.Checked {
+				artist, title := titleFromFilename(p)
+				if strings.TrimSpace(t.Title) == "" {
+					t.Title = title
+				}
+				if strings.TrimSpace(t.Artist) == "" {
+					t.Artist = artist
+				}
+			}
+			jobs[i] = job{p, t}
+		}
+		pic := cover
+
+		bar := widget.NewProgressBar()
+		prog := dialog.NewCustomWithoutButtons("Etiketler yazılıyor", bar, w)
+		prog.Show()
+		go func() {
+			var changed []string
+			var failed []string
+			for i, j := range jobs {
+				if err := tags.Write(j.path, j.t, pic); err != nil {
+					failed = append(failed, filepath.Base(j.path)+": "+err.Error())
+				} else {
+					changed = append(changed, j.path)
+				}
+				v := float64(i+1) / float64(len(jobs))
+				fyne.Do(func() { bar.SetValue(v) })
+			}
+			fyne.Do(func() {
+				prog.Hide()
+				if len(failed) > 0 {
+					dialog.ShowError(fmt.Errorf("%d dosya yazılamadı:\n%s", len(failed), strings.Join(failed, "\n")), w)
+				}
+				done(changed)
+			})
+		}()
+	}
+
+	d := dialog.NewCustomConfirm("Parça Özellikleri", "Kaydet", "İptal", split, func(ok bool) {
+		if ok {
+			save()
+		}
+	}, w)
+	d.Resize(fyne.NewSize(860, 560))
+	d.Show()
+}
+
+// refreshEdited updates the index after tag edits and drops cached
+// artwork of the albums involved.
+func refreshEdited(lib *library.Index, art *artwork.Cache, changed []string) error {
+	if len(changed) == 0 {
+		return nil
+	}
+	is := map[string]bool{}
+	for _, p := range changed {
+		is[p] = true
+	}
+	// Forget the albums the files belonged to before and after the edit.
+	forget := func() {
+		for _, a := range lib.Albums() {
+			for _, t := range a.Tracks {
+				if is[t.Path] {
+					art.Forget(a.Key())
+					break
+				}
+			}
+		}
+	}
+	forget()
+	err := lib.Refresh(changed...)
+	forget()
+	return err
+}